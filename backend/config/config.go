@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/joho/godotenv"
 )
@@ -11,6 +13,14 @@ type Config struct {
 	MongoURI  string
 	JWTSecret string
 	DBName    string
+
+	// Периодичность фоновой проверки сроков документов (0 — отключена)
+	ComplianceCheckInterval time.Duration
+
+	// Хранилище документов: local (каталог DocumentStoragePath) или gridfs
+	DocumentStorage     string
+	DocumentStoragePath string
+	DocumentMaxSize     int64
 }
 
 func LoadConfig() *Config {
@@ -21,6 +31,12 @@ func LoadConfig() *Config {
 		MongoURI:  getEnv("MONGODB_URI", "mongodb://localhost:27017"),
 		JWTSecret: getEnv("JWT_SECRET", "your-super-secret-jwt-key-change-this-in-production"),
 		DBName:    getEnv("DB_NAME", "business_schedule"),
+
+		ComplianceCheckInterval: getDurationEnv("COMPLIANCE_CHECK_INTERVAL", 24*time.Hour),
+
+		DocumentStorage:     getEnv("DOCUMENT_STORAGE", "local"),
+		DocumentStoragePath: getEnv("DOCUMENT_STORAGE_PATH", "./uploads"),
+		DocumentMaxSize:     getIntEnv("DOCUMENT_MAX_SIZE_MB", 10) << 20,
 	}
 }
 
@@ -30,3 +46,21 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	if value := os.Getenv(key); value != "" {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return fallback
+}
+
+func getIntEnv(key string, fallback int64) int64 {
+	if value := os.Getenv(key); value != "" {
+		if number, err := strconv.ParseInt(value, 10, 64); err == nil && number > 0 {
+			return number
+		}
+	}
+	return fallback
+}
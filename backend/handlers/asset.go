@@ -0,0 +1,495 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/storage"
+	"business-schedule-backend/utils"
+	"context"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AssetHandler struct {
+	db    *database.Database
+	store storage.Storage
+}
+
+func NewAssetHandler(db *database.Database, store storage.Storage) *AssetHandler {
+	return &AssetHandler{db: db, store: store}
+}
+
+type ImprovementValue struct {
+	ImprovementID   string                   `json:"improvement_id"`
+	Category        string                   `json:"category"`
+	Description     string                   `json:"description"`
+	InServiceDate   string                   `json:"in_service_date"`
+	Cost            float64                  `json:"cost"`
+	UsefulLifeYears int                      `json:"useful_life_years"`
+	Method          string                   `json:"method"`
+	Accumulated     float64                  `json:"accumulated"`
+	CurrentValue    float64                  `json:"current_value"`
+	Schedule        []utils.DepreciationYear `json:"schedule"`
+}
+
+// VehicleAssetValue — стоимость транспорта в реестре основных средств: базовый актив и улучшения
+type VehicleAssetValue struct {
+	BaseCost                float64            `json:"base_cost"`
+	BaseAccumulated         float64            `json:"base_accumulated"`
+	BaseValue               float64            `json:"base_value"`
+	ImprovementsCost        float64            `json:"improvements_cost"`
+	ImprovementsAccumulated float64            `json:"improvements_accumulated"`
+	ImprovementsValue       float64            `json:"improvements_value"`
+	TotalCost               float64            `json:"total_cost"`
+	Accumulated             float64            `json:"accumulated"`
+	CurrentValue            float64            `json:"current_value"`
+	Improvements            []ImprovementValue `json:"improvements,omitempty"`
+}
+
+type AssetRegisterItem struct {
+	VehicleID    string `json:"vehicle_id"`
+	VehicleName  string `json:"vehicle_name"`
+	CompanyID    string `json:"company_id"`
+	Type         string `json:"type"`
+	VIN          string `json:"vin"`
+	PurchaseDate string `json:"purchase_date"`
+	Status       string `json:"status"`
+	DisposalDate string `json:"disposal_date,omitempty"`
+	VehicleAssetValue
+}
+
+// improvementDepreciationParams собирает параметры амортизации улучшения.
+// Без своего метода используется метод компании; units_of_production для улучшений заменяется прямолинейным.
+func improvementDepreciationParams(improvement *models.CapitalImprovement, defaults models.DepreciationSettings) utils.DepreciationParams {
+	method := improvement.DepreciationMethod
+	if method == "" {
+		method = defaults.Method
+	}
+	if method == "" || method == utils.DepreciationUnitsOfProduction {
+		method = utils.DepreciationStraightLine
+	}
+
+	return utils.DepreciationParams{
+		Method:          method,
+		Cost:            improvement.Cost,
+		SalvageValue:    improvement.SalvageValue,
+		UsefulLifeYears: improvement.UsefulLifeYears,
+	}
+}
+
+// vehicleAssetValueAt рассчитывает стоимость транспорта и его улучшений на дату.
+// После выбытия транспорта амортизация улучшений тоже останавливается.
+func vehicleAssetValueAt(vehicle *models.Vehicle, defaults models.DepreciationSettings, improvements []models.CapitalImprovement, points []utils.MeterPoint, asOf time.Time) VehicleAssetValue {
+	if vehicle.Disposal != nil && vehicle.Disposal.DisposalDate.Before(asOf) {
+		asOf = vehicle.Disposal.DisposalDate
+	}
+
+	base := vehicleDepreciationAt(vehicle, defaults, points, asOf)
+	value := VehicleAssetValue{
+		BaseCost:        vehicle.PurchasePrice,
+		BaseAccumulated: base.Accumulated,
+		BaseValue:       base.CurrentValue,
+		Improvements:    []ImprovementValue{},
+	}
+
+	for i := range improvements {
+		params := improvementDepreciationParams(&improvements[i], defaults)
+		depreciation := utils.CalculateDepreciation(params, utils.CalculateVehicleAgeAt(improvements[i].InServiceDate, asOf))
+
+		value.ImprovementsCost += improvements[i].Cost
+		value.ImprovementsAccumulated += depreciation.Accumulated
+		value.ImprovementsValue += depreciation.CurrentValue
+		value.Improvements = append(value.Improvements, ImprovementValue{
+			ImprovementID:   improvements[i].ID.Hex(),
+			Category:        improvements[i].Category,
+			Description:     improvements[i].Description,
+			InServiceDate:   improvements[i].InServiceDate.Format("2006-01-02"),
+			Cost:            improvements[i].Cost,
+			UsefulLifeYears: params.UsefulLifeYears,
+			Method:          params.Method,
+			Accumulated:     depreciation.Accumulated,
+			CurrentValue:    depreciation.CurrentValue,
+			Schedule:        depreciation.Schedule,
+		})
+	}
+
+	value.ImprovementsCost = math.Round(value.ImprovementsCost*100) / 100
+	value.ImprovementsAccumulated = math.Round(value.ImprovementsAccumulated*100) / 100
+	value.ImprovementsValue = math.Round(value.ImprovementsValue*100) / 100
+	value.TotalCost = math.Round((value.BaseCost+value.ImprovementsCost)*100) / 100
+	value.Accumulated = math.Round((value.BaseAccumulated+value.ImprovementsAccumulated)*100) / 100
+	value.CurrentValue = math.Round((value.BaseValue+value.ImprovementsValue)*100) / 100
+	return value
+}
+
+// loadVehicleImprovements возвращает капитализированные улучшения транспорта компаний, сгруппированные по транспорту
+func loadVehicleImprovements(db *database.Database, companyIDs []primitive.ObjectID) (map[primitive.ObjectID][]models.CapitalImprovement, error) {
+	improvements := map[primitive.ObjectID][]models.CapitalImprovement{}
+	if len(companyIDs) == 0 {
+		return improvements, nil
+	}
+
+	cursor, err := db.DB.Collection("capital_improvements").Find(context.TODO(),
+		bson.M{"company_id": bson.M{"$in": companyIDs}},
+		options.Find().SetSort(bson.M{"in_service_date": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var list []models.CapitalImprovement
+	if err = cursor.All(context.TODO(), &list); err != nil {
+		return nil, err
+	}
+
+	for _, improvement := range list {
+		improvements[improvement.VehicleID] = append(improvements[improvement.VehicleID], improvement)
+	}
+	return improvements, nil
+}
+
+// validateImprovement проверяет улучшение и подставляет дату ввода по умолчанию
+func validateImprovement(improvement *models.CapitalImprovement) string {
+	switch improvement.Category {
+	case "engine_overhaul", "apu", "reefer_unit", "transmission", "other":
+	default:
+		return "Неверная категория улучшения"
+	}
+	if improvement.Cost <= 0 {
+		return "Стоимость улучшения должна быть больше нуля"
+	}
+	if improvement.UsefulLifeYears < 1 {
+		return "Неверный срок службы"
+	}
+	if improvement.SalvageValue < 0 || improvement.SalvageValue > improvement.Cost {
+		return "Ликвидационная стоимость должна быть от 0 до стоимости улучшения"
+	}
+	if improvement.DepreciationMethod != "" && (!utils.IsValidDepreciationMethod(improvement.DepreciationMethod) ||
+		improvement.DepreciationMethod == utils.DepreciationUnitsOfProduction) {
+		return "Неверный метод амортизации"
+	}
+	if improvement.InServiceDate.IsZero() {
+		improvement.InServiceDate = time.Now()
+	}
+	return ""
+}
+
+// validateImprovementDates проверяет дату ввода улучшения относительно срока владения транспортом
+func validateImprovementDates(improvement *models.CapitalImprovement, vehicle *models.Vehicle) string {
+	if improvement.InServiceDate.After(time.Now()) {
+		return "Дата ввода улучшения не может быть в будущем"
+	}
+	if !vehicle.PurchaseDate.IsZero() && improvement.InServiceDate.Before(vehicle.PurchaseDate) {
+		return "Дата ввода улучшения раньше даты покупки транспорта"
+	}
+	return ""
+}
+
+// findUserVehicle возвращает транспорт, если он принадлежит компании пользователя
+func findUserVehicle(db *database.Database, userObjectID, vehicleID primitive.ObjectID) (*models.Vehicle, error) {
+	companyIDs, err := getUserCompanyIDs(db, userObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	var vehicle models.Vehicle
+	err = db.DB.Collection("vehicles").FindOne(context.TODO(), bson.M{
+		"_id":        vehicleID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&vehicle)
+	if err != nil {
+		return nil, err
+	}
+	return &vehicle, nil
+}
+
+// GetRegister возвращает реестр основных средств: базовая стоимость транспорта, улучшения и итоговая стоимость
+func (h *AssetHandler) GetRegister(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companies, err := getUserCompanies(h.db, userObjectID, c.Query("company_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+	}
+
+	var companyIDs []primitive.ObjectID
+	for _, company := range companies {
+		companyIDs = append(companyIDs, company.ID)
+	}
+
+	vehicles, err := loadTaxVehicles(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения транспорта"})
+	}
+
+	improvements, err := loadVehicleImprovements(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения улучшений"})
+	}
+	meters, err := loadVehicleMeterPoints(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+	}
+
+	depreciationDefaults := companyDepreciationDefaults(companies)
+	now := time.Now()
+
+	items := []AssetRegisterItem{}
+	var totals VehicleAssetValue
+	for i := range vehicles {
+		value := vehicleAssetValueAt(&vehicles[i], depreciationDefaults[vehicles[i].CompanyID], improvements[vehicles[i].ID], meters[vehicles[i].ID], now)
+		item := AssetRegisterItem{
+			VehicleID:         vehicles[i].ID.Hex(),
+			VehicleName:       vehicleTitle(&vehicles[i]),
+			CompanyID:         vehicles[i].CompanyID.Hex(),
+			Type:              vehicles[i].Type,
+			VIN:               vehicles[i].VIN,
+			PurchaseDate:      vehicles[i].PurchaseDate.Format("2006-01-02"),
+			Status:            vehicles[i].Status,
+			VehicleAssetValue: value,
+		}
+		if vehicles[i].Disposal != nil {
+			item.DisposalDate = vehicles[i].Disposal.DisposalDate.Format("2006-01-02")
+		} else {
+			totals.BaseCost += value.BaseCost
+			totals.BaseAccumulated += value.BaseAccumulated
+			totals.BaseValue += value.BaseValue
+			totals.ImprovementsCost += value.ImprovementsCost
+			totals.ImprovementsAccumulated += value.ImprovementsAccumulated
+			totals.ImprovementsValue += value.ImprovementsValue
+			totals.TotalCost += value.TotalCost
+			totals.Accumulated += value.Accumulated
+			totals.CurrentValue += value.CurrentValue
+		}
+		items = append(items, item)
+	}
+
+	totals.BaseCost = roundMoney(totals.BaseCost)
+	totals.BaseAccumulated = roundMoney(totals.BaseAccumulated)
+	totals.BaseValue = roundMoney(totals.BaseValue)
+	totals.ImprovementsCost = roundMoney(totals.ImprovementsCost)
+	totals.ImprovementsAccumulated = roundMoney(totals.ImprovementsAccumulated)
+	totals.ImprovementsValue = roundMoney(totals.ImprovementsValue)
+	totals.TotalCost = roundMoney(totals.TotalCost)
+	totals.Accumulated = roundMoney(totals.Accumulated)
+	totals.CurrentValue = roundMoney(totals.CurrentValue)
+
+	return c.JSON(fiber.Map{"assets": items, "totals": totals})
+}
+
+func (h *AssetHandler) GetImprovements(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	if vehicleID := c.Query("vehicle_id"); vehicleID != "" {
+		vehicleObjectID, err := primitive.ObjectIDFromHex(vehicleID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+		}
+		filter["vehicle_id"] = vehicleObjectID
+	}
+
+	cursor, err := h.db.DB.Collection("capital_improvements").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"in_service_date": 1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения улучшений"})
+	}
+	defer cursor.Close(context.TODO())
+
+	improvements := []models.CapitalImprovement{}
+	if err = cursor.All(context.TODO(), &improvements); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	return c.JSON(improvements)
+}
+
+func (h *AssetHandler) CreateImprovement(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var improvement models.CapitalImprovement
+	if err := c.BodyParser(&improvement); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := validateImprovement(&improvement); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	vehicle, err := findUserVehicle(h.db, userObjectID, improvement.VehicleID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+	if vehicle.Disposal != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Транспорт выбыл, улучшения не капитализируются"})
+	}
+	if msg := validateImprovementDates(&improvement, vehicle); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	improvement.CompanyID = vehicle.CompanyID
+	improvement.CreatedAt = time.Now()
+	improvement.UpdatedAt = time.Now()
+
+	result, err := h.db.DB.Collection("capital_improvements").InsertOne(context.TODO(), improvement)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания улучшения"})
+	}
+
+	improvement.ID = result.InsertedID.(primitive.ObjectID)
+	return c.Status(201).JSON(improvement)
+}
+
+func (h *AssetHandler) UpdateImprovement(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	improvementID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID улучшения"})
+	}
+
+	var improvement models.CapitalImprovement
+	if err := c.BodyParser(&improvement); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := validateImprovement(&improvement); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	vehicle, err := findUserVehicle(h.db, userObjectID, improvement.VehicleID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+	if vehicle.Disposal != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Транспорт выбыл, улучшения не изменяются"})
+	}
+	if msg := validateImprovementDates(&improvement, vehicle); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	improvement.ID = primitive.NilObjectID
+	improvement.CompanyID = vehicle.CompanyID
+	improvement.UpdatedAt = time.Now()
+
+	filter := bson.M{"_id": improvementID, "vehicle_id": vehicle.ID}
+	update := bson.M{"$set": bson.M{
+		"category":            improvement.Category,
+		"description":         improvement.Description,
+		"cost":                improvement.Cost,
+		"in_service_date":     improvement.InServiceDate,
+		"useful_life_years":   improvement.UsefulLifeYears,
+		"salvage_value":       improvement.SalvageValue,
+		"depreciation_method": improvement.DepreciationMethod,
+		"vendor":              improvement.Vendor,
+		"updated_at":          improvement.UpdatedAt,
+	}}
+
+	result, err := h.db.DB.Collection("capital_improvements").UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления улучшения"})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Улучшение не найдено"})
+	}
+
+	improvement.ID = improvementID
+	return c.JSON(improvement)
+}
+
+func (h *AssetHandler) DeleteImprovement(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	improvementID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID улучшения"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"_id": improvementID, "company_id": bson.M{"$in": companyIDs}}
+	var improvement models.CapitalImprovement
+	if err := h.db.DB.Collection("capital_improvements").FindOne(context.TODO(), filter).Decode(&improvement); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Улучшение не найдено"})
+	}
+
+	// Улучшения выбывшего транспорта вошли в результат выбытия и не удаляются
+	vehicle, err := findUserVehicle(h.db, userObjectID, improvement.VehicleID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+	if vehicle.Disposal != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Транспорт выбыл, улучшения не удаляются"})
+	}
+
+	result, err := h.db.DB.Collection("capital_improvements").DeleteOne(context.TODO(), filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления улучшения"})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Улучшение не найдено"})
+	}
+
+	// Удаляем документы улучшения вместе с файлами в хранилище
+	_, err = deleteStoredDocuments(h.db, h.store, bson.M{"entity_type": utils.DocumentEntityCapitalImprovement, "entity_id": improvementID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления документов"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Улучшение удалено"})
+}
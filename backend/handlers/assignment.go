@@ -0,0 +1,638 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type AssignmentHandler struct {
+	db *database.Database
+}
+
+func NewAssignmentHandler(db *database.Database) *AssignmentHandler {
+	return &AssignmentHandler{db: db}
+}
+
+type RosterVehicle struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type RosterResponse struct {
+	Date               time.Time           `json:"date"`
+	Assignments        []models.Assignment `json:"assignments"`
+	UnassignedTrucks   []RosterVehicle     `json:"unassigned_trucks"`
+	UnassignedTrailers []RosterVehicle     `json:"unassigned_trailers"`
+	UnassignedDrivers  []RosterVehicle     `json:"unassigned_drivers"`
+}
+
+type EndAssignmentRequest struct {
+	EndDate time.Time `json:"end_date"`
+}
+
+// activeAssignmentFilter отбирает закрепления, действовавшие в какой-либо момент периода [from, to)
+func activeAssignmentFilter(from, to time.Time) bson.M {
+	return bson.M{
+		"start_date": bson.M{"$lt": to},
+		"$or": bson.A{
+			bson.M{"end_date": bson.M{"$exists": false}},
+			bson.M{"end_date": nil},
+			bson.M{"end_date": bson.M{"$gt": from}},
+		},
+	}
+}
+
+// assignmentPeriod возвращает период поиска: весь день при указанной дате (YYYY-MM-DD), иначе текущий момент
+func assignmentPeriod(date string) (time.Time, time.Time, error) {
+	if date == "" {
+		now := time.Now()
+		return now, now.Add(time.Second), nil
+	}
+
+	day, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return day, day.AddDate(0, 0, 1), nil
+}
+
+// validateAssignment проверяет период и участников закрепления: тягач, прицеп и водитель
+// должны относиться к одной компании пользователя
+func validateAssignment(db *database.Database, userObjectID primitive.ObjectID, assignment *models.Assignment) (int, string) {
+	if assignment.StartDate.IsZero() {
+		return 400, "Не указана дата начала"
+	}
+	if assignment.EndDate != nil && !assignment.EndDate.After(assignment.StartDate) {
+		return 400, "Дата окончания должна быть позже даты начала"
+	}
+	if assignment.DriverID == nil && assignment.TrailerID == nil {
+		return 400, "Укажите водителя или прицеп"
+	}
+
+	truck, err := findUserVehicle(db, userObjectID, assignment.TruckID)
+	if err != nil {
+		return 404, "Тягач не найден"
+	}
+	if truck.Type != "truck" {
+		return 400, "Закрепление оформляется на тягач"
+	}
+	assignment.CompanyID = truck.CompanyID
+
+	if assignment.TrailerID != nil {
+		trailer, err := findUserVehicle(db, userObjectID, *assignment.TrailerID)
+		if err != nil || trailer.CompanyID != truck.CompanyID {
+			return 404, "Прицеп не найден"
+		}
+		if trailer.Type != "trailer" {
+			return 400, "Указанный транспорт не является прицепом"
+		}
+	}
+
+	if assignment.DriverID != nil {
+		var driver models.Driver
+		err := db.DB.Collection("drivers").FindOne(context.TODO(), bson.M{
+			"_id":        *assignment.DriverID,
+			"company_id": truck.CompanyID,
+		}).Decode(&driver)
+		if err != nil {
+			return 404, "Водитель не найден"
+		}
+		if assignment.StartDate.Before(driver.HireDate) {
+			return 400, "Закрепление начинается раньше даты приема водителя"
+		}
+		if driver.TerminationDate != nil && !assignment.StartDate.Before(*driver.TerminationDate) {
+			return 400, "Водитель уволен на дату закрепления"
+		}
+		// Закрепление уволенного водителя заканчивается не позже даты увольнения
+		if driver.TerminationDate != nil {
+			if assignment.EndDate == nil {
+				end := *driver.TerminationDate
+				assignment.EndDate = &end
+			} else if assignment.EndDate.After(*driver.TerminationDate) {
+				return 400, "Закрепление заканчивается позже даты увольнения водителя"
+			}
+		}
+	}
+
+	return 0, ""
+}
+
+// closeDriverAssignments закрывает закрепления водителя датой увольнения.
+// Закрепления, начинающиеся с даты увольнения или позже, не закрываются и возвращаются в счетчике.
+func closeDriverAssignments(db *database.Database, driverID primitive.ObjectID, terminationDate time.Time) (int64, error) {
+	collection := db.DB.Collection("assignments")
+	later, err := collection.CountDocuments(context.TODO(), bson.M{
+		"driver_id":  driverID,
+		"start_date": bson.M{"$gte": terminationDate},
+	})
+	if err != nil || later > 0 {
+		return later, err
+	}
+
+	_, err = collection.UpdateMany(context.TODO(), bson.M{
+		"driver_id": driverID,
+		"$or": bson.A{
+			bson.M{"end_date": bson.M{"$exists": false}},
+			bson.M{"end_date": nil},
+			bson.M{"end_date": bson.M{"$gt": terminationDate}},
+		},
+	}, bson.M{"$set": bson.M{
+		"end_date":   terminationDate,
+		"updated_at": time.Now(),
+	}})
+	return 0, err
+}
+
+// findAssignmentConflict ищет закрепление, пересекающееся по периоду с тем же тягачом, прицепом или водителем
+func findAssignmentConflict(db *database.Database, assignment *models.Assignment, excludeID primitive.ObjectID) (string, error) {
+	participants := bson.A{
+		bson.M{"truck_id": assignment.TruckID},
+	}
+	if assignment.TrailerID != nil {
+		participants = append(participants, bson.M{"trailer_id": *assignment.TrailerID})
+	}
+	if assignment.DriverID != nil {
+		participants = append(participants, bson.M{"driver_id": *assignment.DriverID})
+	}
+
+	cursor, err := db.DB.Collection("assignments").Find(context.TODO(), bson.M{
+		"_id":        bson.M{"$ne": excludeID},
+		"company_id": assignment.CompanyID,
+		"$or":        participants,
+	})
+	if err != nil {
+		return "", err
+	}
+	defer cursor.Close(context.TODO())
+
+	var existing []models.Assignment
+	if err = cursor.All(context.TODO(), &existing); err != nil {
+		return "", err
+	}
+
+	for _, other := range existing {
+		if !utils.PeriodsOverlap(assignment.StartDate, assignment.EndDate, other.StartDate, other.EndDate) {
+			continue
+		}
+		switch {
+		case other.TruckID == assignment.TruckID:
+			return "Тягач уже закреплен на этот период", nil
+		case assignment.TrailerID != nil && other.TrailerID != nil && *other.TrailerID == *assignment.TrailerID:
+			return "Прицеп уже закреплен на этот период", nil
+		case assignment.DriverID != nil && other.DriverID != nil && *other.DriverID == *assignment.DriverID:
+			return "Водитель уже закреплен на этот период", nil
+		}
+	}
+
+	return "", nil
+}
+
+// fillAssignmentNames заполняет названия тягачей, прицепов и имена водителей
+func fillAssignmentNames(db *database.Database, assignments []models.Assignment) error {
+	if len(assignments) == 0 {
+		return nil
+	}
+
+	var vehicleIDs, driverIDs []primitive.ObjectID
+	for _, assignment := range assignments {
+		vehicleIDs = append(vehicleIDs, assignment.TruckID)
+		if assignment.TrailerID != nil {
+			vehicleIDs = append(vehicleIDs, *assignment.TrailerID)
+		}
+		if assignment.DriverID != nil {
+			driverIDs = append(driverIDs, *assignment.DriverID)
+		}
+	}
+
+	vehicleNames := map[primitive.ObjectID]string{}
+	vehiclesCursor, err := db.DB.Collection("vehicles").Find(context.TODO(), bson.M{"_id": bson.M{"$in": vehicleIDs}})
+	if err != nil {
+		return err
+	}
+	defer vehiclesCursor.Close(context.TODO())
+
+	var vehicles []models.Vehicle
+	if err = vehiclesCursor.All(context.TODO(), &vehicles); err != nil {
+		return err
+	}
+	for i := range vehicles {
+		vehicleNames[vehicles[i].ID] = vehicleTitle(&vehicles[i])
+	}
+
+	driverNames := map[primitive.ObjectID]string{}
+	if len(driverIDs) > 0 {
+		driversCursor, err := db.DB.Collection("drivers").Find(context.TODO(), bson.M{"_id": bson.M{"$in": driverIDs}})
+		if err != nil {
+			return err
+		}
+		defer driversCursor.Close(context.TODO())
+
+		var drivers []models.Driver
+		if err = driversCursor.All(context.TODO(), &drivers); err != nil {
+			return err
+		}
+		for i := range drivers {
+			driverNames[drivers[i].ID] = driverName(&drivers[i])
+		}
+	}
+
+	for i := range assignments {
+		assignments[i].TruckName = vehicleNames[assignments[i].TruckID]
+		if assignments[i].TrailerID != nil {
+			assignments[i].TrailerName = vehicleNames[*assignments[i].TrailerID]
+		}
+		if assignments[i].DriverID != nil {
+			assignments[i].DriverName = driverNames[*assignments[i].DriverID]
+		}
+	}
+	return nil
+}
+
+// GetAssignments возвращает закрепления. Фильтры: company_id, driver_id, vehicle_id (тягач или прицеп)
+// и date — закрепления, действовавшие в этот день ("кто работал на тягаче X в день Y").
+func (h *AssignmentHandler) GetAssignments(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		filter["company_id"] = bson.M{"$in": filterOwnedIDs(companyIDs, companyObjectID)}
+	}
+	if driverID := c.Query("driver_id"); driverID != "" {
+		driverObjectID, err := primitive.ObjectIDFromHex(driverID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID водителя"})
+		}
+		filter["driver_id"] = driverObjectID
+	}
+
+	conditions := bson.A{filter}
+	if vehicleID := c.Query("vehicle_id"); vehicleID != "" {
+		vehicleObjectID, err := primitive.ObjectIDFromHex(vehicleID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+		}
+		conditions = append(conditions, bson.M{"$or": bson.A{
+			bson.M{"truck_id": vehicleObjectID},
+			bson.M{"trailer_id": vehicleObjectID},
+		}})
+	}
+	if date := c.Query("date"); date != "" {
+		from, to, err := assignmentPeriod(date)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+		}
+		conditions = append(conditions, activeAssignmentFilter(from, to))
+	}
+
+	cursor, err := h.db.DB.Collection("assignments").Find(context.TODO(), bson.M{"$and": conditions},
+		options.Find().SetSort(bson.M{"start_date": -1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения закреплений"})
+	}
+	defer cursor.Close(context.TODO())
+
+	assignments := []models.Assignment{}
+	if err = cursor.All(context.TODO(), &assignments); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	if err := fillAssignmentNames(h.db, assignments); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения названий"})
+	}
+
+	return c.JSON(assignments)
+}
+
+// GetRoster возвращает расстановку на дату (по умолчанию — текущую): действующие закрепления,
+// а также свободные тягачи, прицепы и активных водителей без закрепления
+func (h *AssignmentHandler) GetRoster(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	from, to, err := assignmentPeriod(c.Query("date"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		companyIDs = filterOwnedIDs(companyIDs, companyObjectID)
+	}
+
+	roster := RosterResponse{
+		Date:               from,
+		Assignments:        []models.Assignment{},
+		UnassignedTrucks:   []RosterVehicle{},
+		UnassignedTrailers: []RosterVehicle{},
+		UnassignedDrivers:  []RosterVehicle{},
+	}
+	if len(companyIDs) == 0 {
+		return c.JSON(roster)
+	}
+
+	filter := activeAssignmentFilter(from, to)
+	filter["company_id"] = bson.M{"$in": companyIDs}
+	cursor, err := h.db.DB.Collection("assignments").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"start_date": 1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения закреплений"})
+	}
+	defer cursor.Close(context.TODO())
+
+	if err = cursor.All(context.TODO(), &roster.Assignments); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+	if err := fillAssignmentNames(h.db, roster.Assignments); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения названий"})
+	}
+
+	assigned := map[primitive.ObjectID]bool{}
+	for _, assignment := range roster.Assignments {
+		assigned[assignment.TruckID] = true
+		if assignment.TrailerID != nil {
+			assigned[*assignment.TrailerID] = true
+		}
+		if assignment.DriverID != nil {
+			assigned[*assignment.DriverID] = true
+		}
+	}
+
+	vehiclesCursor, err := h.db.DB.Collection("vehicles").Find(context.TODO(), bson.M{
+		"company_id": bson.M{"$in": companyIDs},
+		"status":     "active",
+		"disposal":   bson.M{"$exists": false},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения транспорта"})
+	}
+	defer vehiclesCursor.Close(context.TODO())
+
+	var vehicles []models.Vehicle
+	if err = vehiclesCursor.All(context.TODO(), &vehicles); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования транспорта"})
+	}
+	for i := range vehicles {
+		if assigned[vehicles[i].ID] {
+			continue
+		}
+		item := RosterVehicle{ID: vehicles[i].ID.Hex(), Name: vehicleTitle(&vehicles[i])}
+		if vehicles[i].Type == "trailer" {
+			roster.UnassignedTrailers = append(roster.UnassignedTrailers, item)
+		} else {
+			roster.UnassignedTrucks = append(roster.UnassignedTrucks, item)
+		}
+	}
+
+	driversCursor, err := h.db.DB.Collection("drivers").Find(context.TODO(), bson.M{
+		"company_id": bson.M{"$in": companyIDs},
+		"status":     utils.DriverActive,
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения водителей"})
+	}
+	defer driversCursor.Close(context.TODO())
+
+	var drivers []models.Driver
+	if err = driversCursor.All(context.TODO(), &drivers); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования водителей"})
+	}
+	for i := range drivers {
+		if !assigned[drivers[i].ID] {
+			roster.UnassignedDrivers = append(roster.UnassignedDrivers, RosterVehicle{ID: drivers[i].ID.Hex(), Name: driverName(&drivers[i])})
+		}
+	}
+
+	return c.JSON(roster)
+}
+
+func (h *AssignmentHandler) CreateAssignment(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var assignment models.Assignment
+	if err := c.BodyParser(&assignment); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if status, msg := validateAssignment(h.db, userObjectID, &assignment); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	conflict, err := findAssignmentConflict(h.db, &assignment, primitive.NilObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка проверки закреплений"})
+	}
+	if conflict != "" {
+		return c.Status(409).JSON(fiber.Map{"error": conflict})
+	}
+
+	assignment.CreatedAt = time.Now()
+	assignment.UpdatedAt = time.Now()
+
+	result, err := h.db.DB.Collection("assignments").InsertOne(context.TODO(), assignment)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания закрепления"})
+	}
+
+	assignment.ID = result.InsertedID.(primitive.ObjectID)
+	return c.Status(201).JSON(assignment)
+}
+
+func (h *AssignmentHandler) UpdateAssignment(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	assignmentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID закрепления"})
+	}
+
+	var assignment models.Assignment
+	if err := c.BodyParser(&assignment); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if status, msg := validateAssignment(h.db, userObjectID, &assignment); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	var existing models.Assignment
+	err = h.db.DB.Collection("assignments").FindOne(context.TODO(), bson.M{
+		"_id":        assignmentID,
+		"company_id": assignment.CompanyID,
+	}).Decode(&existing)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Закрепление не найдено"})
+	}
+
+	conflict, err := findAssignmentConflict(h.db, &assignment, assignmentID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка проверки закреплений"})
+	}
+	if conflict != "" {
+		return c.Status(409).JSON(fiber.Map{"error": conflict})
+	}
+
+	assignment.ID = primitive.NilObjectID
+	assignment.CreatedAt = existing.CreatedAt
+	assignment.UpdatedAt = time.Now()
+
+	_, err = h.db.DB.Collection("assignments").ReplaceOne(context.TODO(), bson.M{"_id": assignmentID}, assignment)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления закрепления"})
+	}
+
+	assignment.ID = assignmentID
+	return c.JSON(assignment)
+}
+
+// EndAssignment закрывает действующее закрепление датой end_date (по умолчанию — текущим моментом)
+func (h *AssignmentHandler) EndAssignment(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	assignmentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID закрепления"})
+	}
+
+	var request EndAssignmentRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+		}
+	}
+	if request.EndDate.IsZero() {
+		request.EndDate = time.Now()
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	var assignment models.Assignment
+	err = h.db.DB.Collection("assignments").FindOne(context.TODO(), bson.M{
+		"_id":        assignmentID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&assignment)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Закрепление не найдено"})
+	}
+
+	if assignment.EndDate != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Закрепление уже завершено"})
+	}
+	if !request.EndDate.After(assignment.StartDate) {
+		return c.Status(400).JSON(fiber.Map{"error": "Дата окончания должна быть позже даты начала"})
+	}
+
+	assignment.EndDate = &request.EndDate
+	assignment.UpdatedAt = time.Now()
+
+	_, err = h.db.DB.Collection("assignments").UpdateOne(context.TODO(), bson.M{"_id": assignmentID}, bson.M{"$set": bson.M{
+		"end_date":   assignment.EndDate,
+		"updated_at": assignment.UpdatedAt,
+	}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка завершения закрепления"})
+	}
+
+	return c.JSON(assignment)
+}
+
+func (h *AssignmentHandler) DeleteAssignment(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	assignmentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID закрепления"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	result, err := h.db.DB.Collection("assignments").DeleteOne(context.TODO(), bson.M{
+		"_id":        assignmentID,
+		"company_id": bson.M{"$in": companyIDs},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления закрепления"})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Закрепление не найдено"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Закрепление удалено"})
+}
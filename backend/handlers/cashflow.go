@@ -0,0 +1,370 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CashFlowHandler struct {
+	db *database.Database
+}
+
+func NewCashFlowHandler(db *database.Database) *CashFlowHandler {
+	return &CashFlowHandler{db: db}
+}
+
+type CashFlowMonth struct {
+	Month         string  `json:"month"`
+	Income        float64 `json:"income"`
+	Expenses      float64 `json:"expenses"`
+	LoanPayments  float64 `json:"loan_payments"`
+	LeasePayments float64 `json:"lease_payments"`
+	DebtService   float64 `json:"debt_service"`
+	NetCashFlow   float64 `json:"net_cash_flow"`
+	EndingCash    float64 `json:"ending_cash"`
+	Negative      bool    `json:"negative"`
+}
+
+type CashFlowForecast struct {
+	OpeningCash    float64         `json:"opening_cash"`
+	Months         []CashFlowMonth `json:"months"`
+	NegativeMonths []string        `json:"negative_months"`
+	TotalDebt      float64         `json:"total_debt_service"`
+}
+
+// projectDebtService рассчитывает помесячные платежи по кредитам и лизингам компаний на months месяцев вперед
+func projectDebtService(db *database.Database, companyIDs []primitive.ObjectID, fromMonth time.Time, months int) ([]float64, []float64, error) {
+	loanPayments := make([]float64, months)
+	leasePayments := make([]float64, months)
+	if len(companyIDs) == 0 {
+		return loanPayments, leasePayments, nil
+	}
+
+	cursor, err := db.DB.Collection("loans").Find(context.TODO(), bson.M{
+		"company_id": bson.M{"$in": companyIDs},
+		"status":     "active",
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var loans []models.Loan
+	if err = cursor.All(context.TODO(), &loans); err != nil {
+		return nil, nil, err
+	}
+
+	for _, loan := range loans {
+		projected := utils.ProjectLoanPayments(loan.RemainingBalance, loan.InterestRate, loan.MonthlyPayment, loan.StartDate, loan.TermMonths, fromMonth, months)
+		for i := range projected {
+			loanPayments[i] += projected[i]
+		}
+	}
+
+	leases, err := getActiveLeases(db, companyIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, lease := range leases {
+		payment := utils.CalculateLeasePaymentWithTax(lease.MonthlyRent, lease.SalesTaxRate)
+		for n := 1; n <= lease.TermMonths; n++ {
+			dueDate := utils.InstallmentDueDate(lease.StartDate, n)
+			if dueDate.Before(fromMonth) {
+				continue
+			}
+			index := (dueDate.Year()-fromMonth.Year())*12 + int(dueDate.Month()) - int(fromMonth.Month())
+			if index >= months {
+				break
+			}
+			leasePayments[index] += payment
+		}
+	}
+
+	return loanPayments, leasePayments, nil
+}
+
+// GetForecast строит помесячный прогноз движения денег: доходы и расходы пользователя и обслуживание долга по графикам
+func (h *CashFlowHandler) GetForecast(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	months, err := strconv.Atoi(c.Query("months", "12"))
+	if err != nil || months < 1 || months > 120 {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверное количество месяцев (1-120)"})
+	}
+
+	openingCash, err := strconv.ParseFloat(c.Query("opening_cash", "0"), 64)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный начальный остаток"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		companyIDs = filterOwnedIDs(companyIDs, companyObjectID)
+	}
+
+	fromMonth := utils.MonthStart(time.Now())
+	loanPayments, leasePayments, err := projectDebtService(h.db, companyIDs, fromMonth, months)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка расчета обслуживания долга"})
+	}
+
+	cursor, err := h.db.DB.Collection("cash_flow_items").Find(context.TODO(), bson.M{"company_id": bson.M{"$in": companyIDs}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения статей"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var items []models.CashFlowItem
+	if err = cursor.All(context.TODO(), &items); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования статей"})
+	}
+
+	forecast := CashFlowForecast{OpeningCash: openingCash, NegativeMonths: []string{}}
+	cash := openingCash
+
+	for i := 0; i < months; i++ {
+		monthStart := fromMonth.AddDate(0, i, 0)
+		month := CashFlowMonth{
+			Month:         monthStart.Format("2006-01"),
+			LoanPayments:  math.Round(loanPayments[i]*100) / 100,
+			LeasePayments: math.Round(leasePayments[i]*100) / 100,
+		}
+
+		for _, item := range items {
+			amount := item.Amount * float64(utils.OccurrencesInMonth(item.Frequency, item.StartDate, item.EndDate, monthStart))
+			if item.Type == "income" {
+				month.Income += amount
+			} else {
+				month.Expenses += amount
+			}
+		}
+
+		month.Income = math.Round(month.Income*100) / 100
+		month.Expenses = math.Round(month.Expenses*100) / 100
+		month.DebtService = math.Round((month.LoanPayments+month.LeasePayments)*100) / 100
+		month.NetCashFlow = math.Round((month.Income-month.Expenses-month.DebtService)*100) / 100
+		cash += month.NetCashFlow
+		month.EndingCash = math.Round(cash*100) / 100
+		month.Negative = month.EndingCash < 0
+		if month.Negative {
+			forecast.NegativeMonths = append(forecast.NegativeMonths, month.Month)
+		}
+
+		forecast.TotalDebt += month.DebtService
+		forecast.Months = append(forecast.Months, month)
+	}
+	forecast.TotalDebt = math.Round(forecast.TotalDebt*100) / 100
+
+	return c.JSON(forecast)
+}
+
+// validateCashFlowItem проверяет статью доходов или расходов
+func validateCashFlowItem(item *models.CashFlowItem) string {
+	if item.Type != "income" && item.Type != "expense" {
+		return "Неверный тип статьи"
+	}
+	if item.Amount < 0 {
+		return "Неверная сумма"
+	}
+	if !utils.IsValidFrequency(item.Frequency) {
+		return "Неверная периодичность"
+	}
+	if item.StartDate.IsZero() {
+		item.StartDate = time.Now()
+	}
+	return ""
+}
+
+func (h *CashFlowHandler) GetItems(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		filter["company_id"] = bson.M{"$in": filterOwnedIDs(companyIDs, companyObjectID)}
+	}
+
+	cursor, err := h.db.DB.Collection("cash_flow_items").Find(context.TODO(), filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения статей"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var items []models.CashFlowItem
+	if err = cursor.All(context.TODO(), &items); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	return c.JSON(items)
+}
+
+func (h *CashFlowHandler) CreateItem(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var item models.CashFlowItem
+	if err := c.BodyParser(&item); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := validateCashFlowItem(&item); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	// Проверяем что компания принадлежит пользователю
+	var company models.Company
+	err = h.db.DB.Collection("companies").FindOne(context.TODO(), bson.M{
+		"_id":     item.CompanyID,
+		"user_id": userObjectID,
+	}).Decode(&company)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	item.CreatedAt = time.Now()
+	item.UpdatedAt = time.Now()
+
+	result, err := h.db.DB.Collection("cash_flow_items").InsertOne(context.TODO(), item)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания статьи"})
+	}
+
+	item.ID = result.InsertedID.(primitive.ObjectID)
+	return c.Status(201).JSON(item)
+}
+
+func (h *CashFlowHandler) UpdateItem(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID статьи"})
+	}
+
+	var item models.CashFlowItem
+	if err := c.BodyParser(&item); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := validateCashFlowItem(&item); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	// Проверяем что компания принадлежит пользователю
+	var company models.Company
+	err = h.db.DB.Collection("companies").FindOne(context.TODO(), bson.M{
+		"_id":     item.CompanyID,
+		"user_id": userObjectID,
+	}).Decode(&company)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	item.ID = primitive.NilObjectID
+	item.UpdatedAt = time.Now()
+
+	filter := bson.M{"_id": itemID, "company_id": item.CompanyID}
+	result, err := h.db.DB.Collection("cash_flow_items").UpdateOne(context.TODO(), filter, bson.M{"$set": item})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления статьи"})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Статья не найдена"})
+	}
+
+	item.ID = itemID
+	return c.JSON(item)
+}
+
+func (h *CashFlowHandler) DeleteItem(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID статьи"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	result, err := h.db.DB.Collection("cash_flow_items").DeleteOne(context.TODO(), bson.M{
+		"_id":        itemID,
+		"company_id": bson.M{"$in": companyIDs},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления статьи"})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Статья не найдена"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Статья удалена"})
+}
@@ -0,0 +1,393 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"context"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var errLienNotFound = errors.New("lien not found")
+
+type LienRelease struct {
+	LoanID          string  `json:"loan_id"`
+	Lender          string  `json:"lender"`
+	VehicleID       string  `json:"vehicle_id"`
+	ReleaseDate     string  `json:"release_date"`
+	LoanBalance     float64 `json:"loan_balance"`
+	Share           float64 `json:"share"`
+	PrincipalShare  float64 `json:"principal_share"`
+	AccruedInterest float64 `json:"accrued_interest"`
+	Total           float64 `json:"total"`
+	FullPayoff      bool    `json:"full_payoff"`
+}
+
+// normalizeCollateral приводит залог кредита к списку: старые кредиты хранят только VehicleID
+func normalizeCollateral(loan *models.Loan) {
+	if len(loan.Collateral) == 0 && !loan.VehicleID.IsZero() {
+		loan.Collateral = []models.LoanCollateral{{VehicleID: loan.VehicleID}}
+	}
+	if loan.VehicleID.IsZero() && len(loan.Collateral) > 0 {
+		loan.VehicleID = loan.Collateral[0].VehicleID
+	}
+}
+
+// validateCollateralChange запрещает менять состояние снятых залогов и снимать залог через редактирование кредита
+func validateCollateralChange(existing, loan *models.Loan) string {
+	stored := map[primitive.ObjectID]models.LoanCollateral{}
+	for _, collateral := range existing.Collateral {
+		stored[collateral.VehicleID] = collateral
+	}
+
+	seen := map[primitive.ObjectID]bool{}
+	for i := range loan.Collateral {
+		collateral := &loan.Collateral[i]
+		seen[collateral.VehicleID] = true
+		previous, ok := stored[collateral.VehicleID]
+		if !ok {
+			if collateral.LienReleased {
+				return "Залог снимается только через снятие залога"
+			}
+			collateral.ReleasedAt = time.Time{}
+			collateral.ReleaseAmount = 0
+			continue
+		}
+		if collateral.LienReleased != previous.LienReleased {
+			return "Залог снимается только через снятие залога"
+		}
+		collateral.ReleasedAt = previous.ReleasedAt
+		collateral.ReleaseAmount = previous.ReleaseAmount
+	}
+
+	for _, collateral := range existing.Collateral {
+		if collateral.LienReleased && !seen[collateral.VehicleID] {
+			return "Снятый залог нельзя удалить из кредита"
+		}
+	}
+	return ""
+}
+
+// validateCollateral проверяет, что залоговый транспорт принадлежит компании кредита и распределение не превышает сумму кредита
+func validateCollateral(db *database.Database, loan *models.Loan) string {
+	allocated := 0.0
+	seen := map[primitive.ObjectID]bool{}
+	var vehicleIDs []primitive.ObjectID
+	for _, collateral := range loan.Collateral {
+		if collateral.AllocatedPrincipal < 0 {
+			return "Неверное распределение суммы кредита"
+		}
+		if seen[collateral.VehicleID] {
+			return "Транспорт указан в залоге дважды"
+		}
+		seen[collateral.VehicleID] = true
+		allocated += collateral.AllocatedPrincipal
+		vehicleIDs = append(vehicleIDs, collateral.VehicleID)
+	}
+	if allocated > loan.PrincipalAmount+0.01 {
+		return "Распределение превышает сумму кредита"
+	}
+	if len(vehicleIDs) == 0 {
+		return ""
+	}
+
+	count, err := db.DB.Collection("vehicles").CountDocuments(context.TODO(), bson.M{
+		"_id":        bson.M{"$in": vehicleIDs},
+		"company_id": loan.CompanyID,
+	})
+	if err != nil || int(count) != len(vehicleIDs) {
+		return "Залоговый транспорт не найден"
+	}
+	return ""
+}
+
+// vehicleLiens возвращает залоги транспорта по действующим кредитам
+func vehicleLiens(db *database.Database, vehicleID primitive.ObjectID) ([]models.VehicleLien, error) {
+	cursor, err := db.DB.Collection("loans").Find(context.TODO(), bson.M{
+		"status": "active",
+		"$or": []bson.M{
+			{"vehicle_id": vehicleID},
+			{"collateral.vehicle_id": vehicleID},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var loans []models.Loan
+	if err = cursor.All(context.TODO(), &loans); err != nil {
+		return nil, err
+	}
+
+	liens := []models.VehicleLien{}
+	for i := range loans {
+		normalizeCollateral(&loans[i])
+		for _, collateral := range loans[i].Collateral {
+			if collateral.VehicleID != vehicleID {
+				continue
+			}
+			liens = append(liens, models.VehicleLien{
+				LoanID:             loans[i].ID,
+				Lender:             loans[i].Lender,
+				AllocatedPrincipal: collateral.AllocatedPrincipal,
+				Released:           collateral.LienReleased,
+				ReleasedAt:         collateral.ReleasedAt,
+			})
+		}
+	}
+	return liens, nil
+}
+
+// hasUnreleasedLien проверяет есть ли у транспорта непогашенный залог
+func hasUnreleasedLien(liens []models.VehicleLien) bool {
+	for _, lien := range liens {
+		if !lien.Released {
+			return true
+		}
+	}
+	return false
+}
+
+// collateralShares возвращает долю остатка кредита, приходящуюся на каждую единицу с неосвобожденным залогом.
+// Доля определяется распределением суммы кредита, без распределения — поровну.
+func collateralShares(loan *models.Loan) map[primitive.ObjectID]float64 {
+	normalizeCollateral(loan)
+
+	shares := map[primitive.ObjectID]float64{}
+	allocatedTotal := 0.0
+	for _, collateral := range loan.Collateral {
+		if collateral.LienReleased {
+			continue
+		}
+		shares[collateral.VehicleID] = collateral.AllocatedPrincipal
+		allocatedTotal += collateral.AllocatedPrincipal
+	}
+
+	for vehicleID, allocated := range shares {
+		if allocatedTotal > 0 {
+			shares[vehicleID] = allocated / allocatedTotal
+		} else {
+			shares[vehicleID] = 1.0 / float64(len(shares))
+		}
+	}
+	return shares
+}
+
+// calculateLienRelease рассчитывает сумму снятия залога с одной единицы транспорта.
+// Доля остатка определяется распределением суммы кредита между неосвобожденными единицами,
+// без распределения — поровну. Начисленные проценты по кредиту погашаются полностью.
+func calculateLienRelease(loan *models.Loan, vehicleID primitive.ObjectID, releaseDate time.Time) (LienRelease, bool) {
+	shares := collateralShares(loan)
+	share, ok := shares[vehicleID]
+	if !ok {
+		return LienRelease{}, false
+	}
+	unreleased := len(shares)
+
+	payoff := calculateLoanPayoff(loan, releaseDate)
+	release := LienRelease{
+		LoanID:          loan.ID.Hex(),
+		Lender:          loan.Lender,
+		VehicleID:       vehicleID.Hex(),
+		ReleaseDate:     releaseDate.Format("2006-01-02"),
+		LoanBalance:     loan.RemainingBalance,
+		Share:           math.Round(share*10000) / 10000,
+		PrincipalShare:  math.Round(loan.RemainingBalance*share*100) / 100,
+		AccruedInterest: payoff.AccruedInterest,
+		FullPayoff:      unreleased == 1,
+	}
+	release.Total = math.Round((release.PrincipalShare+release.AccruedInterest)*100) / 100
+	return release, true
+}
+
+// GetLienRelease рассчитывает сумму снятия залога с транспорта по всем его кредитам
+func (h *VehicleHandler) GetLienRelease(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	vehicleID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+	}
+
+	releaseDate := time.Now()
+	if date := c.Query("date"); date != "" {
+		releaseDate, err = time.Parse("2006-01-02", date)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+		}
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	var vehicle models.Vehicle
+	err = h.db.DB.Collection("vehicles").FindOne(context.TODO(), bson.M{
+		"_id":        vehicleID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&vehicle)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+
+	releases, err := vehicleLienReleases(h.db, vehicle.ID, releaseDate)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения кредитов"})
+	}
+
+	total := 0.0
+	for _, release := range releases {
+		total += release.Total
+	}
+
+	return c.JSON(fiber.Map{
+		"vehicle_id": vehicle.ID.Hex(),
+		"releases":   releases,
+		"total":      math.Round(total*100) / 100,
+	})
+}
+
+// vehicleLienReleases рассчитывает суммы снятия залога по всем действующим кредитам транспорта
+func vehicleLienReleases(db *database.Database, vehicleID primitive.ObjectID, releaseDate time.Time) ([]LienRelease, error) {
+	cursor, err := db.DB.Collection("loans").Find(context.TODO(), bson.M{
+		"status": "active",
+		"$or": []bson.M{
+			{"vehicle_id": vehicleID},
+			{"collateral.vehicle_id": vehicleID},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var loans []models.Loan
+	if err = cursor.All(context.TODO(), &loans); err != nil {
+		return nil, err
+	}
+
+	releases := []LienRelease{}
+	for i := range loans {
+		if release, ok := calculateLienRelease(&loans[i], vehicleID, releaseDate); ok {
+			releases = append(releases, release)
+		}
+	}
+	return releases, nil
+}
+
+// releaseLien снимает залог с транспорта и при необходимости проводит платеж на сумму снятия
+func releaseLien(db *database.Database, loan *models.Loan, vehicleID primitive.ObjectID, releaseDate time.Time, recordPayment bool, userID primitive.ObjectID) (LienRelease, error) {
+	release, ok := calculateLienRelease(loan, vehicleID, releaseDate)
+	if !ok {
+		return release, errLienNotFound
+	}
+
+	if recordPayment && release.Total > 0 {
+		payment := models.Payment{
+			LoanID:         loan.ID,
+			PaymentDate:    releaseDate,
+			TotalPaid:      release.Total,
+			ExtraPrincipal: release.PrincipalShare,
+			Status:         models.PaymentPosted,
+			CreatedAt:      time.Now(),
+
+			LienReleaseVehicleID: vehicleID,
+		}
+		if release.PrincipalShare > 0 {
+			payment.PrepaymentOption = models.PrepaymentRecast
+		}
+		applyPaymentToLoan(loan, &payment)
+
+		result, err := db.DB.Collection("payments").InsertOne(context.TODO(), payment)
+		if err != nil {
+			return release, err
+		}
+		payment.ID = result.InsertedID.(primitive.ObjectID)
+		logPaymentEvent(db, &payment, models.PaymentEventCreated, "lien release", userID)
+
+		if err := saveLoanBalance(db, loan); err != nil {
+			return release, err
+		}
+	}
+
+	for i := range loan.Collateral {
+		if loan.Collateral[i].VehicleID == vehicleID {
+			loan.Collateral[i].LienReleased = true
+			loan.Collateral[i].ReleasedAt = releaseDate
+			loan.Collateral[i].ReleaseAmount = release.Total
+		}
+	}
+
+	_, err := db.DB.Collection("loans").UpdateOne(context.TODO(), bson.M{"_id": loan.ID}, bson.M{"$set": bson.M{
+		"collateral": loan.Collateral,
+		"updated_at": time.Now(),
+	}})
+	return release, err
+}
+
+// ReleaseLien снимает залог с единицы транспорта по кредиту
+func (h *LoanHandler) ReleaseLien(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	loanID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID кредита"})
+	}
+
+	vehicleID, err := primitive.ObjectIDFromHex(c.Params("vehicleId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+	}
+
+	var request struct {
+		ReleaseDate   time.Time `json:"release_date"`
+		RecordPayment bool      `json:"record_payment"`
+	}
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+		}
+	}
+	if request.ReleaseDate.IsZero() {
+		request.ReleaseDate = time.Now()
+	}
+
+	loan, err := findUserLoan(h.db, userObjectID, loanID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Кредит не найден"})
+	}
+
+	release, err := releaseLien(h.db, loan, vehicleID, request.ReleaseDate, request.RecordPayment, userObjectID)
+	if err == errLienNotFound {
+		return c.Status(404).JSON(fiber.Map{"error": "Залог не найден или уже снят"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка снятия залога"})
+	}
+
+	return c.JSON(fiber.Map{"release": release, "loan": loan})
+}
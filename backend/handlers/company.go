@@ -4,6 +4,7 @@ import (
 	"business-schedule-backend/database"
 	"business-schedule-backend/middleware"
 	"business-schedule-backend/models"
+	"business-schedule-backend/storage"
 	"context"
 	"time"
 
@@ -13,11 +14,12 @@ import (
 )
 
 type CompanyHandler struct {
-	db *database.Database
+	db    *database.Database
+	store storage.Storage
 }
 
-func NewCompanyHandler(db *database.Database) *CompanyHandler {
-	return &CompanyHandler{db: db}
+func NewCompanyHandler(db *database.Database, store storage.Storage) *CompanyHandler {
+	return &CompanyHandler{db: db, store: store}
 }
 
 func (h *CompanyHandler) GetCompanies(c *fiber.Ctx) error {
@@ -62,6 +64,13 @@ func (h *CompanyHandler) CreateCompany(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
 	}
 
+	if msg := validateDepreciationSettings(&company.Depreciation); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if msg := validateInvoiceSettings(&company.Invoicing); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
 	company.UserID = userObjectID
 	company.CreatedAt = time.Now()
 	company.UpdatedAt = time.Now()
@@ -97,10 +106,36 @@ func (h *CompanyHandler) UpdateCompany(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
 	}
 
-	company.UpdatedAt = time.Now()
+	fields, err := sentFields(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
 
 	collection := h.db.DB.Collection("companies")
 	filter := bson.M{"_id": companyID, "user_id": userObjectID}
+
+	var existing models.Company
+	if err := collection.FindOne(context.TODO(), filter).Decode(&existing); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Компания не найдена"})
+	}
+
+	// Форма компании не передает настройки амортизации и выставления счетов — сохраняем записанные
+	if !fields["depreciation"] {
+		company.Depreciation = existing.Depreciation
+	}
+	if !fields["invoicing"] {
+		company.Invoicing = existing.Invoicing
+	}
+
+	if msg := validateDepreciationSettings(&company.Depreciation); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if msg := validateInvoiceSettings(&company.Invoicing); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	company.UpdatedAt = time.Now()
+
 	update := bson.M{"$set": company}
 
 	result, err := collection.UpdateOne(context.TODO(), filter, update)
@@ -144,5 +179,10 @@ func (h *CompanyHandler) DeleteCompany(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "Компания не найдена"})
 	}
 
+	// Удаляем все документы компании вместе с файлами в хранилище
+	if _, err := deleteStoredDocuments(h.db, h.store, bson.M{"company_id": companyID}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления документов"})
+	}
+
 	return c.JSON(fiber.Map{"message": "Компания удалена"})
 }
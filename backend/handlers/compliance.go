@@ -0,0 +1,691 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/storage"
+	"business-schedule-backend/utils"
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// complianceTypeNames — названия типов документов для напоминаний
+var complianceTypeNames = map[string]string{
+	utils.ComplianceRegistration:  "Регистрация IRP",
+	utils.ComplianceDOTInspection: "Осмотр DOT",
+	utils.ComplianceInsurance:     "Страховка",
+	utils.CompliancePermit:        "Разрешение",
+	utils.ComplianceIFTA:          "Лицензия IFTA",
+	utils.ComplianceUCR:           "Регистрация UCR",
+	utils.ComplianceOther:         "Документ",
+}
+
+// complianceDocumentCategories — категория скана в хранилище документов по типу документа соответствия
+var complianceDocumentCategories = map[string]string{
+	utils.ComplianceRegistration:  utils.DocumentRegistration,
+	utils.ComplianceDOTInspection: utils.DocumentInspection,
+	utils.ComplianceInsurance:     utils.DocumentInsurance,
+}
+
+type ComplianceHandler struct {
+	db      *database.Database
+	store   storage.Storage
+	maxSize int64
+}
+
+func NewComplianceHandler(db *database.Database, store storage.Storage, maxSize int64) *ComplianceHandler {
+	return &ComplianceHandler{db: db, store: store, maxSize: maxSize}
+}
+
+// setComplianceStatus рассчитывает статус документа и число дней до окончания
+func setComplianceStatus(item *models.ComplianceItem, asOf time.Time) {
+	item.Status, item.DaysRemaining = utils.ComplianceStatus(item.ExpiryDate, asOf, item.WarningDays)
+}
+
+func validateComplianceItem(item *models.ComplianceItem) string {
+	if !utils.IsValidComplianceType(item.Type) {
+		return "Неверный тип документа"
+	}
+	if item.ExpiryDate.IsZero() {
+		return "Не указана дата окончания действия"
+	}
+	if !item.IssueDate.IsZero() && item.ExpiryDate.Before(item.IssueDate) {
+		return "Дата окончания раньше даты выдачи"
+	}
+	if item.WarningDays < 0 {
+		return "Срок предупреждения не может быть отрицательным"
+	}
+	return ""
+}
+
+// resolveComplianceOwner проверяет доступ к транспорту или компании документа.
+// Для документа транспорта компания берется из транспорта.
+func resolveComplianceOwner(db *database.Database, userObjectID primitive.ObjectID, item *models.ComplianceItem) (int, string) {
+	if item.VehicleID != nil {
+		vehicle, err := findUserVehicle(db, userObjectID, *item.VehicleID)
+		if err != nil {
+			return 404, "Транспорт не найден"
+		}
+		item.CompanyID = vehicle.CompanyID
+		return 0, ""
+	}
+
+	count, err := db.DB.Collection("companies").CountDocuments(context.TODO(), bson.M{
+		"_id":     item.CompanyID,
+		"user_id": userObjectID,
+	})
+	if err != nil || count == 0 {
+		return 403, "Компания не найдена или нет доступа"
+	}
+	return 0, ""
+}
+
+// complianceAlertMessage формирует текст напоминания о документе
+func complianceAlertMessage(item *models.ComplianceItem, vehicle *models.Vehicle, days int) string {
+	subject := complianceTypeNames[item.Type]
+	if item.Name != "" {
+		subject += " «" + item.Name + "»"
+	}
+	if item.Number != "" {
+		subject += " № " + item.Number
+	}
+	if vehicle != nil {
+		subject += " (" + vehicleTitle(vehicle) + ")"
+	}
+
+	switch {
+	case days < 0:
+		return fmt.Sprintf("%s истек %s", subject, item.ExpiryDate.Format("2006-01-02"))
+	case days == 0:
+		return subject + " истекает сегодня"
+	}
+	return fmt.Sprintf("%s истекает через %d дн. (%s)", subject, days, item.ExpiryDate.Format("2006-01-02"))
+}
+
+// GenerateComplianceAlerts создает напоминания по истекающим и истекшим документам компаний
+// (companyIDs == nil — по всем компаниям). На каждый порог и дату окончания документа создается
+// одно напоминание, поэтому повторные запуски безопасны. Возвращает новые напоминания.
+func GenerateComplianceAlerts(db *database.Database, companyIDs []primitive.ObjectID, asOf time.Time) ([]models.ComplianceAlert, error) {
+	created := []models.ComplianceAlert{}
+
+	filter := bson.M{}
+	if companyIDs != nil {
+		filter["company_id"] = bson.M{"$in": companyIDs}
+	}
+
+	cursor, err := db.DB.Collection("compliance_items").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"expiry_date": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var items []models.ComplianceItem
+	if err = cursor.All(context.TODO(), &items); err != nil {
+		return nil, err
+	}
+
+	vehicles := map[primitive.ObjectID]*models.Vehicle{}
+	alertsCollection := db.DB.Collection("compliance_alerts")
+
+	for i := range items {
+		item := &items[i]
+		setComplianceStatus(item, asOf)
+
+		threshold, ok := utils.ComplianceAlertThreshold(item.DaysRemaining)
+		if !ok {
+			continue
+		}
+
+		var vehicle *models.Vehicle
+		if item.VehicleID != nil {
+			if cached, found := vehicles[*item.VehicleID]; found {
+				vehicle = cached
+			} else {
+				var v models.Vehicle
+				if err := db.DB.Collection("vehicles").FindOne(context.TODO(), bson.M{"_id": *item.VehicleID}).Decode(&v); err == nil {
+					vehicle = &v
+				}
+				vehicles[*item.VehicleID] = vehicle
+			}
+			// Документы выбывшего транспорта не требуют продления
+			if vehicle != nil && (vehicle.Disposal != nil || vehicle.Status == "sold") {
+				continue
+			}
+		}
+
+		alert := models.ComplianceAlert{
+			CompanyID:     item.CompanyID,
+			ItemID:        item.ID,
+			VehicleID:     item.VehicleID,
+			Type:          item.Type,
+			Name:          item.Name,
+			ExpiryDate:    item.ExpiryDate,
+			Threshold:     threshold,
+			DaysRemaining: item.DaysRemaining,
+			Status:        item.Status,
+			Message:       complianceAlertMessage(item, vehicle, item.DaysRemaining),
+			CreatedAt:     asOf,
+		}
+
+		result, err := alertsCollection.UpdateOne(context.TODO(), bson.M{
+			"item_id":     item.ID,
+			"expiry_date": item.ExpiryDate,
+			"threshold":   threshold,
+		}, bson.M{"$setOnInsert": alert}, options.Update().SetUpsert(true))
+		if err != nil {
+			return nil, err
+		}
+		if result.UpsertedID != nil {
+			alert.ID = result.UpsertedID.(primitive.ObjectID)
+			created = append(created, alert)
+		}
+	}
+
+	return created, nil
+}
+
+// GetItems возвращает документы соответствия с фильтрами company_id, vehicle_id, type и status
+func (h *ComplianceHandler) GetItems(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		filter["company_id"] = bson.M{"$in": filterOwnedIDs(companyIDs, companyObjectID)}
+	}
+	if vehicleID := c.Query("vehicle_id"); vehicleID != "" {
+		vehicleObjectID, err := primitive.ObjectIDFromHex(vehicleID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+		}
+		filter["vehicle_id"] = vehicleObjectID
+	}
+	if itemType := c.Query("type"); itemType != "" {
+		filter["type"] = itemType
+	}
+
+	cursor, err := h.db.DB.Collection("compliance_items").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"expiry_date": 1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения документов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var items []models.ComplianceItem
+	if err = cursor.All(context.TODO(), &items); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	status := c.Query("status")
+	result := []models.ComplianceItem{}
+	asOf := time.Now()
+	for i := range items {
+		setComplianceStatus(&items[i], asOf)
+		if status == "" || items[i].Status == status {
+			result = append(result, items[i])
+		}
+	}
+
+	return c.JSON(result)
+}
+
+// GetExpiring возвращает документы, истекающие в ближайшие days дней (по умолчанию 30), включая истекшие
+func (h *ComplianceHandler) GetExpiring(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	days := utils.DefaultComplianceWarningDays
+	if value := c.Query("days"); value != "" {
+		days, err = strconv.Atoi(value)
+		if err != nil || days < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверное количество дней"})
+		}
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		companyIDs = filterOwnedIDs(companyIDs, companyObjectID)
+	}
+
+	asOf := time.Now()
+	until := time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, days+1)
+	cursor, err := h.db.DB.Collection("compliance_items").Find(context.TODO(), bson.M{
+		"company_id":  bson.M{"$in": companyIDs},
+		"expiry_date": bson.M{"$lt": until},
+	}, options.Find().SetSort(bson.M{"expiry_date": 1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения документов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var items []models.ComplianceItem
+	if err = cursor.All(context.TODO(), &items); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	result := []models.ComplianceItem{}
+	for i := range items {
+		setComplianceStatus(&items[i], asOf)
+		if items[i].DaysRemaining <= days {
+			result = append(result, items[i])
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].DaysRemaining < result[j].DaysRemaining
+	})
+
+	return c.JSON(result)
+}
+
+func (h *ComplianceHandler) CreateItem(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var item models.ComplianceItem
+	if err := c.BodyParser(&item); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := validateComplianceItem(&item); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if status, msg := resolveComplianceOwner(h.db, userObjectID, &item); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	// Скан загружается отдельным запросом
+	item.DocumentID = nil
+	item.CreatedAt = time.Now()
+	item.UpdatedAt = time.Now()
+
+	result, err := h.db.DB.Collection("compliance_items").InsertOne(context.TODO(), item)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания документа"})
+	}
+
+	item.ID = result.InsertedID.(primitive.ObjectID)
+	setComplianceStatus(&item, time.Now())
+	return c.Status(201).JSON(item)
+}
+
+func (h *ComplianceHandler) UpdateItem(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID документа"})
+	}
+
+	var item models.ComplianceItem
+	if err := c.BodyParser(&item); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := validateComplianceItem(&item); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if status, msg := resolveComplianceOwner(h.db, userObjectID, &item); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	item.UpdatedAt = time.Now()
+
+	set := bson.M{
+		"company_id":   item.CompanyID,
+		"type":         item.Type,
+		"name":         item.Name,
+		"number":       item.Number,
+		"issuer":       item.Issuer,
+		"issue_date":   item.IssueDate,
+		"expiry_date":  item.ExpiryDate,
+		"warning_days": item.WarningDays,
+		"notes":        item.Notes,
+		"updated_at":   item.UpdatedAt,
+	}
+	update := bson.M{"$set": set}
+	if item.VehicleID != nil {
+		set["vehicle_id"] = item.VehicleID
+	} else {
+		update["$unset"] = bson.M{"vehicle_id": ""}
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	var updated models.ComplianceItem
+	err = h.db.DB.Collection("compliance_items").FindOneAndUpdate(context.TODO(),
+		bson.M{"_id": itemID, "company_id": bson.M{"$in": companyIDs}},
+		update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Документ не найден"})
+	}
+
+	setComplianceStatus(&updated, time.Now())
+	return c.JSON(updated)
+}
+
+func (h *ComplianceHandler) DeleteItem(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID документа"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	result, err := h.db.DB.Collection("compliance_items").DeleteOne(context.TODO(), bson.M{
+		"_id":        itemID,
+		"company_id": bson.M{"$in": companyIDs},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления документа"})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Документ не найден"})
+	}
+
+	_, err = h.db.DB.Collection("compliance_alerts").DeleteMany(context.TODO(), bson.M{"item_id": itemID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления напоминаний"})
+	}
+
+	_, err = deleteStoredDocuments(h.db, h.store, bson.M{
+		"entity_type": utils.DocumentEntityComplianceItem,
+		"entity_id":   itemID,
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления скана"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Документ удален"})
+}
+
+// UploadDocument прикладывает скан к документу (multipart, поле file) и заменяет предыдущий
+func (h *ComplianceHandler) UploadDocument(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID документа"})
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Файл не передан"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	var item models.ComplianceItem
+	err = h.db.DB.Collection("compliance_items").FindOne(context.TODO(), bson.M{
+		"_id":        itemID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&item)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Документ не найден"})
+	}
+
+	category, ok := complianceDocumentCategories[item.Type]
+	if !ok {
+		category = utils.DocumentOther
+	}
+
+	document := models.Document{
+		CompanyID:   item.CompanyID,
+		EntityType:  utils.DocumentEntityComplianceItem,
+		EntityID:    item.ID,
+		Category:    category,
+		Description: item.Name,
+		UploadedBy:  userObjectID,
+	}
+	if status, msg := storeUploadedDocument(h.db, h.store, h.maxSize, fileHeader, &document); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	_, err = h.db.DB.Collection("compliance_items").UpdateOne(context.TODO(),
+		bson.M{"_id": itemID},
+		bson.M{"$set": bson.M{"document_id": document.ID, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения файла"})
+	}
+
+	if item.DocumentID != nil {
+		if _, err := deleteStoredDocuments(h.db, h.store, bson.M{"_id": *item.DocumentID}); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления предыдущего скана"})
+		}
+	}
+
+	return c.JSON(document)
+}
+
+// DownloadDocument отдает приложенный скан документа
+func (h *ComplianceHandler) DownloadDocument(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID документа"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	var item models.ComplianceItem
+	err = h.db.DB.Collection("compliance_items").FindOne(context.TODO(), bson.M{
+		"_id":        itemID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&item)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Документ не найден"})
+	}
+
+	if item.DocumentID == nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Файл не загружен"})
+	}
+
+	document, err := findUserDocument(h.db, userObjectID, *item.DocumentID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Файл не загружен"})
+	}
+
+	return sendStoredDocument(c, h.store, document)
+}
+
+// GetAlerts возвращает напоминания об истекающих документах (acknowledged=false — только непрочитанные)
+func (h *ComplianceHandler) GetAlerts(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		filter["company_id"] = bson.M{"$in": filterOwnedIDs(companyIDs, companyObjectID)}
+	}
+	if acknowledged := c.Query("acknowledged"); acknowledged != "" {
+		filter["acknowledged"] = acknowledged == "true"
+	}
+
+	cursor, err := h.db.DB.Collection("compliance_alerts").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения напоминаний"})
+	}
+	defer cursor.Close(context.TODO())
+
+	alerts := []models.ComplianceAlert{}
+	if err = cursor.All(context.TODO(), &alerts); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	return c.JSON(alerts)
+}
+
+// RunAlerts запускает проверку документов компаний пользователя вне расписания
+func (h *ComplianceHandler) RunAlerts(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+	if len(companyIDs) == 0 {
+		return c.JSON([]models.ComplianceAlert{})
+	}
+
+	alerts, err := GenerateComplianceAlerts(h.db, companyIDs, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка проверки документов"})
+	}
+
+	return c.JSON(alerts)
+}
+
+func (h *ComplianceHandler) AcknowledgeAlert(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	alertID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID напоминания"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	result, err := h.db.DB.Collection("compliance_alerts").UpdateOne(context.TODO(),
+		bson.M{"_id": alertID, "company_id": bson.M{"$in": companyIDs}},
+		bson.M{"$set": bson.M{"acknowledged": true}},
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления напоминания"})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Напоминание не найдено"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Напоминание отмечено прочитанным"})
+}
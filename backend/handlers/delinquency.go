@@ -0,0 +1,418 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DelinquencyHandler struct {
+	db *database.Database
+}
+
+func NewDelinquencyHandler(db *database.Database) *DelinquencyHandler {
+	return &DelinquencyHandler{db: db}
+}
+
+type AgingBucketTotals struct {
+	LoansCount    int     `json:"loans_count"`
+	Balance       float64 `json:"balance"`
+	PastDueAmount float64 `json:"past_due_amount"`
+}
+
+type AgingReportItem struct {
+	CompanyID   string                       `json:"company_id"`
+	CompanyName string                       `json:"company_name"`
+	Buckets     map[string]AgingBucketTotals `json:"buckets"`
+	LateFees    float64                      `json:"late_fees_outstanding"`
+}
+
+// loanGraceDays возвращает льготный период кредита с учетом значения по умолчанию
+func loanGraceDays(loan *models.Loan) int {
+	if loan.GracePeriodDays <= 0 {
+		return utils.DefaultGracePeriodDays
+	}
+	return loan.GracePeriodDays
+}
+
+// evaluateLoanDelinquency сравнивает график кредита с записанными платежами на дату
+func evaluateLoanDelinquency(db *database.Database, loan *models.Loan, asOf time.Time) (utils.DelinquencyResult, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "payment_date", Value: 1}, {Key: "created_at", Value: 1}})
+	cursor, err := db.DB.Collection("payments").Find(context.TODO(), activePaymentsFilter(loan.ID), opts)
+	if err != nil {
+		return utils.DelinquencyResult{}, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var payments []models.Payment
+	if err = cursor.All(context.TODO(), &payments); err != nil {
+		return utils.DelinquencyResult{}, err
+	}
+
+	var records []utils.PaymentRecord
+	for _, payment := range payments {
+		amount := payment.TotalPaid
+		// При рекасте досрочная часть уменьшает следующие взносы, а не покрывает их заранее
+		if payment.PrepaymentOption == models.PrepaymentRecast {
+			amount -= payment.ExtraPrincipal
+		}
+		records = append(records, utils.PaymentRecord{Date: payment.PaymentDate, Amount: amount})
+	}
+
+	graceDays := loanGraceDays(loan)
+
+	return utils.EvaluateDelinquency(loanDueSchedule(loan, payments), records, graceDays, asOf), nil
+}
+
+// loanDueSchedule восстанавливает график взносов кредита, проводя платежи на копии кредита:
+// каждый рекаст меняет размер следующих взносов
+func loanDueSchedule(loan *models.Loan, payments []models.Payment) []utils.ScheduledInstallment {
+	replay := *loan
+	replay.RemainingBalance = loan.PrincipalAmount
+	replay.LastPaymentDate = time.Time{}
+	replay.MonthlyPayment = utils.CalculateMonthlyPaymentWithBalloon(loan.PrincipalAmount, loan.InterestRate, loan.TermMonths, loan.BalloonAmount)
+	installment := replay.MonthlyPayment
+
+	var changes []utils.InstallmentChange
+	for i := range payments {
+		payment := payments[i]
+		applyPaymentToLoan(&replay, &payment)
+		if payment.PrepaymentOption == models.PrepaymentRecast && replay.RemainingBalance > 0 {
+			changes = append(changes, utils.InstallmentChange{From: payment.PaymentDate, Installment: replay.MonthlyPayment})
+		}
+	}
+
+	return utils.DueSchedule(loan.StartDate, loan.TermMonths, installment, loan.BalloonAmount, changes)
+}
+
+// refreshLoanDelinquency пересчитывает статус просрочки кредита, начисляет новые штрафы и сохраняет результат
+func refreshLoanDelinquency(db *database.Database, loan *models.Loan, asOf time.Time) (utils.DelinquencyResult, error) {
+	if loan.Status != "active" {
+		return utils.DelinquencyResult{Status: utils.DelinquencyCurrent}, nil
+	}
+
+	result, err := evaluateLoanDelinquency(db, loan, asOf)
+	if err != nil {
+		return result, err
+	}
+
+	lateFeesCollection := db.DB.Collection("late_fees")
+
+	// Начисляем штраф по каждому просроченному взносу один раз
+	if loan.LateFeeAmount > 0 {
+		for _, installment := range result.LateInstallments {
+			count, err := lateFeesCollection.CountDocuments(context.TODO(), bson.M{
+				"loan_id":            loan.ID,
+				"installment_number": installment.Number,
+			})
+			if err != nil {
+				return result, err
+			}
+			if count > 0 {
+				continue
+			}
+
+			fee := models.LateFee{
+				LoanID:            loan.ID,
+				CompanyID:         loan.CompanyID,
+				InstallmentNumber: installment.Number,
+				DueDate:           installment.DueDate,
+				Amount:            utils.CalculateLateFee(loan.LateFeeType, loan.LateFeeAmount, loan.MonthlyPayment),
+				Status:            "outstanding",
+				AssessedAt:        time.Now(),
+				UpdatedAt:         time.Now(),
+			}
+			if _, err := lateFeesCollection.InsertOne(context.TODO(), fee); err != nil {
+				return result, err
+			}
+		}
+	}
+
+	outstanding, err := outstandingLateFees(db, loan.ID)
+	if err != nil {
+		return result, err
+	}
+
+	loan.DelinquencyStatus = result.Status
+	loan.DaysPastDue = result.DaysPastDue
+	loan.LateFeesOutstanding = outstanding
+	loan.DelinquencyCheckedAt = time.Now()
+
+	_, err = db.DB.Collection("loans").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": loan.ID},
+		bson.M{"$set": bson.M{
+			"delinquency_status":     loan.DelinquencyStatus,
+			"days_past_due":          loan.DaysPastDue,
+			"late_fees_outstanding":  loan.LateFeesOutstanding,
+			"delinquency_checked_at": loan.DelinquencyCheckedAt,
+		}},
+	)
+	return result, err
+}
+
+// outstandingLateFees возвращает сумму неоплаченных штрафов по кредиту
+func outstandingLateFees(db *database.Database, loanID primitive.ObjectID) (float64, error) {
+	cursor, err := db.DB.Collection("late_fees").Find(context.TODO(), bson.M{"loan_id": loanID, "status": "outstanding"})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var fees []models.LateFee
+	if err = cursor.All(context.TODO(), &fees); err != nil {
+		return 0, err
+	}
+
+	total := 0.0
+	for _, fee := range fees {
+		total += fee.Amount
+	}
+	return math.Round(total*100) / 100, nil
+}
+
+// RunDelinquencyCheck пересчитывает просрочки по всем активным кредитам пользователя
+func (h *DelinquencyHandler) RunDelinquencyCheck(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		companyIDs = filterOwnedIDs(companyIDs, companyObjectID)
+	}
+
+	cursor, err := h.db.DB.Collection("loans").Find(context.TODO(), bson.M{
+		"company_id": bson.M{"$in": companyIDs},
+		"status":     "active",
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения кредитов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var loans []models.Loan
+	if err = cursor.All(context.TODO(), &loans); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования кредитов"})
+	}
+
+	asOf := time.Now()
+	for i := range loans {
+		if _, err := refreshLoanDelinquency(h.db, &loans[i], asOf); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка пересчета просрочки"})
+		}
+	}
+
+	return c.JSON(loans)
+}
+
+// GetAgingReport возвращает отчет по возрасту просроченной задолженности (30/60/90+) по компаниям
+func (h *DelinquencyHandler) GetAgingReport(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	filter := bson.M{"user_id": userObjectID}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		filter["_id"] = companyObjectID
+	}
+
+	companiesCursor, err := h.db.DB.Collection("companies").Find(context.TODO(), filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+	defer companiesCursor.Close(context.TODO())
+
+	var companies []models.Company
+	if err = companiesCursor.All(context.TODO(), &companies); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования компаний"})
+	}
+
+	asOf := time.Now()
+	report := []AgingReportItem{}
+
+	for _, company := range companies {
+		loansCursor, err := h.db.DB.Collection("loans").Find(context.TODO(), bson.M{
+			"company_id": company.ID,
+			"status":     "active",
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения кредитов"})
+		}
+
+		var loans []models.Loan
+		if err = loansCursor.All(context.TODO(), &loans); err != nil {
+			loansCursor.Close(context.TODO())
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования кредитов"})
+		}
+		loansCursor.Close(context.TODO())
+
+		item := AgingReportItem{
+			CompanyID:   company.ID.Hex(),
+			CompanyName: company.Name,
+			Buckets:     map[string]AgingBucketTotals{},
+		}
+		for _, bucket := range utils.AgingBuckets {
+			item.Buckets[bucket] = AgingBucketTotals{}
+		}
+
+		for i := range loans {
+			result, err := evaluateLoanDelinquency(h.db, &loans[i], asOf)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Ошибка расчета просрочки"})
+			}
+
+			bucket := utils.AgingBucket(result.DaysPastDue, loanGraceDays(&loans[i]))
+			totals := item.Buckets[bucket]
+			totals.LoansCount++
+			totals.Balance += loans[i].RemainingBalance
+			totals.PastDueAmount += result.PastDueAmount
+			item.Buckets[bucket] = totals
+			item.LateFees += loans[i].LateFeesOutstanding
+		}
+
+		report = append(report, item)
+	}
+
+	return c.JSON(report)
+}
+
+// GetLateFees возвращает штрафы за просрочку, опционально по одному кредиту
+func (h *DelinquencyHandler) GetLateFees(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	if loanID := c.Query("loan_id"); loanID != "" {
+		loanObjectID, err := primitive.ObjectIDFromHex(loanID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID кредита"})
+		}
+		filter["loan_id"] = loanObjectID
+	}
+
+	cursor, err := h.db.DB.Collection("late_fees").Find(context.TODO(), filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения штрафов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var fees []models.LateFee
+	if err = cursor.All(context.TODO(), &fees); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	return c.JSON(fees)
+}
+
+// UpdateLateFee отмечает штраф оплаченным или списанным
+func (h *DelinquencyHandler) UpdateLateFee(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	feeID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID штрафа"})
+	}
+
+	var request struct {
+		Status string `json:"status"`
+	}
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+	if request.Status != "outstanding" && request.Status != "paid" && request.Status != "waived" {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный статус штрафа"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	lateFeesCollection := h.db.DB.Collection("late_fees")
+	var fee models.LateFee
+	err = lateFeesCollection.FindOne(context.TODO(), bson.M{
+		"_id":        feeID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&fee)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Штраф не найден"})
+	}
+
+	fee.Status = request.Status
+	fee.UpdatedAt = time.Now()
+	_, err = lateFeesCollection.UpdateOne(context.TODO(), bson.M{"_id": fee.ID}, bson.M{"$set": bson.M{
+		"status":     fee.Status,
+		"updated_at": fee.UpdatedAt,
+	}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления штрафа"})
+	}
+
+	// Обновляем сумму неоплаченных штрафов по кредиту
+	outstanding, err := outstandingLateFees(h.db, fee.LoanID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка пересчета штрафов"})
+	}
+	_, err = h.db.DB.Collection("loans").UpdateOne(context.TODO(), bson.M{"_id": fee.LoanID}, bson.M{"$set": bson.M{
+		"late_fees_outstanding": outstanding,
+	}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления кредита"})
+	}
+
+	return c.JSON(fee)
+}
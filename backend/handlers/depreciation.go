@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// vehicleUnitsUsed возвращает пробег транспорта с ввода в эксплуатацию до даты по журналу показаний.
+// Показание на дату ввода берется интерполяцией или по первому показанию; без журнала пробег неизвестен.
+func vehicleUnitsUsed(vehicle *models.Vehicle, points []utils.MeterPoint, asOf time.Time) float64 {
+	if len(points) == 0 {
+		return 0
+	}
+	inService, _ := utils.MeterAt(points, vehicle.PurchaseDate)
+	mileage, _ := utils.MeterAt(points, asOf)
+	return math.Max(mileage-inService, 0)
+}
+
+// vehicleDepreciationParams собирает параметры амортизации транспорта на дату.
+// Незаданные у транспорта метод, срок службы и ликвидационная стоимость берутся из настроек компании,
+// а при их отсутствии — прямолинейный метод, 10 лет для траков и 15 лет для трейлеров без ликвидационной стоимости.
+func vehicleDepreciationParams(vehicle *models.Vehicle, defaults models.DepreciationSettings, points []utils.MeterPoint, asOf time.Time) utils.DepreciationParams {
+	params := utils.DepreciationParams{
+		Method:          vehicle.DepreciationMethod,
+		Cost:            vehicle.PurchasePrice,
+		UsefulLifeYears: vehicle.UsefulLifeYears,
+		LifetimeUnits:   vehicle.LifetimeMiles,
+		AnnualUnits:     vehicle.AnnualMiles,
+		UnitsUsed:       vehicleUnitsUsed(vehicle, points, asOf),
+	}
+
+	if params.Method == "" {
+		params.Method = defaults.Method
+	}
+	if params.Method == "" {
+		params.Method = utils.DefaultDepreciationMethod
+	}
+
+	if params.UsefulLifeYears <= 0 {
+		if vehicle.Type == "trailer" {
+			params.UsefulLifeYears = defaults.TrailerUsefulLifeYears
+			if params.UsefulLifeYears <= 0 {
+				params.UsefulLifeYears = utils.DefaultTrailerUsefulLifeYears
+			}
+		} else {
+			params.UsefulLifeYears = defaults.TruckUsefulLifeYears
+			if params.UsefulLifeYears <= 0 {
+				params.UsefulLifeYears = utils.DefaultTruckUsefulLifeYears
+			}
+		}
+	}
+
+	if vehicle.SalvageValue != nil {
+		params.SalvageValue = *vehicle.SalvageValue
+	} else {
+		params.SalvageValue = vehicle.PurchasePrice * defaults.SalvagePercent / 100
+	}
+
+	return params
+}
+
+// vehicleDepreciation рассчитывает амортизацию транспорта на текущую дату и годовой график.
+// Для выбывшего транспорта амортизация останавливается на дату выбытия.
+func vehicleDepreciation(vehicle *models.Vehicle, defaults models.DepreciationSettings, points []utils.MeterPoint) utils.DepreciationResult {
+	return vehicleDepreciationAt(vehicle, defaults, points, time.Now())
+}
+
+// vehicleDepreciationAt рассчитывает амортизацию транспорта на дату
+func vehicleDepreciationAt(vehicle *models.Vehicle, defaults models.DepreciationSettings, points []utils.MeterPoint, asOf time.Time) utils.DepreciationResult {
+	if vehicle.Disposal != nil && vehicle.Disposal.DisposalDate.Before(asOf) {
+		asOf = vehicle.Disposal.DisposalDate
+	}
+	ageYears := utils.CalculateVehicleAgeAt(vehicle.PurchaseDate, asOf)
+	return utils.CalculateDepreciation(vehicleDepreciationParams(vehicle, defaults, points, asOf), ageYears)
+}
+
+// vehicleBookValue возвращает накопленную амортизацию и текущую стоимость транспорта вместе с улучшениями
+func vehicleBookValue(vehicle *models.Vehicle, defaults models.DepreciationSettings, improvements []models.CapitalImprovement, points []utils.MeterPoint) (float64, float64) {
+	value := vehicleAssetValueAt(vehicle, defaults, improvements, points, time.Now())
+	return value.Accumulated, value.CurrentValue
+}
+
+// companyDepreciationDefaults возвращает настройки амортизации компаний по их ID
+func companyDepreciationDefaults(companies []models.Company) map[primitive.ObjectID]models.DepreciationSettings {
+	defaults := map[primitive.ObjectID]models.DepreciationSettings{}
+	for _, company := range companies {
+		defaults[company.ID] = company.Depreciation
+	}
+	return defaults
+}
+
+// validateDepreciationSettings проверяет настройки амортизации компании
+func validateDepreciationSettings(settings *models.DepreciationSettings) string {
+	if settings.Method != "" && !utils.IsValidDepreciationMethod(settings.Method) {
+		return "Неверный метод амортизации"
+	}
+	if settings.TruckUsefulLifeYears < 0 || settings.TrailerUsefulLifeYears < 0 {
+		return "Неверный срок службы"
+	}
+	if settings.SalvagePercent < 0 || settings.SalvagePercent > 100 {
+		return "Неверный процент ликвидационной стоимости"
+	}
+	return ""
+}
+
+// validateVehicleDepreciation проверяет параметры амортизации транспорта
+func validateVehicleDepreciation(vehicle *models.Vehicle) string {
+	if vehicle.DepreciationMethod != "" && !utils.IsValidDepreciationMethod(vehicle.DepreciationMethod) {
+		return "Неверный метод амортизации"
+	}
+	if vehicle.UsefulLifeYears < 0 {
+		return "Неверный срок службы"
+	}
+	if vehicle.SalvageValue != nil && (*vehicle.SalvageValue < 0 || *vehicle.SalvageValue > vehicle.PurchasePrice) {
+		return "Ликвидационная стоимость должна быть от 0 до цены покупки"
+	}
+	if vehicle.LifetimeMiles < 0 || vehicle.AnnualMiles < 0 || vehicle.Mileage < 0 {
+		return "Неверный пробег"
+	}
+	if vehicle.DepreciationMethod == utils.DepreciationUnitsOfProduction && vehicle.LifetimeMiles <= 0 {
+		return "Для метода units_of_production укажите ожидаемый пробег за срок службы"
+	}
+	if vehicle.DepreciationMethod == utils.DepreciationUnitsOfProduction && vehicle.AnnualMiles <= 0 {
+		return "Для метода units_of_production укажите ожидаемый годовой пробег"
+	}
+	return ""
+}
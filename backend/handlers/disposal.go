@@ -0,0 +1,312 @@
+package handlers
+
+import (
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DisposeVehicleRequest struct {
+	DisposalType    string    `json:"disposal_type"`
+	DisposalDate    time.Time `json:"disposal_date"`
+	SalePrice       float64   `json:"sale_price"`
+	TradeInCredit   float64   `json:"trade_in_credit"`
+	SellingExpenses float64   `json:"selling_expenses"`
+	Buyer           string    `json:"buyer"`
+	Notes           string    `json:"notes"`
+	PayOffLoans     bool      `json:"pay_off_loans"`
+}
+
+type DisposalReportItem struct {
+	VehicleID     string  `json:"vehicle_id"`
+	VehicleName   string  `json:"vehicle_name"`
+	CompanyID     string  `json:"company_id"`
+	PurchaseDate  string  `json:"purchase_date"`
+	PurchasePrice float64 `json:"purchase_price"`
+	models.VehicleDisposal
+}
+
+type DisposalReportTotals struct {
+	Count                 int     `json:"count"`
+	AmountRealized        float64 `json:"amount_realized"`
+	BookGainLoss          float64 `json:"book_gain_loss"`
+	TaxGainLoss           float64 `json:"tax_gain_loss"`
+	DepreciationRecapture float64 `json:"depreciation_recapture"`
+	LoanPayoffs           float64 `json:"loan_payoffs"`
+}
+
+// DisposeVehicle оформляет выбытие транспорта: продажу, trade-in или списание.
+// Амортизация останавливается на дату выбытия, рассчитывается балансовая и налоговая прибыль/убыток,
+// залоги по кредитам погашаются (pay_off_loans) или выбытие требует подтверждения force=true.
+func (h *VehicleHandler) DisposeVehicle(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	vehicleID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+	}
+
+	var request DisposeVehicleRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if !utils.IsValidDisposalType(request.DisposalType) {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный вид выбытия"})
+	}
+	if request.SalePrice < 0 || request.TradeInCredit < 0 || request.SellingExpenses < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Суммы не могут быть отрицательными"})
+	}
+	if request.DisposalDate.IsZero() {
+		request.DisposalDate = time.Now()
+	}
+
+	var company models.Company
+	var vehicle models.Vehicle
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+	err = h.db.DB.Collection("vehicles").FindOne(context.TODO(), bson.M{
+		"_id":        vehicleID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&vehicle)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+	if err = h.db.DB.Collection("companies").FindOne(context.TODO(), bson.M{"_id": vehicle.CompanyID}).Decode(&company); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компании"})
+	}
+
+	if vehicle.Disposal != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Выбытие транспорта уже оформлено"})
+	}
+	if request.DisposalDate.Before(vehicle.PurchaseDate) {
+		return c.Status(400).JSON(fiber.Map{"error": "Дата выбытия раньше даты покупки"})
+	}
+
+	liens, err := vehicleLiens(h.db, vehicleID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения залогов"})
+	}
+	if hasUnreleasedLien(liens) && !request.PayOffLoans && c.Query("force") != "true" {
+		return c.Status(409).JSON(fiber.Map{
+			"error": "Транспорт находится в залоге, укажите pay_off_loans или подтвердите выбытие параметром force=true",
+			"liens": liens,
+		})
+	}
+
+	disposal := models.VehicleDisposal{
+		DisposalType:    request.DisposalType,
+		DisposalDate:    request.DisposalDate,
+		SalePrice:       request.SalePrice,
+		TradeInCredit:   request.TradeInCredit,
+		SellingExpenses: request.SellingExpenses,
+		Buyer:           request.Buyer,
+		Notes:           request.Notes,
+		LoanPayoffs:     []models.DisposalLoanPayoff{},
+		RecordedBy:      userObjectID,
+		RecordedAt:      time.Now(),
+	}
+
+	// Доля кредитов, обеспеченная выбывающим транспортом
+	loans := make([]*models.Loan, 0, len(liens))
+	for _, lien := range liens {
+		if lien.Released {
+			continue
+		}
+
+		payoff := models.DisposalLoanPayoff{LoanID: lien.LoanID, Lender: lien.Lender}
+		loan, err := findUserLoan(h.db, userObjectID, lien.LoanID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения кредита"})
+		}
+		if release, ok := calculateLienRelease(loan, vehicleID, request.DisposalDate); ok {
+			payoff.Amount = release.Total
+		}
+		loans = append(loans, loan)
+		disposal.LoanPayoffs = append(disposal.LoanPayoffs, payoff)
+	}
+
+	// Балансовая стоимость и налоговая база на дату выбытия вместе с улучшениями
+	vehicle.Disposal = &disposal
+	improvements, err := loadVehicleImprovements(h.db, []primitive.ObjectID{vehicle.CompanyID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения улучшений"})
+	}
+	readings, err := loadVehicleReadings(h.db, vehicleID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+	}
+	book := vehicleAssetValueAt(&vehicle, company.Depreciation, improvements[vehicleID], meterPoints(readings), request.DisposalDate)
+
+	taxVehicles, err := loadTaxVehicles(h.db, []primitive.ObjectID{vehicle.CompanyID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения транспорта"})
+	}
+	taxParams := vehicleTaxParams(&vehicle, midQuarterYears(taxVehicles))
+	disposalYear := request.DisposalDate.Year()
+	taxBasis, taxAccumulated := taxBasisAt(taxParams, disposalYear)
+	for i := range improvements[vehicleID] {
+		basis, accumulated := taxBasisAt(improvementTaxParams(&improvements[vehicleID][i], taxParams), disposalYear)
+		taxBasis += basis
+		taxAccumulated += accumulated
+	}
+
+	result := utils.CalculateDisposalGainLoss(request.SalePrice, request.TradeInCredit, request.SellingExpenses, book.CurrentValue, taxBasis, taxAccumulated)
+	disposal.AmountRealized = result.AmountRealized
+	disposal.BookValue = result.BookValue
+	disposal.BookGainLoss = result.BookGainLoss
+	disposal.TaxBasis = result.TaxBasis
+	disposal.TaxGainLoss = result.TaxGainLoss
+	disposal.DepreciationRecapture = result.DepreciationRecapture
+
+	// Выбытие записывается до погашения кредитов: повторный запрос не проведет платежи второй раз,
+	// а незавершенное погашение видно в loan_payoffs (recorded: false)
+	vehicle.Status = "sold"
+	vehicle.UpdatedAt = time.Now()
+	vehiclesCollection := h.db.DB.Collection("vehicles")
+	update, err := vehiclesCollection.UpdateOne(context.TODO(), bson.M{"_id": vehicleID, "disposal": bson.M{"$exists": false}}, bson.M{"$set": bson.M{
+		"disposal":   disposal,
+		"status":     vehicle.Status,
+		"updated_at": vehicle.UpdatedAt,
+	}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения выбытия"})
+	}
+	if update.MatchedCount == 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Выбытие транспорта уже оформлено"})
+	}
+
+	if request.PayOffLoans {
+		for i, loan := range loans {
+			release, err := releaseLien(h.db, loan, vehicleID, request.DisposalDate, true, userObjectID)
+			if err == nil {
+				_, err = refreshLoanDelinquency(h.db, loan, time.Now())
+			}
+			if err != nil {
+				h.saveDisposalPayoffs(vehicleID, disposal.LoanPayoffs)
+				return c.Status(500).JSON(fiber.Map{
+					"error":    "Выбытие сохранено, но погашение кредита не завершено — снимите оставшиеся залоги по кредитам",
+					"disposal": disposal,
+				})
+			}
+			disposal.LoanPayoffs[i].Amount = release.Total
+			disposal.LoanPayoffs[i].Recorded = true
+		}
+		if err := h.saveDisposalPayoffs(vehicleID, disposal.LoanPayoffs); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения выбытия"})
+		}
+	}
+
+	return c.JSON(vehicle)
+}
+
+// saveDisposalPayoffs сохраняет состояние погашения кредитов по выбывшему транспорту
+func (h *VehicleHandler) saveDisposalPayoffs(vehicleID primitive.ObjectID, payoffs []models.DisposalLoanPayoff) error {
+	_, err := h.db.DB.Collection("vehicles").UpdateOne(context.TODO(), bson.M{"_id": vehicleID}, bson.M{"$set": bson.M{
+		"disposal.loan_payoffs": payoffs,
+		"updated_at":            time.Now(),
+	}})
+	return err
+}
+
+// GetDisposals возвращает отчет о выбытии транспорта с итогами прибыли/убытка (year — по году выбытия)
+func (h *VehicleHandler) GetDisposals(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		companyIDs = filterOwnedIDs(companyIDs, companyObjectID)
+	}
+
+	filter := bson.M{
+		"company_id": bson.M{"$in": companyIDs},
+		"disposal":   bson.M{"$exists": true},
+	}
+	if year := c.Query("year"); year != "" {
+		yearValue, err := strconv.Atoi(year)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный год"})
+		}
+		filter["disposal.disposal_date"] = bson.M{
+			"$gte": time.Date(yearValue, 1, 1, 0, 0, 0, 0, time.UTC),
+			"$lt":  time.Date(yearValue+1, 1, 1, 0, 0, 0, 0, time.UTC),
+		}
+	}
+
+	cursor, err := h.db.DB.Collection("vehicles").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"disposal.disposal_date": 1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения транспорта"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var vehicles []models.Vehicle
+	if err = cursor.All(context.TODO(), &vehicles); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования транспорта"})
+	}
+
+	items := []DisposalReportItem{}
+	var totals DisposalReportTotals
+	for i := range vehicles {
+		disposal := vehicles[i].Disposal
+		items = append(items, DisposalReportItem{
+			VehicleID:       vehicles[i].ID.Hex(),
+			VehicleName:     vehicleTitle(&vehicles[i]),
+			CompanyID:       vehicles[i].CompanyID.Hex(),
+			PurchaseDate:    vehicles[i].PurchaseDate.Format("2006-01-02"),
+			PurchasePrice:   vehicles[i].PurchasePrice,
+			VehicleDisposal: *disposal,
+		})
+
+		totals.Count++
+		totals.AmountRealized += disposal.AmountRealized
+		totals.BookGainLoss += disposal.BookGainLoss
+		totals.TaxGainLoss += disposal.TaxGainLoss
+		totals.DepreciationRecapture += disposal.DepreciationRecapture
+		for _, payoff := range disposal.LoanPayoffs {
+			totals.LoanPayoffs += payoff.Amount
+		}
+	}
+
+	totals.AmountRealized = math.Round(totals.AmountRealized*100) / 100
+	totals.BookGainLoss = math.Round(totals.BookGainLoss*100) / 100
+	totals.TaxGainLoss = math.Round(totals.TaxGainLoss*100) / 100
+	totals.DepreciationRecapture = math.Round(totals.DepreciationRecapture*100) / 100
+	totals.LoanPayoffs = math.Round(totals.LoanPayoffs*100) / 100
+
+	return c.JSON(fiber.Map{"disposals": items, "totals": totals})
+}
@@ -0,0 +1,411 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/storage"
+	"business-schedule-backend/utils"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DocumentHandler struct {
+	db      *database.Database
+	store   storage.Storage
+	maxSize int64
+}
+
+func NewDocumentHandler(db *database.Database, store storage.Storage, maxSize int64) *DocumentHandler {
+	return &DocumentHandler{db: db, store: store, maxSize: maxSize}
+}
+
+// documentEntityCompany возвращает компанию записи, к которой прикладывается документ,
+// проверяя что запись принадлежит одной из компаний пользователя
+func documentEntityCompany(db *database.Database, companyIDs []primitive.ObjectID, entityType string, entityID primitive.ObjectID) (primitive.ObjectID, error) {
+	switch entityType {
+	case utils.DocumentEntityCompany:
+		if len(filterOwnedIDs(companyIDs, entityID)) == 0 {
+			return primitive.NilObjectID, errors.New("company not owned")
+		}
+		return entityID, nil
+
+	case utils.DocumentEntityPayment:
+		// Платеж принадлежит компании через кредит
+		var payment models.Payment
+		if err := db.DB.Collection("payments").FindOne(context.TODO(), bson.M{"_id": entityID}).Decode(&payment); err != nil {
+			return primitive.NilObjectID, err
+		}
+		entityType, entityID = utils.DocumentEntityLoan, payment.LoanID
+	}
+
+	collection, ok := utils.DocumentEntityCollections[entityType]
+	if !ok {
+		return primitive.NilObjectID, errors.New("unknown entity type")
+	}
+
+	var owner struct {
+		CompanyID primitive.ObjectID `bson:"company_id"`
+	}
+	err := db.DB.Collection(collection).FindOne(context.TODO(), bson.M{
+		"_id":        entityID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&owner)
+	return owner.CompanyID, err
+}
+
+// storeUploadedDocument проверяет размер и тип файла, сохраняет содержимое в хранилище
+// и записывает метаданные с контрольной суммой. Возвращает HTTP-статус и текст ошибки.
+func storeUploadedDocument(db *database.Database, store storage.Storage, maxSize int64, fileHeader *multipart.FileHeader, document *models.Document) (int, string) {
+	if maxSize <= 0 {
+		maxSize = utils.DefaultDocumentMaxSize
+	}
+	if fileHeader.Size > maxSize {
+		return 413, fmt.Sprintf("Размер файла превышает %d МБ", maxSize>>20)
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		return 400, "Не удалось прочитать файл"
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxSize+1))
+	if err != nil {
+		return 400, "Не удалось прочитать файл"
+	}
+	if len(data) == 0 {
+		return 400, "Файл пустой"
+	}
+	if int64(len(data)) > maxSize {
+		return 413, fmt.Sprintf("Размер файла превышает %d МБ", maxSize>>20)
+	}
+
+	// Тип определяется по содержимому, а не по заголовку клиента
+	contentType := http.DetectContentType(data)
+	if !utils.AllowedDocumentTypes[contentType] {
+		return 415, "Недопустимый тип файла: разрешены PDF и изображения"
+	}
+
+	sum := sha256.Sum256(data)
+
+	document.ID = primitive.NewObjectID()
+	document.FileName = fileHeader.Filename
+	document.ContentType = contentType
+	document.Size = int64(len(data))
+	document.SHA256 = hex.EncodeToString(sum[:])
+	document.Storage = store.Name()
+	document.StorageKey = document.ID.Hex()
+	document.CreatedAt = time.Now()
+
+	if err := store.Save(context.TODO(), document.StorageKey, bytes.NewReader(data)); err != nil {
+		return 500, "Ошибка сохранения файла"
+	}
+
+	if _, err := db.DB.Collection("documents").InsertOne(context.TODO(), document); err != nil {
+		store.Delete(context.TODO(), document.StorageKey)
+		return 500, "Ошибка сохранения документа"
+	}
+
+	return 0, ""
+}
+
+// sendStoredDocument отдает содержимое документа из хранилища
+func sendStoredDocument(c *fiber.Ctx, store storage.Storage, document *models.Document) error {
+	reader, err := store.Open(context.TODO(), document.StorageKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		return c.Status(404).JSON(fiber.Map{"error": "Файл не найден в хранилище"})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка чтения файла"})
+	}
+
+	c.Set("Content-Type", document.ContentType)
+	c.Set(fiber.HeaderContentDisposition, attachmentDisposition(document.FileName))
+	c.Set("ETag", `"`+document.SHA256+`"`)
+	c.Set("X-Checksum-SHA256", document.SHA256)
+	return c.SendStream(reader, int(document.Size))
+}
+
+// attachmentDisposition формирует Content-Disposition по RFC 6266: ASCII-имя для старых клиентов
+// и filename* в UTF-8 (RFC 5987) для имен с кириллицей и другими не-ASCII символами
+func attachmentDisposition(fileName string) string {
+	var fallback, encoded strings.Builder
+	for _, r := range fileName {
+		if r < 0x20 || r > 0x7e || r == '"' || r == '\\' {
+			fallback.WriteByte('_')
+		} else {
+			fallback.WriteRune(r)
+		}
+	}
+	for _, b := range []byte(fileName) {
+		if b < 0x80 && (b >= 'a' && b <= 'z' || b >= 'A' && b <= 'Z' || b >= '0' && b <= '9' || strings.IndexByte("!#$&+-.^_`|~", b) >= 0) {
+			encoded.WriteByte(b)
+		} else {
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, fallback.String(), encoded.String())
+}
+
+// deleteStoredDocuments удаляет документы по фильтру вместе с содержимым в хранилище
+func deleteStoredDocuments(db *database.Database, store storage.Storage, filter bson.M) (int, error) {
+	cursor, err := db.DB.Collection("documents").Find(context.TODO(), filter)
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var documents []models.Document
+	if err = cursor.All(context.TODO(), &documents); err != nil {
+		return 0, err
+	}
+
+	for _, document := range documents {
+		if err := store.Delete(context.TODO(), document.StorageKey); err != nil {
+			return 0, err
+		}
+		if _, err := db.DB.Collection("documents").DeleteOne(context.TODO(), bson.M{"_id": document.ID}); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(documents), nil
+}
+
+// deleteRecordDocuments удаляет документы, приложенные к записям коллекции по фильтру
+func deleteRecordDocuments(db *database.Database, store storage.Storage, entityType string, filter bson.M) error {
+	ids, err := db.DB.Collection(utils.DocumentEntityCollections[entityType]).Distinct(context.TODO(), "_id", filter)
+	if err != nil || len(ids) == 0 {
+		return err
+	}
+	_, err = deleteStoredDocuments(db, store, bson.M{"entity_type": entityType, "entity_id": bson.M{"$in": ids}})
+	return err
+}
+
+// findUserDocument находит документ, принадлежащий одной из компаний пользователя
+func findUserDocument(db *database.Database, userObjectID, documentID primitive.ObjectID) (*models.Document, error) {
+	companyIDs, err := getUserCompanyIDs(db, userObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	var document models.Document
+	err = db.DB.Collection("documents").FindOne(context.TODO(), bson.M{
+		"_id":        documentID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&document)
+	if err != nil {
+		return nil, err
+	}
+	return &document, nil
+}
+
+// GetDocuments возвращает документы с фильтрами company_id, entity_type, entity_id и category
+func (h *DocumentHandler) GetDocuments(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		filter["company_id"] = bson.M{"$in": filterOwnedIDs(companyIDs, companyObjectID)}
+	}
+	if entityType := c.Query("entity_type"); entityType != "" {
+		filter["entity_type"] = entityType
+	}
+	if entityID := c.Query("entity_id"); entityID != "" {
+		entityObjectID, err := primitive.ObjectIDFromHex(entityID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID записи"})
+		}
+		filter["entity_id"] = entityObjectID
+	}
+	if category := c.Query("category"); category != "" {
+		filter["category"] = category
+	}
+
+	cursor, err := h.db.DB.Collection("documents").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения документов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	documents := []models.Document{}
+	if err = cursor.All(context.TODO(), &documents); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	return c.JSON(documents)
+}
+
+// UploadDocument загружает файл (multipart: file, entity_type, entity_id, category, description)
+func (h *DocumentHandler) UploadDocument(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	document := models.Document{
+		EntityType:  c.FormValue("entity_type"),
+		Category:    c.FormValue("category"),
+		Description: c.FormValue("description"),
+		UploadedBy:  userObjectID,
+	}
+	if _, ok := utils.DocumentEntityCollections[document.EntityType]; !ok {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный тип записи"})
+	}
+	if document.Category == "" {
+		document.Category = utils.DocumentOther
+	}
+	if !utils.IsValidDocumentCategory(document.Category) {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверная категория документа"})
+	}
+
+	document.EntityID, err = primitive.ObjectIDFromHex(c.FormValue("entity_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID записи"})
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Файл не передан"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	document.CompanyID, err = documentEntityCompany(h.db, companyIDs, document.EntityType, document.EntityID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Запись не найдена"})
+	}
+
+	if status, msg := storeUploadedDocument(h.db, h.store, h.maxSize, fileHeader, &document); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	return c.Status(201).JSON(document)
+}
+
+// GetDocument возвращает метаданные документа
+func (h *DocumentHandler) GetDocument(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	documentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID документа"})
+	}
+
+	document, err := findUserDocument(h.db, userObjectID, documentID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Документ не найден"})
+	}
+
+	return c.JSON(document)
+}
+
+// DownloadDocument отдает содержимое документа; доступ — по принадлежности компании пользователю
+func (h *DocumentHandler) DownloadDocument(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	documentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID документа"})
+	}
+
+	document, err := findUserDocument(h.db, userObjectID, documentID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Документ не найден"})
+	}
+
+	return sendStoredDocument(c, h.store, document)
+}
+
+func (h *DocumentHandler) DeleteDocument(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	documentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID документа"})
+	}
+
+	document, err := findUserDocument(h.db, userObjectID, documentID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Документ не найден"})
+	}
+
+	if _, err := deleteStoredDocuments(h.db, h.store, bson.M{"_id": document.ID}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления документа"})
+	}
+
+	// Скан документа соответствия отвязывается от него
+	_, err = h.db.DB.Collection("compliance_items").UpdateMany(context.TODO(),
+		bson.M{"document_id": document.ID},
+		bson.M{"$unset": bson.M{"document_id": ""}},
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления документов соответствия"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Документ удален"})
+}
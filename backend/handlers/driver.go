@@ -0,0 +1,292 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/storage"
+	"business-schedule-backend/utils"
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type DriverHandler struct {
+	db    *database.Database
+	store storage.Storage
+}
+
+func NewDriverHandler(db *database.Database, store storage.Storage) *DriverHandler {
+	return &DriverHandler{db: db, store: store}
+}
+
+func driverName(driver *models.Driver) string {
+	return driver.FirstName + " " + driver.LastName
+}
+
+// setDriverStatuses рассчитывает статусы CDL и медицинской карты на дату
+func setDriverStatuses(driver *models.Driver, asOf time.Time) {
+	if !driver.CDLExpiry.IsZero() {
+		driver.CDLStatus, _ = utils.ComplianceStatus(driver.CDLExpiry, asOf, 0)
+	}
+	if !driver.MedicalCardExpiry.IsZero() {
+		driver.MedicalStatus, _ = utils.ComplianceStatus(driver.MedicalCardExpiry, asOf, 0)
+	}
+}
+
+func validateDriver(driver *models.Driver) string {
+	if driver.FirstName == "" || driver.LastName == "" {
+		return "Не указано имя водителя"
+	}
+	if driver.CDLNumber == "" {
+		return "Не указан номер CDL"
+	}
+	if !utils.IsValidCDLClass(driver.CDLClass) {
+		return "Неверный класс CDL"
+	}
+	if driver.Status == "" {
+		driver.Status = utils.DriverActive
+	}
+	if !utils.IsValidDriverStatus(driver.Status) {
+		return "Неверный статус водителя"
+	}
+	if !utils.IsValidPayType(driver.PayType) {
+		return "Неверный вид оплаты"
+	}
+	if driver.PayRate < 0 {
+		return "Ставка не может быть отрицательной"
+	}
+	if driver.TerminationDate != nil && driver.TerminationDate.Before(driver.HireDate) {
+		return "Дата увольнения раньше даты приема"
+	}
+	return ""
+}
+
+func (h *DriverHandler) GetDrivers(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		filter["company_id"] = bson.M{"$in": filterOwnedIDs(companyIDs, companyObjectID)}
+	}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	cursor, err := h.db.DB.Collection("drivers").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"last_name": 1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения водителей"})
+	}
+	defer cursor.Close(context.TODO())
+
+	drivers := []models.Driver{}
+	if err = cursor.All(context.TODO(), &drivers); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	asOf := time.Now()
+	for i := range drivers {
+		setDriverStatuses(&drivers[i], asOf)
+	}
+
+	return c.JSON(drivers)
+}
+
+func (h *DriverHandler) CreateDriver(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var driver models.Driver
+	if err := c.BodyParser(&driver); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := validateDriver(&driver); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	// Проверяем что компания принадлежит пользователю
+	var company models.Company
+	err = h.db.DB.Collection("companies").FindOne(context.TODO(), bson.M{
+		"_id":     driver.CompanyID,
+		"user_id": userObjectID,
+	}).Decode(&company)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	driver.CreatedAt = time.Now()
+	driver.UpdatedAt = time.Now()
+
+	result, err := h.db.DB.Collection("drivers").InsertOne(context.TODO(), driver)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания водителя"})
+	}
+
+	driver.ID = result.InsertedID.(primitive.ObjectID)
+	setDriverStatuses(&driver, time.Now())
+	return c.Status(201).JSON(driver)
+}
+
+func (h *DriverHandler) UpdateDriver(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	driverID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID водителя"})
+	}
+
+	var driver models.Driver
+	if err := c.BodyParser(&driver); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := validateDriver(&driver); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	// Проверяем что компания принадлежит пользователю
+	var company models.Company
+	err = h.db.DB.Collection("companies").FindOne(context.TODO(), bson.M{
+		"_id":     driver.CompanyID,
+		"user_id": userObjectID,
+	}).Decode(&company)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	driver.ID = primitive.NilObjectID
+	driver.UpdatedAt = time.Now()
+
+	var existing models.Driver
+	err = h.db.DB.Collection("drivers").FindOne(context.TODO(), bson.M{"_id": driverID, "company_id": driver.CompanyID}).Decode(&existing)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Водитель не найден"})
+	}
+	driver.CreatedAt = existing.CreatedAt
+
+	// При увольнении действующие закрепления водителя закрываются датой увольнения
+	if driver.Status == utils.DriverTerminated && driver.TerminationDate == nil {
+		now := time.Now()
+		driver.TerminationDate = &now
+	}
+	if driver.TerminationDate != nil {
+		later, err := closeDriverAssignments(h.db, driverID, *driver.TerminationDate)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка закрытия закреплений"})
+		}
+		if later > 0 {
+			return c.Status(409).JSON(fiber.Map{"error": "У водителя есть закрепления после даты увольнения"})
+		}
+	}
+
+	_, err = h.db.DB.Collection("drivers").ReplaceOne(context.TODO(), bson.M{"_id": driverID}, driver)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления водителя"})
+	}
+
+	driver.ID = driverID
+	setDriverStatuses(&driver, time.Now())
+	return c.JSON(driver)
+}
+
+// DeleteDriver удаляет водителя без истории закреплений; иначе водителя следует уволить (status=terminated)
+func (h *DriverHandler) DeleteDriver(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	driverID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID водителя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	count, err := h.db.DB.Collection("assignments").CountDocuments(context.TODO(), bson.M{
+		"driver_id":  driverID,
+		"company_id": bson.M{"$in": companyIDs},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка проверки закреплений"})
+	}
+	if count > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "У водителя есть история закреплений, переведите его в статус terminated"})
+	}
+
+	count, err = h.db.DB.Collection("loads").CountDocuments(context.TODO(), bson.M{
+		"driver_id":  driverID,
+		"company_id": bson.M{"$in": companyIDs},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка проверки рейсов"})
+	}
+	if count > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "У водителя есть рейсы, переведите его в статус terminated"})
+	}
+
+	result, err := h.db.DB.Collection("drivers").DeleteOne(context.TODO(), bson.M{
+		"_id":        driverID,
+		"company_id": bson.M{"$in": companyIDs},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления водителя"})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Водитель не найден"})
+	}
+
+	// Удаляем документы водителя вместе с файлами в хранилище
+	_, err = deleteStoredDocuments(h.db, h.store, bson.M{"entity_type": utils.DocumentEntityDriver, "entity_id": driverID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления документов"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Водитель удален"})
+}
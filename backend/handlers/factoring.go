@@ -0,0 +1,984 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type FactoringHandler struct {
+	db *database.Database
+}
+
+func NewFactoringHandler(db *database.Database) *FactoringHandler {
+	return &FactoringHandler{db: db}
+}
+
+// FactorInvoiceRequest — передача отправленного счета фактору
+type FactorInvoiceRequest struct {
+	InvoiceID   primitive.ObjectID `json:"invoice_id"`
+	FactorID    primitive.ObjectID `json:"factor_id"`
+	FundedDate  time.Time          `json:"funded_date"`
+	AdvanceRate float64            `json:"advance_rate"`
+	Notes       string             `json:"notes"`
+}
+
+// FactoringEventRequest — инкассация, выплата резерва или регресс на дату
+type FactoringEventRequest struct {
+	Date   time.Time `json:"date"`
+	Amount *float64  `json:"amount"`
+}
+
+type FactorCostTotals struct {
+	FactorID         string  `json:"factor_id"`
+	FactorName       string  `json:"factor_name"`
+	InvoicesFactored int     `json:"invoices_factored"`
+	FactoredVolume   float64 `json:"factored_volume"`
+	Advances         float64 `json:"advances"`
+	Fees             float64 `json:"fees"`
+	Chargebacks      float64 `json:"chargebacks"`
+	ReserveHeld      float64 `json:"reserve_held"`
+	ReserveDue       float64 `json:"reserve_due"`
+	RecourseDue      float64 `json:"recourse_due"`
+}
+
+type FactoringCostItem struct {
+	CompanyID     string             `json:"company_id"`
+	CompanyName   string             `json:"company_name"`
+	FactorTotals  FactorCostTotals   `json:"factoring"`
+	Factors       []FactorCostTotals `json:"factors"`
+	FeeRate       float64            `json:"fee_rate"`
+	LoanInterest  float64            `json:"loan_interest"`
+	FinancingCost float64            `json:"financing_cost"`
+}
+
+type FactoringCostReport struct {
+	From      string              `json:"from"`
+	To        string              `json:"to"`
+	Companies []FactoringCostItem `json:"companies"`
+}
+
+// validateFactoringTerms проверяет условия факторинга и подставляет срок регресса по умолчанию
+func validateFactoringTerms(terms *models.FactoringTerms) string {
+	if terms.AdvanceRate <= 0 || terms.AdvanceRate > 100 {
+		return "Ставка аванса должна быть от 0 до 100%"
+	}
+	if terms.FeePercent < 0 || terms.AdditionalFeePercent < 0 || terms.FeePercent >= 100 {
+		return "Неверная комиссия фактора"
+	}
+	if terms.FeeDays < 0 || terms.AdditionalFeeDays < 0 || terms.RecourseDays < 0 {
+		return "Сроки не могут быть отрицательными"
+	}
+	if terms.AdditionalFeePercent > 0 && terms.AdditionalFeeDays == 0 {
+		return "Для дополнительной комиссии нужен период в днях"
+	}
+	if terms.Recourse && terms.RecourseDays == 0 {
+		terms.RecourseDays = utils.DefaultRecourseDays
+	}
+	return ""
+}
+
+// factoredInvoiceFee рассчитывает комиссию фактора по счету за период с даты финансирования
+func factoredInvoiceFee(item *models.FactoredInvoice, date time.Time) float64 {
+	days := utils.DaysUntil(date, item.FundedDate)
+	if days < 0 {
+		days = 0
+	}
+	return utils.FactoringFee(item.FaceAmount, item.Terms.FeePercent, item.Terms.FeeDays,
+		item.Terms.AdditionalFeePercent, item.Terms.AdditionalFeeDays, days)
+}
+
+// setFactoringStatus заполняет срок финансирования, начисленную комиссию и признак регресса для открытых счетов
+func setFactoringStatus(item *models.FactoredInvoice, asOf time.Time) {
+	if item.Status != utils.FactoringFunded {
+		return
+	}
+	item.DaysOutstanding = utils.DaysUntil(asOf, item.FundedDate)
+	if item.DaysOutstanding < 0 {
+		item.DaysOutstanding = 0
+	}
+	item.AccruedFee = factoredInvoiceFee(item, asOf)
+	item.RecourseDue = item.Terms.Recourse && item.DaysOutstanding > item.Terms.RecourseDays
+}
+
+// eventDate возвращает дату операции (по умолчанию сегодня) без времени
+func eventDate(date time.Time) time.Time {
+	if date.IsZero() {
+		date = time.Now()
+	}
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// findUserFactoredInvoice находит факторинг счета, принадлежащий одной из компаний пользователя
+func findUserFactoredInvoice(db *database.Database, userObjectID, id primitive.ObjectID) (*models.FactoredInvoice, error) {
+	companyIDs, err := getUserCompanyIDs(db, userObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	var item models.FactoredInvoice
+	err = db.DB.Collection("factored_invoices").FindOne(context.TODO(), bson.M{
+		"_id":        id,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// GetFactors возвращает факторинговые компании. Фильтр: company_id
+func (h *FactoringHandler) GetFactors(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		companyIDs = filterOwnedIDs(companyIDs, companyObjectID)
+	}
+
+	cursor, err := h.db.DB.Collection("factoring_companies").Find(context.TODO(),
+		bson.M{"company_id": bson.M{"$in": companyIDs}}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения факторов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	factors := []models.FactoringCompany{}
+	if err = cursor.All(context.TODO(), &factors); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	return c.JSON(factors)
+}
+
+func (h *FactoringHandler) CreateFactor(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var factor models.FactoringCompany
+	if err := c.BodyParser(&factor); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+	factor.Name = strings.TrimSpace(factor.Name)
+	if factor.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Не указано название фактора"})
+	}
+	if msg := validateFactoringTerms(&factor.Terms); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	count, err := h.db.DB.Collection("companies").CountDocuments(context.TODO(), bson.M{"_id": factor.CompanyID, "user_id": userObjectID})
+	if err != nil || count == 0 {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	factor.ID = primitive.NilObjectID
+	factor.CreatedBy = userObjectID
+	factor.CreatedAt = time.Now()
+	factor.UpdatedAt = time.Now()
+
+	result, err := h.db.DB.Collection("factoring_companies").InsertOne(context.TODO(), factor)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания фактора"})
+	}
+
+	factor.ID = result.InsertedID.(primitive.ObjectID)
+	return c.Status(201).JSON(factor)
+}
+
+// UpdateFactor обновляет профиль фактора; уже профинансированные счета сохраняют свои условия
+func (h *FactoringHandler) UpdateFactor(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	factorID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID фактора"})
+	}
+
+	var factor models.FactoringCompany
+	if err := c.BodyParser(&factor); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+	factor.Name = strings.TrimSpace(factor.Name)
+	if factor.Name == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Не указано название фактора"})
+	}
+	if msg := validateFactoringTerms(&factor.Terms); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	var updated models.FactoringCompany
+	err = h.db.DB.Collection("factoring_companies").FindOneAndUpdate(context.TODO(),
+		bson.M{"_id": factorID, "company_id": bson.M{"$in": companyIDs}},
+		bson.M{"$set": bson.M{
+			"name":         factor.Name,
+			"contact_name": factor.ContactName,
+			"phone":        factor.Phone,
+			"email":        factor.Email,
+			"terms":        factor.Terms,
+			"notes":        factor.Notes,
+			"updated_at":   time.Now(),
+		}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&updated)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Фактор не найден"})
+	}
+
+	return c.JSON(updated)
+}
+
+func (h *FactoringHandler) DeleteFactor(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	factorID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID фактора"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	count, err := h.db.DB.Collection("factoring_companies").CountDocuments(context.TODO(), bson.M{
+		"_id":        factorID,
+		"company_id": bson.M{"$in": companyIDs},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения фактора"})
+	}
+	if count == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Фактор не найден"})
+	}
+
+	count, err = h.db.DB.Collection("factored_invoices").CountDocuments(context.TODO(), bson.M{"factor_id": factorID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка проверки истории факторинга"})
+	}
+	if count > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "У фактора есть история счетов, удаление невозможно"})
+	}
+
+	if _, err := h.db.DB.Collection("factoring_companies").DeleteOne(context.TODO(), bson.M{"_id": factorID}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления фактора"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Фактор удален"})
+}
+
+// GetFactoredInvoices возвращает счета в факторинге. Фильтры: company_id, factor_id, status, recourse_due=true
+func (h *FactoringHandler) GetFactoredInvoices(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		companyIDs = filterOwnedIDs(companyIDs, companyObjectID)
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	if factorID := c.Query("factor_id"); factorID != "" {
+		factorObjectID, err := primitive.ObjectIDFromHex(factorID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID фактора"})
+		}
+		filter["factor_id"] = factorObjectID
+	}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+	recourseOnly := c.Query("recourse_due") == "true"
+	if recourseOnly {
+		filter["status"] = utils.FactoringFunded
+	}
+
+	cursor, err := h.db.DB.Collection("factored_invoices").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"funded_date": -1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения счетов в факторинге"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var items []models.FactoredInvoice
+	if err = cursor.All(context.TODO(), &items); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	factorNames := map[primitive.ObjectID]string{}
+	factorsCursor, err := h.db.DB.Collection("factoring_companies").Find(context.TODO(), bson.M{"company_id": bson.M{"$in": companyIDs}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения факторов"})
+	}
+	defer factorsCursor.Close(context.TODO())
+	var factors []models.FactoringCompany
+	if err = factorsCursor.All(context.TODO(), &factors); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+	for _, factor := range factors {
+		factorNames[factor.ID] = factor.Name
+	}
+
+	asOf := time.Now()
+	result := []models.FactoredInvoice{}
+	for i := range items {
+		setFactoringStatus(&items[i], asOf)
+		if recourseOnly && !items[i].RecourseDue {
+			continue
+		}
+		items[i].FactorName = factorNames[items[i].FactorID]
+		result = append(result, items[i])
+	}
+
+	return c.JSON(result)
+}
+
+// FactorInvoice передает отправленный неоплаченный счет фактору: аванс по ставке фактора, остаток — в резерв
+func (h *FactoringHandler) FactorInvoice(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var req FactorInvoiceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	invoice, err := findUserInvoice(h.db, userObjectID, req.InvoiceID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Счет не найден"})
+	}
+
+	var factor models.FactoringCompany
+	err = h.db.DB.Collection("factoring_companies").FindOne(context.TODO(), bson.M{"_id": req.FactorID, "company_id": invoice.CompanyID}).Decode(&factor)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Фактор не найден в компании счета"})
+	}
+
+	if invoice.Status != utils.InvoiceSent {
+		return c.Status(409).JSON(fiber.Map{"error": "Фактору передается только отправленный неоплаченный счет"})
+	}
+	if invoice.AmountPaid > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "По счету уже есть оплаты"})
+	}
+	if invoice.FactorID != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Счет уже передан фактору"})
+	}
+
+	terms := factor.Terms
+	if req.AdvanceRate != 0 {
+		terms.AdvanceRate = req.AdvanceRate
+	}
+	if msg := validateFactoringTerms(&terms); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	fundedDate := eventDate(req.FundedDate)
+	if fundedDate.Before(invoice.InvoiceDate) {
+		return c.Status(400).JSON(fiber.Map{"error": "Дата финансирования раньше даты счета"})
+	}
+
+	advance, reserve := utils.FactoringAdvance(invoice.Total, terms.AdvanceRate)
+	item := models.FactoredInvoice{
+		CompanyID:     invoice.CompanyID,
+		FactorID:      factor.ID,
+		InvoiceID:     invoice.ID,
+		InvoiceNumber: invoice.InvoiceNumber,
+		BillTo:        invoice.BillTo,
+		Terms:         terms,
+		FaceAmount:    invoice.Total,
+		AdvanceAmount: advance,
+		ReserveAmount: reserve,
+		FundedDate:    fundedDate,
+		Status:        utils.FactoringFunded,
+		Notes:         req.Notes,
+		CreatedBy:     userObjectID,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+
+	// Счет закрепляется за фактором условно, чтобы параллельная передача не прошла дважды
+	updated, err := h.db.DB.Collection("invoices").UpdateOne(context.TODO(),
+		bson.M{"_id": invoice.ID, "factor_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"factor_id": factor.ID, "updated_at": time.Now()}},
+	)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления счета"})
+	}
+	if updated.ModifiedCount == 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Счет уже передан фактору"})
+	}
+
+	result, err := h.db.DB.Collection("factored_invoices").InsertOne(context.TODO(), item)
+	if err != nil {
+		h.db.DB.Collection("invoices").UpdateOne(context.TODO(), bson.M{"_id": invoice.ID}, bson.M{"$unset": bson.M{"factor_id": ""}})
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения факторинга"})
+	}
+
+	item.ID = result.InsertedID.(primitive.ObjectID)
+	item.FactorName = factor.Name
+	setFactoringStatus(&item, time.Now())
+	return c.Status(201).JSON(item)
+}
+
+// CollectFactoredInvoice фиксирует оплату брокера фактору: рассчитывает комиссию за срок финансирования
+// и резерв к возврату, записывает оплату счета (недоплата по факторингу без регресса списывается со счета)
+func (h *FactoringHandler) CollectFactoredInvoice(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID факторинга"})
+	}
+
+	var req FactoringEventRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	item, err := findUserFactoredInvoice(h.db, userObjectID, itemID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Счет в факторинге не найден"})
+	}
+	if item.Status != utils.FactoringFunded {
+		return c.Status(409).JSON(fiber.Map{"error": "Счет уже закрыт у фактора"})
+	}
+
+	date := eventDate(req.Date)
+	if date.Before(item.FundedDate) {
+		return c.Status(400).JSON(fiber.Map{"error": "Дата оплаты раньше даты финансирования"})
+	}
+	amount := item.FaceAmount
+	if req.Amount != nil {
+		amount = roundMoney(*req.Amount)
+	}
+	if amount <= 0 || amount > item.FaceAmount+0.005 {
+		return c.Status(400).JSON(fiber.Map{"error": "Сумма оплаты должна быть больше нуля и не больше суммы счета"})
+	}
+
+	var factor models.FactoringCompany
+	if err := h.db.DB.Collection("factoring_companies").FindOne(context.TODO(), bson.M{"_id": item.FactorID}).Decode(&factor); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения фактора"})
+	}
+
+	// Недоплата брокера уменьшает резерв к возврату. Если оплата не покрывает аванс и комиссию,
+	// резерв равен нулю, а недостача при факторинге с регрессом возмещается фактору перевозчиком.
+	// При регрессе недоплаченный остаток счета снова становится дебиторской задолженностью брокера
+	// перед перевозчиком (счет возвращается в статус sent); без регресса риск несет фактор,
+	// и остаток списывается — счет закрывается оплаченной суммой
+	original := *item
+	item.Status = utils.FactoringCollected
+	item.CollectedDate = date
+	item.CollectedAmount = amount
+	item.Fee = factoredInvoiceFee(item, date)
+	item.ReserveDue = roundMoney(amount - item.AdvanceAmount - item.Fee)
+	if item.ReserveDue < 0 {
+		if item.Terms.Recourse {
+			item.ChargebackDate = date
+			item.ChargebackAmount = -item.ReserveDue
+		}
+		item.ReserveDue = 0
+	}
+	item.UpdatedAt = time.Now()
+
+	// Факторинг закрывается условно до записи оплаты, чтобы параллельный или повторный запрос не записал ее дважды
+	replaced, err := h.db.DB.Collection("factored_invoices").ReplaceOne(context.TODO(),
+		bson.M{"_id": item.ID, "status": utils.FactoringFunded}, item)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления факторинга"})
+	}
+	if replaced.MatchedCount == 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "Счет уже закрыт у фактора"})
+	}
+
+	payment := models.InvoicePayment{
+		ID:          primitive.NewObjectID(),
+		InvoiceID:   item.InvoiceID,
+		CompanyID:   item.CompanyID,
+		PaymentDate: date,
+		Amount:      amount,
+		Method:      utils.InvoicePaymentFactoring,
+		Reference:   factor.Name,
+		CreatedBy:   userObjectID,
+		CreatedAt:   time.Now(),
+	}
+	if _, err := h.db.DB.Collection("invoice_payments").InsertOne(context.TODO(), payment); err != nil {
+		h.rollbackCollect(&original, primitive.NilObjectID)
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения оплаты"})
+	}
+
+	var invoice models.Invoice
+	if err := h.db.DB.Collection("invoices").FindOne(context.TODO(), bson.M{"_id": item.InvoiceID}).Decode(&invoice); err != nil {
+		h.rollbackCollect(&original, payment.ID)
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения счета"})
+	}
+
+	update := bson.M{"$unset": bson.M{"factor_id": ""}}
+	if shortfall := roundMoney(item.FaceAmount - amount); shortfall > 0 && !item.Terms.Recourse {
+		invoice.WrittenOff = shortfall
+		invoice.WrittenOffDate = date
+		update["$set"] = bson.M{"written_off": invoice.WrittenOff, "written_off_date": invoice.WrittenOffDate}
+	}
+	if _, err := h.db.DB.Collection("invoices").UpdateOne(context.TODO(), bson.M{"_id": invoice.ID}, update); err != nil {
+		h.rollbackCollect(&original, payment.ID)
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления счета"})
+	}
+	if err := applyInvoicePayments(h.db, &invoice); err != nil {
+		h.rollbackCollect(&original, payment.ID)
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления счета"})
+	}
+
+	item.FactorName = factor.Name
+	return c.JSON(item)
+}
+
+// rollbackCollect удаляет записанную оплату фактора и возвращает счет и факторинг в состояние до инкассации
+func (h *FactoringHandler) rollbackCollect(original *models.FactoredInvoice, paymentID primitive.ObjectID) {
+	if !paymentID.IsZero() {
+		if _, err := h.db.DB.Collection("invoice_payments").DeleteOne(context.TODO(), bson.M{"_id": paymentID}); err != nil {
+			log.Printf("Failed to roll back factoring payment %s: %v", paymentID.Hex(), err)
+		}
+		_, err := h.db.DB.Collection("invoices").UpdateOne(context.TODO(), bson.M{"_id": original.InvoiceID}, bson.M{
+			"$set":   bson.M{"factor_id": original.FactorID},
+			"$unset": bson.M{"written_off": "", "written_off_date": ""},
+		})
+		if err != nil {
+			log.Printf("Failed to restore invoice %s after factoring rollback: %v", original.InvoiceID.Hex(), err)
+		}
+	}
+	if _, err := h.db.DB.Collection("factored_invoices").ReplaceOne(context.TODO(), bson.M{"_id": original.ID}, original); err != nil {
+		log.Printf("Failed to restore factored invoice %s: %v", original.ID.Hex(), err)
+	}
+}
+
+// ReleaseReserve фиксирует возврат резерва фактором после инкассации (по умолчанию — весь резерв к возврату)
+func (h *FactoringHandler) ReleaseReserve(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID факторинга"})
+	}
+
+	var req FactoringEventRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	item, err := findUserFactoredInvoice(h.db, userObjectID, itemID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Счет в факторинге не найден"})
+	}
+	if item.Status != utils.FactoringCollected {
+		return c.Status(409).JSON(fiber.Map{"error": "Резерв выплачивается только после оплаты счета фактору"})
+	}
+
+	date := eventDate(req.Date)
+	if date.Before(item.CollectedDate) {
+		return c.Status(400).JSON(fiber.Map{"error": "Дата выплаты резерва раньше даты оплаты счета"})
+	}
+	amount := item.ReserveDue
+	if req.Amount != nil {
+		amount = roundMoney(*req.Amount)
+	}
+	if amount < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Сумма резерва не может быть отрицательной"})
+	}
+
+	// Расхождение с расчетным резервом относится на комиссию фактора
+	item.Status = utils.FactoringReleased
+	item.ReserveReleasedDate = date
+	item.ReserveReleased = amount
+	item.Fee = roundMoney(item.Fee + item.ReserveDue - amount)
+	item.UpdatedAt = time.Now()
+
+	_, err = h.db.DB.Collection("factored_invoices").ReplaceOne(context.TODO(), bson.M{"_id": item.ID}, item)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления факторинга"})
+	}
+
+	return c.JSON(item)
+}
+
+// ChargebackInvoice возвращает неоплаченный счет по регрессу: перевозчик возмещает фактору аванс и комиссию,
+// а требование к брокеру снова становится дебиторской задолженностью компании
+func (h *FactoringHandler) ChargebackInvoice(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID факторинга"})
+	}
+
+	var req FactoringEventRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	item, err := findUserFactoredInvoice(h.db, userObjectID, itemID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Счет в факторинге не найден"})
+	}
+	if item.Status != utils.FactoringFunded {
+		return c.Status(409).JSON(fiber.Map{"error": "Регресс возможен только по неоплаченному счету"})
+	}
+	if !item.Terms.Recourse {
+		return c.Status(409).JSON(fiber.Map{"error": "Факторинг без регресса: риск неоплаты несет фактор"})
+	}
+
+	date := eventDate(req.Date)
+	if date.Before(item.FundedDate) {
+		return c.Status(400).JSON(fiber.Map{"error": "Дата регресса раньше даты финансирования"})
+	}
+
+	item.Fee = factoredInvoiceFee(item, date)
+	amount := roundMoney(item.AdvanceAmount + item.Fee)
+	if req.Amount != nil {
+		amount = roundMoney(*req.Amount)
+		if amount < item.AdvanceAmount {
+			return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("Сумма регресса не может быть меньше аванса (%.2f)", item.AdvanceAmount)})
+		}
+		item.Fee = roundMoney(amount - item.AdvanceAmount)
+	}
+
+	item.Status = utils.FactoringChargedBack
+	item.ChargebackDate = date
+	item.ChargebackAmount = amount
+	item.UpdatedAt = time.Now()
+
+	if _, err := h.db.DB.Collection("invoices").UpdateOne(context.TODO(), bson.M{"_id": item.InvoiceID}, bson.M{
+		"$unset": bson.M{"factor_id": ""},
+		"$set":   bson.M{"updated_at": time.Now()},
+	}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления счета"})
+	}
+
+	_, err = h.db.DB.Collection("factored_invoices").ReplaceOne(context.TODO(), bson.M{"_id": item.ID}, item)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления факторинга"})
+	}
+
+	return c.JSON(item)
+}
+
+// DeleteFactoredInvoice отменяет ошибочно записанную передачу счета, пока фактор не получил оплату
+func (h *FactoringHandler) DeleteFactoredInvoice(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	itemID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID факторинга"})
+	}
+
+	item, err := findUserFactoredInvoice(h.db, userObjectID, itemID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Счет в факторинге не найден"})
+	}
+	if item.Status != utils.FactoringFunded {
+		return c.Status(409).JSON(fiber.Map{"error": "Отменить можно только неоплаченную передачу счета"})
+	}
+
+	if _, err := h.db.DB.Collection("factored_invoices").DeleteOne(context.TODO(), bson.M{"_id": item.ID}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления факторинга"})
+	}
+
+	if _, err := h.db.DB.Collection("invoices").UpdateOne(context.TODO(), bson.M{"_id": item.InvoiceID}, bson.M{"$unset": bson.M{"factor_id": ""}}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления счета"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Передача счета фактору отменена"})
+}
+
+// GetCostReport возвращает стоимость финансирования по компаниям за период: комиссии факторов
+// (по дате оплаты или регресса), объем факторинга (по дате финансирования), текущие резервы
+// и проценты по кредитам из платежей за тот же период
+func (h *FactoringHandler) GetCostReport(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	from, to, err := reportPeriod(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+	}
+	if !from.Before(to) {
+		return c.Status(400).JSON(fiber.Map{"error": "Начало периода должно быть раньше конца"})
+	}
+
+	companies, err := getUserCompanies(h.db, userObjectID, c.Query("company_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+	}
+
+	asOf := time.Now()
+	report := FactoringCostReport{
+		From:      from.Format("2006-01-02"),
+		To:        to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Companies: []FactoringCostItem{},
+	}
+
+	for _, company := range companies {
+		factorsCursor, err := h.db.DB.Collection("factoring_companies").Find(context.TODO(), bson.M{"company_id": company.ID})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения факторов"})
+		}
+		var factors []models.FactoringCompany
+		if err = factorsCursor.All(context.TODO(), &factors); err != nil {
+			factorsCursor.Close(context.TODO())
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+		}
+		factorsCursor.Close(context.TODO())
+
+		itemsCursor, err := h.db.DB.Collection("factored_invoices").Find(context.TODO(), bson.M{"company_id": company.ID})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения счетов в факторинге"})
+		}
+		var items []models.FactoredInvoice
+		if err = itemsCursor.All(context.TODO(), &items); err != nil {
+			itemsCursor.Close(context.TODO())
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+		}
+		itemsCursor.Close(context.TODO())
+
+		item := FactoringCostItem{
+			CompanyID:   company.ID.Hex(),
+			CompanyName: company.Name,
+			Factors:     []FactorCostTotals{},
+		}
+
+		byFactor := map[primitive.ObjectID]*FactorCostTotals{}
+		for _, factor := range factors {
+			byFactor[factor.ID] = &FactorCostTotals{FactorID: factor.ID.Hex(), FactorName: factor.Name}
+		}
+
+		inPeriod := func(date time.Time) bool {
+			return !date.IsZero() && !date.Before(from) && date.Before(to)
+		}
+		for i := range items {
+			totals, ok := byFactor[items[i].FactorID]
+			if !ok {
+				totals = &FactorCostTotals{FactorID: items[i].FactorID.Hex()}
+				byFactor[items[i].FactorID] = totals
+			}
+
+			if inPeriod(items[i].FundedDate) {
+				totals.InvoicesFactored++
+				totals.FactoredVolume += items[i].FaceAmount
+				totals.Advances += items[i].AdvanceAmount
+			}
+
+			switch items[i].Status {
+			case utils.FactoringFunded:
+				setFactoringStatus(&items[i], asOf)
+				totals.ReserveHeld += items[i].ReserveAmount
+				if items[i].RecourseDue {
+					totals.RecourseDue += items[i].AdvanceAmount + items[i].AccruedFee
+				}
+			case utils.FactoringCollected, utils.FactoringReleased:
+				if items[i].Status == utils.FactoringCollected {
+					totals.ReserveDue += items[i].ReserveDue
+				}
+				if inPeriod(items[i].CollectedDate) {
+					totals.Fees += items[i].Fee
+					// Недостача при недоплате брокера по факторингу с регрессом
+					totals.Chargebacks += items[i].ChargebackAmount
+				}
+			case utils.FactoringChargedBack:
+				if inPeriod(items[i].ChargebackDate) {
+					totals.Fees += items[i].Fee
+					totals.Chargebacks += items[i].ChargebackAmount
+				}
+			}
+		}
+
+		for _, factor := range factors {
+			totals := byFactor[factor.ID]
+			item.Factors = append(item.Factors, roundFactorTotals(*totals))
+			delete(byFactor, factor.ID)
+		}
+		for _, totals := range byFactor {
+			item.Factors = append(item.Factors, roundFactorTotals(*totals))
+		}
+		for _, totals := range item.Factors {
+			item.FactorTotals.InvoicesFactored += totals.InvoicesFactored
+			item.FactorTotals.FactoredVolume += totals.FactoredVolume
+			item.FactorTotals.Advances += totals.Advances
+			item.FactorTotals.Fees += totals.Fees
+			item.FactorTotals.Chargebacks += totals.Chargebacks
+			item.FactorTotals.ReserveHeld += totals.ReserveHeld
+			item.FactorTotals.ReserveDue += totals.ReserveDue
+			item.FactorTotals.RecourseDue += totals.RecourseDue
+		}
+		item.FactorTotals = roundFactorTotals(item.FactorTotals)
+		if item.FactorTotals.FactoredVolume > 0 {
+			item.FeeRate = roundMoney(item.FactorTotals.Fees / item.FactorTotals.FactoredVolume * 100)
+		}
+
+		// Проценты по кредитам компании из проведенных платежей за период
+		loansCursor, err := h.db.DB.Collection("loans").Find(context.TODO(), bson.M{"company_id": company.ID})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения кредитов"})
+		}
+		var loans []models.Loan
+		if err = loansCursor.All(context.TODO(), &loans); err != nil {
+			loansCursor.Close(context.TODO())
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования кредитов"})
+		}
+		loansCursor.Close(context.TODO())
+
+		if len(loans) > 0 {
+			loanIDs := make([]primitive.ObjectID, 0, len(loans))
+			for i := range loans {
+				loanIDs = append(loanIDs, loans[i].ID)
+			}
+
+			paymentsCursor, err := h.db.DB.Collection("payments").Find(context.TODO(), bson.M{
+				"loan_id":      bson.M{"$in": loanIDs},
+				"status":       bson.M{"$nin": []string{models.PaymentVoided, models.PaymentReversed}},
+				"payment_date": bson.M{"$gte": from, "$lt": to},
+			})
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения платежей"})
+			}
+			var payments []models.Payment
+			if err = paymentsCursor.All(context.TODO(), &payments); err != nil {
+				paymentsCursor.Close(context.TODO())
+				return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования платежей"})
+			}
+			paymentsCursor.Close(context.TODO())
+
+			for _, payment := range payments {
+				item.LoanInterest += payment.InterestPaid
+			}
+			item.LoanInterest = roundMoney(item.LoanInterest)
+		}
+
+		item.FinancingCost = roundMoney(item.FactorTotals.Fees + item.LoanInterest)
+		report.Companies = append(report.Companies, item)
+	}
+
+	return c.JSON(report)
+}
+
+// roundFactorTotals округляет денежные итоги по фактору
+func roundFactorTotals(totals FactorCostTotals) FactorCostTotals {
+	totals.FactoredVolume = roundMoney(totals.FactoredVolume)
+	totals.Advances = roundMoney(totals.Advances)
+	totals.Fees = roundMoney(totals.Fees)
+	totals.Chargebacks = roundMoney(totals.Chargebacks)
+	totals.ReserveHeld = roundMoney(totals.ReserveHeld)
+	totals.ReserveDue = roundMoney(totals.ReserveDue)
+	totals.RecourseDue = roundMoney(totals.RecourseDue)
+	return totals
+}
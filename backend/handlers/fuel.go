@@ -0,0 +1,1070 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type FuelHandler struct {
+	db *database.Database
+}
+
+func NewFuelHandler(db *database.Database) *FuelHandler {
+	return &FuelHandler{db: db}
+}
+
+type FuelAnomaly struct {
+	PurchaseID     string   `json:"purchase_id"`
+	PurchaseDate   string   `json:"purchase_date"`
+	FuelType       string   `json:"fuel_type"`
+	Gallons        float64  `json:"gallons"`
+	PricePerGallon float64  `json:"price_per_gallon"`
+	TotalCost      float64  `json:"total_cost"`
+	Odometer       float64  `json:"odometer"`
+	State          string   `json:"state"`
+	Merchant       string   `json:"merchant,omitempty"`
+	Flags          []string `json:"flags"`
+}
+
+type VehicleFuelEconomy struct {
+	VehicleID   string                      `json:"vehicle_id"`
+	VehicleName string                      `json:"vehicle_name"`
+	Miles       float64                     `json:"miles"`
+	Gallons     float64                     `json:"gallons"`
+	AverageMPG  float64                     `json:"average_mpg"`
+	MedianMPG   float64                     `json:"median_mpg"`
+	Intervals   []utils.FuelEconomyInterval `json:"intervals"`
+	Anomalies   []FuelAnomaly               `json:"anomalies"`
+}
+
+type FuelTotals struct {
+	Purchases         int     `json:"purchases"`
+	Gallons           float64 `json:"gallons"`
+	PropulsionGallons float64 `json:"propulsion_gallons"`
+	Cost              float64 `json:"cost"`
+	AvgPrice          float64 `json:"avg_price"`
+	Miles             float64 `json:"miles"`
+	MPG               float64 `json:"mpg"`
+	CostPerMile       float64 `json:"cost_per_mile"`
+}
+
+type VehicleFuelReport struct {
+	VehicleID   string `json:"vehicle_id"`
+	VehicleName string `json:"vehicle_name"`
+	FuelTotals
+}
+
+type FuelGroupTotals struct {
+	Key       string  `json:"key"`
+	Purchases int     `json:"purchases"`
+	Gallons   float64 `json:"gallons"`
+	Cost      float64 `json:"cost"`
+	AvgPrice  float64 `json:"avg_price"`
+}
+
+type FuelReport struct {
+	From       string              `json:"from"`
+	To         string              `json:"to"`
+	Totals     FuelTotals          `json:"totals"`
+	Vehicles   []VehicleFuelReport `json:"vehicles"`
+	ByState    []FuelGroupTotals   `json:"by_state"`
+	ByMonth    []FuelGroupTotals   `json:"by_month"`
+	ByFuelType []FuelGroupTotals   `json:"by_fuel_type"`
+}
+
+// reportPeriod разбирает период отчета from/to (YYYY-MM-DD, to включительно); по умолчанию — последние 12 месяцев
+func reportPeriod(c *fiber.Ctx) (time.Time, time.Time, error) {
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	from := utils.MonthStart(to.AddDate(0, -11, 0))
+
+	var err error
+	if value := c.Query("from"); value != "" {
+		if from, err = time.Parse("2006-01-02", value); err != nil {
+			return from, to, err
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		if to, err = time.Parse("2006-01-02", value); err != nil {
+			return from, to, err
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	return from, to, nil
+}
+
+// prepareFuelPurchase проверяет заправку и восстанавливает цену или сумму по объему
+func prepareFuelPurchase(purchase *models.FuelPurchase) string {
+	if purchase.PurchaseDate.IsZero() {
+		return "Не указана дата заправки"
+	}
+	if purchase.FuelType == "" {
+		purchase.FuelType = utils.FuelDiesel
+	}
+	if !utils.IsValidFuelType(purchase.FuelType) {
+		return "Неверный вид топлива"
+	}
+	if purchase.Gallons <= 0 {
+		return "Объем должен быть больше нуля"
+	}
+	if purchase.PricePerGallon < 0 || purchase.TotalCost < 0 || purchase.Odometer < 0 {
+		return "Цена, сумма и пробег не могут быть отрицательными"
+	}
+	purchase.State = strings.ToUpper(strings.TrimSpace(purchase.State))
+	if purchase.State != "" && len(purchase.State) != 2 {
+		return "Штат указывается двухбуквенным кодом"
+	}
+	if purchase.Source == "" {
+		purchase.Source = "manual"
+	}
+
+	if purchase.TotalCost == 0 {
+		purchase.TotalCost = math.Round(purchase.Gallons*purchase.PricePerGallon*100) / 100
+	}
+	if purchase.PricePerGallon == 0 {
+		purchase.PricePerGallon = math.Round(purchase.TotalCost/purchase.Gallons*1000) / 1000
+	}
+	return ""
+}
+
+// assignmentAt возвращает закрепление тягача, действующее на дату (nil, если его нет)
+func assignmentAt(db *database.Database, truckID primitive.ObjectID, date time.Time) *models.Assignment {
+	filter := activeAssignmentFilter(date, date.Add(time.Second))
+	filter["truck_id"] = truckID
+
+	var assignment models.Assignment
+	if err := db.DB.Collection("assignments").FindOne(context.TODO(), filter).Decode(&assignment); err != nil {
+		return nil
+	}
+	return &assignment
+}
+
+// assignedDriverAt возвращает водителя, закрепленного за тягачом на момент заправки
+func assignedDriverAt(db *database.Database, vehicleID primitive.ObjectID, date time.Time) *primitive.ObjectID {
+	if assignment := assignmentAt(db, vehicleID, date); assignment != nil {
+		return assignment.DriverID
+	}
+	return nil
+}
+
+// loadTruckAssignments загружает закрепления тягачей, действовавшие в периоде [from, to)
+func loadTruckAssignments(db *database.Database, truckIDs []primitive.ObjectID, from, to time.Time) ([]models.Assignment, error) {
+	filter := activeAssignmentFilter(from, to)
+	filter["truck_id"] = bson.M{"$in": truckIDs}
+
+	cursor, err := db.DB.Collection("assignments").Find(context.TODO(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	assignments := []models.Assignment{}
+	if err = cursor.All(context.TODO(), &assignments); err != nil {
+		return nil, err
+	}
+	return assignments, nil
+}
+
+// assignedDriverIn возвращает водителя тягача на дату по заранее загруженным закреплениям
+func assignedDriverIn(assignments []models.Assignment, truckID primitive.ObjectID, date time.Time) *primitive.ObjectID {
+	for i := range assignments {
+		assignment := &assignments[i]
+		if assignment.TruckID == truckID && assignment.StartDate.Before(date.Add(time.Second)) &&
+			(assignment.EndDate == nil || assignment.EndDate.After(date)) {
+			return assignment.DriverID
+		}
+	}
+	return nil
+}
+
+// fuelOdometerReading готовит показание одометра по заправке для журнала пробега
+func fuelOdometerReading(readings []models.OdometerReading, purchase *models.FuelPurchase) (models.OdometerReading, string) {
+	reading := models.OdometerReading{
+		VehicleID:   purchase.VehicleID,
+		CompanyID:   purchase.CompanyID,
+		ReadingDate: purchase.PurchaseDate,
+		Odometer:    purchase.Odometer,
+		Source:      utils.ReadingSourceFuel,
+		Notes:       purchase.Merchant,
+		CreatedBy:   purchase.CreatedBy,
+		CreatedAt:   time.Now(),
+
+		FuelPurchaseID: purchase.ID,
+	}
+	msg := prepareReading(readings, &reading, 0)
+	return reading, msg
+}
+
+// fuelReadingFilter находит показание заправки: по ссылке или, для показаний без нее, по транспорту, дате и одометру
+func fuelReadingFilter(purchase *models.FuelPurchase) bson.M {
+	return bson.M{"$or": []bson.M{
+		{"fuel_purchase_id": purchase.ID},
+		{
+			"fuel_purchase_id": bson.M{"$exists": false},
+			"source":           utils.ReadingSourceFuel,
+			"vehicle_id":       purchase.VehicleID,
+			"reading_date":     purchase.PurchaseDate,
+			"odometer":         purchase.Odometer,
+		},
+	}}
+}
+
+// replaceFuelReading удаляет показание одометра прежней версии заправки, записывает показание
+// новой (если она передана и содержит одометр) и обновляет пробег затронутого транспорта.
+// Возвращает предупреждение, если новое показание не прошло проверку журнала.
+func replaceFuelReading(db *database.Database, existing, purchase *models.FuelPurchase) (string, error) {
+	if _, err := db.DB.Collection("odometer_readings").DeleteOne(context.TODO(), fuelReadingFilter(existing)); err != nil {
+		return "", err
+	}
+
+	vehicleIDs := []primitive.ObjectID{existing.VehicleID}
+	warning := ""
+	if purchase != nil {
+		if purchase.VehicleID != existing.VehicleID {
+			vehicleIDs = append(vehicleIDs, purchase.VehicleID)
+		}
+		if purchase.Odometer > 0 && utils.IsPropulsionFuel(purchase.FuelType) {
+			readings, err := loadVehicleReadings(db, purchase.VehicleID)
+			if err != nil {
+				return "", err
+			}
+			reading, msg := fuelOdometerReading(readings, purchase)
+			if msg != "" {
+				warning = "Показание одометра не записано в журнал: " + msg
+			} else if _, err := db.DB.Collection("odometer_readings").InsertOne(context.TODO(), reading); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	for _, vehicleID := range vehicleIDs {
+		readings, err := loadVehicleReadings(db, vehicleID)
+		if err != nil {
+			return "", err
+		}
+		if err := syncVehicleMeters(db, vehicleID, readings); err != nil {
+			return "", err
+		}
+	}
+	return warning, nil
+}
+
+// fuelTransactionKey — ключ повторной загрузки: одна транзакция карты может включать
+// несколько продуктов (дизель, DEF, топливо рефустановки), каждый записывается отдельной заправкой
+func fuelTransactionKey(transactionID, fuelType string) string {
+	return transactionID + "|" + fuelType
+}
+
+// matchVehicleByUnit находит транспорт по номеру юнита или окончанию VIN (не короче 6 символов)
+func matchVehicleByUnit(vehicles []models.Vehicle, unit string) *models.Vehicle {
+	unit = strings.ToUpper(strings.TrimSpace(unit))
+	if unit == "" {
+		return nil
+	}
+	for i := range vehicles {
+		if strings.ToUpper(vehicles[i].UnitNumber) == unit {
+			return &vehicles[i]
+		}
+	}
+	if len(unit) >= 6 {
+		for i := range vehicles {
+			if strings.HasSuffix(strings.ToUpper(vehicles[i].VIN), unit) {
+				return &vehicles[i]
+			}
+		}
+	}
+	return nil
+}
+
+// fuelMileage возвращает пробег на момент заправки с учетом обнулений одометра: по связанному
+// показанию журнала или по смещению последнего показания до заправки
+func fuelMileage(readings []models.OdometerReading, purchase *models.FuelPurchase) float64 {
+	if purchase.Odometer <= 0 {
+		return 0
+	}
+	offset := 0.0
+	for _, reading := range readings {
+		if reading.FuelPurchaseID == purchase.ID {
+			return reading.Mileage
+		}
+		if !reading.ReadingDate.After(purchase.PurchaseDate) {
+			offset = reading.RolloverOffset
+		}
+	}
+	return purchase.Odometer + offset
+}
+
+// fuelEntries готовит заправки транспорта для расчета расхода; одометр заменяется пробегом
+// по журналу показаний, чтобы обнуление одометра не выглядело как откат
+func fuelEntries(purchases []models.FuelPurchase, readings []models.OdometerReading) []utils.FuelEntry {
+	entries := make([]utils.FuelEntry, 0, len(purchases))
+	for i, purchase := range purchases {
+		entries = append(entries, utils.FuelEntry{
+			ID:             purchase.ID.Hex(),
+			Date:           purchase.PurchaseDate,
+			FuelType:       purchase.FuelType,
+			Gallons:        purchase.Gallons,
+			PricePerGallon: purchase.PricePerGallon,
+			TotalCost:      purchase.TotalCost,
+			Odometer:       fuelMileage(readings, &purchases[i]),
+		})
+	}
+	return entries
+}
+
+// loadFuelPurchases загружает заправки компаний за период, отсортированные по дате
+func loadFuelPurchases(db *database.Database, companyIDs []primitive.ObjectID, vehicleID *primitive.ObjectID, from, to time.Time) ([]models.FuelPurchase, error) {
+	filter := bson.M{
+		"company_id":    bson.M{"$in": companyIDs},
+		"purchase_date": bson.M{"$gte": from, "$lt": to},
+	}
+	if vehicleID != nil {
+		filter["vehicle_id"] = *vehicleID
+	}
+
+	cursor, err := db.DB.Collection("fuel_purchases").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"purchase_date": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	purchases := []models.FuelPurchase{}
+	if err = cursor.All(context.TODO(), &purchases); err != nil {
+		return nil, err
+	}
+	return purchases, nil
+}
+
+// reportScope возвращает компании пользователя с учетом фильтров отчета company_id и vehicle_id
+func reportScope(c *fiber.Ctx, db *database.Database, userObjectID primitive.ObjectID) ([]primitive.ObjectID, *primitive.ObjectID, int, string) {
+	companyIDs, err := getUserCompanyIDs(db, userObjectID)
+	if err != nil {
+		return nil, nil, 500, "Ошибка получения компаний"
+	}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return nil, nil, 400, "Неверный ID компании"
+		}
+		companyIDs = filterOwnedIDs(companyIDs, companyObjectID)
+	}
+
+	var vehicleID *primitive.ObjectID
+	if value := c.Query("vehicle_id"); value != "" {
+		vehicleObjectID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return nil, nil, 400, "Неверный ID транспорта"
+		}
+		vehicleID = &vehicleObjectID
+	}
+	return companyIDs, vehicleID, 0, ""
+}
+
+// loadVehiclesByID загружает транспорт по списку ID
+func loadVehiclesByID(db *database.Database, vehicleIDs []primitive.ObjectID) (map[primitive.ObjectID]*models.Vehicle, error) {
+	vehicles := map[primitive.ObjectID]*models.Vehicle{}
+	if len(vehicleIDs) == 0 {
+		return vehicles, nil
+	}
+
+	cursor, err := db.DB.Collection("vehicles").Find(context.TODO(), bson.M{"_id": bson.M{"$in": vehicleIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var list []models.Vehicle
+	if err = cursor.All(context.TODO(), &list); err != nil {
+		return nil, err
+	}
+	for i := range list {
+		vehicles[list[i].ID] = &list[i]
+	}
+	return vehicles, nil
+}
+
+// groupPurchasesByVehicle группирует заправки по транспорту с сохранением порядка дат
+func groupPurchasesByVehicle(purchases []models.FuelPurchase) ([]primitive.ObjectID, map[primitive.ObjectID][]models.FuelPurchase) {
+	var order []primitive.ObjectID
+	groups := map[primitive.ObjectID][]models.FuelPurchase{}
+	for _, purchase := range purchases {
+		if _, ok := groups[purchase.VehicleID]; !ok {
+			order = append(order, purchase.VehicleID)
+		}
+		groups[purchase.VehicleID] = append(groups[purchase.VehicleID], purchase)
+	}
+	return order, groups
+}
+
+func roundMoney(value float64) float64 {
+	return math.Round(value*100) / 100
+}
+
+// finalizeFuelTotals рассчитывает среднюю цену, расход и стоимость мили
+func finalizeFuelTotals(totals *FuelTotals) {
+	totals.Gallons = math.Round(totals.Gallons*1000) / 1000
+	totals.PropulsionGallons = math.Round(totals.PropulsionGallons*1000) / 1000
+	totals.Cost = roundMoney(totals.Cost)
+	totals.Miles = math.Round(totals.Miles)
+	if totals.Gallons > 0 {
+		totals.AvgPrice = math.Round(totals.Cost/totals.Gallons*1000) / 1000
+	}
+	if totals.PropulsionGallons > 0 {
+		totals.MPG = math.Round(totals.Miles/totals.PropulsionGallons*100) / 100
+	}
+	if totals.Miles > 0 {
+		totals.CostPerMile = math.Round(totals.Cost/totals.Miles*1000) / 1000
+	}
+}
+
+func sortedGroupTotals(groups map[string]*FuelGroupTotals) []FuelGroupTotals {
+	result := []FuelGroupTotals{}
+	for _, group := range groups {
+		group.Gallons = math.Round(group.Gallons*1000) / 1000
+		group.Cost = roundMoney(group.Cost)
+		if group.Gallons > 0 {
+			group.AvgPrice = math.Round(group.Cost/group.Gallons*1000) / 1000
+		}
+		result = append(result, *group)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Key < result[j].Key })
+	return result
+}
+
+func (h *FuelHandler) GetPurchases(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	from, to, err := reportPeriod(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+	}
+
+	companyIDs, vehicleID, status, msg := reportScope(c, h.db, userObjectID)
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	purchases, err := loadFuelPurchases(h.db, companyIDs, vehicleID, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения заправок"})
+	}
+
+	if state := strings.ToUpper(c.Query("state")); state != "" {
+		filtered := []models.FuelPurchase{}
+		for _, purchase := range purchases {
+			if purchase.State == state {
+				filtered = append(filtered, purchase)
+			}
+		}
+		purchases = filtered
+	}
+
+	return c.JSON(purchases)
+}
+
+// CreatePurchase записывает заправку. Водитель по умолчанию берется из закрепления на дату заправки,
+// показание одометра записывается в журнал пробега.
+func (h *FuelHandler) CreatePurchase(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var purchase models.FuelPurchase
+	if err := c.BodyParser(&purchase); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	purchase.Source = "manual"
+	if msg := prepareFuelPurchase(&purchase); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	vehicle, err := findUserVehicle(h.db, userObjectID, purchase.VehicleID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+	purchase.CompanyID = vehicle.CompanyID
+
+	if purchase.DriverID == nil {
+		purchase.DriverID = assignedDriverAt(h.db, vehicle.ID, purchase.PurchaseDate)
+	}
+
+	purchase.CreatedBy = userObjectID
+	purchase.CreatedAt = time.Now()
+	purchase.UpdatedAt = time.Now()
+
+	result, err := h.db.DB.Collection("fuel_purchases").InsertOne(context.TODO(), purchase)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения заправки"})
+	}
+	purchase.ID = result.InsertedID.(primitive.ObjectID)
+
+	if purchase.Odometer > 0 && utils.IsPropulsionFuel(purchase.FuelType) {
+		readings, err := loadVehicleReadings(h.db, vehicle.ID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+		}
+
+		reading, msg := fuelOdometerReading(readings, &purchase)
+		if msg != "" {
+			purchase.Warnings = append(purchase.Warnings, "Показание одометра не записано в журнал: "+msg)
+		} else {
+			if _, err := h.db.DB.Collection("odometer_readings").InsertOne(context.TODO(), reading); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения показания"})
+			}
+			if err := syncVehicleMeters(h.db, vehicle.ID, insertSortedReading(readings, reading)); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления пробега"})
+			}
+		}
+	}
+
+	return c.Status(201).JSON(purchase)
+}
+
+func (h *FuelHandler) UpdatePurchase(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	purchaseID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID заправки"})
+	}
+
+	var purchase models.FuelPurchase
+	if err := c.BodyParser(&purchase); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	vehicle, err := findUserVehicle(h.db, userObjectID, purchase.VehicleID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+	purchase.CompanyID = vehicle.CompanyID
+
+	var existing models.FuelPurchase
+	err = h.db.DB.Collection("fuel_purchases").FindOne(context.TODO(), bson.M{
+		"_id":        purchaseID,
+		"company_id": vehicle.CompanyID,
+	}).Decode(&existing)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Заправка не найдена"})
+	}
+
+	purchase.Source = existing.Source
+	if msg := prepareFuelPurchase(&purchase); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	purchase.ID = primitive.NilObjectID
+	purchase.TransactionID = existing.TransactionID
+	purchase.CreatedBy = existing.CreatedBy
+	purchase.CreatedAt = existing.CreatedAt
+	purchase.UpdatedAt = time.Now()
+
+	_, err = h.db.DB.Collection("fuel_purchases").ReplaceOne(context.TODO(), bson.M{"_id": purchaseID}, purchase)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления заправки"})
+	}
+	purchase.ID = purchaseID
+
+	// Показание одометра заправки заменяется вместе с ней
+	warning, err := replaceFuelReading(h.db, &existing, &purchase)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления показания"})
+	}
+	if warning != "" {
+		purchase.Warnings = append(purchase.Warnings, warning)
+	}
+
+	return c.JSON(purchase)
+}
+
+func (h *FuelHandler) DeletePurchase(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	purchaseID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID заправки"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"_id": purchaseID, "company_id": bson.M{"$in": companyIDs}}
+	var purchase models.FuelPurchase
+	if err := h.db.DB.Collection("fuel_purchases").FindOne(context.TODO(), filter).Decode(&purchase); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Заправка не найдена"})
+	}
+
+	result, err := h.db.DB.Collection("fuel_purchases").DeleteOne(context.TODO(), filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления заправки"})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Заправка не найдена"})
+	}
+
+	// Показание одометра заправки удаляется вместе с ней
+	if _, err := replaceFuelReading(h.db, &purchase, nil); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления показания"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Заправка удалена"})
+}
+
+// ImportPurchases загружает выгрузку топливной карты (multipart: file, company_id, layout, vehicle_id).
+// Транспорт определяется по номеру юнита или окончанию VIN, если не задан vehicle_id.
+// Уже загруженные транзакции пропускаются, показания одометра записываются в журнал пробега.
+func (h *FuelHandler) ImportPurchases(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var vehicles []models.Vehicle
+	if value := c.FormValue("vehicle_id"); value != "" {
+		vehicleID, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+		}
+		vehicle, err := findUserVehicle(h.db, userObjectID, vehicleID)
+		if err != nil {
+			return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+		}
+		vehicles = append(vehicles, *vehicle)
+	} else {
+		companyID, err := primitive.ObjectIDFromHex(c.FormValue("company_id"))
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+
+		count, err := h.db.DB.Collection("companies").CountDocuments(context.TODO(), bson.M{"_id": companyID, "user_id": userObjectID})
+		if err != nil || count == 0 {
+			return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+		}
+
+		cursor, err := h.db.DB.Collection("vehicles").Find(context.TODO(), bson.M{"company_id": companyID})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения транспорта"})
+		}
+		defer cursor.Close(context.TODO())
+		if err = cursor.All(context.TODO(), &vehicles); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования транспорта"})
+		}
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Файл не передан"})
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Не удалось прочитать файл"})
+	}
+	defer file.Close()
+
+	rows, layout, rowErrors, err := utils.ParseFuelCSV(file, c.FormValue("layout"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Date.Before(rows[j].Date) })
+
+	// Уже загруженные транзакции
+	var companyIDs []primitive.ObjectID
+	seenCompanies := map[primitive.ObjectID]bool{}
+	for _, vehicle := range vehicles {
+		if !seenCompanies[vehicle.CompanyID] {
+			seenCompanies[vehicle.CompanyID] = true
+			companyIDs = append(companyIDs, vehicle.CompanyID)
+		}
+	}
+	existingTransactions := map[string]bool{}
+	if len(companyIDs) > 0 {
+		cursor, err := h.db.DB.Collection("fuel_purchases").Find(context.TODO(), bson.M{
+			"company_id":     bson.M{"$in": companyIDs},
+			"transaction_id": bson.M{"$exists": true},
+		}, options.Find().SetProjection(bson.M{"transaction_id": 1, "fuel_type": 1}))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения заправок"})
+		}
+		defer cursor.Close(context.TODO())
+
+		var existing []models.FuelPurchase
+		if err = cursor.All(context.TODO(), &existing); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования заправок"})
+		}
+		for _, purchase := range existing {
+			existingTransactions[fuelTransactionKey(purchase.TransactionID, purchase.FuelType)] = true
+		}
+	}
+
+	// Закрепления за период файла загружаются одним запросом
+	assignments := []models.Assignment{}
+	if len(rows) > 0 {
+		truckIDs := make([]primitive.ObjectID, 0, len(vehicles))
+		for _, vehicle := range vehicles {
+			truckIDs = append(truckIDs, vehicle.ID)
+		}
+		assignments, err = loadTruckAssignments(h.db, truckIDs, rows[0].Date, rows[len(rows)-1].Date.Add(time.Second))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения закреплений"})
+		}
+	}
+
+	now := time.Now()
+	var documents []interface{}
+	purchasesByVehicle := map[primitive.ObjectID][]models.FuelPurchase{}
+	purchaseLines := map[primitive.ObjectID]int{}
+	duplicates := 0
+	for _, row := range rows {
+		if row.TransactionID != "" && existingTransactions[fuelTransactionKey(row.TransactionID, row.FuelType)] {
+			duplicates++
+			continue
+		}
+
+		var vehicle *models.Vehicle
+		if c.FormValue("vehicle_id") != "" {
+			vehicle = &vehicles[0]
+		} else {
+			vehicle = matchVehicleByUnit(vehicles, row.Unit)
+		}
+		if vehicle == nil {
+			rowErrors = append(rowErrors, utils.FuelCSVError{Line: row.Line, Error: "Транспорт с юнитом «" + row.Unit + "» не найден"})
+			continue
+		}
+
+		purchase := models.FuelPurchase{
+			ID:             primitive.NewObjectID(),
+			CompanyID:      vehicle.CompanyID,
+			VehicleID:      vehicle.ID,
+			PurchaseDate:   row.Date,
+			FuelType:       row.FuelType,
+			Gallons:        row.Gallons,
+			PricePerGallon: row.PricePerGallon,
+			TotalCost:      row.TotalCost,
+			Odometer:       row.Odometer,
+			Merchant:       row.Merchant,
+			City:           row.City,
+			State:          row.State,
+			CardNumber:     row.CardNumber,
+			TransactionID:  row.TransactionID,
+			Source:         "import",
+			CreatedBy:      userObjectID,
+			CreatedAt:      now,
+			UpdatedAt:      now,
+		}
+		if msg := prepareFuelPurchase(&purchase); msg != "" {
+			rowErrors = append(rowErrors, utils.FuelCSVError{Line: row.Line, Error: msg})
+			continue
+		}
+		purchase.DriverID = assignedDriverIn(assignments, vehicle.ID, purchase.PurchaseDate)
+
+		if purchase.TransactionID != "" {
+			existingTransactions[fuelTransactionKey(purchase.TransactionID, purchase.FuelType)] = true
+		}
+		documents = append(documents, purchase)
+		purchasesByVehicle[vehicle.ID] = append(purchasesByVehicle[vehicle.ID], purchase)
+		purchaseLines[purchase.ID] = row.Line
+	}
+
+	if len(documents) > 0 {
+		if _, err := h.db.DB.Collection("fuel_purchases").InsertMany(context.TODO(), documents); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения заправок"})
+		}
+	}
+
+	// Показания одометра из заправок дополняют журнал пробега
+	warnings := []utils.FuelCSVError{}
+	for vehicleID, purchases := range purchasesByVehicle {
+		readings, err := loadVehicleReadings(h.db, vehicleID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+		}
+
+		var newReadings []interface{}
+		for i := range purchases {
+			if purchases[i].Odometer <= 0 || !utils.IsPropulsionFuel(purchases[i].FuelType) {
+				continue
+			}
+			reading, msg := fuelOdometerReading(readings, &purchases[i])
+			if msg != "" {
+				warnings = append(warnings, utils.FuelCSVError{Line: purchaseLines[purchases[i].ID], Error: msg})
+				continue
+			}
+			reading.ID = primitive.NewObjectID()
+			readings = insertSortedReading(readings, reading)
+			newReadings = append(newReadings, reading)
+		}
+
+		if len(newReadings) > 0 {
+			if _, err := h.db.DB.Collection("odometer_readings").InsertMany(context.TODO(), newReadings); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения показаний"})
+			}
+			if err := syncVehicleMeters(h.db, vehicleID, readings); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления пробега"})
+			}
+		}
+	}
+
+	sort.Slice(warnings, func(i, j int) bool { return warnings[i].Line < warnings[j].Line })
+
+	return c.JSON(fiber.Map{
+		"layout":     layout,
+		"imported":   len(documents),
+		"duplicates": duplicates,
+		"errors":     rowErrors,
+		"warnings":   warnings,
+	})
+}
+
+// GetEconomy возвращает расход между заправками по транспорту и подозрительные заправки
+func (h *FuelHandler) GetEconomy(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	from, to, err := reportPeriod(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+	}
+
+	companyIDs, vehicleID, status, msg := reportScope(c, h.db, userObjectID)
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	purchases, err := loadFuelPurchases(h.db, companyIDs, vehicleID, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения заправок"})
+	}
+
+	// Медианная цена топлива по компании за период — база для поиска завышенных цен
+	pricesByCompany := map[primitive.ObjectID][]float64{}
+	for _, purchase := range purchases {
+		if utils.IsPropulsionFuel(purchase.FuelType) && purchase.PricePerGallon > 0 {
+			pricesByCompany[purchase.CompanyID] = append(pricesByCompany[purchase.CompanyID], purchase.PricePerGallon)
+		}
+	}
+
+	order, groups := groupPurchasesByVehicle(purchases)
+	vehicles, err := loadVehiclesByID(h.db, order)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения транспорта"})
+	}
+
+	report := []VehicleFuelEconomy{}
+	for _, id := range order {
+		vehiclePurchases := groups[id]
+		readings, err := loadVehicleReadings(h.db, id)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+		}
+		entries := fuelEntries(vehiclePurchases, readings)
+		intervals := utils.CalculateFuelEconomy(entries)
+
+		params := utils.DefaultFuelAnomalyParams()
+		item := VehicleFuelEconomy{VehicleID: id.Hex(), Intervals: intervals, Anomalies: []FuelAnomaly{}}
+		if vehicle, ok := vehicles[id]; ok {
+			item.VehicleName = vehicleTitle(vehicle)
+			if vehicle.FuelCapacity > 0 {
+				params.TankCapacity = vehicle.FuelCapacity
+			}
+		}
+
+		var mpgValues []float64
+		for _, interval := range intervals {
+			item.Miles += interval.Miles
+			item.Gallons += interval.Gallons
+			if interval.MPG > 0 {
+				mpgValues = append(mpgValues, interval.MPG)
+			}
+		}
+		item.Gallons = math.Round(item.Gallons*1000) / 1000
+		if item.Gallons > 0 {
+			item.AverageMPG = math.Round(item.Miles/item.Gallons*100) / 100
+		}
+		item.MedianMPG = math.Round(utils.Median(mpgValues)*100) / 100
+
+		medianPrice := utils.Median(pricesByCompany[vehiclePurchases[0].CompanyID])
+		flags := utils.DetectFuelAnomalies(entries, intervals, medianPrice, params)
+		for _, purchase := range vehiclePurchases {
+			if purchaseFlags, ok := flags[purchase.ID.Hex()]; ok {
+				item.Anomalies = append(item.Anomalies, FuelAnomaly{
+					PurchaseID:     purchase.ID.Hex(),
+					PurchaseDate:   purchase.PurchaseDate.Format("2006-01-02 15:04"),
+					FuelType:       purchase.FuelType,
+					Gallons:        purchase.Gallons,
+					PricePerGallon: purchase.PricePerGallon,
+					TotalCost:      purchase.TotalCost,
+					Odometer:       purchase.Odometer,
+					State:          purchase.State,
+					Merchant:       purchase.Merchant,
+					Flags:          purchaseFlags,
+				})
+			}
+		}
+
+		report = append(report, item)
+	}
+
+	return c.JSON(report)
+}
+
+// GetReport возвращает затраты на топливо по транспорту, штатам, месяцам и видам топлива.
+// Пробег за период берется из журнала показаний одометра.
+func (h *FuelHandler) GetReport(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	from, to, err := reportPeriod(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+	}
+
+	companyIDs, vehicleID, status, msg := reportScope(c, h.db, userObjectID)
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	purchases, err := loadFuelPurchases(h.db, companyIDs, vehicleID, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения заправок"})
+	}
+
+	report := FuelReport{
+		From:     from.Format("2006-01-02"),
+		To:       to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Vehicles: []VehicleFuelReport{},
+	}
+	byState := map[string]*FuelGroupTotals{}
+	byMonth := map[string]*FuelGroupTotals{}
+	byFuelType := map[string]*FuelGroupTotals{}
+	addToGroup := func(groups map[string]*FuelGroupTotals, key string, purchase *models.FuelPurchase) {
+		group, ok := groups[key]
+		if !ok {
+			group = &FuelGroupTotals{Key: key}
+			groups[key] = group
+		}
+		group.Purchases++
+		group.Gallons += purchase.Gallons
+		group.Cost += purchase.TotalCost
+	}
+
+	order, groups := groupPurchasesByVehicle(purchases)
+	vehicles, err := loadVehiclesByID(h.db, order)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения транспорта"})
+	}
+
+	for _, id := range order {
+		item := VehicleFuelReport{VehicleID: id.Hex()}
+		if vehicle, ok := vehicles[id]; ok {
+			item.VehicleName = vehicleTitle(vehicle)
+		}
+
+		for i := range groups[id] {
+			purchase := &groups[id][i]
+			item.Purchases++
+			item.Gallons += purchase.Gallons
+			item.Cost += purchase.TotalCost
+			if utils.IsPropulsionFuel(purchase.FuelType) {
+				item.PropulsionGallons += purchase.Gallons
+			}
+
+			state := purchase.State
+			if state == "" {
+				state = "??"
+			}
+			addToGroup(byState, state, purchase)
+			addToGroup(byMonth, purchase.PurchaseDate.Format("2006-01"), purchase)
+			addToGroup(byFuelType, purchase.FuelType, purchase)
+		}
+
+		readings, err := loadVehicleReadings(h.db, id)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+		}
+		points := meterPoints(readings)
+		startMiles, _ := utils.MeterAt(points, from)
+		endMiles, _ := utils.MeterAt(points, to)
+		item.Miles = endMiles - startMiles
+
+		report.Totals.Purchases += item.Purchases
+		report.Totals.Gallons += item.Gallons
+		report.Totals.PropulsionGallons += item.PropulsionGallons
+		report.Totals.Cost += item.Cost
+		report.Totals.Miles += item.Miles
+
+		finalizeFuelTotals(&item.FuelTotals)
+		report.Vehicles = append(report.Vehicles, item)
+	}
+
+	finalizeFuelTotals(&report.Totals)
+	report.ByState = sortedGroupTotals(byState)
+	report.ByMonth = sortedGroupTotals(byMonth)
+	report.ByFuelType = sortedGroupTotals(byFuelType)
+
+	return c.JSON(report)
+}
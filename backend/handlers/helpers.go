@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"encoding/json"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sentFields возвращает имена полей, переданных в JSON-теле запроса, чтобы при обновлении
+// не затирать поля, которых клиент не отправлял
+func sentFields(c *fiber.Ctx) (map[string]bool, error) {
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(c.Body(), &body); err != nil {
+		return nil, err
+	}
+	fields := map[string]bool{}
+	for name := range body {
+		fields[name] = true
+	}
+	return fields, nil
+}
+
+// getUserCompanyIDs возвращает ID всех компаний пользователя
+func getUserCompanyIDs(db *database.Database, userObjectID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	cursor, err := db.DB.Collection("companies").Find(context.TODO(), bson.M{"user_id": userObjectID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var companies []models.Company
+	if err = cursor.All(context.TODO(), &companies); err != nil {
+		return nil, err
+	}
+
+	companyIDs := []primitive.ObjectID{}
+	for _, company := range companies {
+		companyIDs = append(companyIDs, company.ID)
+	}
+	return companyIDs, nil
+}
+
+// getUserCompanies возвращает компании пользователя, при company_id — только указанную
+func getUserCompanies(db *database.Database, userObjectID primitive.ObjectID, companyID string) ([]models.Company, error) {
+	filter := bson.M{"user_id": userObjectID}
+	if companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return nil, err
+		}
+		filter["_id"] = companyObjectID
+	}
+
+	cursor, err := db.DB.Collection("companies").Find(context.TODO(), filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var companies []models.Company
+	if err = cursor.All(context.TODO(), &companies); err != nil {
+		return nil, err
+	}
+	return companies, nil
+}
+
+// vehicleTitle возвращает название транспорта для отчетов
+func vehicleTitle(vehicle *models.Vehicle) string {
+	return vehicle.Make + " " + vehicle.Model + " (" + strconv.Itoa(vehicle.Year) + ")"
+}
+
+// filterOwnedIDs оставляет requestedID только если он входит в список доступных ID
+func filterOwnedIDs(ownedIDs []primitive.ObjectID, requestedID primitive.ObjectID) []primitive.ObjectID {
+	for _, id := range ownedIDs {
+		if id == requestedID {
+			return []primitive.ObjectID{id}
+		}
+	}
+	return []primitive.ObjectID{}
+}
+
+// findUserLoan находит кредит, принадлежащий одной из компаний пользователя
+func findUserLoan(db *database.Database, userObjectID, loanID primitive.ObjectID) (*models.Loan, error) {
+	companyIDs, err := getUserCompanyIDs(db, userObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	var loan models.Loan
+	err = db.DB.Collection("loans").FindOne(context.TODO(), bson.M{
+		"_id":        loanID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&loan)
+	if err != nil {
+		return nil, err
+	}
+	return &loan, nil
+}
+
+// loanDayCount возвращает конвенцию подсчета дней кредита (30/360 по умолчанию)
+func loanDayCount(loan *models.Loan) string {
+	if loan.DayCount == "" {
+		return utils.DayCount30360
+	}
+	return loan.DayCount
+}
+
+// loanAccrualStart возвращает дату, с которой начисляются проценты на текущий остаток
+func loanAccrualStart(loan *models.Loan) time.Time {
+	if !loan.LastPaymentDate.IsZero() {
+		return loan.LastPaymentDate
+	}
+	return loan.StartDate
+}
+
+// calculateLoanPayoff рассчитывает сумму полного погашения кредита на дату
+func calculateLoanPayoff(loan *models.Loan, payoffDate time.Time) utils.PayoffAmounts {
+	return utils.CalculatePayoff(
+		loan.RemainingBalance,
+		loan.InterestRate,
+		loanDayCount(loan),
+		loanAccrualStart(loan),
+		payoffDate,
+		loan.PayoffFee+loan.LateFeesOutstanding,
+	)
+}
+
+// activePaymentsFilter отбирает действующие платежи кредита (без аннулированных и сторнированных)
+func activePaymentsFilter(loanID primitive.ObjectID) bson.M {
+	return bson.M{
+		"loan_id": loanID,
+		"status":  bson.M{"$nin": []string{models.PaymentVoided, models.PaymentReversed}},
+	}
+}
+
+// logPaymentEvent записывает действие с платежом в журнал изменений
+func logPaymentEvent(db *database.Database, payment *models.Payment, action, reason string, userID primitive.ObjectID) {
+	event := models.PaymentEvent{
+		PaymentID: payment.ID,
+		LoanID:    payment.LoanID,
+		UserID:    userID,
+		Action:    action,
+		Reason:    reason,
+		TotalPaid: payment.TotalPaid,
+		CreatedAt: time.Now(),
+	}
+	if _, err := db.DB.Collection("payment_events").InsertOne(context.TODO(), event); err != nil {
+		log.Printf("Failed to log payment event: %v", err)
+	}
+}
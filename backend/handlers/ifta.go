@@ -0,0 +1,851 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type IFTAHandler struct {
+	db *database.Database
+}
+
+func NewIFTAHandler(db *database.Database) *IFTAHandler {
+	return &IFTAHandler{db: db}
+}
+
+type SaveIFTARatesRequest struct {
+	Quarter string               `json:"quarter"`
+	Rates   []models.IFTATaxRate `json:"rates"`
+}
+
+type IFTAVehicleMiles struct {
+	VehicleID     string  `json:"vehicle_id"`
+	VehicleName   string  `json:"vehicle_name"`
+	UnitNumber    string  `json:"unit_number,omitempty"`
+	FuelType      string  `json:"fuel_type"`
+	ReportedMiles float64 `json:"reported_miles"`
+	OdometerMiles float64 `json:"odometer_miles"`
+	Gallons       float64 `json:"gallons"`
+}
+
+type IFTAReport struct {
+	CompanyID   string                  `json:"company_id"`
+	CompanyName string                  `json:"company_name"`
+	Quarter     string                  `json:"quarter"`
+	From        string                  `json:"from"`
+	To          string                  `json:"to"`
+	Fuels       []utils.IFTAFuelSummary `json:"fuels"`
+	NetTax      float64                 `json:"net_tax"`
+	Vehicles    []IFTAVehicleMiles      `json:"vehicles"`
+	Warnings    []string                `json:"warnings"`
+}
+
+// Расхождение заявленного пробега по штатам и пробега по одометру, при котором выдается предупреждение
+const iftaMileageTolerance = 0.05
+
+// prepareStateMileage проверяет запись пробега по юрисдикции
+func prepareStateMileage(mileage *models.StateMileage) string {
+	if mileage.TripDate.IsZero() {
+		return "Не указана дата"
+	}
+	mileage.Jurisdiction = strings.ToUpper(strings.TrimSpace(mileage.Jurisdiction))
+	if len(mileage.Jurisdiction) != 2 {
+		return "Юрисдикция указывается двухбуквенным кодом"
+	}
+	if mileage.Miles <= 0 {
+		return "Пробег должен быть больше нуля"
+	}
+	if mileage.NonTaxableMiles < 0 || mileage.NonTaxableMiles > mileage.Miles {
+		return "Необлагаемый пробег должен быть от нуля до общего пробега"
+	}
+	if mileage.Source == "" {
+		mileage.Source = "manual"
+	}
+	mileage.TripDate = time.Date(mileage.TripDate.Year(), mileage.TripDate.Month(), mileage.TripDate.Day(), 0, 0, 0, 0, time.UTC)
+	return ""
+}
+
+// saveIFTARates сохраняет ставки квартала, заменяя ранее загруженные по той же юрисдикции и виду топлива
+func saveIFTARates(db *database.Database, userObjectID primitive.ObjectID, quarter string, rates []models.IFTATaxRate) error {
+	for _, rate := range rates {
+		rate.ID = primitive.NilObjectID
+		rate.UserID = userObjectID
+		rate.Quarter = quarter
+		rate.UpdatedAt = time.Now()
+
+		_, err := db.DB.Collection("ifta_tax_rates").ReplaceOne(context.TODO(), bson.M{
+			"user_id":      userObjectID,
+			"quarter":      quarter,
+			"jurisdiction": rate.Jurisdiction,
+			"fuel_type":    rate.FuelType,
+		}, rate, options.Replace().SetUpsert(true))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// normalizeQuarter приводит квартал к виду 2024Q1
+func normalizeQuarter(value string) (string, string) {
+	from, _, err := utils.ParseQuarter(value)
+	if err != nil {
+		return "", err.Error()
+	}
+	return utils.QuarterKey(from), ""
+}
+
+func (h *IFTAHandler) GetRates(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	filter := bson.M{"user_id": userObjectID}
+	if value := c.Query("quarter"); value != "" {
+		quarter, msg := normalizeQuarter(value)
+		if msg != "" {
+			return c.Status(400).JSON(fiber.Map{"error": msg})
+		}
+		filter["quarter"] = quarter
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "quarter", Value: -1}, {Key: "jurisdiction", Value: 1}, {Key: "fuel_type", Value: 1}})
+	cursor, err := h.db.DB.Collection("ifta_tax_rates").Find(context.TODO(), filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения ставок"})
+	}
+	defer cursor.Close(context.TODO())
+
+	rates := []models.IFTATaxRate{}
+	if err = cursor.All(context.TODO(), &rates); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования ставок"})
+	}
+
+	return c.JSON(rates)
+}
+
+// SaveRates сохраняет ставки квартала из JSON
+func (h *IFTAHandler) SaveRates(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var request SaveIFTARatesRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	quarter, msg := normalizeQuarter(request.Quarter)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if len(request.Rates) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Нет ставок для сохранения"})
+	}
+
+	for i := range request.Rates {
+		rate := &request.Rates[i]
+		rate.Jurisdiction = strings.ToUpper(strings.TrimSpace(rate.Jurisdiction))
+		if rate.FuelType == "" {
+			rate.FuelType = utils.FuelDiesel
+		}
+		if !utils.IsIFTAJurisdiction(rate.Jurisdiction) {
+			return c.Status(400).JSON(fiber.Map{"error": "Неизвестная юрисдикция " + rate.Jurisdiction})
+		}
+		if !utils.IsPropulsionFuel(rate.FuelType) {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный вид топлива"})
+		}
+		if rate.Rate < 0 || rate.SurchargeRate < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Ставка не может быть отрицательной"})
+		}
+	}
+
+	if err := saveIFTARates(h.db, userObjectID, quarter, request.Rates); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения ставок"})
+	}
+
+	return c.JSON(fiber.Map{"quarter": quarter, "saved": len(request.Rates)})
+}
+
+// ImportRates загружает таблицу ставок квартала из CSV (multipart: quarter, file)
+func (h *IFTAHandler) ImportRates(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	quarter, msg := normalizeQuarter(c.FormValue("quarter"))
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Файл не передан"})
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Не удалось прочитать файл"})
+	}
+	defer file.Close()
+
+	rows, rowErrors, err := utils.ParseIFTARatesCSV(file)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	rates := make([]models.IFTATaxRate, 0, len(rows))
+	for _, row := range rows {
+		rates = append(rates, models.IFTATaxRate{
+			Jurisdiction:  row.Jurisdiction,
+			FuelType:      row.FuelType,
+			Rate:          row.Rate,
+			SurchargeRate: row.Surcharge,
+		})
+	}
+
+	if err := saveIFTARates(h.db, userObjectID, quarter, rates); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения ставок"})
+	}
+
+	return c.JSON(fiber.Map{
+		"quarter":  quarter,
+		"imported": len(rates),
+		"errors":   rowErrors,
+	})
+}
+
+func (h *IFTAHandler) GetMileage(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, vehicleID, status, msg := reportScope(c, h.db, userObjectID)
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	if vehicleID != nil {
+		filter["vehicle_id"] = *vehicleID
+	}
+	if value := c.Query("quarter"); value != "" {
+		from, to, err := utils.ParseQuarter(value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+		}
+		filter["trip_date"] = bson.M{"$gte": from, "$lt": to}
+	}
+	if value := c.Query("jurisdiction"); value != "" {
+		filter["jurisdiction"] = strings.ToUpper(value)
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "trip_date", Value: 1}, {Key: "jurisdiction", Value: 1}})
+	cursor, err := h.db.DB.Collection("state_mileage").Find(context.TODO(), filter, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения пробега"})
+	}
+	defer cursor.Close(context.TODO())
+
+	mileage := []models.StateMileage{}
+	if err = cursor.All(context.TODO(), &mileage); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования пробега"})
+	}
+
+	return c.JSON(mileage)
+}
+
+func (h *IFTAHandler) CreateMileage(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var mileage models.StateMileage
+	if err := c.BodyParser(&mileage); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	mileage.Source = "manual"
+	if msg := prepareStateMileage(&mileage); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	vehicle, err := findUserVehicle(h.db, userObjectID, mileage.VehicleID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+
+	mileage.CompanyID = vehicle.CompanyID
+	mileage.CreatedBy = userObjectID
+	mileage.CreatedAt = time.Now()
+
+	result, err := h.db.DB.Collection("state_mileage").InsertOne(context.TODO(), mileage)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения пробега"})
+	}
+
+	mileage.ID = result.InsertedID.(primitive.ObjectID)
+	return c.Status(201).JSON(mileage)
+}
+
+// ImportMileage загружает пробег по штатам из выгрузки ELD (multipart: company_id, file).
+// Повторная загрузка заменяет пробег транспорта за тот же день в той же юрисдикции.
+func (h *IFTAHandler) ImportMileage(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyID, err := primitive.ObjectIDFromHex(c.FormValue("company_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+	}
+
+	count, err := h.db.DB.Collection("companies").CountDocuments(context.TODO(), bson.M{"_id": companyID, "user_id": userObjectID})
+	if err != nil || count == 0 {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Файл не передан"})
+	}
+	file, err := fileHeader.Open()
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Не удалось прочитать файл"})
+	}
+	defer file.Close()
+
+	rows, rowErrors, err := utils.ParseStateMilesCSV(file)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": err.Error()})
+	}
+
+	cursor, err := h.db.DB.Collection("vehicles").Find(context.TODO(), bson.M{"company_id": companyID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения транспорта"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var vehicles []models.Vehicle
+	if err = cursor.All(context.TODO(), &vehicles); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования транспорта"})
+	}
+
+	// Строки ELD за тот же день и штат по одному транспорту суммируются: запись за день
+	// заменяется итогом файла, а не последней строкой
+	type mileageKey struct {
+		vehicleID    primitive.ObjectID
+		tripDate     time.Time
+		jurisdiction string
+	}
+	totals := map[mileageKey]*models.StateMileage{}
+	var order []mileageKey
+
+	imported := 0
+	now := time.Now()
+	for _, row := range rows {
+		vehicle := matchVehicleByUnit(vehicles, row.Unit)
+		if vehicle == nil {
+			rowErrors = append(rowErrors, utils.FuelCSVError{Line: row.Line, Error: "Транспорт с юнитом «" + row.Unit + "» не найден"})
+			continue
+		}
+
+		mileage := models.StateMileage{
+			CompanyID:       companyID,
+			VehicleID:       vehicle.ID,
+			TripDate:        row.Date,
+			Jurisdiction:    row.Jurisdiction,
+			Miles:           row.Miles,
+			NonTaxableMiles: row.NonTaxableMiles,
+			Source:          "import",
+			CreatedBy:       userObjectID,
+			CreatedAt:       now,
+		}
+		if msg := prepareStateMileage(&mileage); msg != "" {
+			rowErrors = append(rowErrors, utils.FuelCSVError{Line: row.Line, Error: msg})
+			continue
+		}
+
+		key := mileageKey{mileage.VehicleID, mileage.TripDate, mileage.Jurisdiction}
+		if total, ok := totals[key]; ok {
+			total.Miles += mileage.Miles
+			total.NonTaxableMiles += mileage.NonTaxableMiles
+		} else {
+			totals[key] = &mileage
+			order = append(order, key)
+		}
+		imported++
+	}
+
+	for _, key := range order {
+		_, err := h.db.DB.Collection("state_mileage").ReplaceOne(context.TODO(), bson.M{
+			"vehicle_id":   key.vehicleID,
+			"trip_date":    key.tripDate,
+			"jurisdiction": key.jurisdiction,
+		}, totals[key], options.Replace().SetUpsert(true))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения пробега"})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"imported": imported,
+		"errors":   rowErrors,
+	})
+}
+
+func (h *IFTAHandler) DeleteMileage(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	mileageID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID записи"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	result, err := h.db.DB.Collection("state_mileage").DeleteOne(context.TODO(), bson.M{
+		"_id":        mileageID,
+		"company_id": bson.M{"$in": companyIDs},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления пробега"})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Запись не найдена"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Запись удалена"})
+}
+
+// buildIFTAReport собирает квартальную декларацию компании: пробег по юрисдикциям из журнала
+// пробега по штатам, купленное топливо из заправок тягачей, ставки из таблицы пользователя.
+// Вид топлива тягача определяется по большей части заправленных за квартал галлонов.
+func buildIFTAReport(db *database.Database, userObjectID primitive.ObjectID, company *models.Company, quarter string, from, to time.Time) (*IFTAReport, error) {
+	report := &IFTAReport{
+		CompanyID:   company.ID.Hex(),
+		CompanyName: company.Name,
+		Quarter:     quarter,
+		From:        from.Format("2006-01-02"),
+		To:          to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Fuels:       []utils.IFTAFuelSummary{},
+		Vehicles:    []IFTAVehicleMiles{},
+		Warnings:    []string{},
+	}
+
+	cursor, err := db.DB.Collection("vehicles").Find(context.TODO(), bson.M{"company_id": company.ID, "type": "truck"})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+	var trucks []models.Vehicle
+	if err = cursor.All(context.TODO(), &trucks); err != nil {
+		return nil, err
+	}
+
+	mileageCursor, err := db.DB.Collection("state_mileage").Find(context.TODO(), bson.M{
+		"company_id": company.ID,
+		"trip_date":  bson.M{"$gte": from, "$lt": to},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer mileageCursor.Close(context.TODO())
+	var mileage []models.StateMileage
+	if err = mileageCursor.All(context.TODO(), &mileage); err != nil {
+		return nil, err
+	}
+
+	purchases, err := loadFuelPurchases(db, []primitive.ObjectID{company.ID}, nil, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	rateCursor, err := db.DB.Collection("ifta_tax_rates").Find(context.TODO(), bson.M{"user_id": userObjectID, "quarter": quarter})
+	if err != nil {
+		return nil, err
+	}
+	defer rateCursor.Close(context.TODO())
+	var rateList []models.IFTATaxRate
+	if err = rateCursor.All(context.TODO(), &rateList); err != nil {
+		return nil, err
+	}
+	rates := map[string]map[string]utils.IFTARate{}
+	for _, rate := range rateList {
+		if rates[rate.FuelType] == nil {
+			rates[rate.FuelType] = map[string]utils.IFTARate{}
+		}
+		rates[rate.FuelType][rate.Jurisdiction] = utils.IFTARate{Rate: rate.Rate, Surcharge: rate.SurchargeRate}
+	}
+	if len(rateList) == 0 {
+		report.Warnings = append(report.Warnings, "Нет ставок налога за "+quarter+": загрузите таблицу ставок")
+	}
+
+	// Пробег и топливо по тягачам
+	type truckTotals struct {
+		miles, taxableMiles map[string]float64
+		gallons             map[string]map[string]float64 // вид топлива -> юрисдикция -> галлоны
+	}
+	totals := map[primitive.ObjectID]*truckTotals{}
+	truckByID := map[primitive.ObjectID]*models.Vehicle{}
+	for i := range trucks {
+		truckByID[trucks[i].ID] = &trucks[i]
+		totals[trucks[i].ID] = &truckTotals{
+			miles:        map[string]float64{},
+			taxableMiles: map[string]float64{},
+			gallons:      map[string]map[string]float64{},
+		}
+	}
+
+	for _, record := range mileage {
+		truck, ok := totals[record.VehicleID]
+		if !ok {
+			continue
+		}
+		truck.miles[record.Jurisdiction] += record.Miles
+		truck.taxableMiles[record.Jurisdiction] += record.Miles - record.NonTaxableMiles
+	}
+
+	missingState := 0
+	for _, purchase := range purchases {
+		truck, ok := totals[purchase.VehicleID]
+		if !ok || !utils.IsPropulsionFuel(purchase.FuelType) {
+			continue
+		}
+		state := purchase.State
+		if state == "" {
+			// Топливо без штата входит в расчет MPG, но не дает зачета
+			state = "??"
+			missingState++
+		}
+		if truck.gallons[purchase.FuelType] == nil {
+			truck.gallons[purchase.FuelType] = map[string]float64{}
+		}
+		truck.gallons[purchase.FuelType][state] += purchase.Gallons
+	}
+	if missingState > 0 {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("Заправок без штата: %d — налог по ним не зачитывается", missingState))
+	}
+
+	milesByFuel := map[string]map[string]float64{}
+	taxableByFuel := map[string]map[string]float64{}
+	gallonsByFuel := map[string]map[string]float64{}
+	addTo := func(target map[string]map[string]float64, fuelType string, values map[string]float64) {
+		if target[fuelType] == nil {
+			target[fuelType] = map[string]float64{}
+		}
+		for code, value := range values {
+			target[fuelType][code] += value
+		}
+	}
+
+	for i := range trucks {
+		truck := &trucks[i]
+		truckData := totals[truck.ID]
+
+		fuelType, fuelGallons, totalGallons := utils.FuelDiesel, 0.0, 0.0
+		for currentType, byState := range truckData.gallons {
+			sum := 0.0
+			for _, value := range byState {
+				sum += value
+			}
+			totalGallons += sum
+			if sum > fuelGallons {
+				fuelType, fuelGallons = currentType, sum
+			}
+		}
+
+		reportedMiles := 0.0
+		for _, value := range truckData.miles {
+			reportedMiles += value
+		}
+		if reportedMiles == 0 && totalGallons == 0 {
+			continue
+		}
+
+		readings, err := loadVehicleReadings(db, truck.ID)
+		if err != nil {
+			return nil, err
+		}
+		points := meterPoints(readings)
+		startMiles, _ := utils.MeterAt(points, from)
+		endMiles, _ := utils.MeterAt(points, to)
+		odometerMiles := math.Max(0, endMiles-startMiles)
+
+		report.Vehicles = append(report.Vehicles, IFTAVehicleMiles{
+			VehicleID:     truck.ID.Hex(),
+			VehicleName:   vehicleTitle(truck),
+			UnitNumber:    truck.UnitNumber,
+			FuelType:      fuelType,
+			ReportedMiles: math.Round(reportedMiles),
+			OdometerMiles: math.Round(odometerMiles),
+			Gallons:       math.Round(totalGallons*100) / 100,
+		})
+
+		name := vehicleTitle(truck)
+		if truck.UnitNumber != "" {
+			name = truck.UnitNumber + " " + name
+		}
+		switch {
+		case reportedMiles == 0:
+			report.Warnings = append(report.Warnings, name+": есть заправки, но нет пробега по штатам")
+		case odometerMiles > 0 && math.Abs(reportedMiles-odometerMiles)/odometerMiles > iftaMileageTolerance:
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s: пробег по штатам %.0f mi расходится с одометром %.0f mi", name, reportedMiles, odometerMiles))
+		}
+		if len(truckData.gallons) > 1 {
+			report.Warnings = append(report.Warnings, name+": заправки разными видами топлива, пробег отнесен к "+fuelType)
+		}
+
+		addTo(milesByFuel, fuelType, truckData.miles)
+		addTo(taxableByFuel, fuelType, truckData.taxableMiles)
+		for currentType, byState := range truckData.gallons {
+			addTo(gallonsByFuel, currentType, byState)
+		}
+	}
+
+	fuelTypes := map[string]bool{}
+	for fuelType := range milesByFuel {
+		fuelTypes[fuelType] = true
+	}
+	for fuelType := range gallonsByFuel {
+		fuelTypes[fuelType] = true
+	}
+	sortedFuels := make([]string, 0, len(fuelTypes))
+	for fuelType := range fuelTypes {
+		sortedFuels = append(sortedFuels, fuelType)
+	}
+	sort.Strings(sortedFuels)
+
+	for _, fuelType := range sortedFuels {
+		summary := utils.CalculateIFTA(fuelType, milesByFuel[fuelType], taxableByFuel[fuelType], gallonsByFuel[fuelType], rates[fuelType])
+		for _, line := range summary.Jurisdictions {
+			if line.RateMissing {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("Нет ставки %s для %s", fuelType, line.Jurisdiction))
+			}
+			if !utils.IsIFTAJurisdiction(line.Jurisdiction) && line.Jurisdiction != "??" {
+				report.Warnings = append(report.Warnings, line.Jurisdiction+": юрисдикция вне IFTA, налог не декларируется")
+			}
+		}
+		report.NetTax += summary.NetTax
+		report.Fuels = append(report.Fuels, summary)
+	}
+	report.NetTax = math.Round(report.NetTax*100) / 100
+
+	return report, nil
+}
+
+// iftaReportCSV выгружает декларацию в CSV: строки по юрисдикциям для каждого вида топлива
+func iftaReportCSV(report *IFTAReport) ([]byte, error) {
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	number := func(value float64, decimals int) string {
+		return fmt.Sprintf("%.*f", decimals, value)
+	}
+
+	records := [][]string{
+		{"Company", report.CompanyName},
+		{"Quarter", report.Quarter, report.From, report.To},
+		{},
+		{"Fuel type", "Jurisdiction", "Total miles", "Taxable miles", "Taxable gallons", "Tax-paid gallons",
+			"Net taxable gallons", "Tax rate", "Tax due", "Surcharge rate", "Surcharge", "Net tax"},
+	}
+	for _, fuel := range report.Fuels {
+		for _, line := range fuel.Jurisdictions {
+			records = append(records, []string{
+				fuel.FuelType, line.Jurisdiction,
+				number(line.TotalMiles, 0), number(line.TaxableMiles, 0),
+				number(line.TaxableGallons, 2), number(line.TaxPaidGallons, 2), number(line.NetTaxableGallons, 2),
+				number(line.TaxRate, 4), number(line.Tax, 2),
+				number(line.SurchargeRate, 4), number(line.Surcharge, 2), number(line.NetTax, 2),
+			})
+		}
+		records = append(records, []string{
+			fuel.FuelType, "TOTAL",
+			number(fuel.TotalMiles, 0), number(fuel.TaxableMiles, 0),
+			"", number(fuel.TotalGallons, 2), "", "MPG " + number(fuel.FleetMPG, 2),
+			number(fuel.TotalTax, 2), "", number(fuel.TotalSurcharge, 2), number(fuel.NetTax, 2),
+		})
+	}
+	records = append(records, []string{}, []string{"Net tax due", number(report.NetTax, 2)})
+
+	if err := writer.WriteAll(records); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// iftaReportPDF формирует печатную форму декларации
+func iftaReportPDF(report *IFTAReport) []byte {
+	doc := utils.NewPDFDocument()
+	doc.Line("IFTA Quarterly Fuel Tax Report", 14, true)
+	doc.Line(fmt.Sprintf("Carrier: %s", report.CompanyName), 10, false)
+	doc.Line(fmt.Sprintf("Quarter: %s (%s - %s)", report.Quarter, report.From, report.To), 10, false)
+	doc.Space(8)
+
+	widths := []int{4, -8, -8, -10, -10, -10, -7, -10, -9}
+	for _, fuel := range report.Fuels {
+		doc.Line(fmt.Sprintf("Fuel: %s   Total miles: %.0f   Total gallons: %.2f   Fleet MPG: %.2f",
+			strings.ToUpper(fuel.FuelType), fuel.TotalMiles, fuel.TotalGallons, fuel.FleetMPG), 9, true)
+		doc.Line(utils.PDFColumns(widths, "Jur", "Miles", "Taxable", "Tax gal", "Paid gal", "Net gal", "Rate", "Tax", "Surch"), 8, true)
+		for _, line := range fuel.Jurisdictions {
+			doc.Line(utils.PDFColumns(widths, line.Jurisdiction,
+				fmt.Sprintf("%.0f", line.TotalMiles), fmt.Sprintf("%.0f", line.TaxableMiles),
+				fmt.Sprintf("%.2f", line.TaxableGallons), fmt.Sprintf("%.2f", line.TaxPaidGallons),
+				fmt.Sprintf("%.2f", line.NetTaxableGallons), fmt.Sprintf("%.4f", line.TaxRate),
+				fmt.Sprintf("%.2f", line.Tax), fmt.Sprintf("%.2f", line.Surcharge)), 8, false)
+		}
+		doc.Line(utils.PDFColumns(widths, "TOT",
+			fmt.Sprintf("%.0f", fuel.TotalMiles), fmt.Sprintf("%.0f", fuel.TaxableMiles), "",
+			fmt.Sprintf("%.2f", fuel.TotalGallons), "", "",
+			fmt.Sprintf("%.2f", fuel.TotalTax), fmt.Sprintf("%.2f", fuel.TotalSurcharge)), 8, true)
+		doc.Line(fmt.Sprintf("Net tax %s: %.2f", fuel.FuelType, fuel.NetTax), 9, true)
+		doc.Space(8)
+	}
+
+	label := "NET TAX DUE"
+	if report.NetTax < 0 {
+		label = "NET CREDIT"
+	}
+	doc.Line(fmt.Sprintf("%s: %.2f", label, math.Abs(report.NetTax)), 11, true)
+	doc.Space(8)
+
+	if len(report.Vehicles) > 0 {
+		vehicleWidths := []int{28, 8, -12, -12, -10}
+		doc.Line("Qualified vehicles", 9, true)
+		doc.Line(utils.PDFColumns(vehicleWidths, "Vehicle", "Fuel", "State miles", "Odometer", "Gallons"), 8, true)
+		for _, vehicle := range report.Vehicles {
+			name := vehicle.VehicleName
+			if vehicle.UnitNumber != "" {
+				name = vehicle.UnitNumber + " " + name
+			}
+			if len(name) > 28 {
+				name = name[:28]
+			}
+			doc.Line(utils.PDFColumns(vehicleWidths, name, vehicle.FuelType,
+				fmt.Sprintf("%.0f", vehicle.ReportedMiles), fmt.Sprintf("%.0f", vehicle.OdometerMiles),
+				fmt.Sprintf("%.2f", vehicle.Gallons)), 8, false)
+		}
+	}
+
+	return doc.Bytes()
+}
+
+// GetReport формирует квартальную декларацию IFTA по компании (format=json|csv|pdf)
+func (h *IFTAHandler) GetReport(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyID, err := primitive.ObjectIDFromHex(c.Query("company_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+	}
+
+	quarterValue := c.Query("quarter")
+	if quarterValue == "" {
+		// По умолчанию — последний завершенный квартал
+		quarterValue = utils.QuarterKey(time.Now().AddDate(0, -3, 0))
+	}
+	quarter, msg := normalizeQuarter(quarterValue)
+	if msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	from, to, _ := utils.ParseQuarter(quarter)
+
+	var company models.Company
+	err = h.db.DB.Collection("companies").FindOne(context.TODO(), bson.M{"_id": companyID, "user_id": userObjectID}).Decode(&company)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	report, err := buildIFTAReport(h.db, userObjectID, &company, quarter, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка формирования отчета IFTA"})
+	}
+
+	fileName := "ifta_" + quarter
+	switch c.Query("format") {
+	case "csv":
+		data, err := iftaReportCSV(report)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка формирования CSV"})
+		}
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+fileName+`.csv"`)
+		return c.Send(data)
+	case "pdf":
+		c.Set(fiber.HeaderContentType, "application/pdf")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+fileName+`.pdf"`)
+		return c.Send(iftaReportPDF(report))
+	}
+
+	return c.JSON(report)
+}
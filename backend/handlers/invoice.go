@@ -0,0 +1,1021 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type InvoiceHandler struct {
+	db *database.Database
+}
+
+func NewInvoiceHandler(db *database.Database) *InvoiceHandler {
+	return &InvoiceHandler{db: db}
+}
+
+// CreateInvoiceRequest — выставление счета по доставленным рейсам одного брокера
+type CreateInvoiceRequest struct {
+	CompanyID     primitive.ObjectID   `json:"company_id"`
+	LoadIDs       []primitive.ObjectID `json:"load_ids"`
+	BillTo        string               `json:"bill_to"`
+	BillToAddress string               `json:"bill_to_address"`
+	InvoiceDate   time.Time            `json:"invoice_date"`
+	TermsDays     *int                 `json:"terms_days"`
+	Notes         string               `json:"notes"`
+}
+
+// UpdateInvoiceRequest — изменение реквизитов черновика счета
+type UpdateInvoiceRequest struct {
+	BillTo        string    `json:"bill_to"`
+	BillToAddress string    `json:"bill_to_address"`
+	BrokerMC      string    `json:"broker_mc"`
+	InvoiceDate   time.Time `json:"invoice_date"`
+	TermsDays     *int      `json:"terms_days"`
+	Notes         string    `json:"notes"`
+}
+
+type ReceivableBucketTotals struct {
+	InvoicesCount int     `json:"invoices_count"`
+	Balance       float64 `json:"balance"`
+}
+
+type BrokerAging struct {
+	Broker  string             `json:"broker"`
+	Buckets map[string]float64 `json:"buckets"`
+	Total   float64            `json:"total"`
+}
+
+type ReceivablesAgingItem struct {
+	CompanyID   string                            `json:"company_id"`
+	CompanyName string                            `json:"company_name"`
+	Buckets     map[string]ReceivableBucketTotals `json:"buckets"`
+	Total       float64                           `json:"total"`
+	Brokers     []BrokerAging                     `json:"brokers"`
+}
+
+// validateInvoiceSettings проверяет настройки счетов компании
+func validateInvoiceSettings(settings *models.InvoiceSettings) string {
+	settings.Prefix = strings.TrimSpace(settings.Prefix)
+	if settings.PaymentTermsDays < 0 {
+		return "Срок оплаты счетов не может быть отрицательным"
+	}
+	return ""
+}
+
+// invoiceDefaults возвращает префикс нумерации и срок оплаты компании с учетом значений по умолчанию
+func invoiceDefaults(company *models.Company) (string, int) {
+	prefix := company.Invoicing.Prefix
+	if prefix == "" {
+		prefix = utils.DefaultInvoicePrefix
+	}
+	terms := company.Invoicing.PaymentTermsDays
+	if terms == 0 {
+		terms = utils.DefaultInvoiceTermsDays
+	}
+	return prefix, terms
+}
+
+// nextInvoiceSequence выдает следующий порядковый номер счета компании.
+// Счетчик хранится отдельно от компании, чтобы обновление компании его не затирало.
+func nextInvoiceSequence(db *database.Database, companyID primitive.ObjectID) (int, error) {
+	var counter struct {
+		Next int `bson:"next"`
+	}
+	err := db.DB.Collection("invoice_counters").FindOneAndUpdate(context.TODO(),
+		bson.M{"company_id": companyID},
+		bson.M{"$inc": bson.M{"next": 1}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&counter)
+	return counter.Next, err
+}
+
+// sameBroker сравнивает названия брокеров без учета регистра и пробелов по краям
+func sameBroker(a, b string) bool {
+	return strings.EqualFold(strings.TrimSpace(a), strings.TrimSpace(b))
+}
+
+// invoiceLines формирует строки счета по рейсам: линейный тариф, fuel surcharge и доп. начисления
+func invoiceLines(loads []models.Load) []models.InvoiceLine {
+	lines := []models.InvoiceLine{}
+	for i := range loads {
+		load := &loads[i]
+		loadID := load.ID
+		lines = append(lines, models.InvoiceLine{
+			LoadID:      &loadID,
+			Description: fmt.Sprintf("Load %s: %s -> %s, linehaul", load.LoadNumber, load.PickupLocation, load.DeliveryLocation),
+			Amount:      load.Rate,
+		})
+		if load.FuelSurcharge > 0 {
+			lines = append(lines, models.InvoiceLine{
+				LoadID:      &loadID,
+				Description: fmt.Sprintf("Load %s: fuel surcharge", load.LoadNumber),
+				Amount:      load.FuelSurcharge,
+			})
+		}
+		for _, accessorial := range load.Accessorials {
+			description := fmt.Sprintf("Load %s: %s", load.LoadNumber, accessorial.Type)
+			if accessorial.Description != "" {
+				description += " - " + accessorial.Description
+			}
+			lines = append(lines, models.InvoiceLine{LoadID: &loadID, Description: description, Amount: accessorial.Amount})
+		}
+	}
+	return lines
+}
+
+// invoiceTotal суммирует строки счета
+func invoiceTotal(lines []models.InvoiceLine) float64 {
+	total := 0.0
+	for _, line := range lines {
+		total += line.Amount
+	}
+	return roundMoney(total)
+}
+
+// setInvoiceStatus выставляет просрочку на дату выдачи
+func setInvoiceStatus(invoice *models.Invoice, asOf time.Time) {
+	invoice.Status = utils.InvoiceEffectiveStatus(invoice.Status, invoice.DueDate, invoice.Balance, asOf)
+	if invoice.Status == utils.InvoiceSent || invoice.Status == utils.InvoiceOverdue {
+		invoice.DaysPastDue = utils.InvoiceDaysPastDue(invoice.DueDate, asOf)
+	}
+}
+
+// findUserInvoice находит счет, принадлежащий одной из компаний пользователя
+func findUserInvoice(db *database.Database, userObjectID, invoiceID primitive.ObjectID) (*models.Invoice, error) {
+	companyIDs, err := getUserCompanyIDs(db, userObjectID)
+	if err != nil {
+		return nil, err
+	}
+
+	var invoice models.Invoice
+	err = db.DB.Collection("invoices").FindOne(context.TODO(), bson.M{
+		"_id":        invoiceID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&invoice)
+	if err != nil {
+		return nil, err
+	}
+	return &invoice, nil
+}
+
+// loadInvoicePayments возвращает оплаты счета по дате поступления
+func loadInvoicePayments(db *database.Database, invoiceID primitive.ObjectID) ([]models.InvoicePayment, error) {
+	cursor, err := db.DB.Collection("invoice_payments").Find(context.TODO(), bson.M{"invoice_id": invoiceID},
+		options.Find().SetSort(bson.M{"payment_date": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	payments := []models.InvoicePayment{}
+	if err = cursor.All(context.TODO(), &payments); err != nil {
+		return nil, err
+	}
+	return payments, nil
+}
+
+// applyInvoicePayments пересчитывает оплаченную сумму, остаток и статус счета по его оплатам и списанию
+func applyInvoicePayments(db *database.Database, invoice *models.Invoice) error {
+	payments, err := loadInvoicePayments(db, invoice.ID)
+	if err != nil {
+		return err
+	}
+
+	paid := 0.0
+	var lastPayment time.Time
+	for _, payment := range payments {
+		paid += payment.Amount
+		if payment.PaymentDate.After(lastPayment) {
+			lastPayment = payment.PaymentDate
+		}
+	}
+	invoice.AmountPaid = roundMoney(paid)
+	invoice.Balance = roundMoney(invoice.Total - invoice.AmountPaid - invoice.WrittenOff)
+
+	set := bson.M{"amount_paid": invoice.AmountPaid, "balance": invoice.Balance, "updated_at": time.Now()}
+	update := bson.M{"$set": set}
+	if invoice.Balance <= 0.005 {
+		invoice.Status = utils.InvoicePaid
+		invoice.PaidAt = lastPayment
+		set["paid_at"] = lastPayment
+	} else {
+		invoice.Status = utils.InvoiceSent
+		invoice.PaidAt = time.Time{}
+		update["$unset"] = bson.M{"paid_at": ""}
+	}
+	set["status"] = invoice.Status
+
+	_, err = db.DB.Collection("invoices").UpdateOne(context.TODO(), bson.M{"_id": invoice.ID}, update)
+	return err
+}
+
+// releaseInvoiceLoads снимает привязку рейсов к счету
+func releaseInvoiceLoads(db *database.Database, invoiceID primitive.ObjectID) error {
+	_, err := db.DB.Collection("loads").UpdateMany(context.TODO(),
+		bson.M{"invoice_id": invoiceID},
+		bson.M{"$unset": bson.M{"invoice_id": ""}},
+	)
+	return err
+}
+
+// GetInvoices возвращает счета. Фильтры: company_id, status (включая overdue), broker
+func (h *InvoiceHandler) GetInvoices(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		companyIDs = filterOwnedIDs(companyIDs, companyObjectID)
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	status := c.Query("status")
+	if status == utils.InvoiceOverdue {
+		filter["status"] = utils.InvoiceSent
+	} else if status != "" {
+		filter["status"] = status
+	}
+	if broker := strings.TrimSpace(c.Query("broker")); broker != "" {
+		filter["bill_to"] = bson.M{"$regex": "^" + regexp.QuoteMeta(broker) + "$", "$options": "i"}
+	}
+
+	cursor, err := h.db.DB.Collection("invoices").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"invoice_date": -1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения счетов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var invoices []models.Invoice
+	if err = cursor.All(context.TODO(), &invoices); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования счетов"})
+	}
+
+	asOf := time.Now()
+	result := []models.Invoice{}
+	for i := range invoices {
+		setInvoiceStatus(&invoices[i], asOf)
+		if status == utils.InvoiceSent || status == utils.InvoiceOverdue {
+			if invoices[i].Status != status {
+				continue
+			}
+		}
+		result = append(result, invoices[i])
+	}
+
+	return c.JSON(result)
+}
+
+// GetInvoice возвращает счет вместе с оплатами
+func (h *InvoiceHandler) GetInvoice(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID счета"})
+	}
+
+	invoice, err := findUserInvoice(h.db, userObjectID, invoiceID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Счет не найден"})
+	}
+
+	payments, err := loadInvoicePayments(h.db, invoice.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения оплат"})
+	}
+
+	setInvoiceStatus(invoice, time.Now())
+	return c.JSON(fiber.Map{
+		"invoice":  invoice,
+		"payments": payments,
+	})
+}
+
+// CreateInvoice выставляет счет-черновик по доставленным рейсам одного брокера.
+// Номер присваивается сразу из счетчика компании, рейсы привязываются к счету.
+func (h *InvoiceHandler) CreateInvoice(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var req CreateInvoiceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+	seen := map[primitive.ObjectID]bool{}
+	loadIDs := []primitive.ObjectID{}
+	for _, id := range req.LoadIDs {
+		if !seen[id] {
+			seen[id] = true
+			loadIDs = append(loadIDs, id)
+		}
+	}
+	req.LoadIDs = loadIDs
+	if len(req.LoadIDs) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Не указаны рейсы для счета"})
+	}
+	if req.TermsDays != nil && *req.TermsDays < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Срок оплаты не может быть отрицательным"})
+	}
+
+	var company models.Company
+	err = h.db.DB.Collection("companies").FindOne(context.TODO(), bson.M{"_id": req.CompanyID, "user_id": userObjectID}).Decode(&company)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	cursor, err := h.db.DB.Collection("loads").Find(context.TODO(),
+		bson.M{"_id": bson.M{"$in": req.LoadIDs}, "company_id": company.ID},
+		options.Find().SetSort(bson.M{"delivery_date": 1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения рейсов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var loads []models.Load
+	if err = cursor.All(context.TODO(), &loads); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования рейсов"})
+	}
+	if len(loads) != len(req.LoadIDs) {
+		return c.Status(404).JSON(fiber.Map{"error": "Рейс не найден в компании счета"})
+	}
+
+	for i := range loads {
+		if loads[i].Status != utils.LoadDelivered {
+			return c.Status(400).JSON(fiber.Map{"error": "Рейс " + loads[i].LoadNumber + " еще не доставлен"})
+		}
+		if loads[i].InvoiceID != nil {
+			return c.Status(409).JSON(fiber.Map{"error": "Рейс " + loads[i].LoadNumber + " уже выставлен в счете"})
+		}
+		if !sameBroker(loads[i].Broker, loads[0].Broker) {
+			return c.Status(400).JSON(fiber.Map{"error": "В одном счете могут быть только рейсы одного брокера"})
+		}
+	}
+
+	prefix, terms := invoiceDefaults(&company)
+	if req.TermsDays != nil {
+		terms = *req.TermsDays
+	}
+	invoiceDate := req.InvoiceDate
+	if invoiceDate.IsZero() {
+		invoiceDate = time.Now()
+	}
+	invoiceDate = time.Date(invoiceDate.Year(), invoiceDate.Month(), invoiceDate.Day(), 0, 0, 0, 0, time.UTC)
+
+	billTo := strings.TrimSpace(req.BillTo)
+	if billTo == "" {
+		billTo = strings.TrimSpace(loads[0].Broker)
+	}
+	if billTo == "" {
+		return c.Status(400).JSON(fiber.Map{"error": "Не указан плательщик счета"})
+	}
+
+	sequence, err := nextInvoiceSequence(h.db, company.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения номера счета"})
+	}
+
+	invoice := models.Invoice{
+		CompanyID:     company.ID,
+		InvoiceNumber: utils.FormatInvoiceNumber(prefix, sequence),
+		Sequence:      sequence,
+		BillTo:        billTo,
+		BillToAddress: req.BillToAddress,
+		BrokerMC:      loads[0].BrokerMC,
+		LoadIDs:       req.LoadIDs,
+		Lines:         invoiceLines(loads),
+		InvoiceDate:   invoiceDate,
+		TermsDays:     terms,
+		DueDate:       invoiceDate.AddDate(0, 0, terms),
+		Status:        utils.InvoiceDraft,
+		Notes:         req.Notes,
+		CreatedBy:     userObjectID,
+		CreatedAt:     time.Now(),
+		UpdatedAt:     time.Now(),
+	}
+	invoice.Total = invoiceTotal(invoice.Lines)
+	invoice.Balance = invoice.Total
+
+	result, err := h.db.DB.Collection("invoices").InsertOne(context.TODO(), invoice)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания счета"})
+	}
+	invoice.ID = result.InsertedID.(primitive.ObjectID)
+
+	// Привязка рейсов; если рейс успели выставить в другом счете — откатываем
+	updated, err := h.db.DB.Collection("loads").UpdateMany(context.TODO(),
+		bson.M{"_id": bson.M{"$in": req.LoadIDs}, "invoice_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"invoice_id": invoice.ID}},
+	)
+	if err != nil || updated.ModifiedCount != int64(len(req.LoadIDs)) {
+		releaseInvoiceLoads(h.db, invoice.ID)
+		h.db.DB.Collection("invoices").DeleteOne(context.TODO(), bson.M{"_id": invoice.ID})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка привязки рейсов к счету"})
+		}
+		return c.Status(409).JSON(fiber.Map{"error": "Рейс уже выставлен в другом счете"})
+	}
+
+	return c.Status(201).JSON(invoice)
+}
+
+// UpdateInvoice изменяет реквизиты черновика счета; строки пересчитываются по рейсам
+func (h *InvoiceHandler) UpdateInvoice(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID счета"})
+	}
+
+	var req UpdateInvoiceRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+	if req.TermsDays != nil && *req.TermsDays < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Срок оплаты не может быть отрицательным"})
+	}
+
+	invoice, err := findUserInvoice(h.db, userObjectID, invoiceID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Счет не найден"})
+	}
+	if invoice.Status != utils.InvoiceDraft {
+		return c.Status(409).JSON(fiber.Map{"error": "Изменять можно только черновик счета"})
+	}
+
+	if billTo := strings.TrimSpace(req.BillTo); billTo != "" {
+		invoice.BillTo = billTo
+	}
+	if req.BillToAddress != "" {
+		invoice.BillToAddress = req.BillToAddress
+	}
+	if req.BrokerMC != "" {
+		invoice.BrokerMC = req.BrokerMC
+	}
+	if !req.InvoiceDate.IsZero() {
+		invoice.InvoiceDate = time.Date(req.InvoiceDate.Year(), req.InvoiceDate.Month(), req.InvoiceDate.Day(), 0, 0, 0, 0, time.UTC)
+	}
+	if req.TermsDays != nil {
+		invoice.TermsDays = *req.TermsDays
+	}
+	invoice.DueDate = invoice.InvoiceDate.AddDate(0, 0, invoice.TermsDays)
+	if req.Notes != "" {
+		invoice.Notes = req.Notes
+	}
+
+	cursor, err := h.db.DB.Collection("loads").Find(context.TODO(), bson.M{"invoice_id": invoice.ID},
+		options.Find().SetSort(bson.M{"delivery_date": 1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения рейсов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var loads []models.Load
+	if err = cursor.All(context.TODO(), &loads); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования рейсов"})
+	}
+	invoice.Lines = invoiceLines(loads)
+	invoice.Total = invoiceTotal(invoice.Lines)
+	invoice.Balance = invoice.Total
+	invoice.UpdatedAt = time.Now()
+
+	_, err = h.db.DB.Collection("invoices").ReplaceOne(context.TODO(), bson.M{"_id": invoice.ID}, invoice)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления счета"})
+	}
+
+	return c.JSON(invoice)
+}
+
+// SendInvoice отмечает черновик отправленным брокеру; с этого момента начинается срок оплаты
+func (h *InvoiceHandler) SendInvoice(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID счета"})
+	}
+
+	invoice, err := findUserInvoice(h.db, userObjectID, invoiceID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Счет не найден"})
+	}
+	if invoice.Status != utils.InvoiceDraft {
+		return c.Status(409).JSON(fiber.Map{"error": "Счет уже отправлен"})
+	}
+
+	invoice.Status = utils.InvoiceSent
+	invoice.SentAt = time.Now()
+	invoice.UpdatedAt = time.Now()
+	_, err = h.db.DB.Collection("invoices").UpdateOne(context.TODO(), bson.M{"_id": invoice.ID}, bson.M{"$set": bson.M{
+		"status":     invoice.Status,
+		"sent_at":    invoice.SentAt,
+		"updated_at": invoice.UpdatedAt,
+	}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления счета"})
+	}
+
+	setInvoiceStatus(invoice, time.Now())
+	return c.JSON(invoice)
+}
+
+// AddPayment записывает поступление оплаты по отправленному счету (допускается частичная оплата)
+func (h *InvoiceHandler) AddPayment(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID счета"})
+	}
+
+	var payment models.InvoicePayment
+	if err := c.BodyParser(&payment); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+	payment.Amount = roundMoney(payment.Amount)
+	if payment.Amount <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Сумма оплаты должна быть больше нуля"})
+	}
+	if payment.Method == "" {
+		payment.Method = utils.InvoicePaymentACH
+	}
+	if !utils.IsValidInvoicePaymentMethod(payment.Method) {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный способ оплаты"})
+	}
+	if payment.PaymentDate.IsZero() {
+		payment.PaymentDate = time.Now()
+	}
+
+	invoice, err := findUserInvoice(h.db, userObjectID, invoiceID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Счет не найден"})
+	}
+	switch invoice.Status {
+	case utils.InvoiceDraft:
+		return c.Status(409).JSON(fiber.Map{"error": "Счет еще не отправлен"})
+	case utils.InvoicePaid:
+		return c.Status(409).JSON(fiber.Map{"error": "Счет уже оплачен"})
+	case utils.InvoiceVoid:
+		return c.Status(409).JSON(fiber.Map{"error": "Счет аннулирован"})
+	}
+	if invoice.FactorID != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Счет передан фактору, оплата записывается при инкассации факторинга"})
+	}
+	if payment.Amount > invoice.Balance+0.005 {
+		return c.Status(400).JSON(fiber.Map{"error": fmt.Sprintf("Сумма оплаты превышает остаток по счету (%.2f)", invoice.Balance)})
+	}
+
+	payment.ID = primitive.NilObjectID
+	payment.InvoiceID = invoice.ID
+	payment.CompanyID = invoice.CompanyID
+	payment.CreatedBy = userObjectID
+	payment.CreatedAt = time.Now()
+
+	result, err := h.db.DB.Collection("invoice_payments").InsertOne(context.TODO(), payment)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения оплаты"})
+	}
+	payment.ID = result.InsertedID.(primitive.ObjectID)
+
+	if err := applyInvoicePayments(h.db, invoice); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления счета"})
+	}
+
+	setInvoiceStatus(invoice, time.Now())
+	return c.Status(201).JSON(fiber.Map{
+		"payment": payment,
+		"invoice": invoice,
+	})
+}
+
+// DeletePayment удаляет ошибочно записанную оплату и пересчитывает остаток счета
+func (h *InvoiceHandler) DeletePayment(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID счета"})
+	}
+
+	paymentID, err := primitive.ObjectIDFromHex(c.Params("paymentId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID оплаты"})
+	}
+
+	invoice, err := findUserInvoice(h.db, userObjectID, invoiceID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Счет не найден"})
+	}
+
+	var payment models.InvoicePayment
+	err = h.db.DB.Collection("invoice_payments").FindOne(context.TODO(), bson.M{"_id": paymentID, "invoice_id": invoice.ID}).Decode(&payment)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Оплата не найдена"})
+	}
+	if payment.Method == utils.InvoicePaymentFactoring {
+		return c.Status(409).JSON(fiber.Map{"error": "Оплата через фактора записана инкассацией факторинга и не удаляется"})
+	}
+
+	if _, err := h.db.DB.Collection("invoice_payments").DeleteOne(context.TODO(), bson.M{"_id": payment.ID}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления оплаты"})
+	}
+
+	if err := applyInvoicePayments(h.db, invoice); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления счета"})
+	}
+
+	setInvoiceStatus(invoice, time.Now())
+	return c.JSON(invoice)
+}
+
+// VoidInvoice аннулирует счет без оплат; рейсы освобождаются для нового счета
+func (h *InvoiceHandler) VoidInvoice(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID счета"})
+	}
+
+	invoice, err := findUserInvoice(h.db, userObjectID, invoiceID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Счет не найден"})
+	}
+	if invoice.Status == utils.InvoiceVoid {
+		return c.Status(409).JSON(fiber.Map{"error": "Счет уже аннулирован"})
+	}
+	if invoice.AmountPaid > 0 {
+		return c.Status(409).JSON(fiber.Map{"error": "По счету есть оплаты, сначала удалите их"})
+	}
+	if invoice.FactorID != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Счет передан фактору"})
+	}
+
+	invoice.Status = utils.InvoiceVoid
+	invoice.Balance = 0
+	invoice.UpdatedAt = time.Now()
+	_, err = h.db.DB.Collection("invoices").UpdateOne(context.TODO(), bson.M{"_id": invoice.ID}, bson.M{"$set": bson.M{
+		"status":     invoice.Status,
+		"balance":    invoice.Balance,
+		"updated_at": invoice.UpdatedAt,
+	}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка аннулирования счета"})
+	}
+
+	if err := releaseInvoiceLoads(h.db, invoice.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка освобождения рейсов"})
+	}
+
+	return c.JSON(invoice)
+}
+
+// DeleteInvoice удаляет черновик счета; отправленные счета только аннулируются, чтобы не терять нумерацию
+func (h *InvoiceHandler) DeleteInvoice(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID счета"})
+	}
+
+	invoice, err := findUserInvoice(h.db, userObjectID, invoiceID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Счет не найден"})
+	}
+	if invoice.Status != utils.InvoiceDraft {
+		return c.Status(409).JSON(fiber.Map{"error": "Удалить можно только черновик, отправленный счет нужно аннулировать"})
+	}
+
+	if _, err := h.db.DB.Collection("invoices").DeleteOne(context.TODO(), bson.M{"_id": invoice.ID}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления счета"})
+	}
+
+	if err := releaseInvoiceLoads(h.db, invoice.ID); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка освобождения рейсов"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Счет удален"})
+}
+
+// invoicePDF формирует печатную форму счета
+func invoicePDF(company *models.Company, invoice *models.Invoice) []byte {
+	doc := utils.NewPDFDocument()
+	doc.Line(company.Name, 14, true)
+	if company.Address != "" {
+		doc.Line(company.Address, 9, false)
+	}
+	var ids []string
+	if company.Invoicing.MCNumber != "" {
+		ids = append(ids, "MC# "+company.Invoicing.MCNumber)
+	}
+	if company.Invoicing.DOTNumber != "" {
+		ids = append(ids, "USDOT# "+company.Invoicing.DOTNumber)
+	}
+	if company.EIN != "" {
+		ids = append(ids, "EIN "+company.EIN)
+	}
+	if len(ids) > 0 {
+		doc.Line(strings.Join(ids, "   "), 9, false)
+	}
+	var contacts []string
+	if company.Invoicing.Phone != "" {
+		contacts = append(contacts, "Phone: "+company.Invoicing.Phone)
+	}
+	if company.Invoicing.Email != "" {
+		contacts = append(contacts, "Email: "+company.Invoicing.Email)
+	}
+	if len(contacts) > 0 {
+		doc.Line(strings.Join(contacts, "   "), 9, false)
+	}
+	doc.Space(10)
+
+	title := "INVOICE " + invoice.InvoiceNumber
+	if invoice.Status == utils.InvoiceVoid {
+		title += " (VOID)"
+	}
+	doc.Line(title, 14, true)
+	doc.Line(fmt.Sprintf("Invoice date: %s   Terms: Net %d   Due date: %s",
+		invoice.InvoiceDate.Format("01/02/2006"), invoice.TermsDays, invoice.DueDate.Format("01/02/2006")), 9, false)
+	doc.Space(8)
+
+	doc.Line("Bill to:", 9, true)
+	doc.Line(invoice.BillTo, 10, false)
+	if invoice.BillToAddress != "" {
+		doc.Line(invoice.BillToAddress, 9, false)
+	}
+	if invoice.BrokerMC != "" {
+		doc.Line("MC# "+invoice.BrokerMC, 9, false)
+	}
+	doc.Space(10)
+
+	widths := []int{70, -14}
+	doc.Line(utils.PDFColumns(widths, "Description", "Amount"), 9, true)
+	for _, line := range invoice.Lines {
+		doc.Line(utils.PDFColumns(widths, utils.PDFTruncate(line.Description, 70), fmt.Sprintf("%.2f", line.Amount)), 9, false)
+	}
+	doc.Space(6)
+	doc.Line(utils.PDFColumns(widths, "TOTAL", fmt.Sprintf("%.2f", invoice.Total)), 10, true)
+	if invoice.AmountPaid > 0 {
+		doc.Line(utils.PDFColumns(widths, "Paid", fmt.Sprintf("%.2f", invoice.AmountPaid)), 9, false)
+		doc.Line(utils.PDFColumns(widths, "BALANCE DUE", fmt.Sprintf("%.2f", invoice.Balance)), 10, true)
+	}
+	doc.Space(10)
+
+	if company.Invoicing.RemitTo != "" {
+		doc.Line("Please remit payment to:", 9, true)
+		for _, line := range strings.Split(company.Invoicing.RemitTo, "\n") {
+			doc.Line(strings.TrimSpace(line), 9, false)
+		}
+		doc.Space(6)
+	}
+	if invoice.Notes != "" {
+		doc.Line("Notes: "+invoice.Notes, 9, false)
+	}
+
+	return doc.Bytes()
+}
+
+// GetInvoicePDF отдает печатную форму счета
+func (h *InvoiceHandler) GetInvoicePDF(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	invoiceID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID счета"})
+	}
+
+	invoice, err := findUserInvoice(h.db, userObjectID, invoiceID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Счет не найден"})
+	}
+
+	var company models.Company
+	if err := h.db.DB.Collection("companies").FindOne(context.TODO(), bson.M{"_id": invoice.CompanyID}).Decode(&company); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компании"})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, attachmentDisposition("invoice_"+invoice.InvoiceNumber+".pdf"))
+	return c.Send(invoicePDF(&company, invoice))
+}
+
+// GetAging возвращает отчет по возрасту дебиторской задолженности брокеров на дату (as_of, по умолчанию сегодня).
+// Учитываются отправленные счета, выставленные до даты, за вычетом оплат, поступивших до нее, и списаний до нее.
+func (h *InvoiceHandler) GetAging(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	asOf := time.Now()
+	if value := c.Query("as_of"); value != "" {
+		asOf, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+		}
+	}
+	cutoff := time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+
+	companies, err := getUserCompanies(h.db, userObjectID, c.Query("company_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+	}
+
+	report := []ReceivablesAgingItem{}
+	for _, company := range companies {
+		cursor, err := h.db.DB.Collection("invoices").Find(context.TODO(), bson.M{
+			"company_id":   company.ID,
+			"status":       bson.M{"$in": []string{utils.InvoiceSent, utils.InvoicePaid}},
+			"invoice_date": bson.M{"$lt": cutoff},
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения счетов"})
+		}
+
+		var invoices []models.Invoice
+		if err = cursor.All(context.TODO(), &invoices); err != nil {
+			cursor.Close(context.TODO())
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования счетов"})
+		}
+		cursor.Close(context.TODO())
+
+		// Оплаты, поступившие до даты отчета
+		paid := map[primitive.ObjectID]float64{}
+		paymentsCursor, err := h.db.DB.Collection("invoice_payments").Find(context.TODO(), bson.M{
+			"company_id":   company.ID,
+			"payment_date": bson.M{"$lt": cutoff},
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения оплат"})
+		}
+		var payments []models.InvoicePayment
+		if err = paymentsCursor.All(context.TODO(), &payments); err != nil {
+			paymentsCursor.Close(context.TODO())
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования оплат"})
+		}
+		paymentsCursor.Close(context.TODO())
+		for _, payment := range payments {
+			paid[payment.InvoiceID] += payment.Amount
+		}
+
+		item := ReceivablesAgingItem{
+			CompanyID:   company.ID.Hex(),
+			CompanyName: company.Name,
+			Buckets:     map[string]ReceivableBucketTotals{},
+			Brokers:     []BrokerAging{},
+		}
+		for _, bucket := range utils.AgingBuckets {
+			item.Buckets[bucket] = ReceivableBucketTotals{}
+		}
+
+		brokers := map[string]*BrokerAging{}
+		for _, invoice := range invoices {
+			balance := roundMoney(invoice.Total - paid[invoice.ID])
+			if invoice.WrittenOff > 0 && invoice.WrittenOffDate.Before(cutoff) {
+				balance = roundMoney(balance - invoice.WrittenOff)
+			}
+			if balance <= 0.005 {
+				continue
+			}
+
+			bucket := utils.AgingBucket(utils.InvoiceDaysPastDue(invoice.DueDate, asOf), 0)
+			totals := item.Buckets[bucket]
+			totals.InvoicesCount++
+			totals.Balance = roundMoney(totals.Balance + balance)
+			item.Buckets[bucket] = totals
+			item.Total = roundMoney(item.Total + balance)
+
+			key := strings.ToLower(strings.TrimSpace(invoice.BillTo))
+			broker, ok := brokers[key]
+			if !ok {
+				broker = &BrokerAging{Broker: invoice.BillTo, Buckets: map[string]float64{}}
+				for _, name := range utils.AgingBuckets {
+					broker.Buckets[name] = 0
+				}
+				brokers[key] = broker
+			}
+			broker.Buckets[bucket] = roundMoney(broker.Buckets[bucket] + balance)
+			broker.Total = roundMoney(broker.Total + balance)
+		}
+
+		for _, broker := range brokers {
+			item.Brokers = append(item.Brokers, *broker)
+		}
+		sort.Slice(item.Brokers, func(i, j int) bool {
+			if math.Abs(item.Brokers[i].Total-item.Brokers[j].Total) > 0.005 {
+				return item.Brokers[i].Total > item.Brokers[j].Total
+			}
+			return item.Brokers[i].Broker < item.Brokers[j].Broker
+		})
+
+		report = append(report, item)
+	}
+
+	return c.JSON(report)
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/storage"
+	"business-schedule-backend/utils"
+	"context"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LeaseHandler struct {
+	db    *database.Database
+	store storage.Storage
+}
+
+func NewLeaseHandler(db *database.Database, store storage.Storage) *LeaseHandler {
+	return &LeaseHandler{db: db, store: store}
+}
+
+type LeaseResponse struct {
+	models.Lease
+	PaymentWithTax    float64 `json:"payment_with_tax"`
+	RemainingPayments int     `json:"remaining_payments"`
+	Liability         float64 `json:"liability"`
+}
+
+// leaseLiability рассчитывает текущее обязательство по лизингу.
+// Остаточная стоимость TRAC гарантируется лизингополучателем и входит в обязательство.
+// Дисконтируется арендная плата без налога с продаж: налог начисляется при оплате и в обязательство не входит.
+func leaseLiability(lease *models.Lease, asOf time.Time) float64 {
+	residual := 0.0
+	if lease.LeaseType == utils.LeaseTRAC {
+		residual = lease.ResidualValue
+	}
+	remaining := utils.LeaseRemainingPayments(lease.StartDate, lease.TermMonths, asOf)
+	return utils.CalculateLeaseLiability(lease.MonthlyRent, remaining, residual, lease.ImplicitRate)
+}
+
+// getActiveLeases возвращает действующие лизинги по компаниям
+func getActiveLeases(db *database.Database, companyIDs []primitive.ObjectID) ([]models.Lease, error) {
+	if len(companyIDs) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := db.DB.Collection("leases").Find(context.TODO(), bson.M{
+		"company_id": bson.M{"$in": companyIDs},
+		"status":     "active",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var leases []models.Lease
+	if err = cursor.All(context.TODO(), &leases); err != nil {
+		return nil, err
+	}
+	return leases, nil
+}
+
+// operatingLeaseVehicles возвращает транспорт в операционном лизинге: он не амортизируется как собственный актив
+func operatingLeaseVehicles(leases []models.Lease) map[primitive.ObjectID]bool {
+	vehicles := map[primitive.ObjectID]bool{}
+	for _, lease := range leases {
+		if lease.Classification == utils.LeaseOperating {
+			vehicles[lease.VehicleID] = true
+		}
+	}
+	return vehicles
+}
+
+// validateLease проверяет поля лизинга и подставляет значения по умолчанию
+func validateLease(lease *models.Lease) string {
+	if lease.LeaseType != utils.LeaseTRAC && lease.LeaseType != utils.LeaseFMV {
+		return "Неверный тип лизинга"
+	}
+	if lease.Classification != utils.LeaseOperating && lease.Classification != utils.LeaseFinance {
+		return "Неверная классификация лизинга"
+	}
+	if lease.TermMonths < 1 || lease.MonthlyRent < 0 || lease.SalesTaxRate < 0 || lease.ResidualValue < 0 {
+		return "Неверные условия лизинга"
+	}
+	if lease.Status == "" {
+		lease.Status = "active"
+	}
+	return ""
+}
+
+// validateLeaseVehicle проверяет, что транспорт лизинга принадлежит компании лизинга
+func validateLeaseVehicle(db *database.Database, lease *models.Lease) string {
+	count, err := db.DB.Collection("vehicles").CountDocuments(context.TODO(), bson.M{
+		"_id":        lease.VehicleID,
+		"company_id": lease.CompanyID,
+	})
+	if err != nil || count == 0 {
+		return "Транспорт не найден"
+	}
+	return ""
+}
+
+func (h *LeaseHandler) GetLeases(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+
+	// Фильтр по компании если указан
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		filter["company_id"] = bson.M{"$in": filterOwnedIDs(companyIDs, companyObjectID)}
+	}
+
+	cursor, err := h.db.DB.Collection("leases").Find(context.TODO(), filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения лизингов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var leases []models.Lease
+	if err = cursor.All(context.TODO(), &leases); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	now := time.Now()
+	response := []LeaseResponse{}
+	for i := range leases {
+		response = append(response, LeaseResponse{
+			Lease:             leases[i],
+			PaymentWithTax:    utils.CalculateLeasePaymentWithTax(leases[i].MonthlyRent, leases[i].SalesTaxRate),
+			RemainingPayments: utils.LeaseRemainingPayments(leases[i].StartDate, leases[i].TermMonths, now),
+			Liability:         leaseLiability(&leases[i], now),
+		})
+	}
+
+	return c.JSON(response)
+}
+
+func (h *LeaseHandler) CreateLease(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var lease models.Lease
+	if err := c.BodyParser(&lease); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := validateLease(&lease); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	// Проверяем что компания принадлежит пользователю
+	companiesCollection := h.db.DB.Collection("companies")
+	var company models.Company
+	err = companiesCollection.FindOne(context.TODO(), bson.M{
+		"_id":     lease.CompanyID,
+		"user_id": userObjectID,
+	}).Decode(&company)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	if msg := validateLeaseVehicle(h.db, &lease); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	lease.CreatedAt = time.Now()
+	lease.UpdatedAt = time.Now()
+
+	result, err := h.db.DB.Collection("leases").InsertOne(context.TODO(), lease)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания лизинга"})
+	}
+
+	lease.ID = result.InsertedID.(primitive.ObjectID)
+	return c.Status(201).JSON(lease)
+}
+
+func (h *LeaseHandler) UpdateLease(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	leaseID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID лизинга"})
+	}
+
+	var lease models.Lease
+	if err := c.BodyParser(&lease); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := validateLease(&lease); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	// Проверяем что компания принадлежит пользователю
+	companiesCollection := h.db.DB.Collection("companies")
+	var company models.Company
+	err = companiesCollection.FindOne(context.TODO(), bson.M{
+		"_id":     lease.CompanyID,
+		"user_id": userObjectID,
+	}).Decode(&company)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	if msg := validateLeaseVehicle(h.db, &lease); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	lease.ID = primitive.NilObjectID
+	lease.UpdatedAt = time.Now()
+
+	filter := bson.M{"_id": leaseID, "company_id": lease.CompanyID}
+	result, err := h.db.DB.Collection("leases").UpdateOne(context.TODO(), filter, bson.M{"$set": lease})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления лизинга"})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Лизинг не найден"})
+	}
+
+	lease.ID = leaseID
+	return c.JSON(lease)
+}
+
+func (h *LeaseHandler) DeleteLease(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	leaseID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID лизинга"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	result, err := h.db.DB.Collection("leases").DeleteOne(context.TODO(), bson.M{
+		"_id":        leaseID,
+		"company_id": bson.M{"$in": companyIDs},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления лизинга"})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Лизинг не найден"})
+	}
+
+	// Удаляем документы лизинга вместе с файлами в хранилище
+	_, err = deleteStoredDocuments(h.db, h.store, bson.M{"entity_type": utils.DocumentEntityLease, "entity_id": leaseID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления документов"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Лизинг удален"})
+}
@@ -0,0 +1,412 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LoadHandler struct {
+	db *database.Database
+}
+
+func NewLoadHandler(db *database.Database) *LoadHandler {
+	return &LoadHandler{db: db}
+}
+
+// prepareLoad проверяет рейс, подставляет тягач/прицеп/водителя из закрепления на дату погрузки,
+// рассчитывает выручку и оплату водителя (если она не введена вручную, driver_pay_manual)
+func prepareLoad(db *database.Database, load *models.Load) (int, string) {
+	load.LoadNumber = strings.TrimSpace(load.LoadNumber)
+	if load.LoadNumber == "" {
+		return 400, "Не указан номер рейса"
+	}
+	if load.PickupLocation == "" || load.DeliveryLocation == "" {
+		return 400, "Не указаны места погрузки и выгрузки"
+	}
+	if load.PickupDate.IsZero() {
+		return 400, "Не указана дата погрузки"
+	}
+	if !load.DeliveryDate.IsZero() && load.DeliveryDate.Before(load.PickupDate) {
+		return 400, "Дата выгрузки раньше даты погрузки"
+	}
+	if load.Status == "" {
+		load.Status = utils.LoadBooked
+	}
+	if !utils.IsValidLoadStatus(load.Status) {
+		return 400, "Неверный статус рейса"
+	}
+	if load.Status == utils.LoadDelivered && load.DeliveryDate.IsZero() {
+		return 400, "Для доставленного рейса нужна дата выгрузки"
+	}
+	if load.LoadedMiles < 0 || load.DeadheadMiles < 0 || load.Rate < 0 || load.FuelSurcharge < 0 || load.DriverPay < 0 {
+		return 400, "Пробег, ставка и оплата не могут быть отрицательными"
+	}
+
+	if load.Accessorials == nil {
+		load.Accessorials = []models.LoadAccessorial{}
+	}
+	revenue := load.Rate + load.FuelSurcharge
+	for _, accessorial := range load.Accessorials {
+		if !utils.IsValidAccessorialType(accessorial.Type) {
+			return 400, "Неверный вид дополнительного начисления"
+		}
+		revenue += accessorial.Amount
+	}
+	load.TotalRevenue = math.Round(revenue*100) / 100
+
+	// Тягач, прицеп и водитель должны принадлежать компании рейса
+	if load.TruckID != nil {
+		count, err := db.DB.Collection("vehicles").CountDocuments(context.TODO(), bson.M{"_id": *load.TruckID, "company_id": load.CompanyID, "type": "truck"})
+		if err != nil {
+			return 500, "Ошибка проверки транспорта"
+		}
+		if count == 0 {
+			return 400, "Тягач не найден в компании рейса"
+		}
+
+		if assignment := assignmentAt(db, *load.TruckID, load.PickupDate); assignment != nil {
+			if load.DriverID == nil {
+				load.DriverID = assignment.DriverID
+			}
+			if load.TrailerID == nil {
+				load.TrailerID = assignment.TrailerID
+			}
+		}
+	}
+	if load.TrailerID != nil {
+		count, err := db.DB.Collection("vehicles").CountDocuments(context.TODO(), bson.M{"_id": *load.TrailerID, "company_id": load.CompanyID, "type": "trailer"})
+		if err != nil {
+			return 500, "Ошибка проверки транспорта"
+		}
+		if count == 0 {
+			return 400, "Прицеп не найден в компании рейса"
+		}
+	}
+	if load.DriverID != nil {
+		var driver models.Driver
+		err := db.DB.Collection("drivers").FindOne(context.TODO(), bson.M{"_id": *load.DriverID, "company_id": load.CompanyID}).Decode(&driver)
+		if err != nil {
+			return 400, "Водитель не найден в компании рейса"
+		}
+		if !load.DriverPayManual {
+			load.DriverPay = utils.CalculateDriverPay(driver.PayType, driver.PayRate, load.LoadedMiles+load.DeadheadMiles, load.TotalRevenue)
+		}
+	} else if !load.DriverPayManual {
+		load.DriverPay = 0
+	}
+
+	// Номер рейса уникален в пределах компании
+	filter := bson.M{"company_id": load.CompanyID, "load_number": load.LoadNumber}
+	if !load.ID.IsZero() {
+		filter["_id"] = bson.M{"$ne": load.ID}
+	}
+	count, err := db.DB.Collection("loads").CountDocuments(context.TODO(), filter)
+	if err != nil {
+		return 500, "Ошибка проверки номера рейса"
+	}
+	if count > 0 {
+		return 409, "Рейс с таким номером уже есть"
+	}
+
+	return 0, ""
+}
+
+// fillLoadNames заполняет названия тягача, прицепа и водителя
+func fillLoadNames(db *database.Database, loads []models.Load) error {
+	var vehicleIDs, driverIDs []primitive.ObjectID
+	for _, load := range loads {
+		if load.TruckID != nil {
+			vehicleIDs = append(vehicleIDs, *load.TruckID)
+		}
+		if load.TrailerID != nil {
+			vehicleIDs = append(vehicleIDs, *load.TrailerID)
+		}
+		if load.DriverID != nil {
+			driverIDs = append(driverIDs, *load.DriverID)
+		}
+	}
+
+	vehicles, err := loadVehiclesByID(db, vehicleIDs)
+	if err != nil {
+		return err
+	}
+
+	driverNames := map[primitive.ObjectID]string{}
+	if len(driverIDs) > 0 {
+		cursor, err := db.DB.Collection("drivers").Find(context.TODO(), bson.M{"_id": bson.M{"$in": driverIDs}})
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(context.TODO())
+
+		var drivers []models.Driver
+		if err = cursor.All(context.TODO(), &drivers); err != nil {
+			return err
+		}
+		for i := range drivers {
+			driverNames[drivers[i].ID] = driverName(&drivers[i])
+		}
+	}
+
+	for i := range loads {
+		if loads[i].TruckID != nil {
+			if vehicle, ok := vehicles[*loads[i].TruckID]; ok {
+				loads[i].TruckName = vehicleTitle(vehicle)
+			}
+		}
+		if loads[i].TrailerID != nil {
+			if vehicle, ok := vehicles[*loads[i].TrailerID]; ok {
+				loads[i].TrailerName = vehicleTitle(vehicle)
+			}
+		}
+		if loads[i].DriverID != nil {
+			loads[i].DriverName = driverNames[*loads[i].DriverID]
+		}
+	}
+	return nil
+}
+
+// GetLoads возвращает рейсы. Фильтры: company_id, truck_id, driver_id, status, from/to по дате погрузки
+func (h *LoadHandler) GetLoads(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		companyIDs = filterOwnedIDs(companyIDs, companyObjectID)
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	for _, field := range []string{"truck_id", "driver_id"} {
+		if value := c.Query(field); value != "" {
+			id, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "Неверный " + field})
+			}
+			filter[field] = id
+		}
+	}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	pickup := bson.M{}
+	if value := c.Query("from"); value != "" {
+		from, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+		}
+		pickup["$gte"] = from
+	}
+	if value := c.Query("to"); value != "" {
+		to, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+		}
+		pickup["$lt"] = to.AddDate(0, 0, 1)
+	}
+	if len(pickup) > 0 {
+		filter["pickup_date"] = pickup
+	}
+
+	cursor, err := h.db.DB.Collection("loads").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"pickup_date": -1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения рейсов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	loads := []models.Load{}
+	if err = cursor.All(context.TODO(), &loads); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования рейсов"})
+	}
+
+	if err := fillLoadNames(h.db, loads); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения названий"})
+	}
+
+	return c.JSON(loads)
+}
+
+func (h *LoadHandler) CreateLoad(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var load models.Load
+	if err := c.BodyParser(&load); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	count, err := h.db.DB.Collection("companies").CountDocuments(context.TODO(), bson.M{"_id": load.CompanyID, "user_id": userObjectID})
+	if err != nil || count == 0 {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	load.ID = primitive.NilObjectID
+	// Переданная сумма оплаты водителя считается введенной вручную
+	if load.DriverPay > 0 {
+		load.DriverPayManual = true
+	}
+	if status, msg := prepareLoad(h.db, &load); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	load.CreatedBy = userObjectID
+	load.CreatedAt = time.Now()
+	load.UpdatedAt = time.Now()
+
+	result, err := h.db.DB.Collection("loads").InsertOne(context.TODO(), load)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания рейса"})
+	}
+
+	load.ID = result.InsertedID.(primitive.ObjectID)
+	return c.Status(201).JSON(load)
+}
+
+func (h *LoadHandler) UpdateLoad(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	loadID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID рейса"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	var existing models.Load
+	err = h.db.DB.Collection("loads").FindOne(context.TODO(), bson.M{
+		"_id":        loadID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&existing)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Рейс не найден"})
+	}
+
+	var load models.Load
+	if err := c.BodyParser(&load); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	fields, err := sentFields(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	// Форма возвращает записанную оплату водителя: ручной считается только измененная сумма,
+	// иначе оплата пересчитывается по новым милям, выручке и водителю
+	if !fields["driver_pay_manual"] {
+		load.DriverPayManual = existing.DriverPayManual ||
+			(fields["driver_pay"] && math.Abs(load.DriverPay-existing.DriverPay) > 0.005)
+	}
+
+	load.ID = loadID
+	load.CompanyID = existing.CompanyID
+	load.InvoiceID = existing.InvoiceID
+	if status, msg := prepareLoad(h.db, &load); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	// Выручка и статус рейса из счета меняются только после удаления или аннулирования счета
+	if existing.InvoiceID != nil && (load.TotalRevenue != existing.TotalRevenue || load.Status != existing.Status) {
+		return c.Status(409).JSON(fiber.Map{"error": "Рейс включен в счет, сначала удалите или аннулируйте счет"})
+	}
+
+	load.CreatedBy = existing.CreatedBy
+	load.CreatedAt = existing.CreatedAt
+	load.UpdatedAt = time.Now()
+
+	_, err = h.db.DB.Collection("loads").ReplaceOne(context.TODO(), bson.M{"_id": loadID}, load)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления рейса"})
+	}
+
+	return c.JSON(load)
+}
+
+func (h *LoadHandler) DeleteLoad(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	loadID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID рейса"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	var load models.Load
+	err = h.db.DB.Collection("loads").FindOne(context.TODO(), bson.M{
+		"_id":        loadID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&load)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Рейс не найден"})
+	}
+	if load.InvoiceID != nil {
+		return c.Status(409).JSON(fiber.Map{"error": "Рейс включен в счет, сначала удалите или аннулируйте счет"})
+	}
+
+	result, err := h.db.DB.Collection("loads").DeleteOne(context.TODO(), bson.M{"_id": loadID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления рейса"})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Рейс не найден"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Рейс удален"})
+}
@@ -4,8 +4,12 @@ import (
 	"business-schedule-backend/database"
 	"business-schedule-backend/middleware"
 	"business-schedule-backend/models"
+	"business-schedule-backend/storage"
 	"business-schedule-backend/utils"
 	"context"
+	"html/template"
+	"math"
+	"strconv"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -14,11 +18,12 @@ import (
 )
 
 type LoanHandler struct {
-	db *database.Database
+	db    *database.Database
+	store storage.Storage
 }
 
-func NewLoanHandler(db *database.Database) *LoanHandler {
-	return &LoanHandler{db: db}
+func NewLoanHandler(db *database.Database, store storage.Storage) *LoanHandler {
+	return &LoanHandler{db: db, store: store}
 }
 
 func (h *LoanHandler) GetLoans(c *fiber.Ctx) error {
@@ -109,11 +114,32 @@ func (h *LoanHandler) CreateLoan(c *fiber.Ctx) error {
 		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
 	}
 
+	// Залог: одна или несколько единиц транспорта
+	normalizeCollateral(&loan)
+	if msg := validateCollateral(h.db, &loan); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	// Конвенция подсчета дней по умолчанию
+	if loan.DayCount == "" {
+		loan.DayCount = utils.DayCount30360
+	}
+	if !utils.IsValidDayCount(loan.DayCount) {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверная конвенция подсчета дней"})
+	}
+	if loan.LateFeeType != "" && loan.LateFeeType != utils.LateFeeFlat && loan.LateFeeType != utils.LateFeePercent {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный тип штрафа за просрочку"})
+	}
+	if loan.BalloonAmount < 0 || loan.BalloonAmount > loan.PrincipalAmount {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверная сумма balloon-платежа"})
+	}
+
 	// Рассчитываем месячный платеж
-	loan.MonthlyPayment = utils.CalculateMonthlyPayment(
+	loan.MonthlyPayment = utils.CalculateMonthlyPaymentWithBalloon(
 		loan.PrincipalAmount,
 		loan.InterestRate,
 		loan.TermMonths,
+		loan.BalloonAmount,
 	)
 	loan.RemainingBalance = loan.PrincipalAmount
 	loan.CreatedAt = time.Now()
@@ -129,6 +155,8 @@ func (h *LoanHandler) CreateLoan(c *fiber.Ctx) error {
 	return c.Status(201).JSON(loan)
 }
 
+// UpdateLoan изменяет условия кредита. Поля, не переданные клиентом, сохраняются; остаток,
+// статус и снятие залогов меняются только платежами и снятием залога
 func (h *LoanHandler) UpdateLoan(c *fiber.Ctx) error {
 	userID, err := middleware.GetUserIDFromToken(c)
 	if err != nil {
@@ -145,44 +173,106 @@ func (h *LoanHandler) UpdateLoan(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID кредита"})
 	}
 
-	var loan models.Loan
-	if err := c.BodyParser(&loan); err != nil {
+	fields, err := sentFields(c)
+	if err != nil {
 		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
 	}
 
-	// Проверяем что компания принадлежит пользователю
-	companiesCollection := h.db.DB.Collection("companies")
-	var company models.Company
-	err = companiesCollection.FindOne(context.TODO(), bson.M{
-		"_id":     loan.CompanyID,
-		"user_id": userObjectID,
-	}).Decode(&company)
+	existing, err := findUserLoan(h.db, userObjectID, loanID)
 	if err != nil {
-		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+		return c.Status(404).JSON(fiber.Map{"error": "Кредит не найден"})
 	}
 
-	// Пересчитываем месячный платеж если изменились параметры
-	loan.MonthlyPayment = utils.CalculateMonthlyPayment(
-		loan.PrincipalAmount,
-		loan.InterestRate,
-		loan.TermMonths,
-	)
-	loan.UpdatedAt = time.Now()
+	// Переданные поля накладываются на сохраненный кредит
+	loan := *existing
+	loan.Collateral = nil
+	loan.RefinancedFrom = nil
+	if err := c.BodyParser(&loan); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+	if !fields["collateral"] {
+		loan.Collateral = existing.Collateral
+	}
+	loan.ID = existing.ID
+	loan.CompanyID = existing.CompanyID
+	loan.RefinancedFrom = existing.RefinancedFrom
+	loan.RefinancedInto = existing.RefinancedInto
+	loan.CreatedAt = existing.CreatedAt
+
+	if fields["remaining_balance"] && math.Abs(loan.RemainingBalance-existing.RemainingBalance) > 0.005 {
+		return c.Status(400).JSON(fiber.Map{"error": "Остаток по кредиту меняется только платежами"})
+	}
+	if fields["status"] && loan.Status != existing.Status {
+		return c.Status(400).JSON(fiber.Map{"error": "Статус кредита меняется только платежами"})
+	}
+	loan.RemainingBalance = existing.RemainingBalance
+	loan.Status = existing.Status
+	loan.LastPaymentDate = existing.LastPaymentDate
+
+	// Состояние просрочки и штрафы ведет проверка просрочек, а не редактирование кредита
+	loan.DelinquencyStatus = existing.DelinquencyStatus
+	loan.DaysPastDue = existing.DaysPastDue
+	loan.LateFeesOutstanding = existing.LateFeesOutstanding
+	loan.DelinquencyCheckedAt = existing.DelinquencyCheckedAt
+
+	// Залог: одна или несколько единиц транспорта; снятые залоги изменить нельзя
+	if fields["vehicle_id"] && !fields["collateral"] && loan.VehicleID != existing.VehicleID {
+		loan.Collateral = nil
+	}
+	normalizeCollateral(&loan)
+	if msg := validateCollateralChange(existing, &loan); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if msg := validateCollateral(h.db, &loan); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
 
-	loansCollection := h.db.DB.Collection("loans")
-	filter := bson.M{"_id": loanID, "company_id": loan.CompanyID}
-	update := bson.M{"$set": loan}
+	if loan.DayCount == "" {
+		loan.DayCount = utils.DayCount30360
+	}
+	if !utils.IsValidDayCount(loan.DayCount) {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверная конвенция подсчета дней"})
+	}
+	if loan.LateFeeType != "" && loan.LateFeeType != utils.LateFeeFlat && loan.LateFeeType != utils.LateFeePercent {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный тип штрафа за просрочку"})
+	}
+	if loan.BalloonAmount < 0 || loan.BalloonAmount > loan.PrincipalAmount {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверная сумма balloon-платежа"})
+	}
+
+	// При изменении условий пересчитываем платеж и заново проводим историю платежей
+	termsChanged := loan.PrincipalAmount != existing.PrincipalAmount ||
+		loan.InterestRate != existing.InterestRate ||
+		loan.TermMonths != existing.TermMonths ||
+		loan.BalloonAmount != existing.BalloonAmount ||
+		loanDayCount(&loan) != loanDayCount(existing) ||
+		!loan.StartDate.Equal(existing.StartDate)
+	if termsChanged && !existing.RefinancedInto.IsZero() {
+		return c.Status(409).JSON(fiber.Map{"error": "Кредит рефинансирован, его условия нельзя изменить"})
+	}
+	if termsChanged {
+		loan.MonthlyPayment = utils.CalculateMonthlyPaymentWithBalloon(
+			loan.PrincipalAmount,
+			loan.InterestRate,
+			loan.TermMonths,
+			loan.BalloonAmount,
+		)
+	} else {
+		loan.MonthlyPayment = existing.MonthlyPayment
+	}
+	loan.UpdatedAt = time.Now()
 
-	result, err := loansCollection.UpdateOne(context.TODO(), filter, update)
+	_, err = h.db.DB.Collection("loans").ReplaceOne(context.TODO(), bson.M{"_id": loan.ID}, loan)
 	if err != nil {
 		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления кредита"})
 	}
 
-	if result.MatchedCount == 0 {
-		return c.Status(404).JSON(fiber.Map{"error": "Кредит не найден"})
+	if termsChanged {
+		if err := replayLoanPayments(h.db, &loan); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка пересчета платежей"})
+		}
 	}
 
-	loan.ID = loanID
 	return c.JSON(loan)
 }
 
@@ -235,5 +325,253 @@ func (h *LoanHandler) DeleteLoan(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "Кредит не найден"})
 	}
 
+	// Удаляем документы кредита и его платежей вместе с файлами в хранилище
+	_, err = deleteStoredDocuments(h.db, h.store, bson.M{"entity_type": utils.DocumentEntityLoan, "entity_id": loanID})
+	if err == nil {
+		err = deleteRecordDocuments(h.db, h.store, utils.DocumentEntityPayment, bson.M{"loan_id": loanID})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления документов"})
+	}
+
 	return c.JSON(fiber.Map{"message": "Кредит удален"})
 }
+
+type PayoffQuote struct {
+	LoanID     string    `json:"loan_id"`
+	Lender     string    `json:"lender"`
+	PayoffDate string    `json:"payoff_date"`
+	DayCount   string    `json:"day_count"`
+	QuotedAt   time.Time `json:"quoted_at"`
+	utils.PayoffAmounts
+}
+
+var payoffQuoteTemplate = template.Must(template.New("payoff").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Payoff Quote</title>
+<style>
+body { font-family: Arial, sans-serif; margin: 40px; }
+table { border-collapse: collapse; width: 480px; }
+td { padding: 6px 8px; border-bottom: 1px solid #ddd; }
+td.amount { text-align: right; }
+tr.total td { font-weight: bold; border-top: 2px solid #000; }
+</style>
+</head>
+<body>
+<h2>Payoff Quote</h2>
+<p>Lender: {{.Lender}}<br>Loan: {{.LoanID}}<br>Good through: {{.PayoffDate}}</p>
+<table>
+<tr><td>Principal balance</td><td class="amount">{{printf "%.2f" .Principal}}</td></tr>
+<tr><td>Accrued interest ({{.DaysAccrued}} days, {{.DayCount}})</td><td class="amount">{{printf "%.2f" .AccruedInterest}}</td></tr>
+<tr><td>Fees</td><td class="amount">{{printf "%.2f" .Fees}}</td></tr>
+<tr class="total"><td>Total payoff</td><td class="amount">{{printf "%.2f" .Total}}</td></tr>
+</table>
+<p>Per diem after {{.PayoffDate}}: {{printf "%.4f" .PerDiem}}</p>
+<p>Quoted at {{.QuotedAt.Format "2006-01-02 15:04"}}</p>
+</body>
+</html>
+`))
+
+// GetPayoffQuote рассчитывает сумму досрочного погашения кредита на дату
+func (h *LoanHandler) GetPayoffQuote(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	loanID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID кредита"})
+	}
+
+	// Дата погашения, по умолчанию сегодня
+	payoffDate := time.Now()
+	if date := c.Query("date"); date != "" {
+		payoffDate, err = time.Parse("2006-01-02", date)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+		}
+	}
+
+	loan, err := findUserLoan(h.db, userObjectID, loanID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Кредит не найден"})
+	}
+
+	quote := PayoffQuote{
+		LoanID:        loan.ID.Hex(),
+		Lender:        loan.Lender,
+		PayoffDate:    payoffDate.Format("2006-01-02"),
+		DayCount:      loanDayCount(loan),
+		QuotedAt:      time.Now(),
+		PayoffAmounts: calculateLoanPayoff(loan, payoffDate),
+	}
+
+	// Печатная версия документа
+	if c.Query("format") == "html" {
+		c.Type("html", "utf-8")
+		return payoffQuoteTemplate.Execute(c.Response().BodyWriter(), quote)
+	}
+
+	return c.JSON(quote)
+}
+
+type PrepaymentStrategyResult struct {
+	utils.SimulationResult
+	InterestSaved float64 `json:"interest_saved"`
+	MonthsSaved   int     `json:"months_saved"`
+}
+
+type PrepaymentSimulation struct {
+	ExtraMonthly float64                    `json:"extra_monthly"`
+	Baseline     utils.SimulationResult     `json:"baseline"`
+	Strategies   []PrepaymentStrategyResult `json:"strategies"`
+}
+
+// SimulatePrepayment сравнивает стратегии досрочного погашения по активным кредитам
+func (h *LoanHandler) SimulatePrepayment(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	extraMonthly, err := strconv.ParseFloat(c.Query("extra_monthly", "0"), 64)
+	if err != nil || extraMonthly < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверная сумма дополнительного платежа"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}, "status": "active"}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		filter["company_id"] = bson.M{"$in": filterOwnedIDs(companyIDs, companyObjectID)}
+	}
+
+	cursor, err := h.db.DB.Collection("loans").Find(context.TODO(), filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения кредитов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var loans []models.Loan
+	if err = cursor.All(context.TODO(), &loans); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования кредитов"})
+	}
+
+	startDate := time.Now()
+	var simulationLoans []utils.SimulationLoan
+	for _, loan := range loans {
+		simulationLoans = append(simulationLoans, utils.SimulationLoan{
+			ID:             loan.ID.Hex(),
+			Lender:         loan.Lender,
+			Balance:        loan.RemainingBalance,
+			AnnualRate:     loan.InterestRate,
+			MonthlyPayment: loan.MonthlyPayment,
+
+			BalloonAmount:   loan.BalloonAmount,
+			RemainingMonths: loan.TermMonths - utils.MonthsBetween(loan.StartDate, startDate),
+		})
+	}
+
+	simulation := PrepaymentSimulation{
+		ExtraMonthly: extraMonthly,
+		Baseline:     utils.SimulatePrepayment(simulationLoans, 0, utils.StrategyMinimum, startDate),
+	}
+
+	for _, strategy := range []string{utils.StrategyAvalanche, utils.StrategySnowball, utils.StrategyFixed} {
+		result := utils.SimulatePrepayment(simulationLoans, extraMonthly, strategy, startDate)
+		simulation.Strategies = append(simulation.Strategies, PrepaymentStrategyResult{
+			SimulationResult: result,
+			InterestSaved:    math.Round((simulation.Baseline.TotalInterest-result.TotalInterest)*100) / 100,
+			MonthsSaved:      simulation.Baseline.Months - result.Months,
+		})
+	}
+
+	return c.JSON(simulation)
+}
+
+type LoanQuoteRequest struct {
+	Offers []utils.LoanOffer `json:"offers"`
+}
+
+type LoanQuoteComparison struct {
+	Quotes          []utils.LoanQuote `json:"quotes"`
+	LowestAPR       string            `json:"lowest_apr"`
+	LowestTotalCost string            `json:"lowest_total_cost"`
+	LowestPayment   string            `json:"lowest_monthly_payment"`
+}
+
+// QuoteLoans рассчитывает APR и полную стоимость одного или нескольких предложений без сохранения кредитов
+func (h *LoanHandler) QuoteLoans(c *fiber.Ctx) error {
+	var request LoanQuoteRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if len(request.Offers) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Не указаны предложения для сравнения"})
+	}
+
+	comparison := LoanQuoteComparison{}
+	bestAPR, bestCost, bestPayment := -1, -1, -1
+	for i, offer := range request.Offers {
+		if offer.TermMonths < 1 || offer.Principal <= 0 || offer.InterestRate < 0 || offer.Fees < 0 ||
+			offer.DownPayment < 0 || offer.DownPayment >= offer.Principal || offer.Balloon < 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверные условия предложения", "offer": i})
+		}
+
+		// Balloon-платеж должен быть меньше финансируемой суммы, иначе платеж и APR теряют смысл
+		financed := offer.Principal - offer.DownPayment
+		if offer.FeesFinanced {
+			financed += offer.Fees
+		}
+		if offer.Balloon >= financed {
+			return c.Status(400).JSON(fiber.Map{"error": "Balloon-платеж должен быть меньше финансируемой суммы", "offer": i})
+		}
+		if offer.Name == "" {
+			offer.Name = "Offer " + strconv.Itoa(i+1)
+		}
+
+		// Комиссии, оплаченные из суммы кредита, не должны поглощать ее целиком, иначе APR не определен
+		quote := utils.QuoteLoan(offer)
+		if quote.AmountFinanced <= 0 {
+			return c.Status(400).JSON(fiber.Map{"error": "Комиссии не должны превышать финансируемую сумму", "offer": i})
+		}
+		comparison.Quotes = append(comparison.Quotes, quote)
+
+		if bestAPR < 0 || quote.APR < comparison.Quotes[bestAPR].APR {
+			bestAPR = i
+		}
+		if bestCost < 0 || quote.TotalCost < comparison.Quotes[bestCost].TotalCost {
+			bestCost = i
+		}
+		if bestPayment < 0 || quote.MonthlyPayment < comparison.Quotes[bestPayment].MonthlyPayment {
+			bestPayment = i
+		}
+	}
+
+	comparison.LowestAPR = comparison.Quotes[bestAPR].Name
+	comparison.LowestTotalCost = comparison.Quotes[bestCost].Name
+	comparison.LowestPayment = comparison.Quotes[bestPayment].Name
+
+	return c.JSON(comparison)
+}
@@ -0,0 +1,828 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/storage"
+	"business-schedule-backend/utils"
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type MaintenanceHandler struct {
+	db    *database.Database
+	store storage.Storage
+}
+
+func NewMaintenanceHandler(db *database.Database, store storage.Storage) *MaintenanceHandler {
+	return &MaintenanceHandler{db: db, store: store}
+}
+
+type VehicleMaintenanceItem struct {
+	VehicleID          string  `json:"vehicle_id"`
+	VehicleName        string  `json:"vehicle_name"`
+	CompanyID          string  `json:"company_id"`
+	TemplateID         string  `json:"template_id"`
+	TemplateName       string  `json:"template_name"`
+	LastServiceDate    string  `json:"last_service_date,omitempty"`
+	LastServiceMileage float64 `json:"last_service_mileage"`
+	LastWorkOrderID    string  `json:"last_work_order_id,omitempty"`
+	NoServiceHistory   bool    `json:"no_service_history,omitempty"`
+	CurrentMileage     float64 `json:"current_mileage"`
+	CurrentEngineHours float64 `json:"current_engine_hours"`
+	utils.MaintenanceDue
+}
+
+type CompleteWorkOrderRequest struct {
+	CompletedAt time.Time `json:"completed_at"`
+	Odometer    float64   `json:"odometer"`
+	EngineHours float64   `json:"engine_hours"`
+}
+
+// validateMaintenanceTemplate проверяет шаблон: нужен хотя бы один интервал
+func validateMaintenanceTemplate(template *models.MaintenanceTemplate) string {
+	if template.Name == "" {
+		return "Не указано название шаблона"
+	}
+	if template.VehicleType != "" && template.VehicleType != "truck" && template.VehicleType != "trailer" {
+		return "Неверный тип транспорта"
+	}
+	if template.IntervalMiles < 0 || template.IntervalEngineHours < 0 || template.IntervalDays < 0 ||
+		template.DueSoonMiles < 0 || template.DueSoonEngineHours < 0 || template.DueSoonDays < 0 {
+		return "Интервалы не могут быть отрицательными"
+	}
+	if template.IntervalMiles == 0 && template.IntervalEngineHours == 0 && template.IntervalDays == 0 {
+		return "Укажите интервал по пробегу, моточасам или дням"
+	}
+	return ""
+}
+
+// prepareWorkOrder проверяет заказ-наряд и рассчитывает стоимость запчастей, работ и итог
+func prepareWorkOrder(order *models.WorkOrder) string {
+	if order.Title == "" {
+		return "Не указано название заказ-наряда"
+	}
+	if order.Status == "" {
+		order.Status = utils.WorkOrderOpen
+	}
+	if !utils.IsValidWorkOrderStatus(order.Status) {
+		return "Неверный статус заказ-наряда"
+	}
+	// Выполнение фиксируется только закрытием заказ-наряда с показанием одометра
+	if order.Status == utils.WorkOrderCompleted {
+		return "Заказ-наряд закрывается через POST /api/maintenance/work-orders/:id/complete"
+	}
+	if order.VendorCharges < 0 || order.Odometer < 0 || order.EngineHours < 0 {
+		return "Суммы и показания не могут быть отрицательными"
+	}
+	if order.OpenedAt.IsZero() {
+		order.OpenedAt = time.Now()
+	}
+	if order.Parts == nil {
+		order.Parts = []models.WorkOrderPart{}
+	}
+	if order.Labor == nil {
+		order.Labor = []models.WorkOrderLabor{}
+	}
+
+	var parts, labor []utils.WorkOrderLine
+	for _, part := range order.Parts {
+		if part.Quantity < 0 || part.UnitCost < 0 {
+			return "Неверное количество или цена запчасти"
+		}
+		parts = append(parts, utils.WorkOrderLine{Quantity: part.Quantity, Price: part.UnitCost})
+	}
+	for _, item := range order.Labor {
+		if item.Hours < 0 || item.Rate < 0 {
+			return "Неверные часы или ставка работ"
+		}
+		labor = append(labor, utils.WorkOrderLine{Quantity: item.Hours, Price: item.Rate})
+	}
+
+	order.PartsCost = utils.SumWorkOrderLines(parts)
+	order.LaborCost = utils.SumWorkOrderLines(labor)
+	order.TotalCost = math.Round((order.PartsCost+order.LaborCost+order.VendorCharges)*100) / 100
+	return ""
+}
+
+// calculateMaintenanceStatus рассчитывает сроки обслуживания транспорта компаний по активным шаблонам.
+// Отсчет ведется от последнего выполненного заказ-наряда по шаблону, а без него — от даты покупки
+// и первого показания одометра (без показаний — от нуля) с признаком no_service_history.
+func calculateMaintenanceStatus(db *database.Database, companyIDs []primitive.ObjectID, vehicleID *primitive.ObjectID) ([]VehicleMaintenanceItem, error) {
+	items := []VehicleMaintenanceItem{}
+	if len(companyIDs) == 0 {
+		return items, nil
+	}
+
+	vehicleFilter := bson.M{
+		"company_id": bson.M{"$in": companyIDs},
+		"status":     bson.M{"$ne": "sold"},
+		"disposal":   bson.M{"$exists": false},
+	}
+	if vehicleID != nil {
+		vehicleFilter["_id"] = *vehicleID
+	}
+
+	vehiclesCursor, err := db.DB.Collection("vehicles").Find(context.TODO(), vehicleFilter)
+	if err != nil {
+		return nil, err
+	}
+	defer vehiclesCursor.Close(context.TODO())
+
+	var vehicles []models.Vehicle
+	if err = vehiclesCursor.All(context.TODO(), &vehicles); err != nil {
+		return nil, err
+	}
+	if len(vehicles) == 0 {
+		return items, nil
+	}
+
+	templatesCursor, err := db.DB.Collection("maintenance_templates").Find(context.TODO(), bson.M{
+		"company_id": bson.M{"$in": companyIDs},
+		"active":     true,
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer templatesCursor.Close(context.TODO())
+
+	var templates []models.MaintenanceTemplate
+	if err = templatesCursor.All(context.TODO(), &templates); err != nil {
+		return nil, err
+	}
+
+	var vehicleIDs []primitive.ObjectID
+	for _, vehicle := range vehicles {
+		vehicleIDs = append(vehicleIDs, vehicle.ID)
+	}
+
+	// Последний выполненный заказ-наряд по каждой паре транспорт/шаблон
+	ordersCursor, err := db.DB.Collection("work_orders").Find(context.TODO(), bson.M{
+		"vehicle_id":  bson.M{"$in": vehicleIDs},
+		"template_id": bson.M{"$exists": true},
+		"status":      utils.WorkOrderCompleted,
+	}, options.Find().SetSort(bson.M{"completed_at": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer ordersCursor.Close(context.TODO())
+
+	var orders []models.WorkOrder
+	if err = ordersCursor.All(context.TODO(), &orders); err != nil {
+		return nil, err
+	}
+	lastService := map[primitive.ObjectID]map[primitive.ObjectID]models.WorkOrder{}
+	for _, order := range orders {
+		if lastService[order.VehicleID] == nil {
+			lastService[order.VehicleID] = map[primitive.ObjectID]models.WorkOrder{}
+		}
+		lastService[order.VehicleID][order.TemplateID] = order
+	}
+
+	// Первое показание одометра — точка отсчета для еще не обслуживавшегося транспорта
+	readingsCursor, err := db.DB.Collection("odometer_readings").Find(context.TODO(),
+		bson.M{"vehicle_id": bson.M{"$in": vehicleIDs}},
+		options.Find().SetSort(bson.M{"reading_date": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer readingsCursor.Close(context.TODO())
+
+	var readings []models.OdometerReading
+	if err = readingsCursor.All(context.TODO(), &readings); err != nil {
+		return nil, err
+	}
+	firstReading := map[primitive.ObjectID]models.OdometerReading{}
+	for _, reading := range readings {
+		if _, ok := firstReading[reading.VehicleID]; !ok {
+			firstReading[reading.VehicleID] = reading
+		}
+	}
+
+	now := time.Now()
+	for i := range vehicles {
+		vehicle := &vehicles[i]
+		current := utils.MeterState{Date: now, Mileage: vehicle.Mileage, EngineHours: vehicle.EngineHours}
+
+		for _, template := range templates {
+			if template.CompanyID != vehicle.CompanyID || (template.VehicleType != "" && template.VehicleType != vehicle.Type) {
+				continue
+			}
+
+			item := VehicleMaintenanceItem{
+				VehicleID:          vehicle.ID.Hex(),
+				VehicleName:        vehicleTitle(vehicle),
+				CompanyID:          vehicle.CompanyID.Hex(),
+				TemplateID:         template.ID.Hex(),
+				TemplateName:       template.Name,
+				CurrentMileage:     vehicle.Mileage,
+				CurrentEngineHours: vehicle.EngineHours,
+			}
+
+			last := utils.MeterState{Date: vehicle.PurchaseDate}
+			item.NoServiceHistory = true
+			if reading, ok := firstReading[vehicle.ID]; ok {
+				last.Mileage, last.EngineHours = reading.Mileage, reading.EngineHours
+			}
+			if order, ok := lastService[vehicle.ID][template.ID]; ok {
+				last = utils.MeterState{Date: order.CompletedAt, Mileage: order.Odometer, EngineHours: order.EngineHours}
+				item.LastServiceDate = order.CompletedAt.Format("2006-01-02")
+				item.LastWorkOrderID = order.ID.Hex()
+				item.NoServiceHistory = false
+			}
+			item.LastServiceMileage = last.Mileage
+
+			item.MaintenanceDue = utils.CalculateMaintenanceDue(utils.MaintenanceInterval{
+				Miles:        template.IntervalMiles,
+				EngineHours:  template.IntervalEngineHours,
+				Days:         template.IntervalDays,
+				DueSoonMiles: template.DueSoonMiles,
+				DueSoonHours: template.DueSoonEngineHours,
+				DueSoonDays:  template.DueSoonDays,
+			}, last, current)
+
+			items = append(items, item)
+		}
+	}
+
+	return items, nil
+}
+
+// maintenanceUrgency возвращает порядок сортировки: просроченные, затем скорые, затем остальные
+func maintenanceUrgency(status string) int {
+	switch status {
+	case utils.MaintenanceOverdue:
+		return 0
+	case utils.MaintenanceDueSoon:
+		return 1
+	}
+	return 2
+}
+
+// GetUpcoming возвращает предстоящее и просроченное обслуживание по компаниям (all=true — включая не требующее внимания)
+func (h *MaintenanceHandler) GetUpcoming(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		companyIDs = filterOwnedIDs(companyIDs, companyObjectID)
+	}
+
+	items, err := calculateMaintenanceStatus(h.db, companyIDs, nil)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка расчета обслуживания"})
+	}
+
+	upcoming := []VehicleMaintenanceItem{}
+	for _, item := range items {
+		if item.Status != utils.MaintenanceOK || c.Query("all") == "true" {
+			upcoming = append(upcoming, item)
+		}
+	}
+	sort.SliceStable(upcoming, func(i, j int) bool {
+		return maintenanceUrgency(upcoming[i].Status) < maintenanceUrgency(upcoming[j].Status)
+	})
+
+	return c.JSON(upcoming)
+}
+
+// GetVehicleMaintenance возвращает сроки обслуживания транспорта по всем применимым шаблонам
+func (h *MaintenanceHandler) GetVehicleMaintenance(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	vehicleID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+	}
+
+	vehicle, err := findUserVehicle(h.db, userObjectID, vehicleID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+
+	items, err := calculateMaintenanceStatus(h.db, []primitive.ObjectID{vehicle.CompanyID}, &vehicleID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка расчета обслуживания"})
+	}
+
+	return c.JSON(items)
+}
+
+func (h *MaintenanceHandler) GetTemplates(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		companyIDs = filterOwnedIDs(companyIDs, companyObjectID)
+	}
+
+	cursor, err := h.db.DB.Collection("maintenance_templates").Find(context.TODO(), bson.M{"company_id": bson.M{"$in": companyIDs}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения шаблонов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	templates := []models.MaintenanceTemplate{}
+	if err = cursor.All(context.TODO(), &templates); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	return c.JSON(templates)
+}
+
+func (h *MaintenanceHandler) CreateTemplate(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var template models.MaintenanceTemplate
+	if err := c.BodyParser(&template); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := validateMaintenanceTemplate(&template); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	// Проверяем что компания принадлежит пользователю
+	var company models.Company
+	err = h.db.DB.Collection("companies").FindOne(context.TODO(), bson.M{
+		"_id":     template.CompanyID,
+		"user_id": userObjectID,
+	}).Decode(&company)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	template.Active = true
+	template.CreatedAt = time.Now()
+	template.UpdatedAt = time.Now()
+
+	result, err := h.db.DB.Collection("maintenance_templates").InsertOne(context.TODO(), template)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания шаблона"})
+	}
+
+	template.ID = result.InsertedID.(primitive.ObjectID)
+	return c.Status(201).JSON(template)
+}
+
+func (h *MaintenanceHandler) UpdateTemplate(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	templateID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID шаблона"})
+	}
+
+	var template models.MaintenanceTemplate
+	if err := c.BodyParser(&template); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := validateMaintenanceTemplate(&template); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	// Проверяем что компания принадлежит пользователю
+	var company models.Company
+	err = h.db.DB.Collection("companies").FindOne(context.TODO(), bson.M{
+		"_id":     template.CompanyID,
+		"user_id": userObjectID,
+	}).Decode(&company)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	template.ID = primitive.NilObjectID
+	template.UpdatedAt = time.Now()
+
+	filter := bson.M{"_id": templateID, "company_id": template.CompanyID}
+	update := bson.M{"$set": bson.M{
+		"name":                  template.Name,
+		"description":           template.Description,
+		"vehicle_type":          template.VehicleType,
+		"interval_miles":        template.IntervalMiles,
+		"interval_engine_hours": template.IntervalEngineHours,
+		"interval_days":         template.IntervalDays,
+		"due_soon_miles":        template.DueSoonMiles,
+		"due_soon_engine_hours": template.DueSoonEngineHours,
+		"due_soon_days":         template.DueSoonDays,
+		"active":                template.Active,
+		"updated_at":            template.UpdatedAt,
+	}}
+
+	result, err := h.db.DB.Collection("maintenance_templates").UpdateOne(context.TODO(), filter, update)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления шаблона"})
+	}
+
+	if result.MatchedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Шаблон не найден"})
+	}
+
+	template.ID = templateID
+	return c.JSON(template)
+}
+
+func (h *MaintenanceHandler) DeleteTemplate(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	templateID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID шаблона"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	result, err := h.db.DB.Collection("maintenance_templates").DeleteOne(context.TODO(), bson.M{
+		"_id":        templateID,
+		"company_id": bson.M{"$in": companyIDs},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления шаблона"})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Шаблон не найден"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Шаблон удален"})
+}
+
+func (h *MaintenanceHandler) GetWorkOrders(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		filter["company_id"] = bson.M{"$in": filterOwnedIDs(companyIDs, companyObjectID)}
+	}
+	if vehicleID := c.Query("vehicle_id"); vehicleID != "" {
+		vehicleObjectID, err := primitive.ObjectIDFromHex(vehicleID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+		}
+		filter["vehicle_id"] = vehicleObjectID
+	}
+	if status := c.Query("status"); status != "" {
+		filter["status"] = status
+	}
+
+	cursor, err := h.db.DB.Collection("work_orders").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"opened_at": -1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения заказ-нарядов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	orders := []models.WorkOrder{}
+	if err = cursor.All(context.TODO(), &orders); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	return c.JSON(orders)
+}
+
+// validateWorkOrderLinks проверяет транспорт и шаблон заказ-наряда и подставляет компанию транспорта
+func (h *MaintenanceHandler) validateWorkOrderLinks(userObjectID primitive.ObjectID, order *models.WorkOrder) (int, string) {
+	vehicle, err := findUserVehicle(h.db, userObjectID, order.VehicleID)
+	if err != nil {
+		return 404, "Транспорт не найден"
+	}
+	order.CompanyID = vehicle.CompanyID
+
+	if !order.TemplateID.IsZero() {
+		count, err := h.db.DB.Collection("maintenance_templates").CountDocuments(context.TODO(), bson.M{
+			"_id":        order.TemplateID,
+			"company_id": vehicle.CompanyID,
+		})
+		if err != nil || count == 0 {
+			return 400, "Шаблон обслуживания не найден"
+		}
+	}
+	return 0, ""
+}
+
+func (h *MaintenanceHandler) CreateWorkOrder(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var order models.WorkOrder
+	if err := c.BodyParser(&order); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := prepareWorkOrder(&order); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if status, msg := h.validateWorkOrderLinks(userObjectID, &order); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	order.CreatedAt = time.Now()
+	order.UpdatedAt = time.Now()
+
+	result, err := h.db.DB.Collection("work_orders").InsertOne(context.TODO(), order)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания заказ-наряда"})
+	}
+
+	order.ID = result.InsertedID.(primitive.ObjectID)
+	return c.Status(201).JSON(order)
+}
+
+func (h *MaintenanceHandler) UpdateWorkOrder(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	orderID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID заказ-наряда"})
+	}
+
+	var order models.WorkOrder
+	if err := c.BodyParser(&order); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if msg := prepareWorkOrder(&order); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+	if status, msg := h.validateWorkOrderLinks(userObjectID, &order); msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	order.ID = primitive.NilObjectID
+	order.UpdatedAt = time.Now()
+
+	var existing models.WorkOrder
+	err = h.db.DB.Collection("work_orders").FindOne(context.TODO(), bson.M{"_id": orderID, "company_id": order.CompanyID}).Decode(&existing)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Заказ-наряд не найден"})
+	}
+	if existing.Status == utils.WorkOrderCompleted {
+		return c.Status(409).JSON(fiber.Map{"error": "Выполненный заказ-наряд изменить нельзя"})
+	}
+	order.CreatedAt = existing.CreatedAt
+
+	_, err = h.db.DB.Collection("work_orders").ReplaceOne(context.TODO(), bson.M{"_id": orderID}, order)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления заказ-наряда"})
+	}
+
+	order.ID = orderID
+	return c.JSON(order)
+}
+
+// CompleteWorkOrder закрывает заказ-наряд. Показание одометра при обслуживании обязательно
+// и записывается в журнал, моточасы без показания берутся из транспорта.
+func (h *MaintenanceHandler) CompleteWorkOrder(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	orderID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID заказ-наряда"})
+	}
+
+	var request CompleteWorkOrderRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+	if request.CompletedAt.IsZero() {
+		request.CompletedAt = time.Now()
+	}
+	if request.Odometer <= 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Укажите показание одометра при обслуживании"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	var order models.WorkOrder
+	err = h.db.DB.Collection("work_orders").FindOne(context.TODO(), bson.M{
+		"_id":        orderID,
+		"company_id": bson.M{"$in": companyIDs},
+	}).Decode(&order)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Заказ-наряд не найден"})
+	}
+	if order.Status == utils.WorkOrderCompleted || order.Status == utils.WorkOrderCancelled {
+		return c.Status(409).JSON(fiber.Map{"error": "Заказ-наряд уже закрыт"})
+	}
+
+	vehicle, err := findUserVehicle(h.db, userObjectID, order.VehicleID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+
+	readings, err := loadVehicleReadings(h.db, vehicle.ID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+	}
+
+	// Без моточасов в запросе берем их по журналу на дату закрытия, без журнала — из карточки транспорта
+	order.EngineHours = vehicle.EngineHours
+	if len(readings) > 0 {
+		_, order.EngineHours = utils.MeterAt(meterPoints(readings), request.CompletedAt)
+	}
+	if request.EngineHours > 0 {
+		order.EngineHours = request.EngineHours
+	}
+
+	reading := models.OdometerReading{
+		VehicleID:   vehicle.ID,
+		CompanyID:   vehicle.CompanyID,
+		ReadingDate: request.CompletedAt,
+		Odometer:    request.Odometer,
+		EngineHours: request.EngineHours,
+		Source:      utils.ReadingSourceService,
+		Notes:       order.Title,
+		CreatedBy:   userObjectID,
+		CreatedAt:   time.Now(),
+	}
+	if msg := prepareReading(readings, &reading, 0); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	result, err := h.db.DB.Collection("odometer_readings").InsertOne(context.TODO(), reading)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения показания"})
+	}
+	reading.ID = result.InsertedID.(primitive.ObjectID)
+
+	readings = insertSortedReading(readings, reading)
+	if err := syncVehicleMeters(h.db, vehicle.ID, readings); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления пробега"})
+	}
+	order.Odometer = reading.Mileage
+
+	order.Status = utils.WorkOrderCompleted
+	order.CompletedAt = request.CompletedAt
+	order.UpdatedAt = time.Now()
+
+	_, err = h.db.DB.Collection("work_orders").UpdateOne(context.TODO(), bson.M{"_id": orderID}, bson.M{"$set": bson.M{
+		"status":       order.Status,
+		"completed_at": order.CompletedAt,
+		"odometer":     order.Odometer,
+		"engine_hours": order.EngineHours,
+		"updated_at":   order.UpdatedAt,
+	}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка закрытия заказ-наряда"})
+	}
+
+	return c.JSON(order)
+}
+
+func (h *MaintenanceHandler) DeleteWorkOrder(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	orderID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID заказ-наряда"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	result, err := h.db.DB.Collection("work_orders").DeleteOne(context.TODO(), bson.M{
+		"_id":        orderID,
+		"company_id": bson.M{"$in": companyIDs},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления заказ-наряда"})
+	}
+
+	if result.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Заказ-наряд не найден"})
+	}
+
+	// Удаляем документы заказ-наряда вместе с файлами в хранилище
+	_, err = deleteStoredDocuments(h.db, h.store, bson.M{"entity_type": utils.DocumentEntityWorkOrder, "entity_id": orderID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления документов"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Заказ-наряд удален"})
+}
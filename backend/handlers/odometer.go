@@ -0,0 +1,518 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"sort"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type ReadingRequest struct {
+	ReadingDate   time.Time `json:"reading_date"`
+	Odometer      float64   `json:"odometer"`
+	EngineHours   float64   `json:"engine_hours"`
+	Source        string    `json:"source"`
+	Rollover      bool      `json:"rollover"`
+	RolloverLimit float64   `json:"rollover_limit"`
+	Notes         string    `json:"notes"`
+}
+
+type ImportReadingsRequest struct {
+	Readings []ReadingRequest `json:"readings"`
+}
+
+type ReadingImportError struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// loadVehicleReadings возвращает показания одометра транспорта в порядке дат
+func loadVehicleReadings(db *database.Database, vehicleID primitive.ObjectID) ([]models.OdometerReading, error) {
+	opts := options.Find().SetSort(bson.D{{Key: "reading_date", Value: 1}, {Key: "created_at", Value: 1}})
+	cursor, err := db.DB.Collection("odometer_readings").Find(context.TODO(), bson.M{"vehicle_id": vehicleID}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	readings := []models.OdometerReading{}
+	if err = cursor.All(context.TODO(), &readings); err != nil {
+		return nil, err
+	}
+	return readings, nil
+}
+
+// loadVehicleMeterPoints загружает журналы показаний транспорта компаний в виде точек пробега по транспорту
+func loadVehicleMeterPoints(db *database.Database, companyIDs []primitive.ObjectID) (map[primitive.ObjectID][]utils.MeterPoint, error) {
+	meters := map[primitive.ObjectID][]utils.MeterPoint{}
+	if len(companyIDs) == 0 {
+		return meters, nil
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "reading_date", Value: 1}, {Key: "created_at", Value: 1}})
+	cursor, err := db.DB.Collection("odometer_readings").Find(context.TODO(), bson.M{"company_id": bson.M{"$in": companyIDs}}, opts)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var readings []models.OdometerReading
+	if err = cursor.All(context.TODO(), &readings); err != nil {
+		return nil, err
+	}
+
+	byVehicle := map[primitive.ObjectID][]models.OdometerReading{}
+	for _, reading := range readings {
+		byVehicle[reading.VehicleID] = append(byVehicle[reading.VehicleID], reading)
+	}
+	for vehicleID, list := range byVehicle {
+		meters[vehicleID] = meterPoints(list)
+	}
+	return meters, nil
+}
+
+// prepareReading проверяет монотонность показания относительно соседних и рассчитывает пробег с учетом обнулений.
+// Обнуление одометра допускается только для последнего показания: смещение увеличивается на предел одометра.
+func prepareReading(readings []models.OdometerReading, reading *models.OdometerReading, rolloverLimit float64) string {
+	if reading.Odometer < 0 || reading.EngineHours < 0 {
+		return "Показания не могут быть отрицательными"
+	}
+	if reading.Source == "" {
+		reading.Source = utils.ReadingSourceManual
+	}
+	if !utils.IsValidReadingSource(reading.Source) {
+		return "Неверный источник показаний"
+	}
+	if reading.ReadingDate.IsZero() {
+		reading.ReadingDate = time.Now()
+	}
+
+	var prev, next *models.OdometerReading
+	for i := range readings {
+		if readings[i].ReadingDate.After(reading.ReadingDate) {
+			next = &readings[i]
+			break
+		}
+		prev = &readings[i]
+	}
+
+	reading.RolloverOffset = 0
+	if prev != nil {
+		reading.RolloverOffset = prev.RolloverOffset
+	}
+
+	if reading.Rollover {
+		if prev == nil || next != nil {
+			return "Обнуление одометра можно отметить только для последнего показания"
+		}
+		if rolloverLimit <= 0 {
+			rolloverLimit = utils.DefaultOdometerRollover
+		}
+		if prev.Odometer > rolloverLimit || reading.Odometer >= prev.Odometer {
+			return "Показание не соответствует обнулению одометра"
+		}
+		reading.RolloverOffset += rolloverLimit
+	} else if prev != nil && reading.Odometer+reading.RolloverOffset < prev.Mileage {
+		return "Показание одометра меньше предыдущего; если одометр обнулился, укажите rollover"
+	}
+
+	reading.Mileage = reading.Odometer + reading.RolloverOffset
+	if next != nil && reading.Mileage > next.Mileage {
+		return "Показание одометра больше следующего по дате"
+	}
+
+	// Моточасы необязательны: ноль означает, что счетчик не передан
+	if reading.EngineHours > 0 {
+		for i := len(readings) - 1; i >= 0; i-- {
+			if !readings[i].ReadingDate.After(reading.ReadingDate) && readings[i].EngineHours > 0 {
+				if reading.EngineHours < readings[i].EngineHours {
+					return "Моточасы меньше предыдущего показания"
+				}
+				break
+			}
+		}
+		for i := range readings {
+			if readings[i].ReadingDate.After(reading.ReadingDate) && readings[i].EngineHours > 0 {
+				if reading.EngineHours > readings[i].EngineHours {
+					return "Моточасы больше следующего показания"
+				}
+				break
+			}
+		}
+	}
+
+	return ""
+}
+
+// insertSortedReading добавляет показание в отсортированный по дате список
+func insertSortedReading(readings []models.OdometerReading, reading models.OdometerReading) []models.OdometerReading {
+	index := sort.Search(len(readings), func(i int) bool { return readings[i].ReadingDate.After(reading.ReadingDate) })
+	readings = append(readings, models.OdometerReading{})
+	copy(readings[index+1:], readings[index:])
+	readings[index] = reading
+	return readings
+}
+
+// meterPoints преобразует показания в точки для расчета использования; пропущенные моточасы берутся из предыдущего показания
+func meterPoints(readings []models.OdometerReading) []utils.MeterPoint {
+	points := make([]utils.MeterPoint, 0, len(readings))
+	hours := 0.0
+	for _, reading := range readings {
+		if reading.EngineHours > 0 {
+			hours = reading.EngineHours
+		}
+		points = append(points, utils.MeterPoint{Date: reading.ReadingDate, Mileage: reading.Mileage, EngineHours: hours})
+	}
+	return points
+}
+
+// syncVehicleMeters обновляет текущий пробег и моточасы транспорта по последнему показанию.
+// Если журнал показаний пуст, сохраняются записанные значения транспорта.
+func syncVehicleMeters(db *database.Database, vehicleID primitive.ObjectID, readings []models.OdometerReading) error {
+	points := meterPoints(readings)
+	if len(points) == 0 {
+		return nil
+	}
+	mileage, hours := points[len(points)-1].Mileage, points[len(points)-1].EngineHours
+
+	_, err := db.DB.Collection("vehicles").UpdateOne(context.TODO(), bson.M{"_id": vehicleID}, bson.M{"$set": bson.M{
+		"mileage":      mileage,
+		"engine_hours": hours,
+		"updated_at":   time.Now(),
+	}})
+	return err
+}
+
+func (h *VehicleHandler) GetReadings(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	vehicleID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+	}
+
+	if _, err := findUserVehicle(h.db, userObjectID, vehicleID); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+
+	filter := bson.M{"vehicle_id": vehicleID}
+	dateFilter := bson.M{}
+	if from := c.Query("from"); from != "" {
+		fromDate, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+		}
+		dateFilter["$gte"] = fromDate
+	}
+	if to := c.Query("to"); to != "" {
+		toDate, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+		}
+		dateFilter["$lt"] = toDate.AddDate(0, 0, 1)
+	}
+	if len(dateFilter) > 0 {
+		filter["reading_date"] = dateFilter
+	}
+
+	cursor, err := h.db.DB.Collection("odometer_readings").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"reading_date": 1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+	}
+	defer cursor.Close(context.TODO())
+
+	readings := []models.OdometerReading{}
+	if err = cursor.All(context.TODO(), &readings); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	return c.JSON(readings)
+}
+
+// CreateReading записывает показание одометра и моточасов
+func (h *VehicleHandler) CreateReading(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	vehicleID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+	}
+
+	var request ReadingRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	vehicle, err := findUserVehicle(h.db, userObjectID, vehicleID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+
+	readings, err := loadVehicleReadings(h.db, vehicleID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+	}
+
+	reading := models.OdometerReading{
+		VehicleID:   vehicleID,
+		CompanyID:   vehicle.CompanyID,
+		ReadingDate: request.ReadingDate,
+		Odometer:    request.Odometer,
+		EngineHours: request.EngineHours,
+		Source:      request.Source,
+		Rollover:    request.Rollover,
+		Notes:       request.Notes,
+		CreatedBy:   userObjectID,
+		CreatedAt:   time.Now(),
+	}
+	if msg := prepareReading(readings, &reading, request.RolloverLimit); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	result, err := h.db.DB.Collection("odometer_readings").InsertOne(context.TODO(), reading)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения показания"})
+	}
+	reading.ID = result.InsertedID.(primitive.ObjectID)
+
+	if err := syncVehicleMeters(h.db, vehicleID, insertSortedReading(readings, reading)); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления пробега"})
+	}
+
+	return c.Status(201).JSON(reading)
+}
+
+// ImportReadings загружает пакет показаний. Показания проверяются по порядку дат,
+// некорректные строки пропускаются и возвращаются с номером в исходном списке.
+func (h *VehicleHandler) ImportReadings(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	vehicleID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+	}
+
+	var request ImportReadingsRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+	if len(request.Readings) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Нет показаний для импорта"})
+	}
+
+	vehicle, err := findUserVehicle(h.db, userObjectID, vehicleID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+
+	readings, err := loadVehicleReadings(h.db, vehicleID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+	}
+
+	order := make([]int, len(request.Readings))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return request.Readings[order[i]].ReadingDate.Before(request.Readings[order[j]].ReadingDate)
+	})
+
+	var documents []interface{}
+	importErrors := []ReadingImportError{}
+	now := time.Now()
+	for _, index := range order {
+		item := request.Readings[index]
+		if item.Source == "" {
+			item.Source = utils.ReadingSourceImport
+		}
+
+		reading := models.OdometerReading{
+			VehicleID:   vehicleID,
+			CompanyID:   vehicle.CompanyID,
+			ReadingDate: item.ReadingDate,
+			Odometer:    item.Odometer,
+			EngineHours: item.EngineHours,
+			Source:      item.Source,
+			Rollover:    item.Rollover,
+			Notes:       item.Notes,
+			CreatedBy:   userObjectID,
+			CreatedAt:   now,
+		}
+		if reading.ReadingDate.IsZero() {
+			importErrors = append(importErrors, ReadingImportError{Index: index, Error: "Не указана дата показания"})
+			continue
+		}
+		if msg := prepareReading(readings, &reading, item.RolloverLimit); msg != "" {
+			importErrors = append(importErrors, ReadingImportError{Index: index, Error: msg})
+			continue
+		}
+
+		reading.ID = primitive.NewObjectID()
+		readings = insertSortedReading(readings, reading)
+		documents = append(documents, reading)
+	}
+
+	if len(documents) > 0 {
+		if _, err := h.db.DB.Collection("odometer_readings").InsertMany(context.TODO(), documents); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения показаний"})
+		}
+		if err := syncVehicleMeters(h.db, vehicleID, readings); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления пробега"})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"imported": len(documents),
+		"errors":   importErrors,
+	})
+}
+
+func (h *VehicleHandler) DeleteReading(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	vehicleID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+	}
+
+	readingID, err := primitive.ObjectIDFromHex(c.Params("readingId"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID показания"})
+	}
+
+	if _, err := findUserVehicle(h.db, userObjectID, vehicleID); err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+
+	result, err := h.db.DB.Collection("odometer_readings").DeleteOne(context.TODO(), bson.M{"_id": readingID, "vehicle_id": vehicleID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления показания"})
+	}
+	if result.DeletedCount == 0 {
+		return c.Status(404).JSON(fiber.Map{"error": "Показание не найдено"})
+	}
+
+	readings, err := loadVehicleReadings(h.db, vehicleID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+	}
+	if err := syncVehicleMeters(h.db, vehicleID, readings); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления пробега"})
+	}
+
+	return c.JSON(fiber.Map{"message": "Показание удалено"})
+}
+
+// maxUtilizationYears ограничивает период отчета об использовании
+const maxUtilizationYears = 10
+
+// GetUtilization возвращает текущий пробег, пробег по периодам и среднесуточное использование.
+// По умолчанию — последние 12 месяцев с разбивкой по месяцам (period=week — по неделям).
+func (h *VehicleHandler) GetUtilization(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	vehicleID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID транспорта"})
+	}
+
+	now := time.Now()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1)
+	from := utils.MonthStart(to.AddDate(0, -11, 0))
+	if value := c.Query("from"); value != "" {
+		from, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+		}
+	}
+	if value := c.Query("to"); value != "" {
+		to, err = time.Parse("2006-01-02", value)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+		}
+		to = to.AddDate(0, 0, 1)
+	}
+	if !from.Before(to) {
+		return c.Status(400).JSON(fiber.Map{"error": "Начало периода должно быть раньше конца"})
+	}
+	if from.AddDate(maxUtilizationYears, 0, 0).Before(to) {
+		return c.Status(400).JSON(fiber.Map{"error": "Период не может превышать 10 лет"})
+	}
+
+	period := c.Query("period", "month")
+	if period != "month" && period != "week" {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный период (month или week)"})
+	}
+
+	vehicle, err := findUserVehicle(h.db, userObjectID, vehicleID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+
+	readings, err := loadVehicleReadings(h.db, vehicleID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+	}
+
+	response := fiber.Map{
+		"vehicle_id":      vehicle.ID.Hex(),
+		"current_mileage": vehicle.Mileage,
+		"engine_hours":    vehicle.EngineHours,
+		"readings_count":  len(readings),
+		"utilization":     utils.CalculateUtilization(meterPoints(readings), from, to, period),
+	}
+	if len(readings) > 0 {
+		response["last_reading_date"] = readings[len(readings)-1].ReadingDate.Format("2006-01-02")
+	}
+
+	return c.JSON(response)
+}
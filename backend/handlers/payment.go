@@ -11,6 +11,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type PaymentHandler struct {
@@ -125,19 +126,41 @@ func (h *PaymentHandler) CreatePayment(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "Кредит не найден"})
 	}
 
-	// Рассчитываем процентную часть платежа
-	interestPayment := utils.CalculateInterestPayment(loan.RemainingBalance, loan.InterestRate)
-	principalPayment := payment.TotalPaid - interestPayment
+	// Погашенный или рефинансированный кредит закрыт для новых платежей.
+	// Платежи рефинансирования и снятия залога создаются только сервером
+	payment.RefinanceID = primitive.NilObjectID
+	payment.LienReleaseVehicleID = primitive.NilObjectID
+	if isRefinanceLocked(&payment, &loan) {
+		return c.Status(409).JSON(fiber.Map{"error": "Кредит рефинансирован, платежи по нему не принимаются"})
+	}
+	if loan.Status == "paid_off" {
+		return c.Status(409).JSON(fiber.Map{"error": "Кредит погашен, платежи по нему не принимаются"})
+	}
 
-	if principalPayment < 0 {
-		principalPayment = 0
-		interestPayment = payment.TotalPaid
+	if payment.PaymentDate.IsZero() {
+		payment.PaymentDate = time.Now()
 	}
 
-	payment.PrincipalPaid = principalPayment
-	payment.InterestPaid = interestPayment
-	payment.RemainingBalance = utils.CalculateRemainingBalance(loan.RemainingBalance, principalPayment)
+	// Дополнительный платеж в счет основного долга входит в TotalPaid
+	if payment.ExtraPrincipal < 0 || payment.ExtraPrincipal > payment.TotalPaid {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверная сумма досрочного погашения"})
+	}
+	if payment.ExtraPrincipal > 0 && payment.PrepaymentOption == "" {
+		payment.PrepaymentOption = models.PrepaymentShortenTerm
+	}
+	if payment.PrepaymentOption != "" && payment.PrepaymentOption != models.PrepaymentShortenTerm && payment.PrepaymentOption != models.PrepaymentRecast {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный вариант досрочного погашения"})
+	}
+
+	// Платеж задним числом меняет разбивку всех последующих платежей
+	backdated := payment.PaymentDate.Before(loan.LastPaymentDate)
+
+	payment.ID = primitive.NilObjectID
+	payment.Status = models.PaymentPosted
+	payment.Replaces = primitive.NilObjectID
+	payment.ReplacedBy = primitive.NilObjectID
 	payment.CreatedAt = time.Now()
+	applyPaymentToLoan(&loan, &payment)
 
 	// Сохраняем платеж
 	paymentsCollection := h.db.DB.Collection("payments")
@@ -148,24 +171,22 @@ func (h *PaymentHandler) CreatePayment(c *fiber.Ctx) error {
 
 	payment.ID = result.InsertedID.(primitive.ObjectID)
 
-	// Обновляем остаток по кредиту
-	loan.RemainingBalance = payment.RemainingBalance
-	if loan.RemainingBalance <= 0 {
-		loan.Status = "paid_off"
+	if backdated {
+		if err := replayLoanPayments(h.db, &loan); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка пересчета платежей"})
+		}
+		if err := paymentsCollection.FindOne(context.TODO(), bson.M{"_id": payment.ID}).Decode(&payment); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения платежа"})
+		}
+	} else if err := saveLoanBalance(h.db, &loan); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления кредита"})
 	}
-	loan.UpdatedAt = time.Now()
 
-	_, err = loansCollection.UpdateOne(
-		context.TODO(),
-		bson.M{"_id": loan.ID},
-		bson.M{"$set": bson.M{
-			"remaining_balance": loan.RemainingBalance,
-			"status":            loan.Status,
-			"updated_at":        loan.UpdatedAt,
-		}},
-	)
-	if err != nil {
-		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления кредита"})
+	logPaymentEvent(h.db, &payment, models.PaymentEventCreated, "", userObjectID)
+
+	// Платеж может погасить просрочку
+	if _, err := refreshLoanDelinquency(h.db, &loan, time.Now()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка пересчета просрочки"})
 	}
 
 	return c.Status(201).JSON(payment)
@@ -238,3 +259,383 @@ func (h *PaymentHandler) GetPayments(c *fiber.Ctx) error {
 
 	return c.JSON(payments)
 }
+
+// applyPaymentToLoan разбивает платеж на проценты и основной долг и обновляет состояние кредита
+func applyPaymentToLoan(loan *models.Loan, payment *models.Payment) {
+	// Проценты начисляются с даты последнего платежа (или даты выдачи) до даты этого платежа
+	dayCount := loanDayCount(loan)
+	accrualStart := loanAccrualStart(loan)
+	regularPayment := payment.TotalPaid - payment.ExtraPrincipal
+
+	// Рассчитываем процентную часть платежа
+	payment.DaysAccrued = utils.DaysBetween(dayCount, accrualStart, payment.PaymentDate)
+	interestPayment := utils.CalculateAccruedInterest(loan.RemainingBalance, loan.InterestRate, dayCount, accrualStart, payment.PaymentDate)
+	principalPayment := regularPayment - interestPayment
+
+	if principalPayment < 0 {
+		principalPayment = 0
+		interestPayment = regularPayment
+	}
+	principalPayment += payment.ExtraPrincipal
+
+	payment.PrincipalPaid = principalPayment
+	payment.InterestPaid = interestPayment
+	payment.RemainingBalance = utils.CalculateRemainingBalance(loan.RemainingBalance, principalPayment)
+
+	// Обновляем остаток по кредиту
+	loan.RemainingBalance = payment.RemainingBalance
+	if loan.RemainingBalance <= 0 {
+		loan.Status = "paid_off"
+	}
+	if payment.PaymentDate.After(loan.LastPaymentDate) {
+		loan.LastPaymentDate = payment.PaymentDate
+	}
+
+	// При рекасте пересчитываем платеж на оставшийся срок, иначе срок сокращается
+	if payment.PrepaymentOption == models.PrepaymentRecast && loan.RemainingBalance > 0 {
+		remainingTerm := loan.TermMonths - utils.MonthsBetween(loan.StartDate, payment.PaymentDate) - 1
+		if remainingTerm < 1 {
+			remainingTerm = 1
+		}
+		loan.MonthlyPayment = utils.CalculateMonthlyPaymentWithBalloon(loan.RemainingBalance, loan.InterestRate, remainingTerm, loan.BalloonAmount)
+	}
+	loan.UpdatedAt = time.Now()
+}
+
+// saveLoanBalance сохраняет состояние кредита, которое меняют платежи
+func saveLoanBalance(db *database.Database, loan *models.Loan) error {
+	_, err := db.DB.Collection("loans").UpdateOne(
+		context.TODO(),
+		bson.M{"_id": loan.ID},
+		bson.M{"$set": bson.M{
+			"remaining_balance": loan.RemainingBalance,
+			"monthly_payment":   loan.MonthlyPayment,
+			"last_payment_date": loan.LastPaymentDate,
+			"status":            loan.Status,
+			"updated_at":        loan.UpdatedAt,
+		}},
+	)
+	return err
+}
+
+// replayLoanPayments заново проводит все действующие платежи кредита в порядке дат,
+// пересчитывая разбивку каждого платежа и итоговый остаток
+func replayLoanPayments(db *database.Database, loan *models.Loan) error {
+	paymentsCollection := db.DB.Collection("payments")
+	opts := options.Find().SetSort(bson.D{{Key: "payment_date", Value: 1}, {Key: "created_at", Value: 1}})
+	cursor, err := paymentsCollection.Find(context.TODO(), activePaymentsFilter(loan.ID), opts)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(context.TODO())
+
+	var payments []models.Payment
+	if err = cursor.All(context.TODO(), &payments); err != nil {
+		return err
+	}
+
+	// Возвращаем кредит в исходное состояние
+	loan.RemainingBalance = loan.PrincipalAmount
+	loan.LastPaymentDate = time.Time{}
+	loan.MonthlyPayment = utils.CalculateMonthlyPaymentWithBalloon(loan.PrincipalAmount, loan.InterestRate, loan.TermMonths, loan.BalloonAmount)
+	loan.Status = "active"
+
+	for i := range payments {
+		applyPaymentToLoan(loan, &payments[i])
+		_, err := paymentsCollection.UpdateOne(context.TODO(), bson.M{"_id": payments[i].ID}, bson.M{"$set": bson.M{
+			"principal_paid":    payments[i].PrincipalPaid,
+			"interest_paid":     payments[i].InterestPaid,
+			"remaining_balance": payments[i].RemainingBalance,
+			"days_accrued":      payments[i].DaysAccrued,
+		}})
+		if err != nil {
+			return err
+		}
+	}
+
+	// Рефинансированный кредит остается погашенным: его долг перенесен в новый кредит
+	if !loan.RefinancedInto.IsZero() {
+		loan.RemainingBalance = 0
+		loan.Status = "paid_off"
+	}
+	loan.UpdatedAt = time.Now()
+
+	set := bson.M{
+		"remaining_balance": loan.RemainingBalance,
+		"monthly_payment":   loan.MonthlyPayment,
+		"status":            loan.Status,
+		"updated_at":        loan.UpdatedAt,
+	}
+	update := bson.M{"$set": set}
+	if loan.LastPaymentDate.IsZero() {
+		update["$unset"] = bson.M{"last_payment_date": ""}
+	} else {
+		set["last_payment_date"] = loan.LastPaymentDate
+	}
+
+	_, err = db.DB.Collection("loans").UpdateOne(context.TODO(), bson.M{"_id": loan.ID}, update)
+	return err
+}
+
+// isRefinanceLocked сообщает, что платеж нельзя аннулировать или исправлять: погашение при
+// рефинансировании уже включено в новый кредит, а история старого кредита закрыта
+func isRefinanceLocked(payment *models.Payment, loan *models.Loan) bool {
+	return !payment.RefinanceID.IsZero() || !loan.RefinancedInto.IsZero()
+}
+
+type PaymentStatusRequest struct {
+	Reason       string    `json:"reason"`
+	ReversalDate time.Time `json:"reversal_date"`
+}
+
+// findUserPayment находит платеж и его кредит, если кредит принадлежит пользователю
+func (h *PaymentHandler) findUserPayment(userObjectID, paymentID primitive.ObjectID) (*models.Payment, *models.Loan, error) {
+	var payment models.Payment
+	if err := h.db.DB.Collection("payments").FindOne(context.TODO(), bson.M{"_id": paymentID}).Decode(&payment); err != nil {
+		return nil, nil, err
+	}
+
+	loan, err := findUserLoan(h.db, userObjectID, payment.LoanID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &payment, loan, nil
+}
+
+// changePaymentStatus аннулирует или сторнирует платеж и заново проводит историю платежей кредита
+func (h *PaymentHandler) changePaymentStatus(c *fiber.Ctx, status, action string) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	paymentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID платежа"})
+	}
+
+	var request PaymentStatusRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+		}
+	}
+
+	payment, loan, err := h.findUserPayment(userObjectID, paymentID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Платеж не найден"})
+	}
+
+	if payment.Status == models.PaymentVoided || payment.Status == models.PaymentReversed {
+		return c.Status(409).JSON(fiber.Map{"error": "Платеж уже аннулирован"})
+	}
+	if isRefinanceLocked(payment, loan) {
+		return c.Status(409).JSON(fiber.Map{"error": "Кредит рефинансирован, его платежи нельзя изменять"})
+	}
+
+	payment.Status = status
+	payment.StatusReason = request.Reason
+	payment.StatusChangedAt = time.Now()
+
+	set := bson.M{
+		"status":            payment.Status,
+		"status_reason":     payment.StatusReason,
+		"status_changed_at": payment.StatusChangedAt,
+	}
+	if status == models.PaymentReversed {
+		payment.ReversalDate = request.ReversalDate
+		if payment.ReversalDate.IsZero() {
+			payment.ReversalDate = time.Now()
+		}
+		set["reversal_date"] = payment.ReversalDate
+	}
+
+	if _, err := h.db.DB.Collection("payments").UpdateOne(context.TODO(), bson.M{"_id": payment.ID}, bson.M{"$set": set}); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления платежа"})
+	}
+
+	if err := replayLoanPayments(h.db, loan); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка пересчета платежей"})
+	}
+	if _, err := refreshLoanDelinquency(h.db, loan, time.Now()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка пересчета просрочки"})
+	}
+
+	logPaymentEvent(h.db, payment, action, request.Reason, userObjectID)
+
+	return c.JSON(fiber.Map{"payment": payment, "loan": loan})
+}
+
+// VoidPayment аннулирует ошибочно введенный платеж
+func (h *PaymentHandler) VoidPayment(c *fiber.Ctx) error {
+	return h.changePaymentStatus(c, models.PaymentVoided, models.PaymentEventVoided)
+}
+
+// ReversePayment сторнирует платеж, возвращенный банком (например, при недостатке средств)
+func (h *PaymentHandler) ReversePayment(c *fiber.Ctx) error {
+	return h.changePaymentStatus(c, models.PaymentReversed, models.PaymentEventReversed)
+}
+
+// UpdatePayment исправляет платеж: исходный платеж аннулируется, вместо него проводится новый
+func (h *PaymentHandler) UpdatePayment(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	paymentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID платежа"})
+	}
+
+	var correction struct {
+		models.Payment
+		Reason string `json:"reason"`
+	}
+	if err := c.BodyParser(&correction); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	original, loan, err := h.findUserPayment(userObjectID, paymentID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Платеж не найден"})
+	}
+
+	if original.Status == models.PaymentVoided || original.Status == models.PaymentReversed {
+		return c.Status(409).JSON(fiber.Map{"error": "Платеж уже аннулирован"})
+	}
+	if isRefinanceLocked(original, loan) {
+		return c.Status(409).JSON(fiber.Map{"error": "Кредит рефинансирован, его платежи нельзя изменять"})
+	}
+
+	replacement := models.Payment{
+		LoanID:           original.LoanID,
+		PaymentDate:      correction.PaymentDate,
+		TotalPaid:        correction.TotalPaid,
+		ExtraPrincipal:   correction.ExtraPrincipal,
+		PrepaymentOption: correction.PrepaymentOption,
+		Status:           models.PaymentPosted,
+		Replaces:         original.ID,
+		CreatedAt:        time.Now(),
+	}
+	if replacement.PaymentDate.IsZero() {
+		replacement.PaymentDate = original.PaymentDate
+	}
+	if replacement.ExtraPrincipal < 0 || replacement.ExtraPrincipal > replacement.TotalPaid {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверная сумма досрочного погашения"})
+	}
+	if replacement.ExtraPrincipal > 0 && replacement.PrepaymentOption == "" {
+		replacement.PrepaymentOption = models.PrepaymentShortenTerm
+	}
+	if replacement.PrepaymentOption != "" && replacement.PrepaymentOption != models.PrepaymentShortenTerm && replacement.PrepaymentOption != models.PrepaymentRecast {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный вариант досрочного погашения"})
+	}
+
+	// Сначала аннулируем исходный платеж, затем проводим замену; если замена не сохранилась,
+	// исходный платеж восстанавливается, чтобы сумма не учитывалась дважды
+	paymentsCollection := h.db.DB.Collection("payments")
+	replacement.ID = primitive.NewObjectID()
+	replacement.LienReleaseVehicleID = original.LienReleaseVehicleID
+	previous := *original
+
+	original.Status = models.PaymentVoided
+	original.StatusReason = correction.Reason
+	original.StatusChangedAt = time.Now()
+	original.ReplacedBy = replacement.ID
+	_, err = paymentsCollection.UpdateOne(context.TODO(), bson.M{"_id": original.ID}, bson.M{"$set": bson.M{
+		"status":            original.Status,
+		"status_reason":     original.StatusReason,
+		"status_changed_at": original.StatusChangedAt,
+		"replaced_by":       original.ReplacedBy,
+	}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления платежа"})
+	}
+
+	if _, err := paymentsCollection.InsertOne(context.TODO(), replacement); err != nil {
+		set := bson.M{"status": previous.Status}
+		unset := bson.M{"replaced_by": ""}
+		if previous.StatusReason != "" {
+			set["status_reason"] = previous.StatusReason
+		} else {
+			unset["status_reason"] = ""
+		}
+		if !previous.StatusChangedAt.IsZero() {
+			set["status_changed_at"] = previous.StatusChangedAt
+		} else {
+			unset["status_changed_at"] = ""
+		}
+		paymentsCollection.UpdateOne(context.TODO(), bson.M{"_id": original.ID}, bson.M{"$set": set, "$unset": unset})
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания платежа"})
+	}
+
+	if err := replayLoanPayments(h.db, loan); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка пересчета платежей"})
+	}
+	if _, err := refreshLoanDelinquency(h.db, loan, time.Now()); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка пересчета просрочки"})
+	}
+	if err := paymentsCollection.FindOne(context.TODO(), bson.M{"_id": replacement.ID}).Decode(&replacement); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения платежа"})
+	}
+
+	logPaymentEvent(h.db, &replacement, models.PaymentEventCorrected, correction.Reason, userObjectID)
+
+	return c.JSON(fiber.Map{"payment": replacement, "replaced": original, "loan": loan})
+}
+
+// GetPaymentHistory возвращает журнал изменений платежа
+func (h *PaymentHandler) GetPaymentHistory(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	paymentID, err := primitive.ObjectIDFromHex(c.Params("id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID платежа"})
+	}
+
+	payment, _, err := h.findUserPayment(userObjectID, paymentID)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Платеж не найден"})
+	}
+
+	// Журнал включает исходный платеж, если этот платеж его заменил
+	paymentIDs := []primitive.ObjectID{payment.ID}
+	if !payment.Replaces.IsZero() {
+		paymentIDs = append(paymentIDs, payment.Replaces)
+	}
+	if !payment.ReplacedBy.IsZero() {
+		paymentIDs = append(paymentIDs, payment.ReplacedBy)
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := h.db.DB.Collection("payment_events").Find(context.TODO(), bson.M{"payment_id": bson.M{"$in": paymentIDs}}, opts)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения журнала"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var events []models.PaymentEvent
+	if err = cursor.All(context.TODO(), &events); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	return c.JSON(events)
+}
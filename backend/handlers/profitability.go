@@ -0,0 +1,433 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ProfitabilityHandler struct {
+	db *database.Database
+}
+
+func NewProfitabilityHandler(db *database.Database) *ProfitabilityHandler {
+	return &ProfitabilityHandler{db: db}
+}
+
+// ProfitabilityPeriod — выручка и затраты тягача (или парка) за месяц.
+// Profit — операционная прибыль: выручка минус оплата водителя, топливо, обслуживание, амортизация,
+// проценты по кредитам и операционный лизинг. CashFlow — денежный поток: вместо амортизации и процентов
+// вычитаются полные платежи по кредитам и все лизинговые платежи.
+type ProfitabilityPeriod struct {
+	Month          string  `json:"month"`
+	Loads          int     `json:"loads"`
+	LoadedMiles    float64 `json:"loaded_miles"`
+	DeadheadMiles  float64 `json:"deadhead_miles"`
+	Miles          float64 `json:"miles"`
+	Revenue        float64 `json:"revenue"`
+	DriverPay      float64 `json:"driver_pay"`
+	Fuel           float64 `json:"fuel"`
+	Maintenance    float64 `json:"maintenance"`
+	Depreciation   float64 `json:"depreciation"`
+	LoanInterest   float64 `json:"loan_interest"`
+	LoanPayments   float64 `json:"loan_payments"`
+	LoanPayoffs    float64 `json:"loan_payoffs"`
+	LeasePayments  float64 `json:"lease_payments"`
+	OperatingLease float64 `json:"operating_lease"`
+	TotalCosts     float64 `json:"total_costs"`
+	Profit         float64 `json:"profit"`
+	CashFlow       float64 `json:"cash_flow"`
+	RevenuePerMile float64 `json:"revenue_per_mile"`
+	CostPerMile    float64 `json:"cost_per_mile"`
+	ProfitPerMile  float64 `json:"profit_per_mile"`
+}
+
+type TruckProfitability struct {
+	VehicleID   string                `json:"vehicle_id"`
+	VehicleName string                `json:"vehicle_name"`
+	UnitNumber  string                `json:"unit_number,omitempty"`
+	Months      []ProfitabilityPeriod `json:"months"`
+	Totals      ProfitabilityPeriod   `json:"totals"`
+}
+
+type ProfitabilityReport struct {
+	From   string                `json:"from"`
+	To     string                `json:"to"`
+	Trucks []TruckProfitability  `json:"trucks"`
+	Fleet  []ProfitabilityPeriod `json:"fleet"`
+	Totals ProfitabilityPeriod   `json:"totals"`
+}
+
+func (p *ProfitabilityPeriod) add(other *ProfitabilityPeriod) {
+	p.Loads += other.Loads
+	p.LoadedMiles += other.LoadedMiles
+	p.DeadheadMiles += other.DeadheadMiles
+	p.Miles += other.Miles
+	p.Revenue += other.Revenue
+	p.DriverPay += other.DriverPay
+	p.Fuel += other.Fuel
+	p.Maintenance += other.Maintenance
+	p.Depreciation += other.Depreciation
+	p.LoanInterest += other.LoanInterest
+	p.LoanPayments += other.LoanPayments
+	p.LoanPayoffs += other.LoanPayoffs
+	p.LeasePayments += other.LeasePayments
+	p.OperatingLease += other.OperatingLease
+}
+
+// finalize округляет суммы и рассчитывает прибыль, денежный поток и показатели на милю
+func (p *ProfitabilityPeriod) finalize() {
+	for _, value := range []*float64{&p.Revenue, &p.DriverPay, &p.Fuel, &p.Maintenance, &p.Depreciation,
+		&p.LoanInterest, &p.LoanPayments, &p.LoanPayoffs, &p.LeasePayments, &p.OperatingLease} {
+		*value = roundMoney(*value)
+	}
+	p.LoadedMiles = math.Round(p.LoadedMiles)
+	p.DeadheadMiles = math.Round(p.DeadheadMiles)
+	p.Miles = math.Round(p.Miles)
+
+	p.TotalCosts = roundMoney(p.DriverPay + p.Fuel + p.Maintenance + p.Depreciation + p.LoanInterest + p.OperatingLease)
+	p.Profit = roundMoney(p.Revenue - p.TotalCosts)
+	p.CashFlow = roundMoney(p.Revenue - p.DriverPay - p.Fuel - p.Maintenance - p.LoanPayments - p.LeasePayments)
+	p.RevenuePerMile = utils.PerMile(p.Revenue, p.Miles)
+	p.CostPerMile = utils.PerMile(p.TotalCosts, p.Miles)
+	p.ProfitPerMile = utils.PerMile(p.Profit, p.Miles)
+}
+
+// loanVehicleShares возвращает долю каждой залоговой единицы в кредите, включая освобожденные от залога:
+// платежи прошлых периодов распределяются по исходному составу залога
+func loanVehicleShares(loan *models.Loan) map[primitive.ObjectID]float64 {
+	normalizeCollateral(loan)
+
+	shares := map[primitive.ObjectID]float64{}
+	allocatedTotal := 0.0
+	for _, collateral := range loan.Collateral {
+		shares[collateral.VehicleID] += collateral.AllocatedPrincipal
+		allocatedTotal += collateral.AllocatedPrincipal
+	}
+	for vehicleID, allocated := range shares {
+		if allocatedTotal > 0 {
+			shares[vehicleID] = allocated / allocatedTotal
+		} else {
+			shares[vehicleID] = 1.0 / float64(len(shares))
+		}
+	}
+	return shares
+}
+
+// loadRevenueDate — дата признания выручки рейса: выгрузка, а до нее — погрузка
+func loadRevenueDate(load *models.Load) time.Time {
+	if !load.DeliveryDate.IsZero() {
+		return load.DeliveryDate
+	}
+	return load.PickupDate
+}
+
+// GetProfitability рассчитывает прибыльность тягачей по месяцам: выручка рейсов против оплаты водителей,
+// топлива, обслуживания, амортизации, платежей по кредитам и лизинга.
+// Фильтры: company_id, vehicle_id, from/to (по умолчанию последние 12 месяцев).
+func (h *ProfitabilityHandler) GetProfitability(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	from, to, err := reportPeriod(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+	}
+	from = utils.MonthStart(from)
+	if !from.Before(to) {
+		return c.Status(400).JSON(fiber.Map{"error": "Начало периода позже окончания"})
+	}
+
+	companyIDs, vehicleID, status, msg := reportScope(c, h.db, userObjectID)
+	if msg != "" {
+		return c.Status(status).JSON(fiber.Map{"error": msg})
+	}
+
+	// Тягачи
+	truckFilter := bson.M{"company_id": bson.M{"$in": companyIDs}, "type": "truck"}
+	if vehicleID != nil {
+		truckFilter["_id"] = *vehicleID
+	}
+	trucksCursor, err := h.db.DB.Collection("vehicles").Find(context.TODO(), truckFilter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения транспорта"})
+	}
+	defer trucksCursor.Close(context.TODO())
+	var trucks []models.Vehicle
+	if err = trucksCursor.All(context.TODO(), &trucks); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования транспорта"})
+	}
+
+	var months []time.Time
+	for month := from; month.Before(to); month = month.AddDate(0, 1, 0) {
+		months = append(months, month)
+	}
+	monthIndex := func(date time.Time) int {
+		if date.Before(from) || !date.Before(to) {
+			return -1
+		}
+		return (date.Year()-from.Year())*12 + int(date.Month()) - int(from.Month())
+	}
+
+	truckIDs := make([]primitive.ObjectID, 0, len(trucks))
+	periods := map[primitive.ObjectID][]ProfitabilityPeriod{}
+	for _, truck := range trucks {
+		truckIDs = append(truckIDs, truck.ID)
+		list := make([]ProfitabilityPeriod, len(months))
+		for i, month := range months {
+			list[i].Month = month.Format("2006-01")
+		}
+		periods[truck.ID] = list
+	}
+	period := func(truckID primitive.ObjectID, date time.Time) *ProfitabilityPeriod {
+		list, ok := periods[truckID]
+		index := monthIndex(date)
+		if !ok || index < 0 || index >= len(list) {
+			return nil
+		}
+		return &list[index]
+	}
+
+	// Рейсы: выручка и оплата водителя
+	loadsCursor, err := h.db.DB.Collection("loads").Find(context.TODO(), bson.M{
+		"truck_id":    bson.M{"$in": truckIDs},
+		"status":      bson.M{"$ne": utils.LoadCancelled},
+		"pickup_date": bson.M{"$lt": to},
+		"$or": bson.A{
+			bson.M{"pickup_date": bson.M{"$gte": from}},
+			bson.M{"delivery_date": bson.M{"$gte": from}},
+		},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения рейсов"})
+	}
+	defer loadsCursor.Close(context.TODO())
+	var loads []models.Load
+	if err = loadsCursor.All(context.TODO(), &loads); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования рейсов"})
+	}
+	for i := range loads {
+		load := &loads[i]
+		if current := period(*load.TruckID, loadRevenueDate(load)); current != nil {
+			current.Loads++
+			current.LoadedMiles += load.LoadedMiles
+			current.DeadheadMiles += load.DeadheadMiles
+			current.Revenue += load.TotalRevenue
+			current.DriverPay += load.DriverPay
+		}
+	}
+
+	// Топливо
+	purchases, err := loadFuelPurchases(h.db, companyIDs, vehicleID, from, to)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения заправок"})
+	}
+	for _, purchase := range purchases {
+		if current := period(purchase.VehicleID, purchase.PurchaseDate); current != nil {
+			current.Fuel += purchase.TotalCost
+		}
+	}
+
+	// Закрытые заказ-наряды на обслуживание
+	ordersCursor, err := h.db.DB.Collection("work_orders").Find(context.TODO(), bson.M{
+		"vehicle_id":   bson.M{"$in": truckIDs},
+		"status":       utils.WorkOrderCompleted,
+		"completed_at": bson.M{"$gte": from, "$lt": to},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения заказ-нарядов"})
+	}
+	defer ordersCursor.Close(context.TODO())
+	var orders []models.WorkOrder
+	if err = ordersCursor.All(context.TODO(), &orders); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования заказ-нарядов"})
+	}
+	for _, order := range orders {
+		if current := period(order.VehicleID, order.CompletedAt); current != nil {
+			current.Maintenance += order.TotalCost
+		}
+	}
+
+	// Платежи по кредитам распределяются между залоговыми тягачами
+	loansCursor, err := h.db.DB.Collection("loans").Find(context.TODO(), bson.M{
+		"company_id": bson.M{"$in": companyIDs},
+		"$or": bson.A{
+			bson.M{"vehicle_id": bson.M{"$in": truckIDs}},
+			bson.M{"collateral.vehicle_id": bson.M{"$in": truckIDs}},
+		},
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения кредитов"})
+	}
+	defer loansCursor.Close(context.TODO())
+	var loans []models.Loan
+	if err = loansCursor.All(context.TODO(), &loans); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования кредитов"})
+	}
+	if len(loans) > 0 {
+		loanShares := map[primitive.ObjectID]map[primitive.ObjectID]float64{}
+		loanIDs := make([]primitive.ObjectID, 0, len(loans))
+		for i := range loans {
+			loanShares[loans[i].ID] = loanVehicleShares(&loans[i])
+			loanIDs = append(loanIDs, loans[i].ID)
+		}
+
+		paymentsCursor, err := h.db.DB.Collection("payments").Find(context.TODO(), bson.M{
+			"loan_id":      bson.M{"$in": loanIDs},
+			"status":       bson.M{"$nin": []string{models.PaymentVoided, models.PaymentReversed}},
+			"payment_date": bson.M{"$gte": from, "$lt": to},
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения платежей"})
+		}
+		defer paymentsCursor.Close(context.TODO())
+		var payments []models.Payment
+		if err = paymentsCursor.All(context.TODO(), &payments); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования платежей"})
+		}
+		// Погашение при рефинансировании или продаже залога — не операционный платеж:
+		// оно показывается отдельно в loan_payoffs и не уменьшает денежный поток
+		for _, payment := range payments {
+			payoff := !payment.RefinanceID.IsZero() || !payment.LienReleaseVehicleID.IsZero()
+			for truckID, share := range loanShares[payment.LoanID] {
+				if current := period(truckID, payment.PaymentDate); current != nil {
+					if payoff {
+						current.LoanPayoffs += payment.TotalPaid * share
+					} else {
+						current.LoanPayments += payment.TotalPaid * share
+					}
+					current.LoanInterest += payment.InterestPaid * share
+				}
+			}
+		}
+	}
+
+	// Лизинговые платежи за месяцы действия договора; операционный лизинг заменяет амортизацию
+	leasesCursor, err := h.db.DB.Collection("leases").Find(context.TODO(), bson.M{"vehicle_id": bson.M{"$in": truckIDs}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения лизингов"})
+	}
+	defer leasesCursor.Close(context.TODO())
+	var leases []models.Lease
+	if err = leasesCursor.All(context.TODO(), &leases); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования лизингов"})
+	}
+	operatingLeased := map[primitive.ObjectID]bool{}
+	for _, lease := range leases {
+		if lease.Classification == utils.LeaseOperating && lease.Status == "active" {
+			operatingLeased[lease.VehicleID] = true
+		}
+		payment := utils.CalculateLeasePaymentWithTax(lease.MonthlyRent, lease.SalesTaxRate)
+		leaseStart := utils.MonthStart(lease.StartDate)
+		leaseEnd := leaseStart.AddDate(0, lease.TermMonths, 0)
+		for _, month := range months {
+			if month.Before(leaseStart) || !month.Before(leaseEnd) {
+				continue
+			}
+			if current := period(lease.VehicleID, month); current != nil {
+				current.LeasePayments += payment
+				if lease.Classification == utils.LeaseOperating {
+					current.OperatingLease += payment
+				}
+			}
+		}
+	}
+
+	// Амортизация за месяц — прирост накопленной амортизации транспорта с улучшениями
+	companiesCursor, err := h.db.DB.Collection("companies").Find(context.TODO(), bson.M{"_id": bson.M{"$in": companyIDs}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+	defer companiesCursor.Close(context.TODO())
+	var companies []models.Company
+	if err = companiesCursor.All(context.TODO(), &companies); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования компаний"})
+	}
+	depreciationDefaults := companyDepreciationDefaults(companies)
+	improvements, err := loadVehicleImprovements(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения улучшений"})
+	}
+
+	report := ProfitabilityReport{
+		From:   from.Format("2006-01-02"),
+		To:     to.AddDate(0, 0, -1).Format("2006-01-02"),
+		Trucks: []TruckProfitability{},
+		Fleet:  make([]ProfitabilityPeriod, len(months)),
+		Totals: ProfitabilityPeriod{Month: "total"},
+	}
+	for i, month := range months {
+		report.Fleet[i].Month = month.Format("2006-01")
+	}
+
+	for i := range trucks {
+		truck := &trucks[i]
+		list := periods[truck.ID]
+
+		readings, err := loadVehicleReadings(h.db, truck.ID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+		}
+		points := meterPoints(readings)
+
+		defaults := depreciationDefaults[truck.CompanyID]
+		previous := vehicleAssetValueAt(truck, defaults, improvements[truck.ID], points, months[0]).Accumulated
+		for index, month := range months {
+			monthEnd := month.AddDate(0, 1, 0)
+			if monthEnd.After(to) {
+				monthEnd = to
+			}
+			accumulated := vehicleAssetValueAt(truck, defaults, improvements[truck.ID], points, monthEnd).Accumulated
+			if !operatingLeased[truck.ID] && !monthEnd.Before(truck.PurchaseDate) {
+				list[index].Depreciation = math.Max(0, accumulated-previous)
+			}
+			previous = accumulated
+
+			// Пробег по одометру, без показаний — по рейсам
+			startMiles, _ := utils.MeterAt(points, month)
+			endMiles, _ := utils.MeterAt(points, monthEnd)
+			list[index].Miles = math.Max(0, endMiles-startMiles)
+			if list[index].Miles == 0 {
+				list[index].Miles = list[index].LoadedMiles + list[index].DeadheadMiles
+			}
+		}
+
+		item := TruckProfitability{
+			VehicleID:   truck.ID.Hex(),
+			VehicleName: vehicleTitle(truck),
+			UnitNumber:  truck.UnitNumber,
+			Months:      list,
+			Totals:      ProfitabilityPeriod{Month: "total"},
+		}
+		for index := range list {
+			item.Totals.add(&list[index])
+			report.Fleet[index].add(&list[index])
+			list[index].finalize()
+		}
+		report.Totals.add(&item.Totals)
+		item.Totals.finalize()
+		report.Trucks = append(report.Trucks, item)
+	}
+
+	for index := range report.Fleet {
+		report.Fleet[index].finalize()
+	}
+	report.Totals.finalize()
+
+	return c.JSON(report)
+}
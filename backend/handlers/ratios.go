@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type RatiosHandler struct {
+	db *database.Database
+}
+
+func NewRatiosHandler(db *database.Database) *RatiosHandler {
+	return &RatiosHandler{db: db}
+}
+
+type VehicleLTV struct {
+	VehicleID    string   `json:"vehicle_id"`
+	VehicleName  string   `json:"vehicle_name"`
+	LoanBalance  float64  `json:"loan_balance"`
+	CurrentValue float64  `json:"current_value"`
+	LTV          *float64 `json:"ltv"`
+}
+
+type CompanyRatios struct {
+	CompanyID          string       `json:"company_id,omitempty"`
+	CompanyName        string       `json:"company_name"`
+	NetOperatingIncome float64      `json:"net_operating_income"`
+	AnnualDebtService  float64      `json:"annual_debt_service"`
+	DSCR               *float64     `json:"dscr"`
+	LoanBalance        float64      `json:"loan_balance"`
+	LeaseLiability     float64      `json:"lease_liability"`
+	TotalDebt          float64      `json:"total_debt"`
+	FleetValue         float64      `json:"fleet_value"`
+	EquityInFleet      float64      `json:"equity_in_fleet"`
+	DebtToAsset        *float64     `json:"debt_to_asset"`
+	DebtToEquity       *float64     `json:"debt_to_equity"`
+	Vehicles           []VehicleLTV `json:"vehicles"`
+}
+
+type FinancialRatios struct {
+	AsOf         string          `json:"as_of"`
+	Consolidated CompanyRatios   `json:"consolidated"`
+	Companies    []CompanyRatios `json:"companies"`
+}
+
+// ratio возвращает отношение или nil, если знаменатель не положителен
+func ratio(numerator, denominator float64) *float64 {
+	if denominator <= 0 {
+		return nil
+	}
+	value := math.Round(numerator/denominator*10000) / 10000
+	return &value
+}
+
+// finalizeRatios округляет суммы и рассчитывает коэффициенты по накопленным показателям
+func finalizeRatios(r *CompanyRatios) {
+	r.NetOperatingIncome = math.Round(r.NetOperatingIncome*100) / 100
+	r.AnnualDebtService = math.Round(r.AnnualDebtService*100) / 100
+	r.LoanBalance = math.Round(r.LoanBalance*100) / 100
+	r.LeaseLiability = math.Round(r.LeaseLiability*100) / 100
+	r.TotalDebt = math.Round((r.LoanBalance+r.LeaseLiability)*100) / 100
+	r.FleetValue = math.Round(r.FleetValue*100) / 100
+	r.EquityInFleet = math.Round((r.FleetValue-r.TotalDebt)*100) / 100
+
+	r.DSCR = ratio(r.NetOperatingIncome, r.AnnualDebtService)
+	r.DebtToAsset = ratio(r.TotalDebt, r.FleetValue)
+	r.DebtToEquity = ratio(r.TotalDebt, r.EquityInFleet)
+}
+
+// calculateFinancialRatios рассчитывает DSCR, LTV и долговую нагрузку по компаниям и консолидированно.
+// Чистый операционный доход берется из прогноза доходов и расходов на 12 месяцев,
+// обслуживание долга — из графиков кредитов и лизингов на те же 12 месяцев.
+func calculateFinancialRatios(db *database.Database, companies []models.Company, asOf time.Time) (FinancialRatios, error) {
+	result := FinancialRatios{
+		AsOf:         asOf.Format("2006-01-02"),
+		Consolidated: CompanyRatios{CompanyName: "Консолидированно", Vehicles: []VehicleLTV{}},
+		Companies:    []CompanyRatios{},
+	}
+	if len(companies) == 0 {
+		return result, nil
+	}
+
+	var companyIDs []primitive.ObjectID
+	for _, company := range companies {
+		companyIDs = append(companyIDs, company.ID)
+	}
+
+	// Остаток каждого кредита распределяется на залоговый транспорт
+	loansCursor, err := db.DB.Collection("loans").Find(context.TODO(), bson.M{
+		"company_id": bson.M{"$in": companyIDs},
+		"status":     "active",
+	})
+	if err != nil {
+		return result, err
+	}
+	defer loansCursor.Close(context.TODO())
+
+	var loans []models.Loan
+	if err = loansCursor.All(context.TODO(), &loans); err != nil {
+		return result, err
+	}
+
+	loanBalances := map[primitive.ObjectID]float64{}
+	vehicleBalances := map[primitive.ObjectID]float64{}
+	for i := range loans {
+		loanBalances[loans[i].CompanyID] += loans[i].RemainingBalance
+		for vehicleID, share := range collateralShares(&loans[i]) {
+			vehicleBalances[vehicleID] += loans[i].RemainingBalance * share
+		}
+	}
+
+	vehiclesCursor, err := db.DB.Collection("vehicles").Find(context.TODO(), bson.M{
+		"company_id": bson.M{"$in": companyIDs},
+		"status":     bson.M{"$ne": "sold"},
+	})
+	if err != nil {
+		return result, err
+	}
+	defer vehiclesCursor.Close(context.TODO())
+
+	var vehicles []models.Vehicle
+	if err = vehiclesCursor.All(context.TODO(), &vehicles); err != nil {
+		return result, err
+	}
+
+	leases, err := getActiveLeases(db, companyIDs)
+	if err != nil {
+		return result, err
+	}
+	leasedVehicles := operatingLeaseVehicles(leases)
+	leaseLiabilities := map[primitive.ObjectID]float64{}
+	for i := range leases {
+		leaseLiabilities[leases[i].CompanyID] += leaseLiability(&leases[i], asOf)
+	}
+
+	itemsCursor, err := db.DB.Collection("cash_flow_items").Find(context.TODO(), bson.M{"company_id": bson.M{"$in": companyIDs}})
+	if err != nil {
+		return result, err
+	}
+	defer itemsCursor.Close(context.TODO())
+
+	var items []models.CashFlowItem
+	if err = itemsCursor.All(context.TODO(), &items); err != nil {
+		return result, err
+	}
+
+	improvements, err := loadVehicleImprovements(db, companyIDs)
+	if err != nil {
+		return result, err
+	}
+	meters, err := loadVehicleMeterPoints(db, companyIDs)
+	if err != nil {
+		return result, err
+	}
+
+	fromMonth := utils.MonthStart(asOf)
+	for _, company := range companies {
+		ratios := CompanyRatios{
+			CompanyID:      company.ID.Hex(),
+			CompanyName:    company.Name,
+			LoanBalance:    loanBalances[company.ID],
+			LeaseLiability: leaseLiabilities[company.ID],
+			Vehicles:       []VehicleLTV{},
+		}
+
+		for _, item := range items {
+			if item.CompanyID != company.ID {
+				continue
+			}
+			for i := 0; i < 12; i++ {
+				amount := item.Amount * float64(utils.OccurrencesInMonth(item.Frequency, item.StartDate, item.EndDate, fromMonth.AddDate(0, i, 0)))
+				if item.Type == "income" {
+					ratios.NetOperatingIncome += amount
+				} else {
+					ratios.NetOperatingIncome -= amount
+				}
+			}
+		}
+
+		loanPayments, leasePayments, err := projectDebtService(db, []primitive.ObjectID{company.ID}, fromMonth, 12)
+		if err != nil {
+			return result, err
+		}
+		for i := range loanPayments {
+			ratios.AnnualDebtService += loanPayments[i] + leasePayments[i]
+		}
+
+		for i := range vehicles {
+			if vehicles[i].CompanyID != company.ID || leasedVehicles[vehicles[i].ID] {
+				continue
+			}
+			_, currentValue := vehicleBookValue(&vehicles[i], company.Depreciation, improvements[vehicles[i].ID], meters[vehicles[i].ID])
+			ratios.FleetValue += currentValue
+
+			balance := math.Round(vehicleBalances[vehicles[i].ID]*100) / 100
+			ratios.Vehicles = append(ratios.Vehicles, VehicleLTV{
+				VehicleID:    vehicles[i].ID.Hex(),
+				VehicleName:  vehicleTitle(&vehicles[i]),
+				LoanBalance:  balance,
+				CurrentValue: currentValue,
+				LTV:          ratio(balance, currentValue),
+			})
+		}
+
+		result.Consolidated.NetOperatingIncome += ratios.NetOperatingIncome
+		result.Consolidated.AnnualDebtService += ratios.AnnualDebtService
+		result.Consolidated.LoanBalance += ratios.LoanBalance
+		result.Consolidated.LeaseLiability += ratios.LeaseLiability
+		result.Consolidated.FleetValue += ratios.FleetValue
+		result.Consolidated.Vehicles = append(result.Consolidated.Vehicles, ratios.Vehicles...)
+
+		finalizeRatios(&ratios)
+		result.Companies = append(result.Companies, ratios)
+	}
+
+	finalizeRatios(&result.Consolidated)
+	return result, nil
+}
+
+// GetRatios возвращает DSCR, LTV по транспорту, долговую нагрузку и собственный капитал во флоте
+func (h *RatiosHandler) GetRatios(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companies, err := getUserCompanies(h.db, userObjectID, c.Query("company_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+	}
+
+	ratios, err := calculateFinancialRatios(h.db, companies, time.Now())
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка расчета коэффициентов"})
+	}
+
+	return c.JSON(ratios)
+}
+
+// snapshotFromRatios преобразует рассчитанные коэффициенты в запись истории
+func snapshotFromRatios(r CompanyRatios, userObjectID primitive.ObjectID, date time.Time) models.RatioSnapshot {
+	snapshot := models.RatioSnapshot{
+		UserID:             userObjectID,
+		Consolidated:       r.CompanyID == "",
+		SnapshotDate:       date,
+		NetOperatingIncome: r.NetOperatingIncome,
+		AnnualDebtService:  r.AnnualDebtService,
+		DSCR:               r.DSCR,
+		TotalDebt:          r.TotalDebt,
+		FleetValue:         r.FleetValue,
+		EquityInFleet:      r.EquityInFleet,
+		DebtToAsset:        r.DebtToAsset,
+		DebtToEquity:       r.DebtToEquity,
+		CreatedAt:          time.Now(),
+	}
+	if !snapshot.Consolidated {
+		snapshot.CompanyID, _ = primitive.ObjectIDFromHex(r.CompanyID)
+	}
+	return snapshot
+}
+
+// CreateSnapshot сохраняет текущие коэффициенты всех компаний пользователя и консолидированные.
+// Повторный снимок за тот же день заменяет предыдущий.
+func (h *RatiosHandler) CreateSnapshot(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companies, err := getUserCompanies(h.db, userObjectID, "")
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	now := time.Now()
+	ratios, err := calculateFinancialRatios(h.db, companies, now)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка расчета коэффициентов"})
+	}
+
+	snapshotDate := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	snapshots := []models.RatioSnapshot{snapshotFromRatios(ratios.Consolidated, userObjectID, snapshotDate)}
+	for _, company := range ratios.Companies {
+		snapshots = append(snapshots, snapshotFromRatios(company, userObjectID, snapshotDate))
+	}
+
+	collection := h.db.DB.Collection("ratio_snapshots")
+	for _, snapshot := range snapshots {
+		filter := bson.M{
+			"user_id":       userObjectID,
+			"consolidated":  snapshot.Consolidated,
+			"snapshot_date": snapshotDate,
+		}
+		if !snapshot.Consolidated {
+			filter["company_id"] = snapshot.CompanyID
+		}
+
+		_, err := collection.ReplaceOne(context.TODO(), filter, snapshot, options.Replace().SetUpsert(true))
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения снимка"})
+		}
+	}
+
+	return c.Status(201).JSON(snapshots)
+}
+
+// GetHistory возвращает сохраненные снимки коэффициентов компании (без company_id — консолидированные)
+func (h *RatiosHandler) GetHistory(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	filter := bson.M{"user_id": userObjectID, "consolidated": true}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		filter = bson.M{"user_id": userObjectID, "company_id": companyObjectID}
+	}
+
+	dateFilter := bson.M{}
+	if from := c.Query("from"); from != "" {
+		fromDate, err := time.Parse("2006-01-02", from)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+		}
+		dateFilter["$gte"] = fromDate
+	}
+	if to := c.Query("to"); to != "" {
+		toDate, err := time.Parse("2006-01-02", to)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный формат даты, ожидается YYYY-MM-DD"})
+		}
+		dateFilter["$lte"] = toDate
+	}
+	if len(dateFilter) > 0 {
+		filter["snapshot_date"] = dateFilter
+	}
+
+	cursor, err := h.db.DB.Collection("ratio_snapshots").Find(context.TODO(), filter, options.Find().SetSort(bson.M{"snapshot_date": 1}))
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения истории"})
+	}
+	defer cursor.Close(context.TODO())
+
+	snapshots := []models.RatioSnapshot{}
+	if err = cursor.All(context.TODO(), &snapshots); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	return c.JSON(snapshots)
+}
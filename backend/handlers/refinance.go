@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"log"
+	"math"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RefinanceHandler struct {
+	db *database.Database
+}
+
+func NewRefinanceHandler(db *database.Database) *RefinanceHandler {
+	return &RefinanceHandler{db: db}
+}
+
+type RefinanceRequest struct {
+	CompanyID    primitive.ObjectID   `json:"company_id"`
+	VehicleID    primitive.ObjectID   `json:"vehicle_id"`
+	LoanIDs      []primitive.ObjectID `json:"loan_ids"`
+	PayoffDate   time.Time            `json:"payoff_date"`
+	Lender       string               `json:"lender"`
+	InterestRate float64              `json:"interest_rate"`
+	TermMonths   int                  `json:"term_months"`
+	StartDate    time.Time            `json:"start_date"`
+	DayCount     string               `json:"day_count"`
+	ClosingFees  float64              `json:"closing_fees"`
+	FeesFinanced bool                 `json:"fees_financed"`
+	CashOut      float64              `json:"cash_out"`
+}
+
+// RefinanceLoans погашает один или несколько кредитов новым кредитом с сохранением истории
+func (h *RefinanceHandler) RefinanceLoans(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	var request RefinanceRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
+	if len(request.LoanIDs) == 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Не указаны кредиты для рефинансирования"})
+	}
+	if request.TermMonths < 1 || request.InterestRate < 0 || request.ClosingFees < 0 || request.CashOut < 0 {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверные условия нового кредита"})
+	}
+	if request.DayCount == "" {
+		request.DayCount = utils.DayCount30360
+	}
+	if !utils.IsValidDayCount(request.DayCount) {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверная конвенция подсчета дней"})
+	}
+	if request.PayoffDate.IsZero() {
+		request.PayoffDate = time.Now()
+	}
+	if request.StartDate.IsZero() {
+		request.StartDate = request.PayoffDate
+	}
+
+	// Проверяем что компания принадлежит пользователю
+	var company models.Company
+	err = h.db.DB.Collection("companies").FindOne(context.TODO(), bson.M{
+		"_id":     request.CompanyID,
+		"user_id": userObjectID,
+	}).Decode(&company)
+	if err != nil {
+		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
+	}
+
+	// Загружаем погашаемые кредиты
+	loansCollection := h.db.DB.Collection("loans")
+	cursor, err := loansCollection.Find(context.TODO(), bson.M{
+		"_id":        bson.M{"$in": request.LoanIDs},
+		"company_id": company.ID,
+		"status":     "active",
+	})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения кредитов"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var oldLoans []models.Loan
+	if err = cursor.All(context.TODO(), &oldLoans); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования кредитов"})
+	}
+	if len(oldLoans) != len(request.LoanIDs) {
+		return c.Status(404).JSON(fiber.Map{"error": "Кредит не найден или уже погашен"})
+	}
+
+	refinance := models.Refinance{
+		CompanyID:    company.ID,
+		PayoffDate:   request.PayoffDate,
+		ClosingFees:  request.ClosingFees,
+		FeesFinanced: request.FeesFinanced,
+		CashOut:      request.CashOut,
+		CreatedAt:    time.Now(),
+	}
+	for i := range oldLoans {
+		payoff := calculateLoanPayoff(&oldLoans[i], request.PayoffDate)
+		refinance.Payoffs = append(refinance.Payoffs, models.RefinancePayoff{
+			LoanID:          oldLoans[i].ID,
+			Lender:          oldLoans[i].Lender,
+			Principal:       payoff.Principal,
+			AccruedInterest: payoff.AccruedInterest,
+			Fees:            payoff.Fees,
+			Total:           payoff.Total,
+		})
+		refinance.PayoffTotal += payoff.Total
+	}
+	refinance.PayoffTotal = math.Round(refinance.PayoffTotal*100) / 100
+
+	// Новый кредит покрывает погашение, выплату наличными и, если финансируются, комиссии
+	refinance.NewPrincipal = refinance.PayoffTotal + refinance.CashOut
+	if refinance.FeesFinanced {
+		refinance.NewPrincipal += refinance.ClosingFees
+	}
+	refinance.NewPrincipal = math.Round(refinance.NewPrincipal*100) / 100
+
+	// Новый кредит обеспечен всем неосвобожденным залогом погашаемых кредитов
+	vehicleID := request.VehicleID
+	if vehicleID.IsZero() {
+		vehicleID = oldLoans[0].VehicleID
+	}
+	collateral := []models.LoanCollateral{{VehicleID: vehicleID}}
+	seen := map[primitive.ObjectID]bool{vehicleID: true}
+	for i := range oldLoans {
+		normalizeCollateral(&oldLoans[i])
+		for _, item := range oldLoans[i].Collateral {
+			if !item.LienReleased && !seen[item.VehicleID] {
+				seen[item.VehicleID] = true
+				collateral = append(collateral, models.LoanCollateral{VehicleID: item.VehicleID})
+			}
+		}
+	}
+
+	newLoan := models.Loan{
+		VehicleID:        vehicleID,
+		Collateral:       collateral,
+		CompanyID:        company.ID,
+		Lender:           request.Lender,
+		PrincipalAmount:  refinance.NewPrincipal,
+		InterestRate:     request.InterestRate,
+		TermMonths:       request.TermMonths,
+		StartDate:        request.StartDate,
+		MonthlyPayment:   utils.CalculateMonthlyPayment(refinance.NewPrincipal, request.InterestRate, request.TermMonths),
+		RemainingBalance: refinance.NewPrincipal,
+		DayCount:         request.DayCount,
+		Status:           "active",
+		RefinancedFrom:   request.LoanIDs,
+		CreatedAt:        time.Now(),
+		UpdatedAt:        time.Now(),
+	}
+
+	// Залог нового кредита должен принадлежать компании
+	if msg := validateCollateral(h.db, &newLoan); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	// Платежи погашения рассчитываются до записи, чтобы при ошибке откатить все сохраненное
+	original := make([]models.Loan, len(oldLoans))
+	copy(original, oldLoans)
+	newLoan.ID = primitive.NewObjectID()
+	refinance.ID = primitive.NewObjectID()
+	refinance.NewLoanID = newLoan.ID
+
+	payments := make([]models.Payment, len(oldLoans))
+	paymentIDs := make([]primitive.ObjectID, len(oldLoans))
+	for i := range oldLoans {
+		payoff := refinance.Payoffs[i]
+		payments[i] = models.Payment{
+			ID:          primitive.NewObjectID(),
+			LoanID:      oldLoans[i].ID,
+			PaymentDate: request.PayoffDate,
+			TotalPaid:   payoff.Principal + payoff.AccruedInterest,
+			Status:      models.PaymentPosted,
+			RefinanceID: refinance.ID,
+			CreatedAt:   time.Now(),
+		}
+		applyPaymentToLoan(&oldLoans[i], &payments[i])
+		oldLoans[i].RefinancedInto = newLoan.ID
+		oldLoans[i].LateFeesOutstanding = 0
+		paymentIDs[i] = payments[i].ID
+	}
+
+	if _, err := loansCollection.InsertOne(context.TODO(), newLoan); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания кредита"})
+	}
+
+	if _, err := h.db.DB.Collection("refinances").InsertOne(context.TODO(), refinance); err != nil {
+		h.rollbackRefinance(&refinance, paymentIDs, original)
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка сохранения рефинансирования"})
+	}
+
+	// Погашаем старые кредиты платежом из средств нового кредита
+	paymentsCollection := h.db.DB.Collection("payments")
+	for i := range oldLoans {
+		loan := &oldLoans[i]
+
+		if _, err := paymentsCollection.InsertOne(context.TODO(), payments[i]); err != nil {
+			h.rollbackRefinance(&refinance, paymentIDs, original)
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка создания платежа"})
+		}
+
+		if err := saveLoanBalance(h.db, loan); err != nil {
+			h.rollbackRefinance(&refinance, paymentIDs, original)
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления кредита"})
+		}
+
+		_, err = loansCollection.UpdateOne(context.TODO(), bson.M{"_id": loan.ID}, bson.M{"$set": bson.M{
+			"refinanced_into":       loan.RefinancedInto,
+			"late_fees_outstanding": 0,
+		}})
+		if err != nil {
+			h.rollbackRefinance(&refinance, paymentIDs, original)
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления кредита"})
+		}
+	}
+
+	// Штрафы по старым кредитам закрываются из суммы погашения
+	_, err = h.db.DB.Collection("late_fees").UpdateMany(context.TODO(),
+		bson.M{"loan_id": bson.M{"$in": request.LoanIDs}, "status": "outstanding"},
+		bson.M{"$set": bson.M{"status": "paid", "updated_at": time.Now()}},
+	)
+	if err != nil {
+		h.rollbackRefinance(&refinance, paymentIDs, original)
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления штрафов"})
+	}
+
+	for i := range payments {
+		logPaymentEvent(h.db, &payments[i], models.PaymentEventCreated, "refinance", userObjectID)
+	}
+
+	return c.Status(201).JSON(fiber.Map{
+		"refinance": refinance,
+		"new_loan":  newLoan,
+		"old_loans": oldLoans,
+	})
+}
+
+// rollbackRefinance удаляет записанные новый кредит, рефинансирование и платежи погашения
+// и возвращает старые кредиты в состояние до рефинансирования
+func (h *RefinanceHandler) rollbackRefinance(refinance *models.Refinance, paymentIDs []primitive.ObjectID, original []models.Loan) {
+	if _, err := h.db.DB.Collection("loans").DeleteOne(context.TODO(), bson.M{"_id": refinance.NewLoanID}); err != nil {
+		log.Printf("Failed to roll back refinance loan %s: %v", refinance.NewLoanID.Hex(), err)
+	}
+	if _, err := h.db.DB.Collection("refinances").DeleteOne(context.TODO(), bson.M{"_id": refinance.ID}); err != nil {
+		log.Printf("Failed to roll back refinance %s: %v", refinance.ID.Hex(), err)
+	}
+	if _, err := h.db.DB.Collection("payments").DeleteMany(context.TODO(), bson.M{"_id": bson.M{"$in": paymentIDs}}); err != nil {
+		log.Printf("Failed to roll back refinance payments: %v", err)
+	}
+
+	for i := range original {
+		loan := &original[i]
+		set := bson.M{
+			"remaining_balance":     loan.RemainingBalance,
+			"monthly_payment":       loan.MonthlyPayment,
+			"status":                loan.Status,
+			"late_fees_outstanding": loan.LateFeesOutstanding,
+			"updated_at":            loan.UpdatedAt,
+		}
+		unset := bson.M{"refinanced_into": ""}
+		if loan.LastPaymentDate.IsZero() {
+			unset["last_payment_date"] = ""
+		} else {
+			set["last_payment_date"] = loan.LastPaymentDate
+		}
+		_, err := h.db.DB.Collection("loans").UpdateOne(context.TODO(), bson.M{"_id": loan.ID}, bson.M{"$set": set, "$unset": unset})
+		if err != nil {
+			log.Printf("Failed to restore loan %s after refinance rollback: %v", loan.ID.Hex(), err)
+		}
+	}
+}
+
+// GetRefinances возвращает историю рефинансирований пользователя
+func (h *RefinanceHandler) GetRefinances(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companyIDs, err := getUserCompanyIDs(h.db, userObjectID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения компаний"})
+	}
+
+	filter := bson.M{"company_id": bson.M{"$in": companyIDs}}
+	if companyID := c.Query("company_id"); companyID != "" {
+		companyObjectID, err := primitive.ObjectIDFromHex(companyID)
+		if err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+		}
+		filter["company_id"] = bson.M{"$in": filterOwnedIDs(companyIDs, companyObjectID)}
+	}
+
+	cursor, err := h.db.DB.Collection("refinances").Find(context.TODO(), filter)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения рефинансирований"})
+	}
+	defer cursor.Close(context.TODO())
+
+	var refinances []models.Refinance
+	if err = cursor.All(context.TODO(), &refinances); err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
+	}
+
+	return c.JSON(refinances)
+}
+
+// loanLineage возвращает все предшествующие кредиты, погашенные рефинансированием, от старых к новым
+func loanLineage(db *database.Database, loan *models.Loan) ([]models.Loan, error) {
+	var lineage []models.Loan
+	visited := map[primitive.ObjectID]bool{loan.ID: true}
+	queue := loan.RefinancedFrom
+
+	for len(queue) > 0 {
+		var pending []primitive.ObjectID
+		for _, id := range queue {
+			if !visited[id] {
+				visited[id] = true
+				pending = append(pending, id)
+			}
+		}
+		if len(pending) == 0 {
+			break
+		}
+
+		cursor, err := db.DB.Collection("loans").Find(context.TODO(), bson.M{"_id": bson.M{"$in": pending}})
+		if err != nil {
+			return nil, err
+		}
+		var predecessors []models.Loan
+		err = cursor.All(context.TODO(), &predecessors)
+		cursor.Close(context.TODO())
+		if err != nil {
+			return nil, err
+		}
+
+		queue = nil
+		lineage = append(predecessors, lineage...)
+		for _, predecessor := range predecessors {
+			queue = append(queue, predecessor.RefinancedFrom...)
+		}
+	}
+
+	return lineage, nil
+}
@@ -6,10 +6,13 @@ import (
 	"business-schedule-backend/models"
 	"business-schedule-backend/utils"
 	"context"
+	"math"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type ScheduleHandler struct {
@@ -21,13 +24,28 @@ func NewScheduleHandler(db *database.Database) *ScheduleHandler {
 }
 
 type DebtScheduleItem struct {
-	CompanyName    string  `json:"company_name"`
-	TotalDebt      float64 `json:"total_debt"`
-	MonthlyPayment float64 `json:"monthly_payment"`
-	VehiclesCount  int     `json:"vehicles_count"`
+	CompanyName    string             `json:"company_name"`
+	TotalDebt      float64            `json:"total_debt"`
+	MonthlyPayment float64            `json:"monthly_payment"`
+	VehiclesCount  int                `json:"vehicles_count"`
+	Loans          []DebtScheduleLoan `json:"loans"`
+	LeaseLiability float64            `json:"lease_liability"`
+	MonthlyLease   float64            `json:"monthly_lease_payment"`
+	LeasesCount    int                `json:"leases_count"`
+}
+
+type DebtScheduleLoan struct {
+	LoanID            string   `json:"loan_id"`
+	Lender            string   `json:"lender"`
+	RemainingBalance  float64  `json:"remaining_balance"`
+	MonthlyPayment    float64  `json:"monthly_payment"`
+	RefinancedFrom    []string `json:"refinanced_from,omitempty"`
+	OriginalPrincipal float64  `json:"original_principal"`
 }
 
 type AmortizationScheduleItem struct {
+	LoanID           string  `json:"loan_id"`
+	Source           string  `json:"source"`
 	PaymentNumber    int     `json:"payment_number"`
 	PaymentDate      string  `json:"payment_date"`
 	PrincipalPayment float64 `json:"principal_payment"`
@@ -43,6 +61,15 @@ type DepreciationScheduleItem struct {
 	CurrentValue       float64 `json:"current_value"`
 	DepreciationAmount float64 `json:"depreciation_amount"`
 	AgeYears           float64 `json:"age_years"`
+
+	Method          string                   `json:"method"`
+	UsefulLifeYears int                      `json:"useful_life_years"`
+	SalvageValue    float64                  `json:"salvage_value"`
+	Schedule        []utils.DepreciationYear `json:"schedule"`
+	DisposalDate    string                   `json:"disposal_date,omitempty"`
+
+	ImprovementsCost float64            `json:"improvements_cost"`
+	Improvements     []ImprovementValue `json:"improvements,omitempty"`
 }
 
 func (h *ScheduleHandler) GetDebtSchedule(c *fiber.Ctx) error {
@@ -102,17 +129,55 @@ func (h *ScheduleHandler) GetDebtSchedule(c *fiber.Ctx) error {
 		// Рассчитываем общий долг и платежи
 		totalDebt := 0.0
 		monthlyPayment := 0.0
-		for _, loan := range loans {
+		debtLoans := []DebtScheduleLoan{}
+		for i, loan := range loans {
 			totalDebt += loan.RemainingBalance
 			monthlyPayment += loan.MonthlyPayment
+
+			// Для рефинансированных кредитов показываем исходную сумму всей цепочки
+			debtLoan := DebtScheduleLoan{
+				LoanID:            loan.ID.Hex(),
+				Lender:            loan.Lender,
+				RemainingBalance:  loan.RemainingBalance,
+				MonthlyPayment:    loan.MonthlyPayment,
+				OriginalPrincipal: loan.PrincipalAmount,
+			}
+			if len(loan.RefinancedFrom) > 0 {
+				lineage, err := loanLineage(h.db, &loans[i])
+				if err == nil {
+					debtLoan.OriginalPrincipal = 0
+					for _, predecessor := range lineage {
+						if len(predecessor.RefinancedFrom) == 0 {
+							debtLoan.OriginalPrincipal += predecessor.PrincipalAmount
+						}
+					}
+				}
+				for _, id := range loan.RefinancedFrom {
+					debtLoan.RefinancedFrom = append(debtLoan.RefinancedFrom, id.Hex())
+				}
+			}
+			debtLoans = append(debtLoans, debtLoan)
 		}
 
-		debtSchedule = append(debtSchedule, DebtScheduleItem{
+		item := DebtScheduleItem{
 			CompanyName:    company.Name,
 			TotalDebt:      totalDebt,
 			MonthlyPayment: monthlyPayment,
 			VehiclesCount:  int(vehiclesCount),
-		})
+			Loans:          debtLoans,
+		}
+
+		// Обязательства по лизингу показываем отдельно от кредитов
+		leases, err := getActiveLeases(h.db, []primitive.ObjectID{company.ID})
+		if err == nil {
+			for i := range leases {
+				item.LeaseLiability += leaseLiability(&leases[i], time.Now())
+				item.MonthlyLease += utils.CalculateLeasePaymentWithTax(leases[i].MonthlyRent, leases[i].SalesTaxRate)
+			}
+			item.LeasesCount = len(leases)
+		}
+
+		debtSchedule = append(debtSchedule, item)
 	}
 
 	return c.JSON(debtSchedule)
@@ -172,6 +237,40 @@ func (h *ScheduleHandler) GetAmortizationSchedule(c *fiber.Ctx) error {
 
 	var amortizationSchedule []AmortizationScheduleItem
 
+	// Для конкретного кредита добавляем фактическую историю платежей по кредитам, которые он рефинансировал
+	if c.Query("loan_id") != "" && len(loans) == 1 && len(loans[0].RefinancedFrom) > 0 {
+		lineage, err := loanLineage(h.db, &loans[0])
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения истории рефинансирования"})
+		}
+		for _, predecessor := range lineage {
+			opts := options.Find().SetSort(bson.D{{Key: "payment_date", Value: 1}})
+			paymentsCursor, err := h.db.DB.Collection("payments").Find(context.TODO(), activePaymentsFilter(predecessor.ID), opts)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения платежей"})
+			}
+			var payments []models.Payment
+			err = paymentsCursor.All(context.TODO(), &payments)
+			paymentsCursor.Close(context.TODO())
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования платежей"})
+			}
+
+			for i, payment := range payments {
+				amortizationSchedule = append(amortizationSchedule, AmortizationScheduleItem{
+					LoanID:           predecessor.ID.Hex(),
+					Source:           "history",
+					PaymentNumber:    i + 1,
+					PaymentDate:      payment.PaymentDate.Format("2006-01-02"),
+					PrincipalPayment: payment.PrincipalPaid,
+					InterestPayment:  payment.InterestPaid,
+					TotalPayment:     payment.TotalPaid,
+					RemainingBalance: payment.RemainingBalance,
+				})
+			}
+		}
+	}
+
 	for _, loan := range loans {
 		balance := loan.RemainingBalance
 		monthlyRate := loan.InterestRate / 100 / 12
@@ -180,7 +279,8 @@ func (h *ScheduleHandler) GetAmortizationSchedule(c *fiber.Ctx) error {
 			interestPayment := balance * monthlyRate
 			principalPayment := loan.MonthlyPayment - interestPayment
 
-			if principalPayment > balance {
+			// Последний взнос погашает весь остаток, включая balloon
+			if principalPayment > balance || i == loan.TermMonths {
 				principalPayment = balance
 			}
 
@@ -190,6 +290,8 @@ func (h *ScheduleHandler) GetAmortizationSchedule(c *fiber.Ctx) error {
 			paymentDate := loan.StartDate.AddDate(0, i-1, 0)
 
 			amortizationSchedule = append(amortizationSchedule, AmortizationScheduleItem{
+				LoanID:           loan.ID.Hex(),
+				Source:           "scheduled",
 				PaymentNumber:    i,
 				PaymentDate:      paymentDate.Format("2006-01-02"),
 				PrincipalPayment: principalPayment,
@@ -255,36 +357,57 @@ func (h *ScheduleHandler) GetDepreciationSchedule(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования транспорта"})
 	}
 
+	// Транспорт в операционном лизинге не является собственным активом
+	leases, err := getActiveLeases(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения лизингов"})
+	}
+	leasedVehicles := operatingLeaseVehicles(leases)
+	depreciationDefaults := companyDepreciationDefaults(companies)
+
+	// Капитализированные улучшения амортизируются отдельно и добавляются к стоимости транспорта
+	improvements, err := loadVehicleImprovements(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения улучшений"})
+	}
+	meters, err := loadVehicleMeterPoints(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+	}
+
 	var depreciationSchedule []DepreciationScheduleItem
 
 	for _, vehicle := range vehicles {
-		// Рассчитываем возраст транспорта
-		ageYears := utils.CalculateVehicleAge(vehicle.PurchaseDate)
-
-		// Используем стандартный срок службы: 10 лет для траков, 15 лет для трейлеров
-		usefulLife := 10
-		if vehicle.Type == "trailer" {
-			usefulLife = 15
+		if leasedVehicles[vehicle.ID] {
+			continue
 		}
 
-		// Рассчитываем амортизацию
-		depreciationAmount := utils.CalculateDepreciation(vehicle.PurchasePrice, usefulLife, ageYears)
-		currentValue := vehicle.PurchasePrice - depreciationAmount
-
-		if currentValue < 0 {
-			currentValue = 0
-		}
+		// Рассчитываем амортизацию по методу транспорта или компании
+		ageYears := utils.CalculateVehicleAge(vehicle.PurchaseDate)
+		params := vehicleDepreciationParams(&vehicle, depreciationDefaults[vehicle.CompanyID], meters[vehicle.ID], time.Now())
+		depreciation := vehicleDepreciation(&vehicle, depreciationDefaults[vehicle.CompanyID], meters[vehicle.ID])
+		assetValue := vehicleAssetValueAt(&vehicle, depreciationDefaults[vehicle.CompanyID], improvements[vehicle.ID], meters[vehicle.ID], time.Now())
 
 		vehicleName := vehicle.Make + " " + vehicle.Model + " (" + string(rune(vehicle.Year)) + ")"
 
-		depreciationSchedule = append(depreciationSchedule, DepreciationScheduleItem{
+		item := DepreciationScheduleItem{
 			VehicleID:          vehicle.ID.Hex(),
 			VehicleName:        vehicleName,
 			PurchasePrice:      vehicle.PurchasePrice,
-			CurrentValue:       currentValue,
-			DepreciationAmount: depreciationAmount,
+			CurrentValue:       assetValue.CurrentValue,
+			DepreciationAmount: assetValue.Accumulated,
 			AgeYears:           ageYears,
-		})
+			Method:             params.Method,
+			UsefulLifeYears:    params.UsefulLifeYears,
+			SalvageValue:       params.SalvageValue,
+			Schedule:           depreciation.Schedule,
+			ImprovementsCost:   assetValue.ImprovementsCost,
+			Improvements:       assetValue.Improvements,
+		}
+		if vehicle.Disposal != nil {
+			item.DisposalDate = vehicle.Disposal.DisposalDate.Format("2006-01-02")
+		}
+		depreciationSchedule = append(depreciationSchedule, item)
 	}
 
 	return c.JSON(depreciationSchedule)
@@ -298,6 +421,9 @@ type DashboardStats struct {
 	MonthlyPayments   float64 `json:"monthly_payments"`
 	TotalAssetValue   float64 `json:"total_asset_value"`
 	TotalPaymentsYear float64 `json:"total_payments_year"`
+	TotalActiveLeases int     `json:"total_active_leases"`
+	LeaseLiability    float64 `json:"lease_liability"`
+	MonthlyLeases     float64 `json:"monthly_lease_payments"`
 }
 
 func (h *ScheduleHandler) GetDashboardStats(c *fiber.Ctx) error {
@@ -391,26 +517,48 @@ func (h *ScheduleHandler) GetDashboardStats(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования транспорта"})
 	}
 
-	for _, vehicle := range vehicles {
-		// Рассчитываем текущую стоимость с учетом амортизации
-		ageYears := utils.CalculateVehicleAge(vehicle.PurchaseDate)
-		usefulLife := 10
-		if vehicle.Type == "trailer" {
-			usefulLife = 15
-		}
+	// Лизинги: обязательства и платежи, транспорт в операционном лизинге не входит в активы
+	leases, err := getActiveLeases(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения лизингов"})
+	}
+	stats.TotalActiveLeases = len(leases)
+	for i := range leases {
+		stats.LeaseLiability += leaseLiability(&leases[i], time.Now())
+		stats.MonthlyLeases += utils.CalculateLeasePaymentWithTax(leases[i].MonthlyRent, leases[i].SalesTaxRate)
+	}
+	leasedVehicles := operatingLeaseVehicles(leases)
+	depreciationDefaults := companyDepreciationDefaults(companies)
 
-		depreciationAmount := utils.CalculateDepreciation(vehicle.PurchasePrice, usefulLife, ageYears)
-		currentValue := vehicle.PurchasePrice - depreciationAmount
+	improvements, err := loadVehicleImprovements(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения улучшений"})
+	}
+	meters, err := loadVehicleMeterPoints(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+	}
 
-		if currentValue < 0 {
-			currentValue = 0
+	for _, vehicle := range vehicles {
+		// Выбывший транспорт и транспорт в операционном лизинге не входят в активы
+		if leasedVehicles[vehicle.ID] || vehicle.Disposal != nil || vehicle.Status == "sold" {
+			continue
 		}
 
+		// Рассчитываем текущую стоимость с учетом амортизации и улучшений
+		_, currentValue := vehicleBookValue(&vehicle, depreciationDefaults[vehicle.CompanyID], improvements[vehicle.ID], meters[vehicle.ID])
 		stats.TotalAssetValue += currentValue
 	}
 
-	// Рассчитываем общие платежи за год
-	stats.TotalPaymentsYear = stats.MonthlyPayments * 12
+	// Рассчитываем платежи на 12 месяцев вперед по фактическим графикам (с учетом окончания кредитов и balloon)
+	loanPayments, leasePayments, err := projectDebtService(h.db, companyIDs, utils.MonthStart(time.Now()), 12)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка расчета платежей за год"})
+	}
+	for i := range loanPayments {
+		stats.TotalPaymentsYear += loanPayments[i] + leasePayments[i]
+	}
+	stats.TotalPaymentsYear = math.Round(stats.TotalPaymentsYear*100) / 100
 
 	return c.JSON(stats)
 }
@@ -0,0 +1,424 @@
+package handlers
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/middleware"
+	"business-schedule-backend/models"
+	"business-schedule-backend/utils"
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type TaxDepreciationItem struct {
+	VehicleID         string                      `json:"vehicle_id"`
+	VehicleName       string                      `json:"vehicle_name"`
+	CompanyID         string                      `json:"company_id"`
+	PlacedInService   string                      `json:"placed_in_service"`
+	RecoveryYears     int                         `json:"recovery_years"`
+	Convention        string                      `json:"convention"`
+	Cost              float64                     `json:"cost"`
+	Section179        float64                     `json:"section_179"`
+	Bonus             float64                     `json:"bonus"`
+	MACRSBasis        float64                     `json:"macrs_basis"`
+	TaxBasis          float64                     `json:"tax_basis"`
+	ImprovementsBasis float64                     `json:"improvements_tax_basis"`
+	BookValue         float64                     `json:"book_value"`
+	BookTaxDifference float64                     `json:"book_tax_difference"`
+	Schedule          []utils.TaxDepreciationYear `json:"schedule"`
+}
+
+type Form4562Section179Item struct {
+	VehicleID   string  `json:"vehicle_id"`
+	Description string  `json:"description"`
+	Cost        float64 `json:"cost"`
+	Elected     float64 `json:"elected"`
+}
+
+type Form4562MACRSClass struct {
+	Classification string  `json:"classification"`
+	RecoveryPeriod string  `json:"recovery_period"`
+	Convention     string  `json:"convention"`
+	Method         string  `json:"method"`
+	Basis          float64 `json:"basis"`
+	Deduction      float64 `json:"deduction"`
+}
+
+// Form4562Summary — годовая сводка налоговой амортизации компании по строкам формы 4562
+type Form4562Summary struct {
+	CompanyID              string                   `json:"company_id"`
+	CompanyName            string                   `json:"company_name"`
+	TaxYear                int                      `json:"tax_year"`
+	Section179PropertyCost float64                  `json:"section_179_property_cost"` // строка 2
+	Section179Items        []Form4562Section179Item `json:"section_179_items"`         // строка 6
+	Section179Elected      float64                  `json:"section_179_elected"`       // строка 8
+	SpecialAllowance       float64                  `json:"special_allowance"`         // строка 14
+	MACRSPriorYears        float64                  `json:"macrs_prior_years"`         // строка 17
+	MACRSCurrentYear       []Form4562MACRSClass     `json:"macrs_current_year"`        // строка 19
+	Total                  float64                  `json:"total"`                     // строка 22
+}
+
+// taxPlacedInService возвращает дату ввода в эксплуатацию для налогового учета (по умолчанию дата покупки)
+func taxPlacedInService(vehicle *models.Vehicle) time.Time {
+	if !vehicle.Tax.PlacedInService.IsZero() {
+		return vehicle.Tax.PlacedInService
+	}
+	return vehicle.PurchaseDate
+}
+
+// midQuarterYears определяет компании и годы, в которых более 40% базы введено в IV квартале.
+// База для теста берется за вычетом Section 179.
+func midQuarterYears(vehicles []models.Vehicle) map[primitive.ObjectID]map[int]bool {
+	totals := map[primitive.ObjectID]map[int]float64{}
+	fourthQuarter := map[primitive.ObjectID]map[int]float64{}
+	for i := range vehicles {
+		placed := taxPlacedInService(&vehicles[i])
+		basis := vehicles[i].PurchasePrice - math.Min(vehicles[i].Tax.Section179, vehicles[i].PurchasePrice)
+		companyID := vehicles[i].CompanyID
+		if totals[companyID] == nil {
+			totals[companyID] = map[int]float64{}
+			fourthQuarter[companyID] = map[int]float64{}
+		}
+		totals[companyID][placed.Year()] += basis
+		if utils.Quarter(placed) == 4 {
+			fourthQuarter[companyID][placed.Year()] += basis
+		}
+	}
+
+	result := map[primitive.ObjectID]map[int]bool{}
+	for companyID, years := range totals {
+		result[companyID] = map[int]bool{}
+		for year, total := range years {
+			result[companyID][year] = total > 0 && fourthQuarter[companyID][year]/total > utils.MidQuarterThreshold
+		}
+	}
+	return result
+}
+
+// vehicleTaxParams собирает параметры налоговой амортизации: класс по умолчанию — 3 года для траков и 5 для трейлеров
+func vehicleTaxParams(vehicle *models.Vehicle, midQuarter map[primitive.ObjectID]map[int]bool) utils.TaxDepreciationParams {
+	params := utils.TaxDepreciationParams{
+		Cost:            vehicle.PurchasePrice,
+		PlacedInService: taxPlacedInService(vehicle),
+		RecoveryYears:   vehicle.Tax.RecoveryYears,
+		Convention:      vehicle.Tax.Convention,
+		Section179:      vehicle.Tax.Section179,
+		BonusPercent:    vehicle.Tax.BonusPercent,
+	}
+	if vehicle.Disposal != nil {
+		params.DisposalDate = vehicle.Disposal.DisposalDate
+	}
+
+	if params.RecoveryYears == 0 {
+		params.RecoveryYears = utils.DefaultTruckRecoveryYears
+		if vehicle.Type == "trailer" {
+			params.RecoveryYears = utils.DefaultTrailerRecoveryYears
+		}
+	}
+
+	if params.Convention == "" {
+		params.Convention = utils.MACRSHalfYear
+		if midQuarter[vehicle.CompanyID][params.PlacedInService.Year()] {
+			params.Convention = utils.MACRSMidQuarter
+		}
+	}
+
+	return params
+}
+
+// improvementTaxParams — налоговые параметры улучшения: класс имущества транспорта, half-year, без Section 179 и бонуса
+func improvementTaxParams(improvement *models.CapitalImprovement, vehicleParams utils.TaxDepreciationParams) utils.TaxDepreciationParams {
+	return utils.TaxDepreciationParams{
+		Cost:            improvement.Cost,
+		PlacedInService: improvement.InServiceDate,
+		RecoveryYears:   vehicleParams.RecoveryYears,
+		Convention:      utils.MACRSHalfYear,
+		DisposalDate:    vehicleParams.DisposalDate,
+	}
+}
+
+// taxBasisAt возвращает налоговую базу и накопленную налоговую амортизацию на конец налогового года
+func taxBasisAt(params utils.TaxDepreciationParams, taxYear int) (float64, float64) {
+	basis, accumulated := params.Cost, 0.0
+	for _, year := range utils.CalculateTaxDepreciation(params) {
+		if year.TaxYear <= taxYear {
+			basis, accumulated = year.TaxBasis, year.Accumulated
+		}
+	}
+	return basis, accumulated
+}
+
+// validateVehicleTax проверяет налоговые выборы по транспорту
+func validateVehicleTax(vehicle *models.Vehicle) string {
+	if vehicle.Tax.RecoveryYears != 0 && !utils.IsValidRecoveryYears(vehicle.Tax.RecoveryYears) {
+		return "Неверный класс имущества MACRS (3, 5 или 7 лет)"
+	}
+	if vehicle.Tax.Convention != "" && !utils.IsValidMACRSConvention(vehicle.Tax.Convention) {
+		return "Неверное соглашение MACRS"
+	}
+	if vehicle.Tax.Section179 < 0 || vehicle.Tax.Section179 > vehicle.PurchasePrice {
+		return "Сумма Section 179 должна быть от 0 до цены покупки"
+	}
+	if vehicle.Tax.BonusPercent < 0 || vehicle.Tax.BonusPercent > 100 {
+		return "Неверный процент бонусной амортизации"
+	}
+	return ""
+}
+
+// loadTaxVehicles возвращает собственный транспорт компаний для налогового учета (без операционного лизинга)
+func loadTaxVehicles(db *database.Database, companyIDs []primitive.ObjectID) ([]models.Vehicle, error) {
+	if len(companyIDs) == 0 {
+		return nil, nil
+	}
+
+	cursor, err := db.DB.Collection("vehicles").Find(context.TODO(), bson.M{"company_id": bson.M{"$in": companyIDs}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var vehicles []models.Vehicle
+	if err = cursor.All(context.TODO(), &vehicles); err != nil {
+		return nil, err
+	}
+
+	leases, err := getActiveLeases(db, companyIDs)
+	if err != nil {
+		return nil, err
+	}
+	leasedVehicles := operatingLeaseVehicles(leases)
+
+	owned := []models.Vehicle{}
+	for _, vehicle := range vehicles {
+		if !leasedVehicles[vehicle.ID] {
+			owned = append(owned, vehicle)
+		}
+	}
+	return owned, nil
+}
+
+// GetTaxDepreciation возвращает налоговую книгу (MACRS, Section 179, бонус) рядом с балансовой стоимостью
+func (h *ScheduleHandler) GetTaxDepreciation(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	companies, err := getUserCompanies(h.db, userObjectID, c.Query("company_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+	}
+
+	var companyIDs []primitive.ObjectID
+	for _, company := range companies {
+		companyIDs = append(companyIDs, company.ID)
+	}
+
+	vehicles, err := loadTaxVehicles(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения транспорта"})
+	}
+
+	improvements, err := loadVehicleImprovements(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения улучшений"})
+	}
+	meters, err := loadVehicleMeterPoints(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+	}
+
+	vehicleFilter := c.Query("vehicle_id")
+	midQuarter := midQuarterYears(vehicles)
+	depreciationDefaults := companyDepreciationDefaults(companies)
+	currentYear := time.Now().Year()
+
+	items := []TaxDepreciationItem{}
+	for i := range vehicles {
+		if vehicleFilter != "" && vehicles[i].ID.Hex() != vehicleFilter {
+			continue
+		}
+
+		params := vehicleTaxParams(&vehicles[i], midQuarter)
+		bases := utils.SplitTaxBasis(params)
+		schedule := utils.CalculateTaxDepreciation(params)
+
+		// Налоговая база на конец текущего года вместе с улучшениями
+		taxBasis, _ := taxBasisAt(params, currentYear)
+		improvementsTaxBasis := 0.0
+		for j := range improvements[vehicles[i].ID] {
+			basis, _ := taxBasisAt(improvementTaxParams(&improvements[vehicles[i].ID][j], params), currentYear)
+			improvementsTaxBasis += basis
+		}
+		improvementsTaxBasis = math.Round(improvementsTaxBasis*100) / 100
+		taxBasis = math.Round((taxBasis+improvementsTaxBasis)*100) / 100
+
+		_, bookValue := vehicleBookValue(&vehicles[i], depreciationDefaults[vehicles[i].CompanyID], improvements[vehicles[i].ID], meters[vehicles[i].ID])
+
+		items = append(items, TaxDepreciationItem{
+			VehicleID:         vehicles[i].ID.Hex(),
+			VehicleName:       vehicleTitle(&vehicles[i]),
+			CompanyID:         vehicles[i].CompanyID.Hex(),
+			PlacedInService:   params.PlacedInService.Format("2006-01-02"),
+			RecoveryYears:     params.RecoveryYears,
+			Convention:        params.Convention,
+			Cost:              params.Cost,
+			Section179:        bases.Section179,
+			Bonus:             bases.Bonus,
+			MACRSBasis:        bases.MACRSBasis,
+			TaxBasis:          taxBasis,
+			ImprovementsBasis: improvementsTaxBasis,
+			BookValue:         bookValue,
+			BookTaxDifference: math.Round((bookValue-taxBasis)*100) / 100,
+			Schedule:          schedule,
+		})
+	}
+
+	return c.JSON(items)
+}
+
+// GetForm4562 возвращает сводку налоговой амортизации по компаниям за налоговый год в разрезе строк формы 4562
+func (h *ScheduleHandler) GetForm4562(c *fiber.Ctx) error {
+	userID, err := middleware.GetUserIDFromToken(c)
+	if err != nil {
+		return c.Status(401).JSON(fiber.Map{"error": "Не удалось получить ID пользователя"})
+	}
+
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID пользователя"})
+	}
+
+	taxYear := time.Now().Year()
+	if year := c.Query("year"); year != "" {
+		taxYear, err = strconv.Atoi(year)
+		if err != nil || taxYear < 1987 || taxYear > 2100 {
+			return c.Status(400).JSON(fiber.Map{"error": "Неверный налоговый год"})
+		}
+	}
+
+	companies, err := getUserCompanies(h.db, userObjectID, c.Query("company_id"))
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный ID компании"})
+	}
+
+	var companyIDs []primitive.ObjectID
+	for _, company := range companies {
+		companyIDs = append(companyIDs, company.ID)
+	}
+
+	vehicles, err := loadTaxVehicles(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения транспорта"})
+	}
+	midQuarter := midQuarterYears(vehicles)
+
+	improvements, err := loadVehicleImprovements(h.db, companyIDs)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения улучшений"})
+	}
+
+	summaries := []Form4562Summary{}
+	for _, company := range companies {
+		summary := Form4562Summary{
+			CompanyID:        company.ID.Hex(),
+			CompanyName:      company.Name,
+			TaxYear:          taxYear,
+			Section179Items:  []Form4562Section179Item{},
+			MACRSCurrentYear: []Form4562MACRSClass{},
+		}
+		classes := map[string]*Form4562MACRSClass{}
+
+		for i := range vehicles {
+			if vehicles[i].CompanyID != company.ID {
+				continue
+			}
+
+			// Улучшения учитываются как отдельное имущество того же класса
+			vehicleParams := vehicleTaxParams(&vehicles[i], midQuarter)
+			assets := []utils.TaxDepreciationParams{vehicleParams}
+			for j := range improvements[vehicles[i].ID] {
+				assets = append(assets, improvementTaxParams(&improvements[vehicles[i].ID][j], vehicleParams))
+			}
+
+			for _, params := range assets {
+				for _, year := range utils.CalculateTaxDepreciation(params) {
+					if year.TaxYear != taxYear {
+						continue
+					}
+
+					if params.PlacedInService.Year() != taxYear {
+						summary.MACRSPriorYears += year.MACRS
+						continue
+					}
+
+					if year.Section179 > 0 {
+						summary.Section179PropertyCost += params.Cost
+						summary.Section179Elected += year.Section179
+						summary.Section179Items = append(summary.Section179Items, Form4562Section179Item{
+							VehicleID:   vehicles[i].ID.Hex(),
+							Description: vehicleTitle(&vehicles[i]),
+							Cost:        params.Cost,
+							Elected:     year.Section179,
+						})
+					}
+					summary.SpecialAllowance += year.Bonus
+
+					convention := "HY"
+					if params.Convention == utils.MACRSMidQuarter {
+						convention = "MQ"
+					}
+					key := strconv.Itoa(params.RecoveryYears) + convention
+					class, ok := classes[key]
+					if !ok {
+						class = &Form4562MACRSClass{
+							Classification: strconv.Itoa(params.RecoveryYears) + "-year property",
+							RecoveryPeriod: strconv.Itoa(params.RecoveryYears) + " yrs.",
+							Convention:     convention,
+							Method:         "200DB",
+						}
+						classes[key] = class
+					}
+					class.Basis += utils.SplitTaxBasis(params).MACRSBasis
+					class.Deduction += year.MACRS
+				}
+			}
+		}
+
+		for _, class := range classes {
+			class.Basis = math.Round(class.Basis*100) / 100
+			class.Deduction = math.Round(class.Deduction*100) / 100
+			summary.MACRSCurrentYear = append(summary.MACRSCurrentYear, *class)
+		}
+		sort.Slice(summary.MACRSCurrentYear, func(i, j int) bool {
+			return summary.MACRSCurrentYear[i].Classification+summary.MACRSCurrentYear[i].Convention <
+				summary.MACRSCurrentYear[j].Classification+summary.MACRSCurrentYear[j].Convention
+		})
+
+		summary.Section179PropertyCost = math.Round(summary.Section179PropertyCost*100) / 100
+		summary.Section179Elected = math.Round(summary.Section179Elected*100) / 100
+		summary.SpecialAllowance = math.Round(summary.SpecialAllowance*100) / 100
+		summary.MACRSPriorYears = math.Round(summary.MACRSPriorYears*100) / 100
+
+		total := summary.Section179Elected + summary.SpecialAllowance + summary.MACRSPriorYears
+		for _, class := range summary.MACRSCurrentYear {
+			total += class.Deduction
+		}
+		summary.Total = math.Round(total*100) / 100
+
+		summaries = append(summaries, summary)
+	}
+
+	return c.JSON(summaries)
+}
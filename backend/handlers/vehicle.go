@@ -4,6 +4,8 @@ import (
 	"business-schedule-backend/database"
 	"business-schedule-backend/middleware"
 	"business-schedule-backend/models"
+	"business-schedule-backend/storage"
+	"business-schedule-backend/utils"
 	"context"
 	"time"
 
@@ -13,11 +15,12 @@ import (
 )
 
 type VehicleHandler struct {
-	db *database.Database
+	db    *database.Database
+	store storage.Storage
 }
 
-func NewVehicleHandler(db *database.Database) *VehicleHandler {
-	return &VehicleHandler{db: db}
+func NewVehicleHandler(db *database.Database, store storage.Storage) *VehicleHandler {
+	return &VehicleHandler{db: db, store: store}
 }
 
 func (h *VehicleHandler) GetVehicles(c *fiber.Ctx) error {
@@ -79,6 +82,15 @@ func (h *VehicleHandler) GetVehicles(c *fiber.Ctx) error {
 		return c.Status(500).JSON(fiber.Map{"error": "Ошибка декодирования данных"})
 	}
 
+	// Добавляем залоги по кредитам
+	for i := range vehicles {
+		liens, err := vehicleLiens(h.db, vehicles[i].ID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения залогов"})
+		}
+		vehicles[i].Liens = liens
+	}
+
 	return c.JSON(vehicles)
 }
 
@@ -98,6 +110,14 @@ func (h *VehicleHandler) CreateVehicle(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
 	}
 
+	if msg := validateVehicleDepreciation(&vehicle); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	if msg := validateVehicleTax(&vehicle); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
 	// Проверяем что компания принадлежит пользователю
 	companiesCollection := h.db.DB.Collection("companies")
 	var company models.Company
@@ -143,6 +163,11 @@ func (h *VehicleHandler) UpdateVehicle(c *fiber.Ctx) error {
 		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
 	}
 
+	fields, err := sentFields(c)
+	if err != nil {
+		return c.Status(400).JSON(fiber.Map{"error": "Неверный формат данных"})
+	}
+
 	// Проверяем что компания принадлежит пользователю
 	companiesCollection := h.db.DB.Collection("companies")
 	var company models.Company
@@ -154,9 +179,56 @@ func (h *VehicleHandler) UpdateVehicle(c *fiber.Ctx) error {
 		return c.Status(403).JSON(fiber.Map{"error": "Компания не найдена или нет доступа"})
 	}
 
+	vehiclesCollection := h.db.DB.Collection("vehicles")
+	var existing models.Vehicle
+	err = vehiclesCollection.FindOne(context.TODO(), bson.M{"_id": vehicleID, "company_id": vehicle.CompanyID}).Decode(&existing)
+	if err != nil {
+		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
+	}
+
+	// Форма транспорта не передает налоговые выборы — сохраняем записанные
+	if !fields["tax"] {
+		vehicle.Tax = existing.Tax
+	}
+
+	if msg := validateVehicleDepreciation(&vehicle); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	if msg := validateVehicleTax(&vehicle); msg != "" {
+		return c.Status(400).JSON(fiber.Map{"error": msg})
+	}
+
+	// Продажа и списание оформляются только через выбытие, статус выбывшего транспорта не меняется
+	if !fields["status"] {
+		vehicle.Status = existing.Status
+	}
+	if existing.Disposal != nil && vehicle.Status != existing.Status {
+		return c.Status(409).JSON(fiber.Map{"error": "Выбытие транспорта оформлено, статус изменить нельзя"})
+	}
+	if existing.Disposal == nil && vehicle.Status == "sold" && existing.Status != "sold" {
+		return c.Status(400).JSON(fiber.Map{"error": "Продажа транспорта оформляется через POST /api/vehicles/:id/dispose"})
+	}
+
+	// Пробег и моточасы при наличии журнала показаний берутся из последнего показания,
+	// без журнала непереданные значения сохраняются
+	if !fields["mileage"] {
+		vehicle.Mileage = existing.Mileage
+	}
+	if !fields["engine_hours"] {
+		vehicle.EngineHours = existing.EngineHours
+	}
+	readings, err := loadVehicleReadings(h.db, vehicleID)
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка получения показаний"})
+	}
+	if points := meterPoints(readings); len(points) > 0 {
+		vehicle.Mileage = points[len(points)-1].Mileage
+		vehicle.EngineHours = points[len(points)-1].EngineHours
+	}
+
 	vehicle.UpdatedAt = time.Now()
 
-	vehiclesCollection := h.db.DB.Collection("vehicles")
 	filter := bson.M{"_id": vehicleID, "company_id": vehicle.CompanyID}
 	update := bson.M{"$set": vehicle}
 
@@ -222,5 +294,79 @@ func (h *VehicleHandler) DeleteVehicle(c *fiber.Ctx) error {
 		return c.Status(404).JSON(fiber.Map{"error": "Транспорт не найден"})
 	}
 
+	// Удаляем документы транспорта и удаляемых вместе с ним записей
+	_, err = deleteStoredDocuments(h.db, h.store, bson.M{"entity_type": utils.DocumentEntityVehicle, "entity_id": vehicleID})
+	if err == nil {
+		err = deleteRecordDocuments(h.db, h.store, utils.DocumentEntityCapitalImprovement, bson.M{"vehicle_id": vehicleID})
+	}
+	if err == nil {
+		err = deleteRecordDocuments(h.db, h.store, utils.DocumentEntityWorkOrder, bson.M{"vehicle_id": vehicleID})
+	}
+	if err == nil {
+		err = deleteRecordDocuments(h.db, h.store, utils.DocumentEntityComplianceItem, bson.M{"vehicle_id": vehicleID})
+	}
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления документов"})
+	}
+
+	// Удаляем капитализированные улучшения транспорта
+	_, err = h.db.DB.Collection("capital_improvements").DeleteMany(context.TODO(), bson.M{"vehicle_id": vehicleID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления улучшений"})
+	}
+
+	// Удаляем журнал показаний одометра
+	_, err = h.db.DB.Collection("odometer_readings").DeleteMany(context.TODO(), bson.M{"vehicle_id": vehicleID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления показаний"})
+	}
+
+	// Удаляем заказ-наряды на обслуживание
+	_, err = h.db.DB.Collection("work_orders").DeleteMany(context.TODO(), bson.M{"vehicle_id": vehicleID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления заказ-нарядов"})
+	}
+
+	// Удаляем документы соответствия и напоминания по ним
+	_, err = h.db.DB.Collection("compliance_items").DeleteMany(context.TODO(), bson.M{"vehicle_id": vehicleID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления документов"})
+	}
+	_, err = h.db.DB.Collection("compliance_alerts").DeleteMany(context.TODO(), bson.M{"vehicle_id": vehicleID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления напоминаний"})
+	}
+
+	// Удаляем закрепления, где транспорт был тягачом или прицепом
+	_, err = h.db.DB.Collection("assignments").DeleteMany(context.TODO(), bson.M{"$or": bson.A{
+		bson.M{"truck_id": vehicleID},
+		bson.M{"trailer_id": vehicleID},
+	}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления закреплений"})
+	}
+
+	// Удаляем заправки
+	_, err = h.db.DB.Collection("fuel_purchases").DeleteMany(context.TODO(), bson.M{"vehicle_id": vehicleID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления заправок"})
+	}
+
+	// Удаляем пробег по штатам
+	_, err = h.db.DB.Collection("state_mileage").DeleteMany(context.TODO(), bson.M{"vehicle_id": vehicleID})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка удаления пробега по штатам"})
+	}
+
+	// Рейсы остаются в учете выручки, ссылка на транспорт снимается
+	_, err = h.db.DB.Collection("loads").UpdateMany(context.TODO(), bson.M{"truck_id": vehicleID}, bson.M{"$unset": bson.M{"truck_id": ""}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления рейсов"})
+	}
+	_, err = h.db.DB.Collection("loads").UpdateMany(context.TODO(), bson.M{"trailer_id": vehicleID}, bson.M{"$unset": bson.M{"trailer_id": ""}})
+	if err != nil {
+		return c.Status(500).JSON(fiber.Map{"error": "Ошибка обновления рейсов"})
+	}
+
 	return c.JSON(fiber.Map{"message": "Транспорт удален"})
 }
@@ -0,0 +1,38 @@
+package jobs
+
+import (
+	"business-schedule-backend/database"
+	"business-schedule-backend/handlers"
+	"log"
+	"time"
+)
+
+// StartComplianceAlerts запускает фоновую проверку сроков документов: сразу при старте
+// и далее с заданным интервалом. Нулевой интервал отключает проверку.
+func StartComplianceAlerts(db *database.Database, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			runComplianceAlerts(db)
+			<-ticker.C
+		}
+	}()
+}
+
+func runComplianceAlerts(db *database.Database) {
+	alerts, err := handlers.GenerateComplianceAlerts(db, nil, time.Now())
+	if err != nil {
+		log.Printf("Compliance alerts check failed: %v", err)
+		return
+	}
+
+	for _, alert := range alerts {
+		log.Printf("Compliance alert [company %s]: %s", alert.CompanyID.Hex(), alert.Message)
+	}
+}
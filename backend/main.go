@@ -3,7 +3,9 @@ package main
 import (
 	"business-schedule-backend/config"
 	"business-schedule-backend/database"
+	"business-schedule-backend/jobs"
 	"business-schedule-backend/routes"
+	"business-schedule-backend/storage"
 	"log"
 
 	"github.com/gofiber/fiber/v2"
@@ -19,8 +21,16 @@ func main() {
 	db := database.NewDatabase(cfg.MongoURI, cfg.DBName)
 	defer db.Close()
 
+	// Хранилище документов
+	store, err := storage.NewStorage(cfg.DocumentStorage, cfg.DocumentStoragePath, db)
+	if err != nil {
+		log.Fatal("Failed to initialize document storage:", err)
+	}
+
 	// Создаем Fiber приложение
 	app := fiber.New(fiber.Config{
+		// Запас сверх лимита файла на поля multipart-формы
+		BodyLimit: int(cfg.DocumentMaxSize) + 1<<20,
 		ErrorHandler: func(ctx *fiber.Ctx, err error) error {
 			code := fiber.StatusInternalServerError
 			if e, ok := err.(*fiber.Error); ok {
@@ -41,7 +51,10 @@ func main() {
 	}))
 
 	// Маршруты
-	routes.SetupRoutes(app, db, cfg.JWTSecret)
+	routes.SetupRoutes(app, db, store, cfg.JWTSecret, cfg.DocumentMaxSize)
+
+	// Фоновые задачи
+	jobs.StartComplianceAlerts(db, cfg.ComplianceCheckInterval)
 
 	// Запускаем сервер
 	log.Printf("Server running on port %s", cfg.Port)
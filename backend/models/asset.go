@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CapitalImprovement — капитализированное улучшение транспорта (капремонт двигателя, APU, рефустановка).
+// Амортизируется отдельно от базового актива со своей даты ввода и сроком службы.
+type CapitalImprovement struct {
+	ID                 primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	VehicleID          primitive.ObjectID `json:"vehicle_id" bson:"vehicle_id"`
+	CompanyID          primitive.ObjectID `json:"company_id" bson:"company_id"`
+	Category           string             `json:"category" bson:"category" validate:"required,oneof=engine_overhaul apu reefer_unit transmission other"`
+	Description        string             `json:"description" bson:"description"`
+	Cost               float64            `json:"cost" bson:"cost" validate:"required,min=0"`
+	InServiceDate      time.Time          `json:"in_service_date" bson:"in_service_date"`
+	UsefulLifeYears    int                `json:"useful_life_years" bson:"useful_life_years" validate:"required,min=1"`
+	SalvageValue       float64            `json:"salvage_value" bson:"salvage_value" validate:"min=0"`
+	DepreciationMethod string             `json:"depreciation_method,omitempty" bson:"depreciation_method,omitempty"`
+	Vendor             string             `json:"vendor,omitempty" bson:"vendor,omitempty"`
+	CreatedAt          time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt          time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// CashFlowItem — повторяющийся доход или расход компании для прогноза движения денег
+type CashFlowItem struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CompanyID   primitive.ObjectID `json:"company_id" bson:"company_id"`
+	Type        string             `json:"type" bson:"type" validate:"required,oneof=income expense"`
+	Category    string             `json:"category" bson:"category"`
+	Description string             `json:"description" bson:"description"`
+	Amount      float64            `json:"amount" bson:"amount" validate:"required,min=0"`
+	Frequency   string             `json:"frequency" bson:"frequency" validate:"required,oneof=once weekly monthly quarterly annual"`
+	StartDate   time.Time          `json:"start_date" bson:"start_date"`
+	EndDate     time.Time          `json:"end_date,omitempty" bson:"end_date,omitempty"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -14,4 +14,29 @@ type Company struct {
 	Address   string             `json:"address" bson:"address"`
 	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt time.Time          `json:"updated_at" bson:"updated_at"`
+
+	// Настройки амортизации по умолчанию для транспорта компании
+	Depreciation DepreciationSettings `json:"depreciation" bson:"depreciation"`
+
+	// Реквизиты и условия для счетов брокерам
+	Invoicing InvoiceSettings `json:"invoicing" bson:"invoicing"`
+}
+
+// InvoiceSettings — префикс нумерации счетов, срок оплаты по умолчанию и реквизиты перевозчика для печатной формы
+type InvoiceSettings struct {
+	Prefix           string `json:"prefix" bson:"prefix"`
+	PaymentTermsDays int    `json:"payment_terms_days" bson:"payment_terms_days"`
+	MCNumber         string `json:"mc_number,omitempty" bson:"mc_number,omitempty"`
+	DOTNumber        string `json:"dot_number,omitempty" bson:"dot_number,omitempty"`
+	Phone            string `json:"phone,omitempty" bson:"phone,omitempty"`
+	Email            string `json:"email,omitempty" bson:"email,omitempty"`
+	RemitTo          string `json:"remit_to,omitempty" bson:"remit_to,omitempty"`
+}
+
+// DepreciationSettings — метод, сроки службы и ликвидационная стоимость (в % от цены) по умолчанию
+type DepreciationSettings struct {
+	Method                 string  `json:"method" bson:"method"`
+	TruckUsefulLifeYears   int     `json:"truck_useful_life_years" bson:"truck_useful_life_years"`
+	TrailerUsefulLifeYears int     `json:"trailer_useful_life_years" bson:"trailer_useful_life_years"`
+	SalvagePercent         float64 `json:"salvage_percent" bson:"salvage_percent"`
 }
@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// ComplianceItem — документ соответствия транспорта или компании (регистрация IRP, осмотр DOT,
+// страховка, разрешения). Без VehicleID документ относится к компании в целом.
+type ComplianceItem struct {
+	ID          primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	CompanyID   primitive.ObjectID  `json:"company_id" bson:"company_id"`
+	VehicleID   *primitive.ObjectID `json:"vehicle_id,omitempty" bson:"vehicle_id,omitempty"`
+	Type        string              `json:"type" bson:"type" validate:"required,oneof=registration dot_inspection insurance permit ifta ucr other"`
+	Name        string              `json:"name" bson:"name"`
+	Number      string              `json:"number" bson:"number"`
+	Issuer      string              `json:"issuer,omitempty" bson:"issuer,omitempty"`
+	IssueDate   time.Time           `json:"issue_date" bson:"issue_date"`
+	ExpiryDate  time.Time           `json:"expiry_date" bson:"expiry_date" validate:"required"`
+	WarningDays int                 `json:"warning_days" bson:"warning_days" validate:"min=0"`
+	DocumentID  *primitive.ObjectID `json:"document_id,omitempty" bson:"document_id,omitempty"`
+	Notes       string              `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedAt   time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at" bson:"updated_at"`
+
+	// Рассчитываются при выдаче
+	Status        string `json:"status,omitempty" bson:"-"`
+	DaysRemaining int    `json:"days_remaining" bson:"-"`
+}
+
+// ComplianceAlert — напоминание об истекающем или истекшем документе.
+// Создается фоновой проверкой один раз на каждый порог (30, 14, 7, 1 день, истек).
+type ComplianceAlert struct {
+	ID            primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	CompanyID     primitive.ObjectID  `json:"company_id" bson:"company_id"`
+	ItemID        primitive.ObjectID  `json:"item_id" bson:"item_id"`
+	VehicleID     *primitive.ObjectID `json:"vehicle_id,omitempty" bson:"vehicle_id,omitempty"`
+	Type          string              `json:"type" bson:"type"`
+	Name          string              `json:"name" bson:"name"`
+	ExpiryDate    time.Time           `json:"expiry_date" bson:"expiry_date"`
+	Threshold     int                 `json:"threshold" bson:"threshold"`
+	DaysRemaining int                 `json:"days_remaining" bson:"days_remaining"`
+	Status        string              `json:"status" bson:"status"`
+	Message       string              `json:"message" bson:"message"`
+	Acknowledged  bool                `json:"acknowledged" bson:"acknowledged"`
+	CreatedAt     time.Time           `json:"created_at" bson:"created_at"`
+}
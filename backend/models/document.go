@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Document — загруженный файл (кредитный договор, ПТС, договор купли-продажи, счет),
+// привязанный к записи системы. Содержимое лежит в хранилище под ключом StorageKey.
+type Document struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CompanyID   primitive.ObjectID `json:"company_id" bson:"company_id"`
+	EntityType  string             `json:"entity_type" bson:"entity_type" validate:"required,oneof=company vehicle loan lease payment compliance_item work_order capital_improvement driver"`
+	EntityID    primitive.ObjectID `json:"entity_id" bson:"entity_id"`
+	Category    string             `json:"category" bson:"category" validate:"oneof=loan_contract title bill_of_sale invoice registration insurance inspection receipt other"`
+	FileName    string             `json:"file_name" bson:"file_name"`
+	ContentType string             `json:"content_type" bson:"content_type"`
+	Size        int64              `json:"size" bson:"size"`
+	SHA256      string             `json:"sha256" bson:"sha256"`
+	Storage     string             `json:"storage" bson:"storage"`
+	StorageKey  string             `json:"-" bson:"storage_key"`
+	Description string             `json:"description,omitempty" bson:"description,omitempty"`
+	UploadedBy  primitive.ObjectID `json:"uploaded_by" bson:"uploaded_by"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Driver — водитель компании
+type Driver struct {
+	ID                primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CompanyID         primitive.ObjectID `json:"company_id" bson:"company_id"`
+	FirstName         string             `json:"first_name" bson:"first_name" validate:"required"`
+	LastName          string             `json:"last_name" bson:"last_name" validate:"required"`
+	Phone             string             `json:"phone,omitempty" bson:"phone,omitempty"`
+	Email             string             `json:"email,omitempty" bson:"email,omitempty"`
+	CDLNumber         string             `json:"cdl_number" bson:"cdl_number" validate:"required"`
+	CDLState          string             `json:"cdl_state" bson:"cdl_state"`
+	CDLClass          string             `json:"cdl_class" bson:"cdl_class" validate:"required,oneof=A B C"`
+	CDLExpiry         time.Time          `json:"cdl_expiry" bson:"cdl_expiry"`
+	MedicalCardExpiry time.Time          `json:"medical_card_expiry" bson:"medical_card_expiry"`
+	HireDate          time.Time          `json:"hire_date" bson:"hire_date"`
+	TerminationDate   *time.Time         `json:"termination_date,omitempty" bson:"termination_date,omitempty"`
+	PayType           string             `json:"pay_type" bson:"pay_type" validate:"required,oneof=per_mile percentage hourly salary per_load"`
+	PayRate           float64            `json:"pay_rate" bson:"pay_rate" validate:"min=0"`
+	Status            string             `json:"status" bson:"status" validate:"required,oneof=active inactive terminated"`
+	CreatedAt         time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt         time.Time          `json:"updated_at" bson:"updated_at"`
+
+	// Статусы CDL и медицинской карты рассчитываются при выдаче
+	CDLStatus     string `json:"cdl_status,omitempty" bson:"-"`
+	MedicalStatus string `json:"medical_status,omitempty" bson:"-"`
+}
+
+// Assignment — закрепление водителя и прицепа за тягачом на период [StartDate, EndDate).
+// Без EndDate закрепление действует сейчас.
+type Assignment struct {
+	ID        primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	CompanyID primitive.ObjectID  `json:"company_id" bson:"company_id"`
+	TruckID   primitive.ObjectID  `json:"truck_id" bson:"truck_id" validate:"required"`
+	DriverID  *primitive.ObjectID `json:"driver_id,omitempty" bson:"driver_id,omitempty"`
+	TrailerID *primitive.ObjectID `json:"trailer_id,omitempty" bson:"trailer_id,omitempty"`
+	StartDate time.Time           `json:"start_date" bson:"start_date" validate:"required"`
+	EndDate   *time.Time          `json:"end_date,omitempty" bson:"end_date,omitempty"`
+	Notes     string              `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedAt time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time           `json:"updated_at" bson:"updated_at"`
+
+	// Названия заполняются при выдаче
+	TruckName   string `json:"truck_name,omitempty" bson:"-"`
+	DriverName  string `json:"driver_name,omitempty" bson:"-"`
+	TrailerName string `json:"trailer_name,omitempty" bson:"-"`
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FactoringTerms — условия факторинга: ставка аванса, комиссия и регресс
+type FactoringTerms struct {
+	AdvanceRate          float64 `json:"advance_rate" bson:"advance_rate" validate:"gt=0,lte=100"`
+	FeePercent           float64 `json:"fee_percent" bson:"fee_percent" validate:"min=0"`
+	FeeDays              int     `json:"fee_days" bson:"fee_days" validate:"min=0"`
+	AdditionalFeePercent float64 `json:"additional_fee_percent" bson:"additional_fee_percent" validate:"min=0"`
+	AdditionalFeeDays    int     `json:"additional_fee_days" bson:"additional_fee_days" validate:"min=0"`
+	Recourse             bool    `json:"recourse" bson:"recourse"`
+	RecourseDays         int     `json:"recourse_days" bson:"recourse_days" validate:"min=0"`
+}
+
+// FactoringCompany — факторинговая компания, с которой работает компания пользователя
+type FactoringCompany struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CompanyID   primitive.ObjectID `json:"company_id" bson:"company_id"`
+	Name        string             `json:"name" bson:"name" validate:"required"`
+	ContactName string             `json:"contact_name,omitempty" bson:"contact_name,omitempty"`
+	Phone       string             `json:"phone,omitempty" bson:"phone,omitempty"`
+	Email       string             `json:"email,omitempty" bson:"email,omitempty"`
+	Terms       FactoringTerms     `json:"terms" bson:"terms"`
+	Notes       string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedBy   primitive.ObjectID `json:"created_by" bson:"created_by"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// FactoredInvoice — счет, переданный фактору: аванс, резерв, комиссия и регресс.
+// Условия копируются из профиля фактора на дату финансирования.
+type FactoredInvoice struct {
+	ID                  primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CompanyID           primitive.ObjectID `json:"company_id" bson:"company_id"`
+	FactorID            primitive.ObjectID `json:"factor_id" bson:"factor_id" validate:"required"`
+	InvoiceID           primitive.ObjectID `json:"invoice_id" bson:"invoice_id" validate:"required"`
+	InvoiceNumber       string             `json:"invoice_number" bson:"invoice_number"`
+	BillTo              string             `json:"bill_to" bson:"bill_to"`
+	Terms               FactoringTerms     `json:"terms" bson:"terms"`
+	FaceAmount          float64            `json:"face_amount" bson:"face_amount"`
+	AdvanceAmount       float64            `json:"advance_amount" bson:"advance_amount"`
+	ReserveAmount       float64            `json:"reserve_amount" bson:"reserve_amount"`
+	FundedDate          time.Time          `json:"funded_date" bson:"funded_date"`
+	Status              string             `json:"status" bson:"status" validate:"oneof=funded collected released charged_back"`
+	CollectedDate       time.Time          `json:"collected_date,omitempty" bson:"collected_date,omitempty"`
+	CollectedAmount     float64            `json:"collected_amount" bson:"collected_amount"`
+	Fee                 float64            `json:"fee" bson:"fee"`
+	ReserveDue          float64            `json:"reserve_due" bson:"reserve_due"`
+	ReserveReleasedDate time.Time          `json:"reserve_released_date,omitempty" bson:"reserve_released_date,omitempty"`
+	ReserveReleased     float64            `json:"reserve_released" bson:"reserve_released"`
+	ChargebackDate      time.Time          `json:"chargeback_date,omitempty" bson:"chargeback_date,omitempty"`
+	ChargebackAmount    float64            `json:"chargeback_amount" bson:"chargeback_amount"`
+	Notes               string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedBy           primitive.ObjectID `json:"created_by" bson:"created_by"`
+	CreatedAt           time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt           time.Time          `json:"updated_at" bson:"updated_at"`
+
+	// Заполняются при выдаче для профинансированных счетов
+	FactorName      string  `json:"factor_name,omitempty" bson:"-"`
+	DaysOutstanding int     `json:"days_outstanding" bson:"-"`
+	AccruedFee      float64 `json:"accrued_fee" bson:"-"`
+	RecourseDue     bool    `json:"recourse_due" bson:"-"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FuelPurchase — заправка транспорта (вручную или из выгрузки топливной карты)
+type FuelPurchase struct {
+	ID             primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	CompanyID      primitive.ObjectID  `json:"company_id" bson:"company_id"`
+	VehicleID      primitive.ObjectID  `json:"vehicle_id" bson:"vehicle_id" validate:"required"`
+	DriverID       *primitive.ObjectID `json:"driver_id,omitempty" bson:"driver_id,omitempty"`
+	PurchaseDate   time.Time           `json:"purchase_date" bson:"purchase_date" validate:"required"`
+	FuelType       string              `json:"fuel_type" bson:"fuel_type" validate:"required,oneof=diesel gasoline def reefer other"`
+	Gallons        float64             `json:"gallons" bson:"gallons" validate:"required,gt=0"`
+	PricePerGallon float64             `json:"price_per_gallon" bson:"price_per_gallon" validate:"min=0"`
+	TotalCost      float64             `json:"total_cost" bson:"total_cost" validate:"min=0"`
+	Odometer       float64             `json:"odometer" bson:"odometer" validate:"min=0"`
+	Merchant       string              `json:"merchant,omitempty" bson:"merchant,omitempty"`
+	City           string              `json:"city,omitempty" bson:"city,omitempty"`
+	State          string              `json:"state" bson:"state"`
+	CardNumber     string              `json:"card_number,omitempty" bson:"card_number,omitempty"`
+	TransactionID  string              `json:"transaction_id,omitempty" bson:"transaction_id,omitempty"`
+	Source         string              `json:"source" bson:"source" validate:"oneof=manual import"`
+	Notes          string              `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedBy      primitive.ObjectID  `json:"created_by" bson:"created_by"`
+	CreatedAt      time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time           `json:"updated_at" bson:"updated_at"`
+
+	// Предупреждения при сохранении (например, показание одометра не записано в журнал)
+	Warnings []string `json:"warnings,omitempty" bson:"-"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// IFTATaxRate — ставка налога на топливо юрисдикции за квартал (таблица ставок пользователя)
+type IFTATaxRate struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID        primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Quarter       string             `json:"quarter" bson:"quarter"`
+	Jurisdiction  string             `json:"jurisdiction" bson:"jurisdiction" validate:"required,len=2"`
+	FuelType      string             `json:"fuel_type" bson:"fuel_type" validate:"required,oneof=diesel gasoline"`
+	Rate          float64            `json:"rate" bson:"rate" validate:"min=0"`
+	SurchargeRate float64            `json:"surcharge_rate" bson:"surcharge_rate" validate:"min=0"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// StateMileage — пробег транспорта по юрисдикции за день (из ELD, путевых листов или вручную)
+type StateMileage struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CompanyID       primitive.ObjectID `json:"company_id" bson:"company_id"`
+	VehicleID       primitive.ObjectID `json:"vehicle_id" bson:"vehicle_id" validate:"required"`
+	TripDate        time.Time          `json:"trip_date" bson:"trip_date" validate:"required"`
+	Jurisdiction    string             `json:"jurisdiction" bson:"jurisdiction" validate:"required,len=2"`
+	Miles           float64            `json:"miles" bson:"miles" validate:"required,gt=0"`
+	NonTaxableMiles float64            `json:"non_taxable_miles" bson:"non_taxable_miles" validate:"min=0"`
+	Source          string             `json:"source" bson:"source" validate:"oneof=manual import"`
+	Notes           string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedBy       primitive.ObjectID `json:"created_by" bson:"created_by"`
+	CreatedAt       time.Time          `json:"created_at" bson:"created_at"`
+}
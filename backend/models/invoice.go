@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Invoice — счет брокеру (грузоотправителю) за доставленные рейсы.
+// Статус overdue не хранится: он выставляется при выдаче для отправленных счетов с истекшим сроком оплаты.
+type Invoice struct {
+	ID            primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	CompanyID     primitive.ObjectID   `json:"company_id" bson:"company_id"`
+	InvoiceNumber string               `json:"invoice_number" bson:"invoice_number"`
+	Sequence      int                  `json:"sequence" bson:"sequence"`
+	BillTo        string               `json:"bill_to" bson:"bill_to" validate:"required"`
+	BillToAddress string               `json:"bill_to_address,omitempty" bson:"bill_to_address,omitempty"`
+	BrokerMC      string               `json:"broker_mc,omitempty" bson:"broker_mc,omitempty"`
+	LoadIDs       []primitive.ObjectID `json:"load_ids" bson:"load_ids"`
+	Lines         []InvoiceLine        `json:"lines" bson:"lines"`
+	Total         float64              `json:"total" bson:"total"`
+	AmountPaid    float64              `json:"amount_paid" bson:"amount_paid"`
+	Balance       float64              `json:"balance" bson:"balance"`
+	InvoiceDate   time.Time            `json:"invoice_date" bson:"invoice_date"`
+	TermsDays     int                  `json:"terms_days" bson:"terms_days" validate:"min=0"`
+	DueDate       time.Time            `json:"due_date" bson:"due_date"`
+	Status        string               `json:"status" bson:"status" validate:"oneof=draft sent paid void"`
+	SentAt        time.Time            `json:"sent_at,omitempty" bson:"sent_at,omitempty"`
+	PaidAt        time.Time            `json:"paid_at,omitempty" bson:"paid_at,omitempty"`
+	Notes         string               `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedBy     primitive.ObjectID   `json:"created_by" bson:"created_by"`
+	CreatedAt     time.Time            `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time            `json:"updated_at" bson:"updated_at"`
+
+	// Фактор, которому передан счет (пока счет не возвращен по регрессу)
+	FactorID *primitive.ObjectID `json:"factor_id,omitempty" bson:"factor_id,omitempty"`
+
+	// Списанная недоплата брокера по факторингу без регресса: уменьшает остаток счета
+	WrittenOff     float64   `json:"written_off,omitempty" bson:"written_off,omitempty"`
+	WrittenOffDate time.Time `json:"written_off_date,omitempty" bson:"written_off_date,omitempty"`
+
+	// Дней просрочки на дату выдачи
+	DaysPastDue int `json:"days_past_due" bson:"-"`
+}
+
+// InvoiceLine — строка счета: линейный тариф, fuel surcharge или доп. начисление по рейсу
+type InvoiceLine struct {
+	LoadID      *primitive.ObjectID `json:"load_id,omitempty" bson:"load_id,omitempty"`
+	Description string              `json:"description" bson:"description" validate:"required"`
+	Amount      float64             `json:"amount" bson:"amount"`
+}
+
+// InvoicePayment — поступление оплаты по счету (в том числе частичное)
+type InvoicePayment struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	InvoiceID   primitive.ObjectID `json:"invoice_id" bson:"invoice_id"`
+	CompanyID   primitive.ObjectID `json:"company_id" bson:"company_id"`
+	PaymentDate time.Time          `json:"payment_date" bson:"payment_date" validate:"required"`
+	Amount      float64            `json:"amount" bson:"amount" validate:"required,gt=0"`
+	Method      string             `json:"method" bson:"method" validate:"oneof=ach check wire quick_pay factoring other"`
+	Reference   string             `json:"reference,omitempty" bson:"reference,omitempty"`
+	Notes       string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedBy   primitive.ObjectID `json:"created_by" bson:"created_by"`
+	CreatedAt   time.Time          `json:"created_at" bson:"created_at"`
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Lease — лизинг транспорта (TRAC или FMV)
+type Lease struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	VehicleID      primitive.ObjectID `json:"vehicle_id" bson:"vehicle_id"`
+	CompanyID      primitive.ObjectID `json:"company_id" bson:"company_id"`
+	Lessor         string             `json:"lessor" bson:"lessor" validate:"required"`
+	LeaseType      string             `json:"lease_type" bson:"lease_type" validate:"required,oneof=trac fmv"`
+	Classification string             `json:"classification" bson:"classification" validate:"required,oneof=operating finance"`
+	StartDate      time.Time          `json:"start_date" bson:"start_date"`
+	TermMonths     int                `json:"term_months" bson:"term_months" validate:"required,min=1"`
+	MonthlyRent    float64            `json:"monthly_rent" bson:"monthly_rent" validate:"required,min=0"`
+	SalesTaxRate   float64            `json:"sales_tax_rate" bson:"sales_tax_rate" validate:"min=0,max=100"`
+	ResidualValue  float64            `json:"residual_value" bson:"residual_value" validate:"min=0"`
+	BuyoutOption   bool               `json:"buyout_option" bson:"buyout_option"`
+	BuyoutPrice    float64            `json:"buyout_price" bson:"buyout_price" validate:"min=0"`
+	ImplicitRate   float64            `json:"implicit_rate" bson:"implicit_rate" validate:"min=0,max=100"`
+	Status         string             `json:"status" bson:"status" validate:"required,oneof=active ended bought_out"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt      time.Time          `json:"updated_at" bson:"updated_at"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Load — рейс (груз) от брокера или грузоотправителя
+type Load struct {
+	ID               primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	CompanyID        primitive.ObjectID  `json:"company_id" bson:"company_id"`
+	LoadNumber       string              `json:"load_number" bson:"load_number" validate:"required"`
+	Broker           string              `json:"broker" bson:"broker"`
+	BrokerMC         string              `json:"broker_mc,omitempty" bson:"broker_mc,omitempty"`
+	Shipper          string              `json:"shipper,omitempty" bson:"shipper,omitempty"`
+	Consignee        string              `json:"consignee,omitempty" bson:"consignee,omitempty"`
+	PickupLocation   string              `json:"pickup_location" bson:"pickup_location" validate:"required"`
+	PickupDate       time.Time           `json:"pickup_date" bson:"pickup_date" validate:"required"`
+	DeliveryLocation string              `json:"delivery_location" bson:"delivery_location" validate:"required"`
+	DeliveryDate     time.Time           `json:"delivery_date" bson:"delivery_date"`
+	LoadedMiles      float64             `json:"loaded_miles" bson:"loaded_miles" validate:"min=0"`
+	DeadheadMiles    float64             `json:"deadhead_miles" bson:"deadhead_miles" validate:"min=0"`
+	Rate             float64             `json:"rate" bson:"rate" validate:"min=0"`
+	FuelSurcharge    float64             `json:"fuel_surcharge" bson:"fuel_surcharge" validate:"min=0"`
+	Accessorials     []LoadAccessorial   `json:"accessorials" bson:"accessorials"`
+	TotalRevenue     float64             `json:"total_revenue" bson:"total_revenue"`
+	TruckID          *primitive.ObjectID `json:"truck_id,omitempty" bson:"truck_id,omitempty"`
+	TrailerID        *primitive.ObjectID `json:"trailer_id,omitempty" bson:"trailer_id,omitempty"`
+	DriverID         *primitive.ObjectID `json:"driver_id,omitempty" bson:"driver_id,omitempty"`
+	DriverPay        float64             `json:"driver_pay" bson:"driver_pay" validate:"min=0"`
+	Status           string              `json:"status" bson:"status" validate:"oneof=booked dispatched in_transit delivered cancelled"`
+	Notes            string              `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedBy        primitive.ObjectID  `json:"created_by" bson:"created_by"`
+	CreatedAt        time.Time           `json:"created_at" bson:"created_at"`
+	UpdatedAt        time.Time           `json:"updated_at" bson:"updated_at"`
+
+	// Оплата водителя введена вручную; иначе она пересчитывается по ставке водителя при каждом изменении рейса
+	DriverPayManual bool `json:"driver_pay_manual" bson:"driver_pay_manual"`
+
+	// Счет, в который включен рейс
+	InvoiceID *primitive.ObjectID `json:"invoice_id,omitempty" bson:"invoice_id,omitempty"`
+
+	// Названия транспорта и водителя заполняются при выдаче
+	TruckName   string `json:"truck_name,omitempty" bson:"-"`
+	TrailerName string `json:"trailer_name,omitempty" bson:"-"`
+	DriverName  string `json:"driver_name,omitempty" bson:"-"`
+}
+
+// LoadAccessorial — дополнительное начисление по рейсу (простой, lumper, TONU, доп. остановка)
+type LoadAccessorial struct {
+	Type        string  `json:"type" bson:"type" validate:"required,oneof=detention layover lumper tonu stop_off other"`
+	Description string  `json:"description,omitempty" bson:"description,omitempty"`
+	Amount      float64 `json:"amount" bson:"amount"`
+}
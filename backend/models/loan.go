@@ -9,6 +9,7 @@ import (
 type Loan struct {
 	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	VehicleID        primitive.ObjectID `json:"vehicle_id" bson:"vehicle_id"`
+	Collateral       []LoanCollateral   `json:"collateral,omitempty" bson:"collateral,omitempty"`
 	CompanyID        primitive.ObjectID `json:"company_id" bson:"company_id"`
 	Lender           string             `json:"lender" bson:"lender" validate:"required"`
 	PrincipalAmount  float64            `json:"principal_amount" bson:"principal_amount" validate:"required,min=0"`
@@ -16,12 +17,46 @@ type Loan struct {
 	TermMonths       int                `json:"term_months" bson:"term_months" validate:"required,min=1"`
 	StartDate        time.Time          `json:"start_date" bson:"start_date"`
 	MonthlyPayment   float64            `json:"monthly_payment" bson:"monthly_payment"`
+	BalloonAmount    float64            `json:"balloon_amount" bson:"balloon_amount"`
 	RemainingBalance float64            `json:"remaining_balance" bson:"remaining_balance"`
+	DayCount         string             `json:"day_count" bson:"day_count" validate:"omitempty,oneof=30/360 actual/365 actual/360"`
+	LastPaymentDate  time.Time          `json:"last_payment_date,omitempty" bson:"last_payment_date,omitempty"`
+	PayoffFee        float64            `json:"payoff_fee" bson:"payoff_fee"`
 	Status           string             `json:"status" bson:"status" validate:"required,oneof=active paid_off"`
-	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
-	UpdatedAt        time.Time          `json:"updated_at" bson:"updated_at"`
+
+	// Связи рефинансирования: новый кредит ссылается на погашенные им кредиты и наоборот
+	RefinancedFrom []primitive.ObjectID `json:"refinanced_from,omitempty" bson:"refinanced_from,omitempty"`
+	RefinancedInto primitive.ObjectID   `json:"refinanced_into,omitempty" bson:"refinanced_into,omitempty"`
+
+	// Условия просрочки и текущее состояние, которое ведет модуль просрочек
+	GracePeriodDays      int       `json:"grace_period_days" bson:"grace_period_days"`
+	LateFeeType          string    `json:"late_fee_type,omitempty" bson:"late_fee_type,omitempty" validate:"omitempty,oneof=flat percent"`
+	LateFeeAmount        float64   `json:"late_fee_amount" bson:"late_fee_amount"`
+	DelinquencyStatus    string    `json:"delinquency_status,omitempty" bson:"delinquency_status,omitempty" validate:"omitempty,oneof=current late delinquent default"`
+	DaysPastDue          int       `json:"days_past_due" bson:"days_past_due,omitempty"`
+	LateFeesOutstanding  float64   `json:"late_fees_outstanding" bson:"late_fees_outstanding,omitempty"`
+	DelinquencyCheckedAt time.Time `json:"delinquency_checked_at,omitempty" bson:"delinquency_checked_at,omitempty"`
+
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+	UpdatedAt time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+// LoanCollateral — транспорт в залоге по кредиту. VehicleID кредита остается основным залогом,
+// Collateral перечисляет все залоговые единицы, в том числе при перекрестном залоге.
+type LoanCollateral struct {
+	VehicleID          primitive.ObjectID `json:"vehicle_id" bson:"vehicle_id"`
+	AllocatedPrincipal float64            `json:"allocated_principal" bson:"allocated_principal"`
+	LienReleased       bool               `json:"lien_released" bson:"lien_released"`
+	ReleasedAt         time.Time          `json:"released_at,omitempty" bson:"released_at,omitempty"`
+	ReleaseAmount      float64            `json:"release_amount,omitempty" bson:"release_amount,omitempty"`
 }
 
+// Варианты применения досрочного погашения основного долга
+const (
+	PrepaymentShortenTerm = "shorten_term"
+	PrepaymentRecast      = "recast"
+)
+
 type Payment struct {
 	ID               primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	LoanID           primitive.ObjectID `json:"loan_id" bson:"loan_id"`
@@ -29,6 +64,85 @@ type Payment struct {
 	PrincipalPaid    float64            `json:"principal_paid" bson:"principal_paid"`
 	InterestPaid     float64            `json:"interest_paid" bson:"interest_paid"`
 	TotalPaid        float64            `json:"total_paid" bson:"total_paid"`
+	ExtraPrincipal   float64            `json:"extra_principal" bson:"extra_principal"`
+	PrepaymentOption string             `json:"prepayment_option,omitempty" bson:"prepayment_option,omitempty" validate:"omitempty,oneof=shorten_term recast"`
 	RemainingBalance float64            `json:"remaining_balance" bson:"remaining_balance"`
+	DaysAccrued      int                `json:"days_accrued" bson:"days_accrued"`
+	Status           string             `json:"status" bson:"status" validate:"omitempty,oneof=posted voided reversed"`
+	StatusReason     string             `json:"status_reason,omitempty" bson:"status_reason,omitempty"`
+	StatusChangedAt  time.Time          `json:"status_changed_at,omitempty" bson:"status_changed_at,omitempty"`
+	ReversalDate     time.Time          `json:"reversal_date,omitempty" bson:"reversal_date,omitempty"`
+	Replaces         primitive.ObjectID `json:"replaces,omitempty" bson:"replaces,omitempty"`
+	ReplacedBy       primitive.ObjectID `json:"replaced_by,omitempty" bson:"replaced_by,omitempty"`
+	RefinanceID      primitive.ObjectID `json:"refinance_id,omitempty" bson:"refinance_id,omitempty"`
 	CreatedAt        time.Time          `json:"created_at" bson:"created_at"`
+
+	// Транспорт, залог по которому погашен платежом (снятие залога при продаже)
+	LienReleaseVehicleID primitive.ObjectID `json:"lien_release_vehicle_id,omitempty" bson:"lien_release_vehicle_id,omitempty"`
+}
+
+// Статусы платежа. Аннулированные и сторнированные платежи не удаляются,
+// но исключаются из расчета остатка по кредиту.
+const (
+	PaymentPosted   = "posted"
+	PaymentVoided   = "voided"
+	PaymentReversed = "reversed"
+)
+
+// Действия в журнале изменений платежей
+const (
+	PaymentEventCreated   = "created"
+	PaymentEventVoided    = "voided"
+	PaymentEventReversed  = "reversed"
+	PaymentEventCorrected = "corrected"
+)
+
+// PaymentEvent — запись журнала изменений платежа
+type PaymentEvent struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	PaymentID primitive.ObjectID `json:"payment_id" bson:"payment_id"`
+	LoanID    primitive.ObjectID `json:"loan_id" bson:"loan_id"`
+	UserID    primitive.ObjectID `json:"user_id" bson:"user_id"`
+	Action    string             `json:"action" bson:"action"`
+	Reason    string             `json:"reason,omitempty" bson:"reason,omitempty"`
+	TotalPaid float64            `json:"total_paid" bson:"total_paid"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// LateFee — штраф за просроченный взнос по кредиту
+type LateFee struct {
+	ID                primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	LoanID            primitive.ObjectID `json:"loan_id" bson:"loan_id"`
+	CompanyID         primitive.ObjectID `json:"company_id" bson:"company_id"`
+	InstallmentNumber int                `json:"installment_number" bson:"installment_number"`
+	DueDate           time.Time          `json:"due_date" bson:"due_date"`
+	Amount            float64            `json:"amount" bson:"amount"`
+	Status            string             `json:"status" bson:"status" validate:"required,oneof=outstanding paid waived"`
+	AssessedAt        time.Time          `json:"assessed_at" bson:"assessed_at"`
+	UpdatedAt         time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// RefinancePayoff — погашение одного старого кредита в рамках рефинансирования
+type RefinancePayoff struct {
+	LoanID          primitive.ObjectID `json:"loan_id" bson:"loan_id"`
+	Lender          string             `json:"lender" bson:"lender"`
+	Principal       float64            `json:"principal" bson:"principal"`
+	AccruedInterest float64            `json:"accrued_interest" bson:"accrued_interest"`
+	Fees            float64            `json:"fees" bson:"fees"`
+	Total           float64            `json:"total" bson:"total"`
+}
+
+// Refinance — рефинансирование или консолидация кредитов в новый кредит
+type Refinance struct {
+	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CompanyID    primitive.ObjectID `json:"company_id" bson:"company_id"`
+	NewLoanID    primitive.ObjectID `json:"new_loan_id" bson:"new_loan_id"`
+	PayoffDate   time.Time          `json:"payoff_date" bson:"payoff_date"`
+	Payoffs      []RefinancePayoff  `json:"payoffs" bson:"payoffs"`
+	PayoffTotal  float64            `json:"payoff_total" bson:"payoff_total"`
+	ClosingFees  float64            `json:"closing_fees" bson:"closing_fees"`
+	FeesFinanced bool               `json:"fees_financed" bson:"fees_financed"`
+	CashOut      float64            `json:"cash_out" bson:"cash_out"`
+	NewPrincipal float64            `json:"new_principal" bson:"new_principal"`
+	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
 }
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaintenanceTemplate — шаблон планового обслуживания (PM-A, PM-B, ежегодный осмотр DOT).
+// Срабатывает по пробегу, моточасам или календарному интервалу — что наступит раньше.
+type MaintenanceTemplate struct {
+	ID                  primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CompanyID           primitive.ObjectID `json:"company_id" bson:"company_id"`
+	Name                string             `json:"name" bson:"name" validate:"required"`
+	Description         string             `json:"description" bson:"description"`
+	VehicleType         string             `json:"vehicle_type,omitempty" bson:"vehicle_type,omitempty" validate:"omitempty,oneof=truck trailer"`
+	IntervalMiles       float64            `json:"interval_miles" bson:"interval_miles" validate:"min=0"`
+	IntervalEngineHours float64            `json:"interval_engine_hours" bson:"interval_engine_hours" validate:"min=0"`
+	IntervalDays        int                `json:"interval_days" bson:"interval_days" validate:"min=0"`
+	DueSoonMiles        float64            `json:"due_soon_miles" bson:"due_soon_miles" validate:"min=0"`
+	DueSoonEngineHours  float64            `json:"due_soon_engine_hours" bson:"due_soon_engine_hours" validate:"min=0"`
+	DueSoonDays         int                `json:"due_soon_days" bson:"due_soon_days" validate:"min=0"`
+	Active              bool               `json:"active" bson:"active"`
+	CreatedAt           time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt           time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// WorkOrder — заказ-наряд на обслуживание или ремонт транспорта
+type WorkOrder struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	CompanyID     primitive.ObjectID `json:"company_id" bson:"company_id"`
+	VehicleID     primitive.ObjectID `json:"vehicle_id" bson:"vehicle_id"`
+	TemplateID    primitive.ObjectID `json:"template_id,omitempty" bson:"template_id,omitempty"`
+	Title         string             `json:"title" bson:"title" validate:"required"`
+	Status        string             `json:"status" bson:"status" validate:"oneof=open in_progress completed cancelled"`
+	Vendor        string             `json:"vendor" bson:"vendor"`
+	OpenedAt      time.Time          `json:"opened_at" bson:"opened_at"`
+	CompletedAt   time.Time          `json:"completed_at,omitempty" bson:"completed_at,omitempty"`
+	Odometer      float64            `json:"odometer" bson:"odometer"`
+	EngineHours   float64            `json:"engine_hours" bson:"engine_hours"`
+	Parts         []WorkOrderPart    `json:"parts" bson:"parts"`
+	Labor         []WorkOrderLabor   `json:"labor" bson:"labor"`
+	VendorCharges float64            `json:"vendor_charges" bson:"vendor_charges" validate:"min=0"`
+	PartsCost     float64            `json:"parts_cost" bson:"parts_cost"`
+	LaborCost     float64            `json:"labor_cost" bson:"labor_cost"`
+	TotalCost     float64            `json:"total_cost" bson:"total_cost"`
+	Notes         string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// WorkOrderPart — запчасть в заказ-наряде
+type WorkOrderPart struct {
+	PartNumber  string  `json:"part_number" bson:"part_number"`
+	Description string  `json:"description" bson:"description"`
+	Quantity    float64 `json:"quantity" bson:"quantity"`
+	UnitCost    float64 `json:"unit_cost" bson:"unit_cost"`
+}
+
+// WorkOrderLabor — работы в заказ-наряде
+type WorkOrderLabor struct {
+	Description string  `json:"description" bson:"description"`
+	Hours       float64 `json:"hours" bson:"hours"`
+	Rate        float64 `json:"rate" bson:"rate"`
+}
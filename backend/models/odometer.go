@@ -0,0 +1,28 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// OdometerReading — показание одометра и счетчика моточасов.
+// Mileage — пробег с учетом обнулений одометра (Odometer + RolloverOffset).
+type OdometerReading struct {
+	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	VehicleID      primitive.ObjectID `json:"vehicle_id" bson:"vehicle_id"`
+	CompanyID      primitive.ObjectID `json:"company_id" bson:"company_id"`
+	ReadingDate    time.Time          `json:"reading_date" bson:"reading_date"`
+	Odometer       float64            `json:"odometer" bson:"odometer" validate:"min=0"`
+	EngineHours    float64            `json:"engine_hours" bson:"engine_hours" validate:"min=0"`
+	Source         string             `json:"source" bson:"source" validate:"oneof=manual eld fuel service import"`
+	Rollover       bool               `json:"rollover" bson:"rollover"`
+	RolloverOffset float64            `json:"rollover_offset" bson:"rollover_offset"`
+	Mileage        float64            `json:"mileage" bson:"mileage"`
+	Notes          string             `json:"notes,omitempty" bson:"notes,omitempty"`
+	CreatedBy      primitive.ObjectID `json:"created_by" bson:"created_by"`
+	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
+
+	// Заправка, по которой записано показание: меняется и удаляется вместе с ней
+	FuelPurchaseID primitive.ObjectID `json:"fuel_purchase_id,omitempty" bson:"fuel_purchase_id,omitempty"`
+}
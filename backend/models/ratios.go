@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RatioSnapshot — сохраненные финансовые коэффициенты компании (или консолидированно) на дату
+type RatioSnapshot struct {
+	ID                 primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	UserID             primitive.ObjectID `json:"user_id" bson:"user_id"`
+	CompanyID          primitive.ObjectID `json:"company_id,omitempty" bson:"company_id,omitempty"`
+	Consolidated       bool               `json:"consolidated" bson:"consolidated"`
+	SnapshotDate       time.Time          `json:"snapshot_date" bson:"snapshot_date"`
+	NetOperatingIncome float64            `json:"net_operating_income" bson:"net_operating_income"`
+	AnnualDebtService  float64            `json:"annual_debt_service" bson:"annual_debt_service"`
+	DSCR               *float64           `json:"dscr" bson:"dscr"`
+	TotalDebt          float64            `json:"total_debt" bson:"total_debt"`
+	FleetValue         float64            `json:"fleet_value" bson:"fleet_value"`
+	EquityInFleet      float64            `json:"equity_in_fleet" bson:"equity_in_fleet"`
+	DebtToAsset        *float64           `json:"debt_to_asset" bson:"debt_to_asset"`
+	DebtToEquity       *float64           `json:"debt_to_equity" bson:"debt_to_equity"`
+	CreatedAt          time.Time          `json:"created_at" bson:"created_at"`
+}
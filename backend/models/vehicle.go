@@ -19,4 +19,75 @@ type Vehicle struct {
 	Status        string             `json:"status" bson:"status" validate:"required,oneof=active inactive sold"`
 	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
 	UpdatedAt     time.Time          `json:"updated_at" bson:"updated_at"`
+
+	// Амортизация: незаданные значения берутся из настроек компании.
+	// Для units_of_production используются ожидаемый пробег за срок службы, пробег в год и пробег по журналу показаний с даты покупки.
+	// Текущий пробег и моточасы обновляются по журналу показаний одометра.
+	DepreciationMethod string   `json:"depreciation_method,omitempty" bson:"depreciation_method,omitempty"`
+	UsefulLifeYears    int      `json:"useful_life_years,omitempty" bson:"useful_life_years,omitempty"`
+	SalvageValue       *float64 `json:"salvage_value,omitempty" bson:"salvage_value,omitempty"`
+	LifetimeMiles      float64  `json:"lifetime_miles,omitempty" bson:"lifetime_miles,omitempty"`
+	AnnualMiles        float64  `json:"annual_miles,omitempty" bson:"annual_miles,omitempty"`
+	Mileage            float64  `json:"mileage" bson:"mileage"`
+	EngineHours        float64  `json:"engine_hours" bson:"engine_hours"`
+
+	// Налоговая амортизация (отдельно от балансовой)
+	Tax VehicleTaxElections `json:"tax" bson:"tax"`
+
+	// Выбытие (продажа, trade-in, списание); после выбытия амортизация не начисляется
+	Disposal *VehicleDisposal `json:"disposal,omitempty" bson:"disposal,omitempty"`
+
+	// Номер юнита во флоте (по нему сопоставляются выгрузки топливных карт) и емкость баков, галлоны
+	UnitNumber   string  `json:"unit_number,omitempty" bson:"unit_number,omitempty"`
+	FuelCapacity float64 `json:"fuel_capacity,omitempty" bson:"fuel_capacity,omitempty"`
+
+	// Залоги по кредитам рассчитываются при выдаче и не хранятся в документе транспорта
+	Liens []VehicleLien `json:"liens,omitempty" bson:"-"`
+}
+
+// VehicleTaxElections — выборы по налоговой амортизации актива.
+// Пустое соглашение определяется тестом mid-quarter по компании и году ввода.
+type VehicleTaxElections struct {
+	PlacedInService time.Time `json:"placed_in_service,omitempty" bson:"placed_in_service,omitempty"`
+	RecoveryYears   int       `json:"recovery_years,omitempty" bson:"recovery_years,omitempty"`
+	Convention      string    `json:"convention,omitempty" bson:"convention,omitempty"`
+	Section179      float64   `json:"section_179" bson:"section_179"`
+	BonusPercent    float64   `json:"bonus_percent" bson:"bonus_percent"`
+}
+
+// VehicleDisposal — запись о выбытии транспорта с результатом в балансовом и налоговом учете
+type VehicleDisposal struct {
+	DisposalType          string               `json:"disposal_type" bson:"disposal_type"`
+	DisposalDate          time.Time            `json:"disposal_date" bson:"disposal_date"`
+	SalePrice             float64              `json:"sale_price" bson:"sale_price"`
+	TradeInCredit         float64              `json:"trade_in_credit" bson:"trade_in_credit"`
+	SellingExpenses       float64              `json:"selling_expenses" bson:"selling_expenses"`
+	Buyer                 string               `json:"buyer" bson:"buyer"`
+	Notes                 string               `json:"notes,omitempty" bson:"notes,omitempty"`
+	LoanPayoffs           []DisposalLoanPayoff `json:"loan_payoffs" bson:"loan_payoffs"`
+	AmountRealized        float64              `json:"amount_realized" bson:"amount_realized"`
+	BookValue             float64              `json:"book_value" bson:"book_value"`
+	BookGainLoss          float64              `json:"book_gain_loss" bson:"book_gain_loss"`
+	TaxBasis              float64              `json:"tax_basis" bson:"tax_basis"`
+	TaxGainLoss           float64              `json:"tax_gain_loss" bson:"tax_gain_loss"`
+	DepreciationRecapture float64              `json:"depreciation_recapture" bson:"depreciation_recapture"`
+	RecordedBy            primitive.ObjectID   `json:"recorded_by" bson:"recorded_by"`
+	RecordedAt            time.Time            `json:"recorded_at" bson:"recorded_at"`
+}
+
+// DisposalLoanPayoff — погашение кредита за счет выбывшего транспорта
+type DisposalLoanPayoff struct {
+	LoanID   primitive.ObjectID `json:"loan_id" bson:"loan_id"`
+	Lender   string             `json:"lender" bson:"lender"`
+	Amount   float64            `json:"amount" bson:"amount"`
+	Recorded bool               `json:"recorded" bson:"recorded"`
+}
+
+// VehicleLien — залог транспорта по кредиту
+type VehicleLien struct {
+	LoanID             primitive.ObjectID `json:"loan_id"`
+	Lender             string             `json:"lender"`
+	AllocatedPrincipal float64            `json:"allocated_principal"`
+	Released           bool               `json:"released"`
+	ReleasedAt         time.Time          `json:"released_at,omitempty"`
 }
@@ -4,11 +4,12 @@ import (
 	"business-schedule-backend/database"
 	"business-schedule-backend/handlers"
 	"business-schedule-backend/middleware"
+	"business-schedule-backend/storage"
 
 	"github.com/gofiber/fiber/v2"
 )
 
-func SetupRoutes(app *fiber.App, db *database.Database, jwtSecret string) {
+func SetupRoutes(app *fiber.App, db *database.Database, store storage.Storage, jwtSecret string, maxDocumentSize int64) {
 	// Здоровье приложения
 	app.Get("/health", func(c *fiber.Ctx) error {
 		return c.JSON(fiber.Map{
@@ -30,7 +31,7 @@ func SetupRoutes(app *fiber.App, db *database.Database, jwtSecret string) {
 
 	// Компании
 	companies := protected.Group("/companies")
-	companyHandler := handlers.NewCompanyHandler(db)
+	companyHandler := handlers.NewCompanyHandler(db, store)
 	companies.Get("/", companyHandler.GetCompanies)
 	companies.Post("/", companyHandler.CreateCompany)
 	companies.Put("/:id", companyHandler.UpdateCompany)
@@ -38,26 +39,200 @@ func SetupRoutes(app *fiber.App, db *database.Database, jwtSecret string) {
 
 	// Транспорт
 	vehicles := protected.Group("/vehicles")
-	vehicleHandler := handlers.NewVehicleHandler(db)
+	vehicleHandler := handlers.NewVehicleHandler(db, store)
 	vehicles.Get("/", vehicleHandler.GetVehicles)
+	vehicles.Get("/disposals", vehicleHandler.GetDisposals)
 	vehicles.Post("/", vehicleHandler.CreateVehicle)
 	vehicles.Put("/:id", vehicleHandler.UpdateVehicle)
 	vehicles.Delete("/:id", vehicleHandler.DeleteVehicle)
+	vehicles.Get("/:id/lien-release", vehicleHandler.GetLienRelease)
+	vehicles.Post("/:id/dispose", vehicleHandler.DisposeVehicle)
+	vehicles.Get("/:id/readings", vehicleHandler.GetReadings)
+	vehicles.Post("/:id/readings", vehicleHandler.CreateReading)
+	vehicles.Post("/:id/readings/import", vehicleHandler.ImportReadings)
+	vehicles.Delete("/:id/readings/:readingId", vehicleHandler.DeleteReading)
+	vehicles.Get("/:id/utilization", vehicleHandler.GetUtilization)
+
+	// Реестр основных средств
+	assets := protected.Group("/assets")
+	assetHandler := handlers.NewAssetHandler(db, store)
+	assets.Get("/register", assetHandler.GetRegister)
+	assets.Get("/improvements", assetHandler.GetImprovements)
+	assets.Post("/improvements", assetHandler.CreateImprovement)
+	assets.Put("/improvements/:id", assetHandler.UpdateImprovement)
+	assets.Delete("/improvements/:id", assetHandler.DeleteImprovement)
+
+	// Водители
+	drivers := protected.Group("/drivers")
+	driverHandler := handlers.NewDriverHandler(db, store)
+	drivers.Get("/", driverHandler.GetDrivers)
+	drivers.Post("/", driverHandler.CreateDriver)
+	drivers.Put("/:id", driverHandler.UpdateDriver)
+	drivers.Delete("/:id", driverHandler.DeleteDriver)
+
+	// Закрепление водителей и прицепов за тягачами
+	assignments := protected.Group("/assignments")
+	assignmentHandler := handlers.NewAssignmentHandler(db)
+	assignments.Get("/", assignmentHandler.GetAssignments)
+	assignments.Get("/roster", assignmentHandler.GetRoster)
+	assignments.Post("/", assignmentHandler.CreateAssignment)
+	assignments.Put("/:id", assignmentHandler.UpdateAssignment)
+	assignments.Post("/:id/end", assignmentHandler.EndAssignment)
+	assignments.Delete("/:id", assignmentHandler.DeleteAssignment)
+
+	// Рейсы
+	loads := protected.Group("/loads")
+	loadHandler := handlers.NewLoadHandler(db)
+	loads.Get("/", loadHandler.GetLoads)
+	loads.Post("/", loadHandler.CreateLoad)
+	loads.Put("/:id", loadHandler.UpdateLoad)
+	loads.Delete("/:id", loadHandler.DeleteLoad)
+
+	// Счета брокерам и дебиторская задолженность
+	invoices := protected.Group("/invoices")
+	invoiceHandler := handlers.NewInvoiceHandler(db)
+	invoices.Get("/", invoiceHandler.GetInvoices)
+	invoices.Post("/", invoiceHandler.CreateInvoice)
+	invoices.Get("/aging", invoiceHandler.GetAging)
+	invoices.Get("/:id", invoiceHandler.GetInvoice)
+	invoices.Get("/:id/pdf", invoiceHandler.GetInvoicePDF)
+	invoices.Put("/:id", invoiceHandler.UpdateInvoice)
+	invoices.Post("/:id/send", invoiceHandler.SendInvoice)
+	invoices.Post("/:id/void", invoiceHandler.VoidInvoice)
+	invoices.Post("/:id/payments", invoiceHandler.AddPayment)
+	invoices.Delete("/:id/payments/:paymentId", invoiceHandler.DeletePayment)
+	invoices.Delete("/:id", invoiceHandler.DeleteInvoice)
+
+	// Факторинг счетов
+	factoring := protected.Group("/factoring")
+	factoringHandler := handlers.NewFactoringHandler(db)
+	factoring.Get("/factors", factoringHandler.GetFactors)
+	factoring.Post("/factors", factoringHandler.CreateFactor)
+	factoring.Put("/factors/:id", factoringHandler.UpdateFactor)
+	factoring.Delete("/factors/:id", factoringHandler.DeleteFactor)
+	factoring.Get("/invoices", factoringHandler.GetFactoredInvoices)
+	factoring.Post("/invoices", factoringHandler.FactorInvoice)
+	factoring.Post("/invoices/:id/collect", factoringHandler.CollectFactoredInvoice)
+	factoring.Post("/invoices/:id/release", factoringHandler.ReleaseReserve)
+	factoring.Post("/invoices/:id/chargeback", factoringHandler.ChargebackInvoice)
+	factoring.Delete("/invoices/:id", factoringHandler.DeleteFactoredInvoice)
+	factoring.Get("/costs", factoringHandler.GetCostReport)
+
+	// Прибыльность тягачей
+	profitabilityHandler := handlers.NewProfitabilityHandler(db)
+	protected.Get("/profitability", profitabilityHandler.GetProfitability)
+
+	// Топливо
+	fuel := protected.Group("/fuel")
+	fuelHandler := handlers.NewFuelHandler(db)
+	fuel.Get("/purchases", fuelHandler.GetPurchases)
+	fuel.Post("/purchases", fuelHandler.CreatePurchase)
+	fuel.Post("/purchases/import", fuelHandler.ImportPurchases)
+	fuel.Put("/purchases/:id", fuelHandler.UpdatePurchase)
+	fuel.Delete("/purchases/:id", fuelHandler.DeletePurchase)
+	fuel.Get("/economy", fuelHandler.GetEconomy)
+	fuel.Get("/report", fuelHandler.GetReport)
+
+	// Квартальная декларация IFTA
+	ifta := protected.Group("/ifta")
+	iftaHandler := handlers.NewIFTAHandler(db)
+	ifta.Get("/rates", iftaHandler.GetRates)
+	ifta.Post("/rates", iftaHandler.SaveRates)
+	ifta.Post("/rates/import", iftaHandler.ImportRates)
+	ifta.Get("/mileage", iftaHandler.GetMileage)
+	ifta.Post("/mileage", iftaHandler.CreateMileage)
+	ifta.Post("/mileage/import", iftaHandler.ImportMileage)
+	ifta.Delete("/mileage/:id", iftaHandler.DeleteMileage)
+	ifta.Get("/report", iftaHandler.GetReport)
+
+	// Плановое обслуживание
+	maintenance := protected.Group("/maintenance")
+	maintenanceHandler := handlers.NewMaintenanceHandler(db, store)
+	maintenance.Get("/upcoming", maintenanceHandler.GetUpcoming)
+	maintenance.Get("/vehicles/:id", maintenanceHandler.GetVehicleMaintenance)
+	maintenance.Get("/templates", maintenanceHandler.GetTemplates)
+	maintenance.Post("/templates", maintenanceHandler.CreateTemplate)
+	maintenance.Put("/templates/:id", maintenanceHandler.UpdateTemplate)
+	maintenance.Delete("/templates/:id", maintenanceHandler.DeleteTemplate)
+	maintenance.Get("/work-orders", maintenanceHandler.GetWorkOrders)
+	maintenance.Post("/work-orders", maintenanceHandler.CreateWorkOrder)
+	maintenance.Put("/work-orders/:id", maintenanceHandler.UpdateWorkOrder)
+	maintenance.Post("/work-orders/:id/complete", maintenanceHandler.CompleteWorkOrder)
+	maintenance.Delete("/work-orders/:id", maintenanceHandler.DeleteWorkOrder)
+
+	// Документы соответствия (регистрация, осмотр DOT, страховка, разрешения)
+	compliance := protected.Group("/compliance")
+	complianceHandler := handlers.NewComplianceHandler(db, store, maxDocumentSize)
+	compliance.Get("/", complianceHandler.GetItems)
+	compliance.Post("/", complianceHandler.CreateItem)
+	compliance.Get("/expiring", complianceHandler.GetExpiring)
+	compliance.Get("/alerts", complianceHandler.GetAlerts)
+	compliance.Post("/alerts/run", complianceHandler.RunAlerts)
+	compliance.Put("/alerts/:id/acknowledge", complianceHandler.AcknowledgeAlert)
+	compliance.Put("/:id", complianceHandler.UpdateItem)
+	compliance.Delete("/:id", complianceHandler.DeleteItem)
+	compliance.Post("/:id/document", complianceHandler.UploadDocument)
+	compliance.Get("/:id/document", complianceHandler.DownloadDocument)
+
+	// Документы (договоры, ПТС, счета)
+	documents := protected.Group("/documents")
+	documentHandler := handlers.NewDocumentHandler(db, store, maxDocumentSize)
+	documents.Get("/", documentHandler.GetDocuments)
+	documents.Post("/", documentHandler.UploadDocument)
+	documents.Get("/:id", documentHandler.GetDocument)
+	documents.Get("/:id/download", documentHandler.DownloadDocument)
+	documents.Delete("/:id", documentHandler.DeleteDocument)
 
 	// Кредиты
 	loans := protected.Group("/loans")
-	loanHandler := handlers.NewLoanHandler(db)
+	loanHandler := handlers.NewLoanHandler(db, store)
 	loans.Get("/", loanHandler.GetLoans)
 	loans.Post("/", loanHandler.CreateLoan)
+	loans.Get("/prepayment-simulation", loanHandler.SimulatePrepayment)
+	loans.Post("/quote", loanHandler.QuoteLoans)
+	refinanceHandler := handlers.NewRefinanceHandler(db)
+	loans.Get("/refinances", refinanceHandler.GetRefinances)
+	loans.Post("/refinance", refinanceHandler.RefinanceLoans)
+	loans.Get("/:id/payoff", loanHandler.GetPayoffQuote)
+	loans.Post("/:id/collateral/:vehicleId/release", loanHandler.ReleaseLien)
 	loans.Put("/:id", loanHandler.UpdateLoan)
 	loans.Delete("/:id", loanHandler.DeleteLoan)
 
+	// Лизинг
+	leases := protected.Group("/leases")
+	leaseHandler := handlers.NewLeaseHandler(db, store)
+	leases.Get("/", leaseHandler.GetLeases)
+	leases.Post("/", leaseHandler.CreateLease)
+	leases.Put("/:id", leaseHandler.UpdateLease)
+	leases.Delete("/:id", leaseHandler.DeleteLease)
+
+	// Прогноз движения денег
+	cashflow := protected.Group("/cashflow")
+	cashFlowHandler := handlers.NewCashFlowHandler(db)
+	cashflow.Get("/forecast", cashFlowHandler.GetForecast)
+	cashflow.Get("/items", cashFlowHandler.GetItems)
+	cashflow.Post("/items", cashFlowHandler.CreateItem)
+	cashflow.Put("/items/:id", cashFlowHandler.UpdateItem)
+	cashflow.Delete("/items/:id", cashFlowHandler.DeleteItem)
+
 	// Платежи
 	payments := protected.Group("/payments")
 	paymentHandler := handlers.NewPaymentHandler(db)
 	payments.Get("/", paymentHandler.GetPayments) // Все платежи пользователя
 	payments.Get("/loan/:loanId", paymentHandler.GetPaymentsByLoan)
 	payments.Post("/", paymentHandler.CreatePayment)
+	payments.Put("/:id", paymentHandler.UpdatePayment)
+	payments.Post("/:id/void", paymentHandler.VoidPayment)
+	payments.Post("/:id/reverse", paymentHandler.ReversePayment)
+	payments.Get("/:id/history", paymentHandler.GetPaymentHistory)
+
+	// Просрочки и штрафы
+	delinquency := protected.Group("/delinquency")
+	delinquencyHandler := handlers.NewDelinquencyHandler(db)
+	delinquency.Post("/run", delinquencyHandler.RunDelinquencyCheck)
+	delinquency.Get("/aging", delinquencyHandler.GetAgingReport)
+	delinquency.Get("/late-fees", delinquencyHandler.GetLateFees)
+	delinquency.Put("/late-fees/:id", delinquencyHandler.UpdateLateFee)
 
 	// Финансовые отчеты
 	schedules := protected.Group("/schedules")
@@ -65,6 +240,15 @@ func SetupRoutes(app *fiber.App, db *database.Database, jwtSecret string) {
 	schedules.Get("/debt", scheduleHandler.GetDebtSchedule)
 	schedules.Get("/amortization", scheduleHandler.GetAmortizationSchedule)
 	schedules.Get("/depreciation", scheduleHandler.GetDepreciationSchedule)
+	schedules.Get("/tax-depreciation", scheduleHandler.GetTaxDepreciation)
+	schedules.Get("/form-4562", scheduleHandler.GetForm4562)
+
+	// Финансовые коэффициенты
+	ratios := protected.Group("/ratios")
+	ratiosHandler := handlers.NewRatiosHandler(db)
+	ratios.Get("/", ratiosHandler.GetRatios)
+	ratios.Post("/snapshots", ratiosHandler.CreateSnapshot)
+	ratios.Get("/history", ratiosHandler.GetHistory)
 
 	// Статистика
 	stats := protected.Group("/stats")
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"business-schedule-backend/database"
+	"context"
+	"errors"
+	"io"
+
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// gridFSBucket — имя бакета GridFS для документов
+const gridFSBucket = "documents_fs"
+
+// GridFSStorage хранит файлы в MongoDB GridFS; ключ используется как _id файла
+type GridFSStorage struct {
+	bucket *gridfs.Bucket
+}
+
+func NewGridFSStorage(db *database.Database) (*GridFSStorage, error) {
+	bucket, err := gridfs.NewBucket(db.DB, options.GridFSBucket().SetName(gridFSBucket))
+	if err != nil {
+		return nil, err
+	}
+	return &GridFSStorage{bucket: bucket}, nil
+}
+
+func (s *GridFSStorage) Name() string {
+	return BackendGridFS
+}
+
+func (s *GridFSStorage) Save(ctx context.Context, key string, r io.Reader) error {
+	return s.bucket.UploadFromStreamWithID(key, key, r)
+}
+
+func (s *GridFSStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	stream, err := s.bucket.OpenDownloadStream(key)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (s *GridFSStorage) Delete(ctx context.Context, key string) error {
+	err := s.bucket.DeleteContext(ctx, key)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"business-schedule-backend/database"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Типы хранилищ файлов
+const (
+	BackendLocal  = "local"
+	BackendGridFS = "gridfs"
+)
+
+// ErrNotFound — файл с указанным ключом отсутствует в хранилище
+var ErrNotFound = errors.New("file not found")
+
+// Storage — хранилище содержимого документов. Метаданные (имя, тип, контрольная сумма)
+// хранятся отдельно в коллекции documents, хранилище отвечает только за байты по ключу.
+type Storage interface {
+	// Name возвращает тип хранилища
+	Name() string
+	// Save сохраняет содержимое под ключом
+	Save(ctx context.Context, key string, r io.Reader) error
+	// Open открывает содержимое на чтение; вызывающий закрывает поток
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete удаляет содержимое; отсутствие файла не считается ошибкой
+	Delete(ctx context.Context, key string) error
+}
+
+// NewStorage создает хранилище по типу из конфигурации
+func NewStorage(backend, path string, db *database.Database) (Storage, error) {
+	switch backend {
+	case BackendLocal, "":
+		return NewLocalStorage(path)
+	case BackendGridFS:
+		return NewGridFSStorage(db)
+	}
+	return nil, fmt.Errorf("unknown document storage %q", backend)
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"math"
+)
+
+// LoanOffer — условия предложения по кредиту для сравнения
+type LoanOffer struct {
+	Name         string  `json:"name"`
+	Principal    float64 `json:"principal"`
+	DownPayment  float64 `json:"down_payment"`
+	InterestRate float64 `json:"interest_rate"`
+	TermMonths   int     `json:"term_months"`
+	Fees         float64 `json:"fees"`
+	FeesFinanced bool    `json:"fees_financed"`
+	Balloon      float64 `json:"balloon"`
+}
+
+// LoanQuote — расчет стоимости кредита по предложению
+type LoanQuote struct {
+	LoanOffer
+	NoteAmount      float64 `json:"note_amount"`
+	AmountFinanced  float64 `json:"amount_financed"`
+	MonthlyPayment  float64 `json:"monthly_payment"`
+	APR             float64 `json:"apr"`
+	TotalInterest   float64 `json:"total_interest"`
+	FinanceCharge   float64 `json:"finance_charge"`
+	TotalOfPayments float64 `json:"total_of_payments"`
+	TotalCost       float64 `json:"total_cost"`
+}
+
+// CalculateMonthlyPaymentWithBalloon рассчитывает аннуитетный платеж с остаточным (balloon) платежом в конце срока
+func CalculateMonthlyPaymentWithBalloon(principal, annualRate float64, termMonths int, balloon float64) float64 {
+	if termMonths <= 0 {
+		return 0
+	}
+	n := float64(termMonths)
+	if annualRate == 0 {
+		return math.Round((principal-balloon)/n*100) / 100
+	}
+
+	r := annualRate / 100 / 12
+	payment := (principal - balloon/math.Pow(1+r, n)) * r / (1 - math.Pow(1+r, -n))
+	return math.Round(payment*100) / 100
+}
+
+// presentValue рассчитывает приведенную стоимость графика платежей по месячной ставке
+func presentValue(payment float64, termMonths int, balloon, monthlyRate float64) float64 {
+	n := float64(termMonths)
+	if monthlyRate == 0 {
+		return payment*n + balloon
+	}
+	return payment*(1-math.Pow(1+monthlyRate, -n))/monthlyRate + balloon/math.Pow(1+monthlyRate, n)
+}
+
+// CalculateAPR рассчитывает годовую процентную ставку актуарным методом (Reg Z, Appendix J)
+// для регулярных месячных платежей: ставка, при которой приведенная стоимость платежей
+// равна сумме, фактически полученной заемщиком (amount financed)
+func CalculateAPR(amountFinanced, payment float64, termMonths int, balloon float64) float64 {
+	if amountFinanced <= 0 || termMonths <= 0 {
+		return 0
+	}
+	if presentValue(payment, termMonths, balloon, 0) <= amountFinanced {
+		return 0
+	}
+
+	// Бисекция: приведенная стоимость монотонно убывает с ростом ставки
+	low, high := 0.0, 1.0
+	for presentValue(payment, termMonths, balloon, high) > amountFinanced {
+		high *= 2
+	}
+	for i := 0; i < 200; i++ {
+		mid := (low + high) / 2
+		if presentValue(payment, termMonths, balloon, mid) > amountFinanced {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return math.Round((low+high)/2*12*100*10000) / 10000
+}
+
+// QuoteLoan рассчитывает APR, проценты и полную стоимость предложения по кредиту.
+// Комиссии считаются предоплаченной финансовой платой: они уменьшают amount financed
+// независимо от того, включены ли они в сумму кредита.
+func QuoteLoan(offer LoanOffer) LoanQuote {
+	quote := LoanQuote{LoanOffer: offer}
+
+	quote.NoteAmount = offer.Principal - offer.DownPayment
+	if offer.FeesFinanced {
+		quote.NoteAmount += offer.Fees
+	}
+	quote.NoteAmount = math.Round(quote.NoteAmount*100) / 100
+	quote.AmountFinanced = math.Round((quote.NoteAmount-offer.Fees)*100) / 100
+
+	quote.MonthlyPayment = CalculateMonthlyPaymentWithBalloon(quote.NoteAmount, offer.InterestRate, offer.TermMonths, offer.Balloon)
+	quote.TotalOfPayments = math.Round((quote.MonthlyPayment*float64(offer.TermMonths)+offer.Balloon)*100) / 100
+	quote.TotalInterest = math.Round((quote.TotalOfPayments-quote.NoteAmount)*100) / 100
+	quote.FinanceCharge = math.Round((quote.TotalInterest+offer.Fees)*100) / 100
+	quote.APR = CalculateAPR(quote.AmountFinanced, quote.MonthlyPayment, offer.TermMonths, offer.Balloon)
+
+	// Полная стоимость: первоначальный взнос, все платежи и комиссии, оплаченные отдельно
+	quote.TotalCost = offer.DownPayment + quote.TotalOfPayments
+	if !offer.FeesFinanced {
+		quote.TotalCost += offer.Fees
+	}
+	quote.TotalCost = math.Round(quote.TotalCost*100) / 100
+
+	return quote
+}
@@ -0,0 +1,94 @@
+package utils
+
+import (
+	"math"
+	"time"
+)
+
+// Периодичность повторяющихся доходов и расходов
+const (
+	FrequencyOnce      = "once"
+	FrequencyWeekly    = "weekly"
+	FrequencyMonthly   = "monthly"
+	FrequencyQuarterly = "quarterly"
+	FrequencyAnnual    = "annual"
+)
+
+// IsValidFrequency проверяет что периодичность поддерживается
+func IsValidFrequency(frequency string) bool {
+	switch frequency {
+	case FrequencyOnce, FrequencyWeekly, FrequencyMonthly, FrequencyQuarterly, FrequencyAnnual:
+		return true
+	}
+	return false
+}
+
+// MonthStart возвращает первое число месяца даты
+func MonthStart(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), 1, 0, 0, 0, 0, date.Location())
+}
+
+// OccurrencesInMonth возвращает сколько раз повторяющаяся статья приходится на месяц.
+// Статья повторяется от startDate с заданной периодичностью до endDate (если задана).
+func OccurrencesInMonth(frequency string, startDate, endDate, monthStart time.Time) int {
+	monthEnd := monthStart.AddDate(0, 1, 0)
+	count := 0
+
+	for i := 0; ; i++ {
+		var date time.Time
+		switch frequency {
+		case FrequencyWeekly:
+			date = startDate.AddDate(0, 0, 7*i)
+		case FrequencyMonthly:
+			date = startDate.AddDate(0, i, 0)
+		case FrequencyQuarterly:
+			date = startDate.AddDate(0, 3*i, 0)
+		case FrequencyAnnual:
+			date = startDate.AddDate(i, 0, 0)
+		default:
+			if i > 0 {
+				return count
+			}
+			date = startDate
+		}
+
+		if !date.Before(monthEnd) || (!endDate.IsZero() && date.After(endDate)) {
+			return count
+		}
+		if !date.Before(monthStart) {
+			count++
+		}
+	}
+}
+
+// ProjectLoanPayments рассчитывает платежи по кредиту на каждый из months месяцев, начиная с fromMonth,
+// по фактическому графику: платежи прекращаются после погашения, в последний взнос выплачивается остаток (balloon)
+func ProjectLoanPayments(balance, annualRate, monthlyPayment float64, startDate time.Time, termMonths int, fromMonth time.Time, months int) []float64 {
+	payments := make([]float64, months)
+	monthlyRate := annualRate / 100 / 12
+	horizon := fromMonth.AddDate(0, months, 0)
+
+	for n := 1; n <= termMonths && balance > 0.005; n++ {
+		dueDate := InstallmentDueDate(startDate, n)
+		if dueDate.Before(fromMonth) {
+			continue
+		}
+		if !dueDate.Before(horizon) {
+			break
+		}
+
+		interest := balance * monthlyRate
+		payment := math.Min(monthlyPayment, balance+interest)
+		if n == termMonths {
+			payment = balance + interest
+		}
+		balance -= payment - interest
+
+		index := MonthsBetween(fromMonth, MonthStart(dueDate))
+		if index >= 0 && index < months {
+			payments[index] += math.Round(payment*100) / 100
+		}
+	}
+
+	return payments
+}
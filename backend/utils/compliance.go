@@ -0,0 +1,83 @@
+package utils
+
+import (
+	"math"
+	"time"
+)
+
+// Типы документов соответствия
+const (
+	ComplianceRegistration  = "registration"   // регистрация IRP (cab card)
+	ComplianceDOTInspection = "dot_inspection" // ежегодный осмотр DOT
+	ComplianceInsurance     = "insurance"      // страховая карточка
+	CompliancePermit        = "permit"         // разрешения (oversize, штатовые)
+	ComplianceIFTA          = "ifta"           // лицензия и наклейки IFTA
+	ComplianceUCR           = "ucr"            // регистрация UCR
+	ComplianceOther         = "other"
+)
+
+// Статусы документов соответствия
+const (
+	ComplianceValid    = "valid"
+	ComplianceExpiring = "expiring"
+	ComplianceExpired  = "expired"
+)
+
+// DefaultComplianceWarningDays — за сколько дней до окончания документ считается истекающим
+const DefaultComplianceWarningDays = 30
+
+// ComplianceAlertThresholds — пороги напоминаний в днях до окончания
+var ComplianceAlertThresholds = []int{30, 14, 7, 1}
+
+// ComplianceExpiredThreshold — порог напоминания для истекшего документа
+const ComplianceExpiredThreshold = -1
+
+// IsValidComplianceType проверяет тип документа соответствия
+func IsValidComplianceType(itemType string) bool {
+	switch itemType {
+	case ComplianceRegistration, ComplianceDOTInspection, ComplianceInsurance, CompliancePermit,
+		ComplianceIFTA, ComplianceUCR, ComplianceOther:
+		return true
+	}
+	return false
+}
+
+// DaysUntil возвращает число календарных дней от asOf до даты (отрицательное — дата прошла)
+func DaysUntil(date, asOf time.Time) int {
+	from := time.Date(asOf.Year(), asOf.Month(), asOf.Day(), 0, 0, 0, 0, time.UTC)
+	to := time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, time.UTC)
+	return int(math.Round(to.Sub(from).Hours() / 24))
+}
+
+// ComplianceStatus возвращает статус документа и число дней до окончания.
+// Документ действует по день окончания включительно.
+func ComplianceStatus(expiryDate, asOf time.Time, warningDays int) (string, int) {
+	days := DaysUntil(expiryDate, asOf)
+	if warningDays <= 0 {
+		warningDays = DefaultComplianceWarningDays
+	}
+
+	switch {
+	case days < 0:
+		return ComplianceExpired, days
+	case days <= warningDays:
+		return ComplianceExpiring, days
+	}
+	return ComplianceValid, days
+}
+
+// ComplianceAlertThreshold возвращает ближайший пройденный порог напоминания
+// и false, если до окончания больше максимального порога
+func ComplianceAlertThreshold(daysRemaining int) (int, bool) {
+	if daysRemaining < 0 {
+		return ComplianceExpiredThreshold, true
+	}
+
+	threshold, found := 0, false
+	for _, t := range ComplianceAlertThresholds {
+		if daysRemaining <= t && (!found || t < threshold) {
+			threshold, found = t, true
+		}
+	}
+	return threshold, found
+}
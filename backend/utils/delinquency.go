@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"math"
+	"time"
+)
+
+// Статусы просрочки кредита
+const (
+	DelinquencyCurrent    = "current"
+	DelinquencyLate       = "late"
+	DelinquencyDelinquent = "delinquent"
+	DelinquencyDefault    = "default"
+)
+
+// Типы штрафа за просрочку
+const (
+	LateFeeFlat    = "flat"
+	LateFeePercent = "percent"
+)
+
+// DefaultGracePeriodDays — льготный период по умолчанию
+const DefaultGracePeriodDays = 10
+
+// PaymentRecord — фактический платеж для сравнения с графиком
+type PaymentRecord struct {
+	Date   time.Time
+	Amount float64
+}
+
+// LateInstallment — взнос, не оплаченный до конца льготного периода
+type LateInstallment struct {
+	Number  int       `json:"installment_number"`
+	DueDate time.Time `json:"due_date"`
+}
+
+// DelinquencyResult — состояние кредита относительно графика платежей на дату
+type DelinquencyResult struct {
+	Status           string            `json:"status"`
+	DaysPastDue      int               `json:"days_past_due"`
+	PastDueAmount    float64           `json:"past_due_amount"`
+	OldestUnpaidDate time.Time         `json:"oldest_unpaid_date,omitempty"`
+	LateInstallments []LateInstallment `json:"late_installments"`
+}
+
+// InstallmentDueDate возвращает дату n-го взноса (нумерация с 1, первый взнос в дату начала)
+func InstallmentDueDate(startDate time.Time, n int) time.Time {
+	return startDate.AddDate(0, n-1, 0)
+}
+
+// ScheduledInstallment — взнос графика кредита
+type ScheduledInstallment struct {
+	DueDate time.Time
+	Amount  float64
+}
+
+// InstallmentChange — новый размер взноса после рекаста: действует для взносов со сроком позже From
+type InstallmentChange struct {
+	From        time.Time
+	Installment float64
+}
+
+// DueSchedule строит график взносов по фактической амортизации кредита: размер взноса меняется
+// после каждого рекаста, а последний взнос включает balloon-платеж
+func DueSchedule(startDate time.Time, termMonths int, installment, balloon float64, changes []InstallmentChange) []ScheduledInstallment {
+	schedule := make([]ScheduledInstallment, 0, termMonths)
+	for n := 1; n <= termMonths; n++ {
+		dueDate := InstallmentDueDate(startDate, n)
+		amount := installment
+		for _, change := range changes {
+			if dueDate.After(change.From) {
+				amount = change.Installment
+			}
+		}
+		if n == termMonths {
+			amount += balloon
+		}
+		schedule = append(schedule, ScheduledInstallment{DueDate: dueDate, Amount: amount})
+	}
+	return schedule
+}
+
+// EvaluateDelinquency сравнивает график взносов с фактическими платежами на дату asOf.
+// Платежи распределяются на самые ранние взносы; взнос считается просроченным,
+// если к концу льготного периода сумма платежей не покрыла его полностью.
+func EvaluateDelinquency(schedule []ScheduledInstallment, payments []PaymentRecord, graceDays int, asOf time.Time) DelinquencyResult {
+	result := DelinquencyResult{Status: DelinquencyCurrent}
+
+	paidBy := func(date time.Time) float64 {
+		total := 0.0
+		for _, p := range payments {
+			if !p.Date.After(date) {
+				total += p.Amount
+			}
+		}
+		return total
+	}
+
+	totalPaid := paidBy(asOf)
+	const tolerance = 0.01
+
+	required := 0.0
+	for i, installment := range schedule {
+		n := i + 1
+		dueDate := installment.DueDate
+		if dueDate.After(asOf) {
+			break
+		}
+		required += installment.Amount
+
+		// Взнос просрочен, если не покрыт к концу льготного периода
+		graceEnd := dueDate.AddDate(0, 0, graceDays)
+		if graceEnd.Before(asOf) && paidBy(graceEnd)+tolerance < required {
+			result.LateInstallments = append(result.LateInstallments, LateInstallment{Number: n, DueDate: dueDate})
+		}
+
+		// Текущая задолженность по графику
+		if totalPaid+tolerance < required {
+			if result.OldestUnpaidDate.IsZero() {
+				result.OldestUnpaidDate = dueDate
+			}
+			result.PastDueAmount = required - totalPaid
+		}
+	}
+
+	result.PastDueAmount = math.Round(result.PastDueAmount*100) / 100
+	if !result.OldestUnpaidDate.IsZero() {
+		result.DaysPastDue = int(asOf.Sub(result.OldestUnpaidDate).Hours() / 24)
+	}
+
+	switch {
+	case result.DaysPastDue <= graceDays:
+		result.Status = DelinquencyCurrent
+	case result.DaysPastDue < 30:
+		result.Status = DelinquencyLate
+	case result.DaysPastDue < 90:
+		result.Status = DelinquencyDelinquent
+	default:
+		result.Status = DelinquencyDefault
+	}
+
+	return result
+}
+
+// CalculateLateFee рассчитывает штраф за просроченный взнос
+func CalculateLateFee(feeType string, feeAmount, installment float64) float64 {
+	if feeType == LateFeePercent {
+		return math.Round(installment*feeAmount/100*100) / 100
+	}
+	return math.Round(feeAmount*100) / 100
+}
+
+// AgingBuckets — интервалы отчетов по возрасту задолженности в порядке вывода
+var AgingBuckets = []string{"current", "1-29", "30-59", "60-89", "90+"}
+
+// AgingBucket возвращает интервал просрочки для отчета по возрасту задолженности.
+// Просрочка в пределах льготного периода считается текущей, сверх него интервал
+// определяется по полному числу дней просрочки.
+func AgingBucket(daysPastDue, graceDays int) string {
+	switch {
+	case daysPastDue <= 0 || daysPastDue <= graceDays:
+		return "current"
+	case daysPastDue < 30:
+		return "1-29"
+	case daysPastDue < 60:
+		return "30-59"
+	case daysPastDue < 90:
+		return "60-89"
+	default:
+		return "90+"
+	}
+}
@@ -0,0 +1,79 @@
+package utils
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAgingBucket(t *testing.T) {
+	tests := []struct {
+		name        string
+		daysPastDue int
+		graceDays   int
+		want        string
+	}{
+		{"платеж без просрочки", 0, 10, "current"},
+		{"просрочка в пределах льготного периода", 5, 10, "current"},
+		{"последний день льготного периода", 10, 10, "current"},
+		{"сразу после льготного периода", 11, 10, "1-29"},
+		{"льготные дни не вычитаются из просрочки", 35, 10, "30-59"},
+		{"без льготного периода", 1, 0, "1-29"},
+		{"граница 60 дней", 60, 10, "60-89"},
+		{"граница 90 дней", 90, 10, "90+"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AgingBucket(tt.daysPastDue, tt.graceDays); got != tt.want {
+				t.Errorf("AgingBucket(%d, %d) = %q, want %q", tt.daysPastDue, tt.graceDays, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateDelinquency(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	recast := []InstallmentChange{{From: time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC), Installment: 60}}
+
+	tests := []struct {
+		name       string
+		schedule   []ScheduledInstallment
+		payments   []PaymentRecord
+		asOf       time.Time
+		wantStatus string
+		wantDue    float64
+	}{
+		{
+			name:     "после рекаста требуется уменьшенный взнос",
+			schedule: DueSchedule(start, 6, 100, 0, recast),
+			payments: []PaymentRecord{
+				{Date: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), Amount: 100},
+				{Date: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), Amount: 100},
+				{Date: time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), Amount: 60},
+				{Date: time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), Amount: 60},
+			},
+			asOf:       time.Date(2024, 4, 20, 0, 0, 0, 0, time.UTC),
+			wantStatus: DelinquencyCurrent,
+		},
+		{
+			name:       "balloon входит в последний взнос",
+			schedule:   DueSchedule(start, 3, 100, 500, nil),
+			payments:   []PaymentRecord{{Date: start, Amount: 100}, {Date: start.AddDate(0, 1, 0), Amount: 100}, {Date: start.AddDate(0, 2, 0), Amount: 100}},
+			asOf:       start.AddDate(0, 2, 15),
+			wantStatus: DelinquencyLate,
+			wantDue:    500,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := EvaluateDelinquency(tt.schedule, tt.payments, 10, tt.asOf)
+			if result.Status != tt.wantStatus {
+				t.Errorf("Status = %q, want %q", result.Status, tt.wantStatus)
+			}
+			if result.PastDueAmount != tt.wantDue {
+				t.Errorf("PastDueAmount = %.2f, want %.2f", result.PastDueAmount, tt.wantDue)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package utils
+
+import "math"
+
+// Методы амортизации транспорта
+const (
+	DepreciationStraightLine      = "straight_line"
+	DepreciationDecliningBalance  = "declining_balance"
+	DepreciationDoubleDeclining   = "double_declining"
+	DepreciationSumOfYearsDigits  = "sum_of_years_digits"
+	DepreciationUnitsOfProduction = "units_of_production"
+	DecliningBalanceFactor        = 1.5
+	DoubleDecliningBalanceFactor  = 2.0
+	DefaultTruckUsefulLifeYears   = 10
+	DefaultTrailerUsefulLifeYears = 15
+	DefaultDepreciationMethod     = DepreciationStraightLine
+)
+
+// IsValidDepreciationMethod проверяет что метод амортизации поддерживается
+func IsValidDepreciationMethod(method string) bool {
+	switch method {
+	case DepreciationStraightLine, DepreciationDecliningBalance, DepreciationDoubleDeclining,
+		DepreciationSumOfYearsDigits, DepreciationUnitsOfProduction:
+		return true
+	}
+	return false
+}
+
+// DepreciationParams — параметры амортизации актива.
+// Для units_of_production задаются ожидаемый пробег за весь срок, пробег в год и фактический пробег.
+type DepreciationParams struct {
+	Method          string
+	Cost            float64
+	SalvageValue    float64
+	UsefulLifeYears int
+	LifetimeUnits   float64
+	AnnualUnits     float64
+	UnitsUsed       float64
+}
+
+// DepreciationYear — строка годового графика амортизации
+type DepreciationYear struct {
+	Year           int     `json:"year"`
+	BeginningValue float64 `json:"beginning_value"`
+	Depreciation   float64 `json:"depreciation"`
+	Accumulated    float64 `json:"accumulated"`
+	EndingValue    float64 `json:"ending_value"`
+}
+
+// DepreciationResult — накопленная амортизация на дату и полный годовой график
+type DepreciationResult struct {
+	Accumulated  float64            `json:"accumulated"`
+	CurrentValue float64            `json:"current_value"`
+	Schedule     []DepreciationYear `json:"schedule"`
+}
+
+// DepreciationSchedule строит годовой график амортизации по выбранному методу.
+// Балансовая стоимость не опускается ниже ликвидационной.
+func DepreciationSchedule(params DepreciationParams) []DepreciationYear {
+	depreciable := params.Cost - params.SalvageValue
+	if depreciable <= 0 || params.UsefulLifeYears <= 0 {
+		return []DepreciationYear{}
+	}
+
+	life := params.UsefulLifeYears
+	if params.Method == DepreciationUnitsOfProduction && params.LifetimeUnits > 0 && params.AnnualUnits > 0 {
+		life = int(math.Ceil(params.LifetimeUnits / params.AnnualUnits))
+	}
+
+	schedule := make([]DepreciationYear, 0, life)
+	bookValue := params.Cost
+	accumulated := 0.0
+	sumOfYears := float64(life*(life+1)) / 2
+
+	for year := 1; year <= life; year++ {
+		remainingYears := float64(life - year + 1)
+		straightLine := (bookValue - params.SalvageValue) / remainingYears
+
+		var amount float64
+		switch params.Method {
+		case DepreciationDecliningBalance, DepreciationDoubleDeclining:
+			factor := DecliningBalanceFactor
+			if params.Method == DepreciationDoubleDeclining {
+				factor = DoubleDecliningBalanceFactor
+			}
+			// Переход на прямолинейный метод, когда он дает большую сумму
+			amount = math.Max(bookValue*factor/float64(params.UsefulLifeYears), straightLine)
+		case DepreciationSumOfYearsDigits:
+			amount = depreciable * remainingYears / sumOfYears
+		case DepreciationUnitsOfProduction:
+			// Без ожидаемого годового пробега график строится прямолинейно
+			if params.LifetimeUnits <= 0 || params.AnnualUnits <= 0 {
+				amount = straightLine
+			} else {
+				amount = depreciable * params.AnnualUnits / params.LifetimeUnits
+			}
+		default:
+			amount = depreciable / float64(life)
+		}
+
+		if year == life || amount > bookValue-params.SalvageValue {
+			amount = bookValue - params.SalvageValue
+		}
+		amount = math.Round(amount*100) / 100
+
+		beginning := bookValue
+		bookValue -= amount
+		accumulated += amount
+		schedule = append(schedule, DepreciationYear{
+			Year:           year,
+			BeginningValue: math.Round(beginning*100) / 100,
+			Depreciation:   amount,
+			Accumulated:    math.Round(accumulated*100) / 100,
+			EndingValue:    math.Round(bookValue*100) / 100,
+		})
+	}
+
+	return schedule
+}
+
+// CalculateDepreciation рассчитывает накопленную амортизацию на возраст актива и возвращает годовой график.
+// Внутри года амортизация начисляется пропорционально прошедшей части года,
+// для units_of_production — пропорционально фактическому пробегу.
+func CalculateDepreciation(params DepreciationParams, ageInYears float64) DepreciationResult {
+	result := DepreciationResult{
+		CurrentValue: params.Cost,
+		Schedule:     DepreciationSchedule(params),
+	}
+	if ageInYears < 0 {
+		ageInYears = 0
+	}
+
+	depreciable := params.Cost - params.SalvageValue
+	if depreciable <= 0 {
+		return result
+	}
+
+	if params.Method == DepreciationUnitsOfProduction && params.LifetimeUnits > 0 {
+		result.Accumulated = depreciable * math.Min(params.UnitsUsed/params.LifetimeUnits, 1)
+	} else {
+		fullYears := int(ageInYears)
+		for _, year := range result.Schedule {
+			if year.Year <= fullYears {
+				result.Accumulated = year.Accumulated
+			} else if year.Year == fullYears+1 {
+				result.Accumulated += year.Depreciation * (ageInYears - float64(fullYears))
+				break
+			}
+		}
+	}
+
+	result.Accumulated = math.Round(result.Accumulated*100) / 100
+	result.CurrentValue = math.Round((params.Cost-result.Accumulated)*100) / 100
+	return result
+}
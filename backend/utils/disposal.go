@@ -0,0 +1,43 @@
+package utils
+
+import "math"
+
+// Виды выбытия транспорта
+const (
+	DisposalSale    = "sale"
+	DisposalTradeIn = "trade_in"
+	DisposalScrap   = "scrap"
+)
+
+// IsValidDisposalType проверяет вид выбытия
+func IsValidDisposalType(disposalType string) bool {
+	return disposalType == DisposalSale || disposalType == DisposalTradeIn || disposalType == DisposalScrap
+}
+
+// DisposalGainLoss — результат выбытия актива в балансовом и налоговом учете
+type DisposalGainLoss struct {
+	AmountRealized        float64 `json:"amount_realized"`
+	BookValue             float64 `json:"book_value"`
+	BookGainLoss          float64 `json:"book_gain_loss"`
+	TaxBasis              float64 `json:"tax_basis"`
+	TaxGainLoss           float64 `json:"tax_gain_loss"`
+	DepreciationRecapture float64 `json:"depreciation_recapture"`
+}
+
+// CalculateDisposalGainLoss рассчитывает прибыль или убыток от выбытия.
+// Выручка = цена продажи + зачет при trade-in − расходы на продажу.
+// Налоговая прибыль в пределах накопленной налоговой амортизации — восстановление по Section 1245.
+func CalculateDisposalGainLoss(salePrice, tradeInCredit, sellingExpenses, bookValue, taxBasis, taxAccumulated float64) DisposalGainLoss {
+	realized := salePrice + tradeInCredit - sellingExpenses
+	result := DisposalGainLoss{
+		AmountRealized: math.Round(realized*100) / 100,
+		BookValue:      math.Round(bookValue*100) / 100,
+		BookGainLoss:   math.Round((realized-bookValue)*100) / 100,
+		TaxBasis:       math.Round(taxBasis*100) / 100,
+		TaxGainLoss:    math.Round((realized-taxBasis)*100) / 100,
+	}
+	if result.TaxGainLoss > 0 {
+		result.DepreciationRecapture = math.Round(math.Min(result.TaxGainLoss, taxAccumulated)*100) / 100
+	}
+	return result
+}
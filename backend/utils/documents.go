@@ -0,0 +1,62 @@
+package utils
+
+// Записи, к которым можно приложить документ
+const (
+	DocumentEntityCompany            = "company"
+	DocumentEntityVehicle            = "vehicle"
+	DocumentEntityLoan               = "loan"
+	DocumentEntityLease              = "lease"
+	DocumentEntityPayment            = "payment"
+	DocumentEntityComplianceItem     = "compliance_item"
+	DocumentEntityWorkOrder          = "work_order"
+	DocumentEntityCapitalImprovement = "capital_improvement"
+	DocumentEntityDriver             = "driver"
+)
+
+// Категории документов
+const (
+	DocumentLoanContract = "loan_contract"
+	DocumentTitle        = "title"
+	DocumentBillOfSale   = "bill_of_sale"
+	DocumentInvoice      = "invoice"
+	DocumentRegistration = "registration"
+	DocumentInsurance    = "insurance"
+	DocumentInspection   = "inspection"
+	DocumentReceipt      = "receipt"
+	DocumentOther        = "other"
+)
+
+// DefaultDocumentMaxSize — максимальный размер загружаемого файла по умолчанию (10 МБ)
+const DefaultDocumentMaxSize = 10 << 20
+
+// AllowedDocumentTypes — допустимые типы содержимого, определяемые по сигнатуре файла
+var AllowedDocumentTypes = map[string]bool{
+	"application/pdf": true,
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+}
+
+// IsValidDocumentCategory проверяет категорию документа
+func IsValidDocumentCategory(category string) bool {
+	switch category {
+	case DocumentLoanContract, DocumentTitle, DocumentBillOfSale, DocumentInvoice, DocumentRegistration,
+		DocumentInsurance, DocumentInspection, DocumentReceipt, DocumentOther:
+		return true
+	}
+	return false
+}
+
+// DocumentEntityCollections — коллекции записей, к которым прикладываются документы
+var DocumentEntityCollections = map[string]string{
+	DocumentEntityCompany:            "companies",
+	DocumentEntityVehicle:            "vehicles",
+	DocumentEntityLoan:               "loans",
+	DocumentEntityLease:              "leases",
+	DocumentEntityPayment:            "payments",
+	DocumentEntityComplianceItem:     "compliance_items",
+	DocumentEntityWorkOrder:          "work_orders",
+	DocumentEntityCapitalImprovement: "capital_improvements",
+	DocumentEntityDriver:             "drivers",
+}
@@ -0,0 +1,62 @@
+package utils
+
+import "time"
+
+// Статусы водителей
+const (
+	DriverActive     = "active"
+	DriverInactive   = "inactive"
+	DriverTerminated = "terminated"
+)
+
+// Виды оплаты водителей
+const (
+	PayPerMile = "per_mile"
+	PayPercent = "percentage"
+	PayHourly  = "hourly"
+	PaySalary  = "salary"
+	PayPerLoad = "per_load"
+)
+
+// IsValidDriverStatus проверяет статус водителя
+func IsValidDriverStatus(status string) bool {
+	switch status {
+	case DriverActive, DriverInactive, DriverTerminated:
+		return true
+	}
+	return false
+}
+
+// IsValidPayType проверяет вид оплаты водителя
+func IsValidPayType(payType string) bool {
+	switch payType {
+	case PayPerMile, PayPercent, PayHourly, PaySalary, PayPerLoad:
+		return true
+	}
+	return false
+}
+
+// IsValidCDLClass проверяет класс водительского удостоверения CDL
+func IsValidCDLClass(class string) bool {
+	switch class {
+	case "A", "B", "C":
+		return true
+	}
+	return false
+}
+
+// PeriodsOverlap проверяет пересечение периодов [start, end); nil в конце — период не закрыт
+func PeriodsOverlap(start1 time.Time, end1 *time.Time, start2 time.Time, end2 *time.Time) bool {
+	if end1 != nil && !end1.After(start2) {
+		return false
+	}
+	if end2 != nil && !end2.After(start1) {
+		return false
+	}
+	return true
+}
+
+// PeriodContains проверяет, что дата попадает в период [start, end)
+func PeriodContains(start time.Time, end *time.Time, date time.Time) bool {
+	return !date.Before(start) && (end == nil || date.Before(*end))
+}
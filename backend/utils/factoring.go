@@ -0,0 +1,38 @@
+package utils
+
+import "math"
+
+// Статусы факторинга счета
+const (
+	FactoringFunded      = "funded"
+	FactoringCollected   = "collected"
+	FactoringReleased    = "released"
+	FactoringChargedBack = "charged_back"
+)
+
+// DefaultRecourseDays — срок, после которого неоплаченный счет возвращается перевозчику по регрессу
+const DefaultRecourseDays = 90
+
+// FactoringAdvance делит сумму счета на аванс (по ставке аванса, %) и резерв, удерживаемый фактором до оплаты
+func FactoringAdvance(faceAmount, advanceRate float64) (float64, float64) {
+	advance := math.Round(faceAmount*advanceRate/100*100) / 100
+	return advance, math.Round((faceAmount-advance)*100) / 100
+}
+
+// FactoringFeePercent возвращает комиссию фактора в процентах от суммы счета за days дней финансирования:
+// базовая ставка покрывает первые feeDays дней, далее за каждый начатый период additionalDays
+// добавляется additionalPercent
+func FactoringFeePercent(feePercent float64, feeDays int, additionalPercent float64, additionalDays, days int) float64 {
+	percent := feePercent
+	if additionalPercent > 0 && additionalDays > 0 && days > feeDays {
+		periods := (days - feeDays + additionalDays - 1) / additionalDays
+		percent += additionalPercent * float64(periods)
+	}
+	return percent
+}
+
+// FactoringFee рассчитывает комиссию фактора в деньгах
+func FactoringFee(faceAmount, feePercent float64, feeDays int, additionalPercent float64, additionalDays, days int) float64 {
+	percent := FactoringFeePercent(feePercent, feeDays, additionalPercent, additionalDays, days)
+	return math.Round(faceAmount*percent/100*100) / 100
+}
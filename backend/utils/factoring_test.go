@@ -0,0 +1,51 @@
+package utils
+
+import "testing"
+
+func TestFactoringFee(t *testing.T) {
+	tests := []struct {
+		name              string
+		faceAmount        float64
+		feePercent        float64
+		feeDays           int
+		additionalPercent float64
+		additionalDays    int
+		days              int
+		want              float64
+	}{
+		{
+			name:       "в пределах базового срока — только базовая ставка",
+			faceAmount: 3000, feePercent: 3, feeDays: 30, additionalPercent: 1, additionalDays: 15, days: 30,
+			want: 90,
+		},
+		{
+			name:       "начатый дополнительный период считается целиком",
+			faceAmount: 3000, feePercent: 3, feeDays: 30, additionalPercent: 1, additionalDays: 15, days: 31,
+			want: 120,
+		},
+		{
+			name:       "несколько дополнительных периодов",
+			faceAmount: 3000, feePercent: 3, feeDays: 30, additionalPercent: 1, additionalDays: 15, days: 46,
+			want: 150,
+		},
+		{
+			name:       "без дополнительной ставки комиссия не растет",
+			faceAmount: 2500, feePercent: 2.5, feeDays: 30, days: 90,
+			want: 62.5,
+		},
+		{
+			name:       "округление до центов",
+			faceAmount: 1234.56, feePercent: 1.75, feeDays: 0, days: 0,
+			want: 21.6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := FactoringFee(tt.faceAmount, tt.feePercent, tt.feeDays, tt.additionalPercent, tt.additionalDays, tt.days)
+			if got != tt.want {
+				t.Errorf("FactoringFee() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -18,22 +18,6 @@ func CalculateMonthlyPayment(principal float64, annualRate float64, termMonths i
 	return math.Round(payment*100) / 100
 }
 
-// CalculateDepreciation рассчитывает амортизацию по прямолинейному методу
-func CalculateDepreciation(purchasePrice float64, usefulLifeYears int, ageInYears float64) float64 {
-	if usefulLifeYears <= 0 {
-		return 0
-	}
-
-	annualDepreciation := purchasePrice / float64(usefulLifeYears)
-	totalDepreciation := annualDepreciation * ageInYears
-
-	if totalDepreciation > purchasePrice {
-		return purchasePrice
-	}
-
-	return math.Round(totalDepreciation*100) / 100
-}
-
 // CalculateRemainingBalance рассчитывает остаток по кредиту после платежа
 func CalculateRemainingBalance(currentBalance, principalPaid float64) float64 {
 	remaining := currentBalance - principalPaid
@@ -49,10 +33,110 @@ func CalculateInterestPayment(balance float64, annualRate float64) float64 {
 	return math.Round(balance*monthlyRate*100) / 100
 }
 
+// Конвенции подсчета дней для начисления процентов
+const (
+	DayCount30360     = "30/360"
+	DayCountActual365 = "actual/365"
+	DayCountActual360 = "actual/360"
+)
+
+// IsValidDayCount проверяет что конвенция подсчета дней поддерживается
+func IsValidDayCount(convention string) bool {
+	switch convention {
+	case DayCount30360, DayCountActual365, DayCountActual360:
+		return true
+	}
+	return false
+}
+
+// DaysBetween возвращает количество дней между датами по выбранной конвенции.
+// Для 30/360 используется правило US (Bond Basis), для actual-конвенций — календарные дни.
+func DaysBetween(convention string, from, to time.Time) int {
+	if !to.After(from) {
+		return 0
+	}
+
+	if convention == DayCount30360 {
+		y1, m1, d1 := from.Date()
+		y2, m2, d2 := to.Date()
+		if d1 == 31 {
+			d1 = 30
+		}
+		if d2 == 31 && d1 == 30 {
+			d2 = 30
+		}
+		return (y2-y1)*360 + (int(m2)-int(m1))*30 + (d2 - d1)
+	}
+
+	fromDay := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	toDay := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(toDay.Sub(fromDay).Hours() / 24)
+}
+
+// daysInYear возвращает базу года для конвенции
+func daysInYear(convention string) float64 {
+	if convention == DayCountActual365 {
+		return 365
+	}
+	return 360
+}
+
+// CalculatePerDiem рассчитывает дневные проценты на остаток долга
+func CalculatePerDiem(balance float64, annualRate float64, convention string) float64 {
+	perDiem := balance * annualRate / 100 / daysInYear(convention)
+	return math.Round(perDiem*10000) / 10000
+}
+
+// CalculateAccruedInterest рассчитывает проценты, начисленные на остаток между двумя датами
+func CalculateAccruedInterest(balance float64, annualRate float64, convention string, from, to time.Time) float64 {
+	days := DaysBetween(convention, from, to)
+	interest := balance * annualRate / 100 * float64(days) / daysInYear(convention)
+	return math.Round(interest*100) / 100
+}
+
+// PayoffAmounts описывает сумму полного погашения кредита на дату
+type PayoffAmounts struct {
+	Principal       float64 `json:"principal"`
+	AccruedInterest float64 `json:"accrued_interest"`
+	DaysAccrued     int     `json:"days_accrued"`
+	PerDiem         float64 `json:"per_diem"`
+	Fees            float64 `json:"fees"`
+	Total           float64 `json:"total"`
+}
+
+// CalculatePayoff рассчитывает сумму погашения: остаток, проценты с даты последнего платежа и комиссии
+func CalculatePayoff(balance, annualRate float64, convention string, accrualStart, payoffDate time.Time, fees float64) PayoffAmounts {
+	payoff := PayoffAmounts{
+		Principal:       math.Round(balance*100) / 100,
+		AccruedInterest: CalculateAccruedInterest(balance, annualRate, convention, accrualStart, payoffDate),
+		DaysAccrued:     DaysBetween(convention, accrualStart, payoffDate),
+		PerDiem:         CalculatePerDiem(balance, annualRate, convention),
+		Fees:            math.Round(fees*100) / 100,
+	}
+	payoff.Total = math.Round((payoff.Principal+payoff.AccruedInterest+payoff.Fees)*100) / 100
+	return payoff
+}
+
+// MonthsBetween возвращает количество полных месяцев между датами
+func MonthsBetween(from, to time.Time) int {
+	months := (to.Year()-from.Year())*12 + int(to.Month()) - int(from.Month())
+	if to.Day() < from.Day() {
+		months--
+	}
+	if months < 0 {
+		return 0
+	}
+	return months
+}
+
 // CalculateVehicleAge рассчитывает возраст транспорта в годах
 func CalculateVehicleAge(purchaseDate time.Time) float64 {
-	now := time.Now()
-	duration := now.Sub(purchaseDate)
+	return CalculateVehicleAgeAt(purchaseDate, time.Now())
+}
+
+// CalculateVehicleAgeAt рассчитывает возраст транспорта в годах на дату
+func CalculateVehicleAgeAt(purchaseDate, asOf time.Time) float64 {
+	duration := asOf.Sub(purchaseDate)
 	years := duration.Hours() / 24 / 365.25
 	return math.Round(years*100) / 100
 }
@@ -0,0 +1,207 @@
+package utils
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Виды топлива
+const (
+	FuelDiesel   = "diesel"
+	FuelGasoline = "gasoline"
+	FuelDEF      = "def"    // жидкость DEF (AdBlue)
+	FuelReefer   = "reefer" // дизель для рефустановки, не облагается IFTA
+	FuelOther    = "other"
+)
+
+// Признаки подозрительных заправок
+const (
+	FuelFlagOverCapacity       = "over_tank_capacity"
+	FuelFlagPriceOutlier       = "price_outlier"
+	FuelFlagAmountMismatch     = "amount_mismatch"
+	FuelFlagOdometerRegression = "odometer_regression"
+	FuelFlagMPGOutlier         = "mpg_outlier"
+	FuelFlagRapidRefuel        = "rapid_refuel"
+)
+
+// DefaultTruckFuelCapacity — емкость баков тягача по умолчанию (два бака по 150 галлонов)
+const DefaultTruckFuelCapacity = 300
+
+// IsValidFuelType проверяет вид топлива
+func IsValidFuelType(fuelType string) bool {
+	switch fuelType {
+	case FuelDiesel, FuelGasoline, FuelDEF, FuelReefer, FuelOther:
+		return true
+	}
+	return false
+}
+
+// IsPropulsionFuel — топливо для движения тягача: учитывается в расходе и в IFTA
+func IsPropulsionFuel(fuelType string) bool {
+	return fuelType == FuelDiesel || fuelType == FuelGasoline
+}
+
+// FuelEntry — заправка для расчета расхода и поиска аномалий
+type FuelEntry struct {
+	ID             string
+	Date           time.Time
+	FuelType       string
+	Gallons        float64
+	PricePerGallon float64
+	TotalCost      float64
+	Odometer       float64
+}
+
+// FuelEconomyInterval — расход между двумя заправками с известным пробегом.
+// Галлоны заправок без показания одометра добавляются к следующему интервалу.
+type FuelEconomyInterval struct {
+	PurchaseID    string  `json:"purchase_id"`
+	FromDate      string  `json:"from_date"`
+	ToDate        string  `json:"to_date"`
+	StartOdometer float64 `json:"start_odometer"`
+	EndOdometer   float64 `json:"end_odometer"`
+	Miles         float64 `json:"miles"`
+	Gallons       float64 `json:"gallons"`
+	MPG           float64 `json:"mpg"`
+}
+
+// FuelAnomalyParams — пороги поиска подозрительных заправок
+type FuelAnomalyParams struct {
+	TankCapacity     float64 // максимальный объем одной заправки, галлоны
+	PriceTolerance   float64 // допустимое отклонение цены от медианы, доля
+	MPGTolerance     float64 // допустимое отклонение расхода от медианы транспорта, доля
+	RapidRefuelHours float64 // повторная заправка раньше этого срока подозрительна
+}
+
+// DefaultFuelAnomalyParams возвращает пороги по умолчанию
+func DefaultFuelAnomalyParams() FuelAnomalyParams {
+	return FuelAnomalyParams{
+		TankCapacity:     DefaultTruckFuelCapacity,
+		PriceTolerance:   0.25,
+		MPGTolerance:     0.4,
+		RapidRefuelHours: 2,
+	}
+}
+
+// Median возвращает медиану значений (0 для пустого списка)
+func Median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+// CalculateFuelEconomy рассчитывает расход (MPG) между заправками одного транспорта методом
+// "полный бак — полный бак". Заправки должны быть отсортированы по дате.
+func CalculateFuelEconomy(entries []FuelEntry) []FuelEconomyInterval {
+	intervals := []FuelEconomyInterval{}
+
+	var lastOdometer, pendingGallons float64
+	var lastDate time.Time
+	for _, entry := range entries {
+		if !IsPropulsionFuel(entry.FuelType) {
+			continue
+		}
+		if entry.Odometer <= 0 {
+			pendingGallons += entry.Gallons
+			continue
+		}
+		if lastOdometer == 0 {
+			// Первая заправка с пробегом — точка отсчета
+			lastOdometer, lastDate, pendingGallons = entry.Odometer, entry.Date, 0
+			continue
+		}
+
+		gallons := pendingGallons + entry.Gallons
+		if entry.Odometer <= lastOdometer {
+			// Пробег не вырос — показание ошибочно, топливо переносится в следующий интервал
+			pendingGallons = gallons
+			continue
+		}
+
+		interval := FuelEconomyInterval{
+			PurchaseID:    entry.ID,
+			FromDate:      lastDate.Format("2006-01-02"),
+			ToDate:        entry.Date.Format("2006-01-02"),
+			StartOdometer: lastOdometer,
+			EndOdometer:   entry.Odometer,
+			Miles:         math.Round(entry.Odometer - lastOdometer),
+			Gallons:       math.Round(gallons*1000) / 1000,
+		}
+		if gallons > 0 {
+			interval.MPG = math.Round((entry.Odometer-lastOdometer)/gallons*100) / 100
+		}
+		intervals = append(intervals, interval)
+
+		lastOdometer, lastDate, pendingGallons = entry.Odometer, entry.Date, 0
+	}
+
+	return intervals
+}
+
+// DetectFuelAnomalies ищет подозрительные заправки одного транспорта: объем больше баков,
+// цена далеко от медианы (medianPrice — по компании за период), сумма не равна объему на цену,
+// пробег меньше предыдущего, расход далеко от медианы транспорта и повторная заправка через короткое время.
+// Заправки должны быть отсортированы по дате. Возвращает признаки по ID заправки.
+func DetectFuelAnomalies(entries []FuelEntry, intervals []FuelEconomyInterval, medianPrice float64, params FuelAnomalyParams) map[string][]string {
+	flags := map[string][]string{}
+	add := func(id, flag string) {
+		flags[id] = append(flags[id], flag)
+	}
+
+	var lastOdometer float64
+	var lastPropulsion *FuelEntry
+	for i := range entries {
+		entry := &entries[i]
+
+		if params.TankCapacity > 0 && IsPropulsionFuel(entry.FuelType) && entry.Gallons > params.TankCapacity {
+			add(entry.ID, FuelFlagOverCapacity)
+		}
+		if medianPrice > 0 && IsPropulsionFuel(entry.FuelType) && entry.PricePerGallon > 0 &&
+			math.Abs(entry.PricePerGallon-medianPrice)/medianPrice > params.PriceTolerance {
+			add(entry.ID, FuelFlagPriceOutlier)
+		}
+		if entry.PricePerGallon > 0 && entry.TotalCost > 0 &&
+			math.Abs(entry.Gallons*entry.PricePerGallon-entry.TotalCost) > math.Max(1, entry.TotalCost*0.01) {
+			add(entry.ID, FuelFlagAmountMismatch)
+		}
+		if entry.Odometer > 0 {
+			if entry.Odometer < lastOdometer {
+				add(entry.ID, FuelFlagOdometerRegression)
+			} else {
+				lastOdometer = entry.Odometer
+			}
+		}
+		if IsPropulsionFuel(entry.FuelType) {
+			if lastPropulsion != nil && params.RapidRefuelHours > 0 &&
+				entry.Date.Sub(lastPropulsion.Date).Hours() < params.RapidRefuelHours {
+				add(entry.ID, FuelFlagRapidRefuel)
+			}
+			lastPropulsion = entry
+		}
+	}
+
+	var mpgValues []float64
+	for _, interval := range intervals {
+		if interval.MPG > 0 {
+			mpgValues = append(mpgValues, interval.MPG)
+		}
+	}
+	if medianMPG := Median(mpgValues); medianMPG > 0 && len(mpgValues) >= 3 {
+		for _, interval := range intervals {
+			if math.Abs(interval.MPG-medianMPG)/medianMPG > params.MPGTolerance {
+				add(interval.PurchaseID, FuelFlagMPGOutlier)
+			}
+		}
+	}
+
+	return flags
+}
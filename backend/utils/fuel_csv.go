@@ -0,0 +1,409 @@
+package utils
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Поля строки выгрузки топливной карты
+const (
+	fuelFieldDate          = "date"
+	fuelFieldTime          = "time"
+	fuelFieldTransactionID = "transaction_id"
+	fuelFieldUnit          = "unit"
+	fuelFieldDriver        = "driver"
+	fuelFieldCard          = "card"
+	fuelFieldMerchant      = "merchant"
+	fuelFieldCity          = "city"
+	fuelFieldState         = "state"
+	fuelFieldOdometer      = "odometer"
+	fuelFieldProduct       = "product"
+	fuelFieldGallons       = "gallons"
+	fuelFieldPrice         = "price"
+	fuelFieldAmount        = "amount"
+)
+
+// FuelCSVProduct — колонки отдельного вида топлива в строке (Comdata выгружает тягач и рефустановку
+// в одной строке)
+type FuelCSVProduct struct {
+	FuelType string
+	Gallons  []string
+	Price    []string
+	Amount   []string
+}
+
+// FuelCSVLayout — формат выгрузки: названия колонок для каждого поля. Для форматов с колонкой
+// продукта вид топлива определяется по коду продукта, иначе — по набору Products.
+type FuelCSVLayout struct {
+	Name     string
+	Columns  map[string][]string
+	Products []FuelCSVProduct
+}
+
+// FuelCSVLayouts — поддерживаемые форматы выгрузок топливных карт
+var FuelCSVLayouts = []FuelCSVLayout{
+	{
+		Name: "efs",
+		Columns: map[string][]string{
+			fuelFieldDate:          {"tran date"},
+			fuelFieldTime:          {"tran time"},
+			fuelFieldTransactionID: {"invoice", "tran id"},
+			fuelFieldUnit:          {"unit"},
+			fuelFieldDriver:        {"driver name"},
+			fuelFieldCard:          {"card #", "card"},
+			fuelFieldMerchant:      {"location name"},
+			fuelFieldCity:          {"city"},
+			fuelFieldState:         {"state/ prov", "state/prov"},
+			fuelFieldOdometer:      {"odometer"},
+			fuelFieldProduct:       {"item"},
+			fuelFieldGallons:       {"qty"},
+			fuelFieldPrice:         {"unit price"},
+			fuelFieldAmount:        {"amt"},
+		},
+	},
+	{
+		Name: "comdata",
+		Columns: map[string][]string{
+			fuelFieldDate:          {"transaction date"},
+			fuelFieldTime:          {"transaction time"},
+			fuelFieldTransactionID: {"transaction number"},
+			fuelFieldUnit:          {"unit number"},
+			fuelFieldDriver:        {"driver name"},
+			fuelFieldCard:          {"card number"},
+			fuelFieldMerchant:      {"truck stop name"},
+			fuelFieldCity:          {"truck stop city"},
+			fuelFieldState:         {"truck stop state"},
+			fuelFieldOdometer:      {"hubometer", "odometer"},
+		},
+		Products: []FuelCSVProduct{
+			{FuelType: FuelDiesel, Gallons: []string{"number of tractor gallons"}, Price: []string{"tractor fuel price per gallon"}, Amount: []string{"cost of tractor fuel"}},
+			{FuelType: FuelReefer, Gallons: []string{"number of reefer gallons"}, Price: []string{"reefer price per gallon"}, Amount: []string{"cost of reefer fuel"}},
+		},
+	},
+	{
+		Name: "wex",
+		Columns: map[string][]string{
+			fuelFieldDate:          {"transaction date"},
+			fuelFieldTime:          {"transaction time"},
+			fuelFieldTransactionID: {"transaction ticket number", "transaction id"},
+			fuelFieldUnit:          {"custom vehicle/asset id", "vehicle number"},
+			fuelFieldDriver:        {"driver last name", "driver name"},
+			fuelFieldCard:          {"card number"},
+			fuelFieldMerchant:      {"merchant name"},
+			fuelFieldCity:          {"merchant city"},
+			fuelFieldState:         {"merchant state/province", "merchant state"},
+			fuelFieldOdometer:      {"current odometer", "odometer"},
+			fuelFieldProduct:       {"product description", "product"},
+			fuelFieldGallons:       {"units"},
+			fuelFieldPrice:         {"unit cost"},
+			fuelFieldAmount:        {"gross cost", "net cost"},
+		},
+	},
+	{
+		Name: "generic",
+		Columns: map[string][]string{
+			fuelFieldDate:          {"date", "purchase_date"},
+			fuelFieldTime:          {"time"},
+			fuelFieldTransactionID: {"transaction_id", "id"},
+			fuelFieldUnit:          {"unit", "unit_number", "truck", "vin"},
+			fuelFieldDriver:        {"driver"},
+			fuelFieldCard:          {"card"},
+			fuelFieldMerchant:      {"merchant", "location"},
+			fuelFieldCity:          {"city"},
+			fuelFieldState:         {"state"},
+			fuelFieldOdometer:      {"odometer"},
+			fuelFieldProduct:       {"fuel_type", "product"},
+			fuelFieldGallons:       {"gallons"},
+			fuelFieldPrice:         {"price_per_gallon", "price"},
+			fuelFieldAmount:        {"total", "total_cost", "amount"},
+		},
+	},
+}
+
+// FuelCSVRow — заправка из выгрузки топливной карты
+type FuelCSVRow struct {
+	Line           int
+	TransactionID  string
+	Date           time.Time
+	Unit           string
+	Driver         string
+	CardNumber     string
+	Merchant       string
+	City           string
+	State          string
+	Odometer       float64
+	FuelType       string
+	Gallons        float64
+	PricePerGallon float64
+	TotalCost      float64
+}
+
+// FuelCSVError — ошибка разбора строки выгрузки
+type FuelCSVError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+// FuelProductType определяет вид топлива по коду продукта из выгрузки
+func FuelProductType(product string) string {
+	code := strings.ToUpper(strings.TrimSpace(product))
+	switch {
+	case code == "":
+		return FuelDiesel
+	case strings.Contains(code, "DEF") || strings.Contains(code, "EXHAUST") || strings.Contains(code, "FLUID") || strings.Contains(code, "ADBLUE"):
+		// Diesel Exhaust Fluid проверяется до дизеля: название содержит DIESEL
+		return FuelDEF
+	case strings.Contains(code, "RFR") || strings.Contains(code, "REEF"):
+		return FuelReefer
+	case strings.Contains(code, "UNL") || strings.Contains(code, "GAS") || strings.Contains(code, "REG"):
+		return FuelGasoline
+	case strings.Contains(code, "DSL") || strings.Contains(code, "DIESEL") || strings.Contains(code, "ULSD") || strings.Contains(code, "ULS"):
+		return FuelDiesel
+	}
+	if IsValidFuelType(strings.ToLower(code)) {
+		return strings.ToLower(code)
+	}
+	return FuelOther
+}
+
+func normalizeHeader(header string) string {
+	return strings.ToLower(strings.Join(strings.Fields(strings.TrimPrefix(header, "\ufeff")), " "))
+}
+
+// findColumn возвращает индекс первой найденной колонки из списка названий или -1
+func findColumn(headers map[string]int, names []string) int {
+	for _, name := range names {
+		if index, ok := headers[name]; ok {
+			return index
+		}
+	}
+	return -1
+}
+
+// detectFuelLayout выбирает формат, у которого найдены дата и объем, с наибольшим числом совпавших колонок
+func detectFuelLayout(headers map[string]int, name string) (*FuelCSVLayout, error) {
+	var best *FuelCSVLayout
+	bestScore := 0
+	for i := range FuelCSVLayouts {
+		layout := &FuelCSVLayouts[i]
+		if name != "" && layout.Name != name {
+			continue
+		}
+		if findColumn(headers, layout.Columns[fuelFieldDate]) < 0 {
+			continue
+		}
+
+		score := 0
+		for _, names := range layout.Columns {
+			if findColumn(headers, names) >= 0 {
+				score++
+			}
+		}
+		hasGallons := findColumn(headers, layout.Columns[fuelFieldGallons]) >= 0
+		for _, product := range layout.Products {
+			if findColumn(headers, product.Gallons) >= 0 {
+				hasGallons = true
+				score++
+			}
+		}
+		if hasGallons && score > bestScore {
+			best, bestScore = layout, score
+		}
+	}
+
+	if best == nil {
+		if name != "" {
+			return nil, fmt.Errorf("файл не соответствует формату %s", name)
+		}
+		return nil, errors.New("не удалось определить формат выгрузки")
+	}
+	return best, nil
+}
+
+func parseFuelNumber(value string) (float64, error) {
+	value = strings.NewReplacer("$", "", ",", "", " ", "").Replace(strings.TrimSpace(value))
+	if value == "" {
+		return 0, nil
+	}
+	// Отрицательные суммы в скобках: (12.50)
+	if strings.HasPrefix(value, "(") && strings.HasSuffix(value, ")") {
+		value = "-" + strings.Trim(value, "()")
+	}
+	return strconv.ParseFloat(value, 64)
+}
+
+var fuelDateFormats = []string{"2006-01-02", "01/02/2006", "1/2/2006", "01/02/06", "1/2/06", "2006/01/02", "01-02-2006"}
+var fuelTimeFormats = []string{"15:04:05", "15:04", "1504", "3:04 PM", "3:04:05 PM"}
+
+func parseFuelDate(dateValue, timeValue string) (time.Time, error) {
+	dateValue = strings.TrimSpace(dateValue)
+	// Дата может содержать время: 2024-03-15 14:22 или 2024-03-15T14:22:00Z
+	if date, err := time.Parse(time.RFC3339, dateValue); err == nil {
+		return date, nil
+	}
+	if fields := strings.Fields(dateValue); len(fields) > 1 && timeValue == "" {
+		dateValue, timeValue = fields[0], strings.Join(fields[1:], " ")
+	}
+
+	for _, format := range fuelDateFormats {
+		date, err := time.Parse(format, dateValue)
+		if err != nil {
+			continue
+		}
+		timeValue = strings.TrimSpace(timeValue)
+		if timeValue == "" {
+			return date, nil
+		}
+		for _, timeFormat := range fuelTimeFormats {
+			if clock, err := time.Parse(timeFormat, timeValue); err == nil {
+				return date.Add(time.Duration(clock.Hour())*time.Hour + time.Duration(clock.Minute())*time.Minute + time.Duration(clock.Second())*time.Second), nil
+			}
+		}
+		return date, nil
+	}
+	return time.Time{}, fmt.Errorf("неверная дата %q", dateValue)
+}
+
+// completeFuelAmounts восстанавливает недостающие цену или сумму по объему
+func completeFuelAmounts(row *FuelCSVRow) {
+	if row.TotalCost == 0 && row.PricePerGallon > 0 {
+		row.TotalCost = math.Round(row.Gallons*row.PricePerGallon*100) / 100
+	}
+	if row.PricePerGallon == 0 && row.TotalCost > 0 && row.Gallons > 0 {
+		row.PricePerGallon = math.Round(row.TotalCost/row.Gallons*1000) / 1000
+	}
+}
+
+// ParseFuelCSV разбирает выгрузку топливной карты. Формат определяется по заголовкам,
+// если layout пуст. Некорректные строки пропускаются и возвращаются как ошибки с номером строки.
+func ParseFuelCSV(r io.Reader, layoutName string) ([]FuelCSVRow, string, []FuelCSVError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	headerRecord, err := reader.Read()
+	if err != nil {
+		return nil, "", nil, errors.New("не удалось прочитать заголовок файла")
+	}
+	headers := map[string]int{}
+	for i, header := range headerRecord {
+		headers[normalizeHeader(header)] = i
+	}
+
+	layout, err := detectFuelLayout(headers, layoutName)
+	if err != nil {
+		return nil, "", nil, err
+	}
+
+	columns := map[string]int{}
+	for field, names := range layout.Columns {
+		columns[field] = findColumn(headers, names)
+	}
+
+	var rows []FuelCSVRow
+	rowErrors := []FuelCSVError{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		line++
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, FuelCSVError{Line: line, Error: "Ошибка чтения строки"})
+			continue
+		}
+
+		value := func(field string) string {
+			index := columns[field]
+			if index < 0 || index >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[index])
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		date, err := parseFuelDate(value(fuelFieldDate), value(fuelFieldTime))
+		if err != nil {
+			rowErrors = append(rowErrors, FuelCSVError{Line: line, Error: err.Error()})
+			continue
+		}
+		odometer, err := parseFuelNumber(value(fuelFieldOdometer))
+		if err != nil {
+			rowErrors = append(rowErrors, FuelCSVError{Line: line, Error: "Неверное показание одометра"})
+			continue
+		}
+
+		base := FuelCSVRow{
+			Line:          line,
+			TransactionID: value(fuelFieldTransactionID),
+			Date:          date,
+			Unit:          value(fuelFieldUnit),
+			Driver:        value(fuelFieldDriver),
+			CardNumber:    value(fuelFieldCard),
+			Merchant:      value(fuelFieldMerchant),
+			City:          value(fuelFieldCity),
+			State:         strings.ToUpper(value(fuelFieldState)),
+			Odometer:      odometer,
+		}
+
+		// Формат с отдельными колонками для каждого вида топлива
+		if len(layout.Products) > 0 {
+			for _, product := range layout.Products {
+				cell := func(names []string) string {
+					index := findColumn(headers, names)
+					if index < 0 || index >= len(record) {
+						return ""
+					}
+					return record[index]
+				}
+				gallons, errGallons := parseFuelNumber(cell(product.Gallons))
+				price, errPrice := parseFuelNumber(cell(product.Price))
+				amount, errAmount := parseFuelNumber(cell(product.Amount))
+				if errGallons != nil || errPrice != nil || errAmount != nil {
+					rowErrors = append(rowErrors, FuelCSVError{Line: line, Error: "Неверный объем, цена или сумма"})
+					continue
+				}
+				if gallons <= 0 {
+					continue
+				}
+				row := base
+				row.FuelType, row.Gallons, row.PricePerGallon, row.TotalCost = product.FuelType, gallons, price, amount
+				if row.TransactionID != "" {
+					row.TransactionID += "-" + product.FuelType
+				}
+				completeFuelAmounts(&row)
+				rows = append(rows, row)
+			}
+			continue
+		}
+
+		gallons, errGallons := parseFuelNumber(value(fuelFieldGallons))
+		price, errPrice := parseFuelNumber(value(fuelFieldPrice))
+		amount, errAmount := parseFuelNumber(value(fuelFieldAmount))
+		if errGallons != nil || errPrice != nil || errAmount != nil {
+			rowErrors = append(rowErrors, FuelCSVError{Line: line, Error: "Неверный объем, цена или сумма"})
+			continue
+		}
+		if gallons <= 0 {
+			rowErrors = append(rowErrors, FuelCSVError{Line: line, Error: "Не указан объем"})
+			continue
+		}
+
+		row := base
+		row.FuelType = FuelProductType(value(fuelFieldProduct))
+		row.Gallons, row.PricePerGallon, row.TotalCost = gallons, price, amount
+		completeFuelAmounts(&row)
+		rows = append(rows, row)
+	}
+
+	return rows, layout.Name, rowErrors, nil
+}
@@ -0,0 +1,34 @@
+package utils
+
+import "testing"
+
+func TestFuelProductType(t *testing.T) {
+	tests := []struct {
+		product string
+		want    string
+	}{
+		{"", FuelDiesel},
+		{"ULSD", FuelDiesel},
+		{"Diesel #2", FuelDiesel},
+		{"DSL", FuelDiesel},
+		{"DEF", FuelDEF},
+		{"DEFD", FuelDEF},
+		{"DIESEL EXHAUST FLUID", FuelDEF},
+		{"Exhaust Fluid Bulk", FuelDEF},
+		{"AdBlue", FuelDEF},
+		{"RFR", FuelReefer},
+		{"Reefer Diesel", FuelReefer},
+		{"UNL", FuelGasoline},
+		{"Regular Gas", FuelGasoline},
+		{"gasoline", FuelGasoline},
+		{"OIL", FuelOther},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.product, func(t *testing.T) {
+			if got := FuelProductType(tt.product); got != tt.want {
+				t.Errorf("FuelProductType(%q) = %q, want %q", tt.product, got, tt.want)
+			}
+		})
+	}
+}
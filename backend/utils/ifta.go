@@ -0,0 +1,320 @@
+package utils
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IFTAJurisdictions — юрисдикции IFTA: штаты США (кроме AK, HI, DC) и провинции Канады
+var IFTAJurisdictions = map[string]string{
+	"AL": "Alabama", "AZ": "Arizona", "AR": "Arkansas", "CA": "California", "CO": "Colorado",
+	"CT": "Connecticut", "DE": "Delaware", "FL": "Florida", "GA": "Georgia", "ID": "Idaho",
+	"IL": "Illinois", "IN": "Indiana", "IA": "Iowa", "KS": "Kansas", "KY": "Kentucky",
+	"LA": "Louisiana", "ME": "Maine", "MD": "Maryland", "MA": "Massachusetts", "MI": "Michigan",
+	"MN": "Minnesota", "MS": "Mississippi", "MO": "Missouri", "MT": "Montana", "NE": "Nebraska",
+	"NV": "Nevada", "NH": "New Hampshire", "NJ": "New Jersey", "NM": "New Mexico", "NY": "New York",
+	"NC": "North Carolina", "ND": "North Dakota", "OH": "Ohio", "OK": "Oklahoma", "OR": "Oregon",
+	"PA": "Pennsylvania", "RI": "Rhode Island", "SC": "South Carolina", "SD": "South Dakota",
+	"TN": "Tennessee", "TX": "Texas", "UT": "Utah", "VT": "Vermont", "VA": "Virginia",
+	"WA": "Washington", "WV": "West Virginia", "WI": "Wisconsin", "WY": "Wyoming",
+	"AB": "Alberta", "BC": "British Columbia", "MB": "Manitoba", "NB": "New Brunswick",
+	"NL": "Newfoundland and Labrador", "NS": "Nova Scotia", "ON": "Ontario", "PE": "Prince Edward Island",
+	"QC": "Quebec", "SK": "Saskatchewan",
+}
+
+// IsIFTAJurisdiction проверяет код юрисдикции
+func IsIFTAJurisdiction(code string) bool {
+	_, ok := IFTAJurisdictions[code]
+	return ok
+}
+
+// ParseQuarter разбирает квартал вида 2024Q1 или 2024-Q1 и возвращает его границы [from, to)
+func ParseQuarter(value string) (time.Time, time.Time, error) {
+	value = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(value), "-", ""))
+	var year, quarter int
+	if _, err := fmt.Sscanf(value, "%4dQ%1d", &year, &quarter); err != nil || quarter < 1 || quarter > 4 || year < 2000 {
+		return time.Time{}, time.Time{}, errors.New("неверный квартал, ожидается YYYYQn")
+	}
+	from := time.Date(year, time.Month((quarter-1)*3+1), 1, 0, 0, 0, 0, time.UTC)
+	return from, from.AddDate(0, 3, 0), nil
+}
+
+// QuarterKey возвращает обозначение квартала даты (2024Q1)
+func QuarterKey(date time.Time) string {
+	return fmt.Sprintf("%dQ%d", date.Year(), (int(date.Month())-1)/3+1)
+}
+
+// IFTARate — ставка налога на топливо юрисдикции за квартал, $/галлон.
+// Surcharge — дополнительный сбор (KY, IN, VA), начисляется на все облагаемые галлоны без зачета.
+type IFTARate struct {
+	Rate      float64
+	Surcharge float64
+}
+
+// IFTAJurisdictionLine — строка декларации по юрисдикции
+type IFTAJurisdictionLine struct {
+	Jurisdiction      string  `json:"jurisdiction"`
+	TotalMiles        float64 `json:"total_miles"`
+	TaxableMiles      float64 `json:"taxable_miles"`
+	TaxableGallons    float64 `json:"taxable_gallons"`
+	TaxPaidGallons    float64 `json:"tax_paid_gallons"`
+	NetTaxableGallons float64 `json:"net_taxable_gallons"`
+	TaxRate           float64 `json:"tax_rate"`
+	Tax               float64 `json:"tax"`
+	SurchargeRate     float64 `json:"surcharge_rate"`
+	Surcharge         float64 `json:"surcharge"`
+	NetTax            float64 `json:"net_tax"`
+	RateMissing       bool    `json:"rate_missing,omitempty"`
+}
+
+// IFTAFuelSummary — расчет IFTA по одному виду топлива
+type IFTAFuelSummary struct {
+	FuelType       string                 `json:"fuel_type"`
+	TotalMiles     float64                `json:"total_miles"`
+	TaxableMiles   float64                `json:"taxable_miles"`
+	TotalGallons   float64                `json:"total_gallons"`
+	FleetMPG       float64                `json:"fleet_mpg"`
+	Jurisdictions  []IFTAJurisdictionLine `json:"jurisdictions"`
+	TotalTax       float64                `json:"total_tax"`
+	TotalSurcharge float64                `json:"total_surcharge"`
+	NetTax         float64                `json:"net_tax"`
+}
+
+// CalculateIFTA рассчитывает декларацию по виду топлива. Средний расход парка (MPG) — все мили,
+// деленные на все купленные галлоны; облагаемые галлоны юрисдикции — ее мили, деленные на MPG.
+// Налог начисляется на разницу облагаемых галлонов и галлонов, купленных в юрисдикции
+// (отрицательный — зачет). taxableMiles — мили без необлагаемых (вне дорог общего пользования).
+func CalculateIFTA(fuelType string, miles, taxableMiles, gallons map[string]float64, rates map[string]IFTARate) IFTAFuelSummary {
+	summary := IFTAFuelSummary{FuelType: fuelType, Jurisdictions: []IFTAJurisdictionLine{}}
+
+	codes := map[string]bool{}
+	for code, value := range miles {
+		summary.TotalMiles += value
+		codes[code] = true
+	}
+	for code, value := range gallons {
+		summary.TotalGallons += value
+		codes[code] = true
+	}
+	summary.TotalMiles = math.Round(summary.TotalMiles)
+	summary.TotalGallons = math.Round(summary.TotalGallons*100) / 100
+	if summary.TotalGallons > 0 {
+		summary.FleetMPG = math.Round(summary.TotalMiles/summary.TotalGallons*100) / 100
+	}
+
+	sorted := make([]string, 0, len(codes))
+	for code := range codes {
+		sorted = append(sorted, code)
+	}
+	sort.Strings(sorted)
+
+	for _, code := range sorted {
+		line := IFTAJurisdictionLine{
+			Jurisdiction:   code,
+			TotalMiles:     math.Round(miles[code]),
+			TaxableMiles:   math.Round(taxableMiles[code]),
+			TaxPaidGallons: math.Round(gallons[code]*100) / 100,
+		}
+		if !IsIFTAJurisdiction(code) {
+			// Пробег и топливо вне IFTA входят в расчет MPG, но налог по ним не декларируется
+			line.TaxableMiles = 0
+			summary.Jurisdictions = append(summary.Jurisdictions, line)
+			continue
+		}
+		if summary.FleetMPG > 0 {
+			line.TaxableGallons = math.Round(line.TaxableMiles/summary.FleetMPG*100) / 100
+		}
+		line.NetTaxableGallons = math.Round((line.TaxableGallons-line.TaxPaidGallons)*100) / 100
+
+		rate, ok := rates[code]
+		if !ok && (line.TaxableGallons != 0 || line.TaxPaidGallons != 0) {
+			line.RateMissing = true
+		}
+		line.TaxRate = rate.Rate
+		line.SurchargeRate = rate.Surcharge
+		line.Tax = math.Round(line.NetTaxableGallons*rate.Rate*100) / 100
+		line.Surcharge = math.Round(line.TaxableGallons*rate.Surcharge*100) / 100
+		line.NetTax = math.Round((line.Tax+line.Surcharge)*100) / 100
+
+		summary.TaxableMiles += line.TaxableMiles
+		summary.TotalTax += line.Tax
+		summary.TotalSurcharge += line.Surcharge
+		summary.Jurisdictions = append(summary.Jurisdictions, line)
+	}
+
+	summary.TotalTax = math.Round(summary.TotalTax*100) / 100
+	summary.TotalSurcharge = math.Round(summary.TotalSurcharge*100) / 100
+	summary.NetTax = math.Round((summary.TotalTax+summary.TotalSurcharge)*100) / 100
+	return summary
+}
+
+// IFTARateCSVRow — ставка из таблицы налоговых ставок
+type IFTARateCSVRow struct {
+	Jurisdiction string
+	FuelType     string
+	Rate         float64
+	Surcharge    float64
+}
+
+// ParseIFTARatesCSV разбирает таблицу ставок: jurisdiction, fuel_type (по умолчанию diesel), rate, surcharge
+func ParseIFTARatesCSV(r io.Reader) ([]IFTARateCSVRow, []FuelCSVError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	headerRecord, err := reader.Read()
+	if err != nil {
+		return nil, nil, errors.New("не удалось прочитать заголовок файла")
+	}
+	headers := map[string]int{}
+	for i, header := range headerRecord {
+		headers[normalizeHeader(header)] = i
+	}
+
+	jurisdictionColumn := findColumn(headers, []string{"jurisdiction", "state", "juris"})
+	fuelColumn := findColumn(headers, []string{"fuel_type", "fuel type", "fuel"})
+	rateColumn := findColumn(headers, []string{"rate", "tax_rate", "tax rate"})
+	surchargeColumn := findColumn(headers, []string{"surcharge", "surcharge_rate", "surcharge rate"})
+	if jurisdictionColumn < 0 || rateColumn < 0 {
+		return nil, nil, errors.New("в файле должны быть колонки jurisdiction и rate")
+	}
+
+	var rows []IFTARateCSVRow
+	rowErrors := []FuelCSVError{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		line++
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, FuelCSVError{Line: line, Error: "Ошибка чтения строки"})
+			continue
+		}
+		value := func(index int) string {
+			if index < 0 || index >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[index])
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		row := IFTARateCSVRow{
+			Jurisdiction: strings.ToUpper(value(jurisdictionColumn)),
+			FuelType:     strings.ToLower(value(fuelColumn)),
+		}
+		if row.FuelType == "" {
+			row.FuelType = FuelDiesel
+		}
+		if !IsIFTAJurisdiction(row.Jurisdiction) {
+			rowErrors = append(rowErrors, FuelCSVError{Line: line, Error: "Неизвестная юрисдикция " + row.Jurisdiction})
+			continue
+		}
+		if !IsPropulsionFuel(row.FuelType) {
+			rowErrors = append(rowErrors, FuelCSVError{Line: line, Error: "Неверный вид топлива"})
+			continue
+		}
+		var errRate, errSurcharge error
+		row.Rate, errRate = parseFuelNumber(value(rateColumn))
+		row.Surcharge, errSurcharge = parseFuelNumber(value(surchargeColumn))
+		if errRate != nil || errSurcharge != nil || row.Rate < 0 || row.Surcharge < 0 {
+			rowErrors = append(rowErrors, FuelCSVError{Line: line, Error: "Неверная ставка"})
+			continue
+		}
+		rows = append(rows, row)
+	}
+
+	return rows, rowErrors, nil
+}
+
+// StateMilesCSVRow — пробег по юрисдикции из выгрузки ELD или путевых листов
+type StateMilesCSVRow struct {
+	Line            int
+	Date            time.Time
+	Unit            string
+	Jurisdiction    string
+	Miles           float64
+	NonTaxableMiles float64
+}
+
+// ParseStateMilesCSV разбирает выгрузку пробега по штатам: date, unit, jurisdiction (state), miles,
+// необязательно non_taxable_miles (мили вне дорог общего пользования)
+func ParseStateMilesCSV(r io.Reader) ([]StateMilesCSVRow, []FuelCSVError, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	headerRecord, err := reader.Read()
+	if err != nil {
+		return nil, nil, errors.New("не удалось прочитать заголовок файла")
+	}
+	headers := map[string]int{}
+	for i, header := range headerRecord {
+		headers[normalizeHeader(header)] = i
+	}
+
+	dateColumn := findColumn(headers, []string{"date", "trip date", "trip_date"})
+	unitColumn := findColumn(headers, []string{"unit", "unit number", "unit_number", "truck", "vehicle"})
+	jurisdictionColumn := findColumn(headers, []string{"jurisdiction", "state", "state/prov", "state/ prov"})
+	milesColumn := findColumn(headers, []string{"miles", "total miles", "total_miles", "distance"})
+	nonTaxableColumn := findColumn(headers, []string{"non taxable miles", "non_taxable_miles", "nontaxable miles", "exempt miles"})
+	if dateColumn < 0 || jurisdictionColumn < 0 || milesColumn < 0 {
+		return nil, nil, errors.New("в файле должны быть колонки date, jurisdiction и miles")
+	}
+
+	var rows []StateMilesCSVRow
+	rowErrors := []FuelCSVError{}
+	line := 1
+	for {
+		record, err := reader.Read()
+		line++
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rowErrors = append(rowErrors, FuelCSVError{Line: line, Error: "Ошибка чтения строки"})
+			continue
+		}
+		value := func(index int) string {
+			if index < 0 || index >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[index])
+		}
+		if strings.TrimSpace(strings.Join(record, "")) == "" {
+			continue
+		}
+
+		date, err := parseFuelDate(value(dateColumn), "")
+		if err != nil {
+			rowErrors = append(rowErrors, FuelCSVError{Line: line, Error: err.Error()})
+			continue
+		}
+		miles, errMiles := parseFuelNumber(value(milesColumn))
+		nonTaxableMiles, errNonTaxable := parseFuelNumber(value(nonTaxableColumn))
+		if errMiles != nil || errNonTaxable != nil || miles <= 0 || nonTaxableMiles < 0 || nonTaxableMiles > miles {
+			rowErrors = append(rowErrors, FuelCSVError{Line: line, Error: "Неверный пробег"})
+			continue
+		}
+
+		rows = append(rows, StateMilesCSVRow{
+			Line:            line,
+			Date:            date,
+			Unit:            value(unitColumn),
+			Jurisdiction:    strings.ToUpper(value(jurisdictionColumn)),
+			Miles:           miles,
+			NonTaxableMiles: nonTaxableMiles,
+		})
+	}
+
+	return rows, rowErrors, nil
+}
@@ -0,0 +1,90 @@
+package utils
+
+import "testing"
+
+func TestCalculateIFTA(t *testing.T) {
+	tests := []struct {
+		name         string
+		miles        map[string]float64
+		taxableMiles map[string]float64
+		gallons      map[string]float64
+		rates        map[string]IFTARate
+		wantMPG      float64
+		wantLines    map[string]IFTAJurisdictionLine
+		wantNetTax   float64
+	}{
+		{
+			name:         "налог по разнице облагаемых и купленных галлонов, зачет по переплате",
+			miles:        map[string]float64{"TX": 1000, "OK": 500},
+			taxableMiles: map[string]float64{"TX": 1000, "OK": 500},
+			gallons:      map[string]float64{"TX": 300},
+			rates:        map[string]IFTARate{"TX": {Rate: 0.2}, "OK": {Rate: 0.19}},
+			wantMPG:      5,
+			wantLines: map[string]IFTAJurisdictionLine{
+				"TX": {TaxableGallons: 200, TaxPaidGallons: 300, NetTaxableGallons: -100, Tax: -20},
+				"OK": {TaxableGallons: 100, NetTaxableGallons: 100, Tax: 19},
+			},
+			wantNetTax: -1,
+		},
+		{
+			name:         "надбавка начисляется на все облагаемые галлоны",
+			miles:        map[string]float64{"KY": 600},
+			taxableMiles: map[string]float64{"KY": 600},
+			gallons:      map[string]float64{"KY": 100},
+			rates:        map[string]IFTARate{"KY": {Rate: 0.25, Surcharge: 0.1}},
+			wantMPG:      6,
+			wantLines: map[string]IFTAJurisdictionLine{
+				"KY": {TaxableGallons: 100, TaxPaidGallons: 100, Surcharge: 10},
+			},
+			wantNetTax: 10,
+		},
+		{
+			name:         "необлагаемые мили входят в MPG, но не в налог",
+			miles:        map[string]float64{"NM": 1200},
+			taxableMiles: map[string]float64{"NM": 600},
+			gallons:      map[string]float64{"NM": 200},
+			rates:        map[string]IFTARate{"NM": {Rate: 0.21}},
+			wantMPG:      6,
+			wantLines: map[string]IFTAJurisdictionLine{
+				"NM": {TaxableGallons: 100, TaxPaidGallons: 200, NetTaxableGallons: -100, Tax: -21},
+			},
+			wantNetTax: -21,
+		},
+		{
+			name:         "пробег вне IFTA учитывается только в MPG",
+			miles:        map[string]float64{"TX": 500, "MX": 500},
+			taxableMiles: map[string]float64{"TX": 500, "MX": 500},
+			gallons:      map[string]float64{"TX": 200},
+			rates:        map[string]IFTARate{"TX": {Rate: 0.2}},
+			wantMPG:      5,
+			wantLines: map[string]IFTAJurisdictionLine{
+				"TX": {TaxableGallons: 100, TaxPaidGallons: 200, NetTaxableGallons: -100, Tax: -20},
+				"MX": {TaxableGallons: 0},
+			},
+			wantNetTax: -20,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			summary := CalculateIFTA(FuelDiesel, tt.miles, tt.taxableMiles, tt.gallons, tt.rates)
+			if summary.FleetMPG != tt.wantMPG {
+				t.Errorf("FleetMPG = %.2f, want %.2f", summary.FleetMPG, tt.wantMPG)
+			}
+			if summary.NetTax != tt.wantNetTax {
+				t.Errorf("NetTax = %.2f, want %.2f", summary.NetTax, tt.wantNetTax)
+			}
+			for _, line := range summary.Jurisdictions {
+				want, ok := tt.wantLines[line.Jurisdiction]
+				if !ok {
+					t.Errorf("unexpected jurisdiction %s", line.Jurisdiction)
+					continue
+				}
+				if line.TaxableGallons != want.TaxableGallons || line.TaxPaidGallons != want.TaxPaidGallons ||
+					line.NetTaxableGallons != want.NetTaxableGallons || line.Tax != want.Tax || line.Surcharge != want.Surcharge {
+					t.Errorf("%s = %+v, want %+v", line.Jurisdiction, line, want)
+				}
+			}
+		})
+	}
+}
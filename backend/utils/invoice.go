@@ -0,0 +1,65 @@
+package utils
+
+import (
+	"fmt"
+	"time"
+)
+
+// Статусы счета
+const (
+	InvoiceDraft   = "draft"
+	InvoiceSent    = "sent"
+	InvoicePaid    = "paid"
+	InvoiceOverdue = "overdue"
+	InvoiceVoid    = "void"
+)
+
+// Способы оплаты счета
+const (
+	InvoicePaymentACH      = "ach"
+	InvoicePaymentCheck    = "check"
+	InvoicePaymentWire     = "wire"
+	InvoicePaymentQuickPay = "quick_pay"
+	InvoicePaymentOther    = "other"
+
+	// Оплата брокера фактору записывается при инкассации факторинга, вручную не вводится
+	InvoicePaymentFactoring = "factoring"
+)
+
+// Настройки счетов по умолчанию
+const (
+	DefaultInvoicePrefix    = "INV-"
+	DefaultInvoiceTermsDays = 30
+)
+
+// IsValidInvoicePaymentMethod проверяет способ оплаты счета
+func IsValidInvoicePaymentMethod(method string) bool {
+	switch method {
+	case InvoicePaymentACH, InvoicePaymentCheck, InvoicePaymentWire, InvoicePaymentQuickPay, InvoicePaymentOther:
+		return true
+	}
+	return false
+}
+
+// FormatInvoiceNumber формирует номер счета из префикса компании и порядкового номера
+func FormatInvoiceNumber(prefix string, sequence int) string {
+	return fmt.Sprintf("%s%05d", prefix, sequence)
+}
+
+// InvoiceDaysPastDue возвращает число дней просрочки счета на дату (0, если срок не наступил)
+func InvoiceDaysPastDue(dueDate, asOf time.Time) int {
+	days := -DaysUntil(dueDate, asOf)
+	if days < 0 {
+		return 0
+	}
+	return days
+}
+
+// InvoiceEffectiveStatus возвращает статус счета на дату: отправленный неоплаченный счет
+// после срока оплаты считается просроченным
+func InvoiceEffectiveStatus(status string, dueDate time.Time, balance float64, asOf time.Time) string {
+	if status == InvoiceSent && balance > 0.005 && InvoiceDaysPastDue(dueDate, asOf) > 0 {
+		return InvoiceOverdue
+	}
+	return status
+}
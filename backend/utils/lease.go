@@ -0,0 +1,53 @@
+package utils
+
+import (
+	"math"
+	"time"
+)
+
+// Классификация лизинга
+const (
+	LeaseOperating = "operating"
+	LeaseFinance   = "finance"
+)
+
+// Типы лизинга
+const (
+	LeaseTRAC = "trac"
+	LeaseFMV  = "fmv"
+)
+
+// CalculateLeasePaymentWithTax рассчитывает ежемесячный платеж по лизингу с налогом с продаж
+func CalculateLeasePaymentWithTax(monthlyRent, salesTaxRate float64) float64 {
+	return math.Round(monthlyRent*(1+salesTaxRate/100)*100) / 100
+}
+
+// LeaseRemainingPayments возвращает количество оставшихся платежей по лизингу на дату
+func LeaseRemainingPayments(startDate time.Time, termMonths int, asOf time.Time) int {
+	if asOf.Before(startDate) {
+		return termMonths
+	}
+	remaining := termMonths - MonthsBetween(startDate, asOf) - 1
+	if remaining < 0 {
+		return 0
+	}
+	return remaining
+}
+
+// CalculateLeaseLiability рассчитывает обязательство по лизингу: приведенная стоимость
+// оставшихся платежей и гарантированной остаточной стоимости (для TRAC) по ставке лизинга
+func CalculateLeaseLiability(monthlyRent float64, remainingPayments int, residualValue, annualRate float64) float64 {
+	if remainingPayments <= 0 {
+		return 0
+	}
+
+	n := float64(remainingPayments)
+	if annualRate == 0 {
+		return math.Round((monthlyRent*n+residualValue)*100) / 100
+	}
+
+	r := annualRate / 100 / 12
+	pvRent := monthlyRent * (1 - math.Pow(1+r, -n)) / r
+	pvResidual := residualValue / math.Pow(1+r, n)
+	return math.Round((pvRent+pvResidual)*100) / 100
+}
@@ -0,0 +1,63 @@
+package utils
+
+import "math"
+
+// Статусы рейса
+const (
+	LoadBooked     = "booked"
+	LoadDispatched = "dispatched"
+	LoadInTransit  = "in_transit"
+	LoadDelivered  = "delivered"
+	LoadCancelled  = "cancelled"
+)
+
+// Виды дополнительных начислений по рейсу
+const (
+	AccessorialDetention = "detention"
+	AccessorialLayover   = "layover"
+	AccessorialLumper    = "lumper"
+	AccessorialTONU      = "tonu"
+	AccessorialStopOff   = "stop_off"
+	AccessorialOther     = "other"
+)
+
+// IsValidLoadStatus проверяет статус рейса
+func IsValidLoadStatus(status string) bool {
+	switch status {
+	case LoadBooked, LoadDispatched, LoadInTransit, LoadDelivered, LoadCancelled:
+		return true
+	}
+	return false
+}
+
+// IsValidAccessorialType проверяет вид дополнительного начисления
+func IsValidAccessorialType(accessorialType string) bool {
+	switch accessorialType {
+	case AccessorialDetention, AccessorialLayover, AccessorialLumper, AccessorialTONU, AccessorialStopOff, AccessorialOther:
+		return true
+	}
+	return false
+}
+
+// CalculateDriverPay рассчитывает оплату водителя за рейс по виду оплаты.
+// Почасовая оплата и оклад не привязаны к рейсу и возвращают 0.
+func CalculateDriverPay(payType string, payRate, miles, revenue float64) float64 {
+	var pay float64
+	switch payType {
+	case PayPerMile:
+		pay = payRate * miles
+	case PayPercent:
+		pay = revenue * payRate / 100
+	case PayPerLoad:
+		pay = payRate
+	}
+	return math.Round(pay*100) / 100
+}
+
+// PerMile делит сумму на мили с округлением до тысячных (0 без пробега)
+func PerMile(amount, miles float64) float64 {
+	if miles <= 0 {
+		return 0
+	}
+	return math.Round(amount/miles*1000) / 1000
+}
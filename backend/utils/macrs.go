@@ -0,0 +1,175 @@
+package utils
+
+import (
+	"math"
+	"time"
+)
+
+// Соглашения MACRS
+const (
+	MACRSHalfYear   = "half_year"
+	MACRSMidQuarter = "mid_quarter"
+
+	// Классы имущества по умолчанию: тягачи — 3 года, трейлеры — 5 лет
+	DefaultTruckRecoveryYears   = 3
+	DefaultTrailerRecoveryYears = 5
+
+	// Порог теста mid-quarter: доля базы, введенной в IV квартале
+	MidQuarterThreshold = 0.4
+)
+
+// macrsHalfYear — таблица A-1 IRS Pub. 946 (GDS, 200% DB, half-year), проценты по годам
+var macrsHalfYear = map[int][]float64{
+	3: {33.33, 44.45, 14.81, 7.41},
+	5: {20.00, 32.00, 19.20, 11.52, 11.52, 5.76},
+	7: {14.29, 24.49, 17.49, 12.49, 8.93, 8.92, 8.93, 4.46},
+}
+
+// macrsMidQuarter — таблицы A-2…A-5 IRS Pub. 946 (GDS, 200% DB, mid-quarter) по кварталу ввода
+var macrsMidQuarter = map[int]map[int][]float64{
+	1: {
+		3: {58.33, 27.78, 12.35, 1.54},
+		5: {35.00, 26.00, 15.60, 11.01, 11.01, 1.38},
+		7: {25.00, 21.43, 15.31, 10.93, 8.75, 8.74, 8.75, 1.09},
+	},
+	2: {
+		3: {41.67, 38.89, 14.14, 5.30},
+		5: {25.00, 30.00, 18.00, 11.37, 11.37, 4.26},
+		7: {17.85, 23.47, 16.76, 11.97, 8.87, 8.87, 8.87, 3.34},
+	},
+	3: {
+		3: {25.00, 50.00, 16.67, 8.33},
+		5: {15.00, 34.00, 20.40, 12.24, 11.30, 7.06},
+		7: {10.71, 25.51, 18.22, 13.02, 9.30, 8.85, 8.86, 5.53},
+	},
+	4: {
+		3: {8.33, 61.11, 20.37, 10.19},
+		5: {5.00, 38.00, 22.80, 13.68, 10.94, 9.58},
+		7: {3.57, 27.55, 19.68, 14.06, 10.04, 8.73, 8.73, 7.64},
+	},
+}
+
+// IsValidRecoveryYears проверяет что класс имущества MACRS поддерживается
+func IsValidRecoveryYears(years int) bool {
+	_, ok := macrsHalfYear[years]
+	return ok
+}
+
+// IsValidMACRSConvention проверяет соглашение MACRS
+func IsValidMACRSConvention(convention string) bool {
+	return convention == MACRSHalfYear || convention == MACRSMidQuarter
+}
+
+// Quarter возвращает квартал даты (1-4)
+func Quarter(date time.Time) int {
+	return (int(date.Month())-1)/3 + 1
+}
+
+// MACRSRates возвращает проценты MACRS по годам для класса, соглашения и квартала ввода
+func MACRSRates(recoveryYears int, convention string, quarter int) []float64 {
+	if convention == MACRSMidQuarter {
+		if rates, ok := macrsMidQuarter[quarter][recoveryYears]; ok {
+			return rates
+		}
+	}
+	return macrsHalfYear[recoveryYears]
+}
+
+// TaxDepreciationParams — параметры налоговой амортизации актива
+type TaxDepreciationParams struct {
+	Cost            float64
+	PlacedInService time.Time
+	RecoveryYears   int
+	Convention      string
+	Section179      float64
+	BonusPercent    float64
+	DisposalDate    time.Time
+}
+
+// TaxDepreciationYear — строка налогового графика за налоговый год
+type TaxDepreciationYear struct {
+	TaxYear     int     `json:"tax_year"`
+	Section179  float64 `json:"section_179"`
+	Bonus       float64 `json:"bonus"`
+	MACRS       float64 `json:"macrs"`
+	Total       float64 `json:"total"`
+	Accumulated float64 `json:"accumulated"`
+	TaxBasis    float64 `json:"tax_basis"`
+}
+
+// TaxDepreciationBases — распределение стоимости актива: Section 179, бонусная амортизация и база MACRS
+type TaxDepreciationBases struct {
+	Section179 float64 `json:"section_179"`
+	Bonus      float64 `json:"bonus"`
+	MACRSBasis float64 `json:"macrs_basis"`
+}
+
+// SplitTaxBasis распределяет стоимость: сначала Section 179, затем бонус от остатка, остаток амортизируется по MACRS
+func SplitTaxBasis(params TaxDepreciationParams) TaxDepreciationBases {
+	section179 := math.Min(math.Max(params.Section179, 0), params.Cost)
+	bonus := (params.Cost - section179) * math.Min(math.Max(params.BonusPercent, 0), 100) / 100
+	return TaxDepreciationBases{
+		Section179: math.Round(section179*100) / 100,
+		Bonus:      math.Round(bonus*100) / 100,
+		MACRSBasis: math.Round((params.Cost-section179-bonus)*100) / 100,
+	}
+}
+
+// disposalYearFactor возвращает долю годовой суммы MACRS в год выбытия:
+// половина при half-year, при mid-quarter — до середины квартала выбытия (12.5%, 37.5%, 62.5%, 87.5%)
+func disposalYearFactor(convention string, disposalDate time.Time) float64 {
+	if convention == MACRSMidQuarter {
+		return (float64(Quarter(disposalDate)) - 0.5) / 4
+	}
+	return 0.5
+}
+
+// CalculateTaxDepreciation строит налоговый график по годам: Section 179 и бонус в год ввода,
+// затем MACRS по таблицам IRS. Последний год закрывает округления до нулевой базы.
+// При выбытии график заканчивается годом выбытия с частичной суммой MACRS,
+// а при выбытии в год ввода MACRS и бонус не начисляются.
+func CalculateTaxDepreciation(params TaxDepreciationParams) []TaxDepreciationYear {
+	bases := SplitTaxBasis(params)
+	rates := MACRSRates(params.RecoveryYears, params.Convention, Quarter(params.PlacedInService))
+	if len(rates) == 0 {
+		return []TaxDepreciationYear{}
+	}
+
+	schedule := make([]TaxDepreciationYear, 0, len(rates))
+	accumulated := 0.0
+	macrsTaken := 0.0
+	for i, rate := range rates {
+		year := TaxDepreciationYear{TaxYear: params.PlacedInService.Year() + i}
+		disposedThisYear := !params.DisposalDate.IsZero() && params.DisposalDate.Year() == year.TaxYear
+		if i == 0 {
+			year.Section179 = bases.Section179
+			if !disposedThisYear {
+				year.Bonus = bases.Bonus
+			}
+		}
+
+		year.MACRS = math.Round(bases.MACRSBasis*rate) / 100
+		if i == len(rates)-1 {
+			year.MACRS = math.Round((bases.MACRSBasis-macrsTaken)*100) / 100
+		}
+		if disposedThisYear {
+			year.MACRS = 0
+			if i > 0 {
+				year.MACRS = math.Round(bases.MACRSBasis*rate*disposalYearFactor(params.Convention, params.DisposalDate)) / 100
+			}
+		}
+		macrsTaken += year.MACRS
+
+		year.Total = math.Round((year.Section179+year.Bonus+year.MACRS)*100) / 100
+		accumulated += year.Total
+		year.Accumulated = math.Round(accumulated*100) / 100
+		year.TaxBasis = math.Round((params.Cost-accumulated)*100) / 100
+		schedule = append(schedule, year)
+
+		if disposedThisYear {
+			break
+		}
+	}
+
+	return schedule
+}
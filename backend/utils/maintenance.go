@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"math"
+	"time"
+)
+
+// Статусы планового обслуживания
+const (
+	MaintenanceOK      = "ok"
+	MaintenanceDueSoon = "due_soon"
+	MaintenanceOverdue = "overdue"
+)
+
+// Статусы заказ-нарядов
+const (
+	WorkOrderOpen       = "open"
+	WorkOrderInProgress = "in_progress"
+	WorkOrderCompleted  = "completed"
+	WorkOrderCancelled  = "cancelled"
+)
+
+// IsValidWorkOrderStatus проверяет статус заказ-наряда
+func IsValidWorkOrderStatus(status string) bool {
+	switch status {
+	case WorkOrderOpen, WorkOrderInProgress, WorkOrderCompleted, WorkOrderCancelled:
+		return true
+	}
+	return false
+}
+
+// MaintenanceInterval — периодичность обслуживания по пробегу, моточасам и календарю (ноль — не используется)
+// и окно предупреждения "скоро" по каждому критерию
+type MaintenanceInterval struct {
+	Miles        float64
+	EngineHours  float64
+	Days         int
+	DueSoonMiles float64
+	DueSoonHours float64
+	DueSoonDays  int
+}
+
+// MeterState — пробег, моточасы и дата на момент обслуживания или текущие
+type MeterState struct {
+	Date        time.Time
+	Mileage     float64
+	EngineHours float64
+}
+
+// MaintenanceDue — срок следующего обслуживания; срабатывает критерий, наступающий первым
+type MaintenanceDue struct {
+	Status         string   `json:"status"`
+	NextDueMileage *float64 `json:"next_due_mileage,omitempty"`
+	NextDueHours   *float64 `json:"next_due_engine_hours,omitempty"`
+	NextDueDate    string   `json:"next_due_date,omitempty"`
+	MilesRemaining *float64 `json:"miles_remaining,omitempty"`
+	HoursRemaining *float64 `json:"hours_remaining,omitempty"`
+	DaysRemaining  *int     `json:"days_remaining,omitempty"`
+}
+
+// CalculateMaintenanceDue рассчитывает срок и статус обслуживания от последнего обслуживания до текущего состояния
+func CalculateMaintenanceDue(interval MaintenanceInterval, last, current MeterState) MaintenanceDue {
+	due := MaintenanceDue{Status: MaintenanceOK}
+
+	escalate := func(status string) {
+		if status == MaintenanceOverdue || (status == MaintenanceDueSoon && due.Status == MaintenanceOK) {
+			due.Status = status
+		}
+	}
+
+	if interval.Miles > 0 {
+		next := last.Mileage + interval.Miles
+		remaining := math.Round(next - current.Mileage)
+		due.NextDueMileage = &next
+		due.MilesRemaining = &remaining
+		if remaining <= 0 {
+			escalate(MaintenanceOverdue)
+		} else if remaining <= interval.DueSoonMiles {
+			escalate(MaintenanceDueSoon)
+		}
+	}
+
+	if interval.EngineHours > 0 {
+		next := last.EngineHours + interval.EngineHours
+		remaining := math.Round((next-current.EngineHours)*10) / 10
+		due.NextDueHours = &next
+		due.HoursRemaining = &remaining
+		if remaining <= 0 {
+			escalate(MaintenanceOverdue)
+		} else if remaining <= interval.DueSoonHours {
+			escalate(MaintenanceDueSoon)
+		}
+	}
+
+	if interval.Days > 0 {
+		next := last.Date.AddDate(0, 0, interval.Days)
+		remaining := int(math.Ceil(next.Sub(current.Date).Hours() / 24))
+		due.NextDueDate = next.Format("2006-01-02")
+		due.DaysRemaining = &remaining
+		if remaining <= 0 {
+			escalate(MaintenanceOverdue)
+		} else if remaining <= interval.DueSoonDays {
+			escalate(MaintenanceDueSoon)
+		}
+	}
+
+	return due
+}
+
+// WorkOrderLine — строка стоимости заказ-наряда: количество × цена
+type WorkOrderLine struct {
+	Quantity float64
+	Price    float64
+}
+
+// SumWorkOrderLines возвращает сумму строк заказ-наряда
+func SumWorkOrderLines(lines []WorkOrderLine) float64 {
+	total := 0.0
+	for _, line := range lines {
+		total += line.Quantity * line.Price
+	}
+	return math.Round(total*100) / 100
+}
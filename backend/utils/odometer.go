@@ -0,0 +1,135 @@
+package utils
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Источники показаний одометра
+const (
+	ReadingSourceManual  = "manual"
+	ReadingSourceELD     = "eld"
+	ReadingSourceFuel    = "fuel"
+	ReadingSourceService = "service"
+	ReadingSourceImport  = "import"
+
+	// Одометр большинства траков обнуляется после 999 999 миль
+	DefaultOdometerRollover = 1000000
+)
+
+// IsValidReadingSource проверяет источник показаний
+func IsValidReadingSource(source string) bool {
+	switch source {
+	case ReadingSourceManual, ReadingSourceELD, ReadingSourceFuel, ReadingSourceService, ReadingSourceImport:
+		return true
+	}
+	return false
+}
+
+// MeterPoint — показание на дату: пробег с учетом обнулений и моточасы
+type MeterPoint struct {
+	Date        time.Time
+	Mileage     float64
+	EngineHours float64
+}
+
+// PeriodUtilization — пробег и моточасы за период
+type PeriodUtilization struct {
+	Period        string  `json:"period"`
+	Miles         float64 `json:"miles"`
+	EngineHours   float64 `json:"engine_hours"`
+	AvgDailyMiles float64 `json:"avg_daily_miles"`
+}
+
+// Utilization — использование транспорта за интервал
+type Utilization struct {
+	From          string              `json:"from"`
+	To            string              `json:"to"`
+	StartMileage  float64             `json:"start_mileage"`
+	EndMileage    float64             `json:"end_mileage"`
+	Miles         float64             `json:"miles"`
+	EngineHours   float64             `json:"engine_hours"`
+	Days          int                 `json:"days"`
+	AvgDailyMiles float64             `json:"avg_daily_miles"`
+	AvgDailyHours float64             `json:"avg_daily_hours"`
+	Periods       []PeriodUtilization `json:"periods"`
+}
+
+// MeterAt возвращает пробег и моточасы на дату линейной интерполяцией между соседними показаниями.
+// До первого показания — первое значение, после последнего — последнее.
+func MeterAt(points []MeterPoint, date time.Time) (float64, float64) {
+	if len(points) == 0 {
+		return 0, 0
+	}
+
+	index := sort.Search(len(points), func(i int) bool { return points[i].Date.After(date) })
+	if index == 0 {
+		return points[0].Mileage, points[0].EngineHours
+	}
+	if index == len(points) {
+		last := points[len(points)-1]
+		return last.Mileage, last.EngineHours
+	}
+
+	prev, next := points[index-1], points[index]
+	span := next.Date.Sub(prev.Date).Hours()
+	if span <= 0 {
+		return next.Mileage, next.EngineHours
+	}
+	share := date.Sub(prev.Date).Hours() / span
+	return prev.Mileage + (next.Mileage-prev.Mileage)*share, prev.EngineHours + (next.EngineHours-prev.EngineHours)*share
+}
+
+// CalculateUtilization рассчитывает пробег, моточасы и среднесуточное использование за интервал [from, to)
+// с разбивкой по периодам (week или month). Показания должны быть отсортированы по дате.
+func CalculateUtilization(points []MeterPoint, from, to time.Time, period string) Utilization {
+	result := Utilization{
+		From:    from.Format("2006-01-02"),
+		To:      to.Format("2006-01-02"),
+		Periods: []PeriodUtilization{},
+	}
+
+	startMiles, startHours := MeterAt(points, from)
+	endMiles, endHours := MeterAt(points, to)
+	result.StartMileage = math.Round(startMiles)
+	result.EndMileage = math.Round(endMiles)
+	result.Miles = math.Round(endMiles - startMiles)
+	result.EngineHours = math.Round((endHours-startHours)*10) / 10
+	result.Days = int(math.Round(to.Sub(from).Hours() / 24))
+	if result.Days > 0 {
+		result.AvgDailyMiles = math.Round((endMiles-startMiles)/float64(result.Days)*10) / 10
+		result.AvgDailyHours = math.Round((endHours-startHours)/float64(result.Days)*10) / 10
+	}
+
+	for periodStart := from; periodStart.Before(to); {
+		var periodEnd time.Time
+		var label string
+		if period == "week" {
+			periodEnd = periodStart.AddDate(0, 0, 7)
+			label = periodStart.Format("2006-01-02")
+		} else {
+			periodEnd = MonthStart(periodStart).AddDate(0, 1, 0)
+			label = periodStart.Format("2006-01")
+		}
+		if periodEnd.After(to) {
+			periodEnd = to
+		}
+
+		milesStart, hoursStart := MeterAt(points, periodStart)
+		milesEnd, hoursEnd := MeterAt(points, periodEnd)
+		days := periodEnd.Sub(periodStart).Hours() / 24
+		item := PeriodUtilization{
+			Period:      label,
+			Miles:       math.Round(milesEnd - milesStart),
+			EngineHours: math.Round((hoursEnd-hoursStart)*10) / 10,
+		}
+		if days > 0 {
+			item.AvgDailyMiles = math.Round((milesEnd-milesStart)/days*10) / 10
+		}
+		result.Periods = append(result.Periods, item)
+		periodStart = periodEnd
+	}
+
+	return result
+}
@@ -0,0 +1,190 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Размеры страницы Letter и поля, пункты
+const (
+	pdfPageWidth  = 612.0
+	pdfPageHeight = 792.0
+	pdfMargin     = 50.0
+)
+
+type pdfLine struct {
+	text string
+	size float64
+	bold bool
+	y    float64
+}
+
+// PDFDocument — простой текстовый PDF без внешних зависимостей: моноширинный шрифт Courier,
+// автоматический перенос на новую страницу. Кириллица транслитерируется латиницей,
+// остальные символы вне Latin-1 заменяются на «?».
+type PDFDocument struct {
+	pages [][]pdfLine
+	y     float64
+}
+
+// NewPDFDocument создает документ с одной пустой страницей
+func NewPDFDocument() *PDFDocument {
+	doc := &PDFDocument{}
+	doc.AddPage()
+	return doc
+}
+
+// AddPage начинает новую страницу
+func (d *PDFDocument) AddPage() {
+	d.pages = append(d.pages, nil)
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// Line добавляет строку текста заданного размера
+func (d *PDFDocument) Line(text string, size float64, bold bool) {
+	leading := size * 1.35
+	if d.y-leading < pdfMargin {
+		d.AddPage()
+	}
+	d.y -= leading
+	page := len(d.pages) - 1
+	d.pages[page] = append(d.pages[page], pdfLine{text: text, size: size, bold: bold, y: d.y})
+}
+
+// Space добавляет вертикальный отступ
+func (d *PDFDocument) Space(points float64) {
+	d.y -= points
+}
+
+// PDFColumns выравнивает значения по колонкам заданной ширины (в символах);
+// отрицательная ширина — выравнивание по правому краю
+func PDFColumns(widths []int, values ...string) string {
+	var builder strings.Builder
+	for i, value := range values {
+		if i >= len(widths) {
+			break
+		}
+		width := widths[i]
+		value = pdfTransliterate(value)
+		if width < 0 {
+			builder.WriteString(fmt.Sprintf("%*s", -width, value))
+		} else {
+			builder.WriteString(fmt.Sprintf("%-*s", width, value))
+		}
+		if i < len(values)-1 {
+			builder.WriteString(" ")
+		}
+	}
+	return strings.TrimRight(builder.String(), " ")
+}
+
+// PDFTruncate транслитерирует текст и обрезает его до заданного числа символов
+func PDFTruncate(text string, width int) string {
+	runes := []rune(pdfTransliterate(text))
+	if len(runes) > width {
+		runes = runes[:width]
+	}
+	return string(runes)
+}
+
+// pdfTransliterations — замены символов, которых нет в кодировке стандартных шрифтов PDF
+var pdfTransliterations = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "e", 'ж': "zh", 'з': "z",
+	'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o", 'п': "p", 'р': "r",
+	'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts", 'ч': "ch", 'ш': "sh", 'щ': "shch",
+	'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu", 'я': "ya",
+	'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+	'—': "-", '–': "-", '„': "\"", '“': "\"", '”': "\"", '‘': "'", '’': "'",
+	'№': "No.", '…': "...",
+}
+
+// pdfTransliterate заменяет кириллицу латиницей (заглавная буква сохраняется: «Щ» → «Shch»)
+func pdfTransliterate(text string) string {
+	var builder strings.Builder
+	for _, r := range text {
+		if r <= 255 {
+			builder.WriteRune(r)
+			continue
+		}
+		lower := unicode.ToLower(r)
+		replacement, ok := pdfTransliterations[lower]
+		if !ok {
+			builder.WriteRune(r)
+			continue
+		}
+		if lower != r && replacement != "" {
+			replacement = strings.ToUpper(replacement[:1]) + replacement[1:]
+		}
+		builder.WriteString(replacement)
+	}
+	return builder.String()
+}
+
+func pdfEscape(text string) string {
+	var builder strings.Builder
+	for _, r := range pdfTransliterate(text) {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			builder.WriteByte('\\')
+			builder.WriteRune(r)
+		case r < 32:
+			builder.WriteByte(' ')
+		case r > 255:
+			builder.WriteByte('?')
+		default:
+			builder.WriteByte(byte(r))
+		}
+	}
+	return builder.String()
+}
+
+// Bytes собирает PDF-файл
+func (d *PDFDocument) Bytes() []byte {
+	var buf bytes.Buffer
+	var offsets []int
+	writeObject := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	// 1 — каталог, 2 — дерево страниц, 3 и 4 — шрифты, далее пары страница + содержимое
+	pageCount := len(d.pages)
+	kids := make([]string, pageCount)
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+i*2)
+	}
+	writeObject("<< /Type /Catalog /Pages 2 0 R >>")
+	writeObject(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pageCount))
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	writeObject("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+
+	for i, lines := range d.pages {
+		var content bytes.Buffer
+		for _, line := range lines {
+			font := "F1"
+			if line.bold {
+				font = "F2"
+			}
+			fmt.Fprintf(&content, "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, line.size, pdfMargin, line.y, pdfEscape(line.text))
+		}
+		footer := fmt.Sprintf("Page %d of %d", i+1, pageCount)
+		fmt.Fprintf(&content, "BT /F1 8.0 Tf %.1f %.1f Td (%s) Tj ET\n", pdfPageWidth-pdfMargin-float64(len(footer))*4.8, pdfMargin/2, footer)
+
+		writeObject(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, 6+i*2))
+		writeObject(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	return buf.Bytes()
+}
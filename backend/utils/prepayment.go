@@ -0,0 +1,185 @@
+package utils
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Стратегии досрочного погашения
+const (
+	StrategyMinimum   = "minimum"
+	StrategyAvalanche = "avalanche"
+	StrategySnowball  = "snowball"
+	StrategyFixed     = "fixed_extra"
+)
+
+// maxSimulationMonths ограничивает симуляцию для кредитов, платеж по которым не покрывает проценты
+const maxSimulationMonths = 600
+
+// SimulationLoan описывает кредит для симуляции досрочного погашения
+type SimulationLoan struct {
+	ID             string
+	Lender         string
+	Balance        float64
+	AnnualRate     float64
+	MonthlyPayment float64
+
+	// Balloon-платеж вносится остатком долга в последний месяц срока
+	BalloonAmount   float64
+	RemainingMonths int
+}
+
+// LoanPayoffResult содержит срок погашения отдельного кредита
+type LoanPayoffResult struct {
+	LoanID        string  `json:"loan_id"`
+	Lender        string  `json:"lender"`
+	PayoffMonth   int     `json:"payoff_month"`
+	PayoffDate    string  `json:"payoff_date"`
+	TotalInterest float64 `json:"total_interest"`
+}
+
+// SimulationResult содержит итоги одной стратегии погашения
+type SimulationResult struct {
+	Strategy      string             `json:"strategy"`
+	Months        int                `json:"months"`
+	PayoffDate    string             `json:"payoff_date"`
+	TotalInterest float64            `json:"total_interest"`
+	TotalPaid     float64            `json:"total_paid"`
+	Loans         []LoanPayoffResult `json:"loans"`
+}
+
+// SimulatePrepayment моделирует помесячное погашение набора кредитов по стратегии.
+// avalanche и snowball направляют весь дополнительный бюджет и освободившиеся платежи
+// на кредит с максимальной ставкой или минимальным остатком; fixed_extra делит
+// дополнительную сумму поровну между непогашенными кредитами, а остаток доли погашенного
+// кредита переходит на остальные. Кредит с balloon-платежом гасится остатком в конце срока.
+func SimulatePrepayment(loans []SimulationLoan, extraMonthly float64, strategy string, startDate time.Time) SimulationResult {
+	balances := make([]float64, len(loans))
+	interest := make([]float64, len(loans))
+	payoffMonth := make([]int, len(loans))
+	for i, loan := range loans {
+		balances[i] = loan.Balance
+	}
+
+	// Порядок приоритета для avalanche/snowball
+	order := make([]int, len(loans))
+	for i := range order {
+		order[i] = i
+	}
+	switch strategy {
+	case StrategyAvalanche:
+		sort.SliceStable(order, func(a, b int) bool { return loans[order[a]].AnnualRate > loans[order[b]].AnnualRate })
+	case StrategySnowball:
+		sort.SliceStable(order, func(a, b int) bool { return loans[order[a]].Balance < loans[order[b]].Balance })
+	}
+
+	result := SimulationResult{Strategy: strategy}
+	remaining := 0
+	for _, b := range balances {
+		if b > 0 {
+			remaining++
+		}
+	}
+
+	month := 0
+	for remaining > 0 && month < maxSimulationMonths {
+		month++
+		available := 0.0
+		if strategy != StrategyMinimum {
+			available = extraMonthly
+		}
+
+		// Начисляем проценты и вносим обязательные платежи
+		for i, loan := range loans {
+			if balances[i] <= 0 {
+				// Платеж кредита, погашенного в ходе симуляции, переходит в дополнительный бюджет;
+				// кредиты с нулевым остатком на старте бюджет не пополняют
+				if (strategy == StrategyAvalanche || strategy == StrategySnowball) && loan.Balance > 0 {
+					available += loan.MonthlyPayment
+				}
+				continue
+			}
+			monthInterest := balances[i] * loan.AnnualRate / 100 / 12
+			interest[i] += monthInterest
+			payment := math.Min(loan.MonthlyPayment, balances[i]+monthInterest)
+			balances[i] += monthInterest - payment
+			result.TotalPaid += payment
+			if (strategy == StrategyAvalanche || strategy == StrategySnowball) && payment < loan.MonthlyPayment {
+				available += loan.MonthlyPayment - payment
+			}
+			if loan.BalloonAmount > 0 && month >= loan.RemainingMonths && balances[i] > 0 {
+				result.TotalPaid += balances[i]
+				balances[i] = 0
+			}
+		}
+
+		// Распределяем дополнительный платеж
+		switch strategy {
+		case StrategyAvalanche, StrategySnowball:
+			for _, i := range order {
+				if available <= 0 {
+					break
+				}
+				if balances[i] <= 0 {
+					continue
+				}
+				extra := math.Min(available, balances[i])
+				balances[i] -= extra
+				available -= extra
+				result.TotalPaid += extra
+			}
+		case StrategyFixed:
+			for available > 0.005 {
+				open := 0
+				for _, b := range balances {
+					if b > 0.005 {
+						open++
+					}
+				}
+				if open == 0 {
+					break
+				}
+				share := available / float64(open)
+				for i := range balances {
+					if balances[i] <= 0.005 {
+						continue
+					}
+					extra := math.Min(share, balances[i])
+					balances[i] -= extra
+					available -= extra
+					result.TotalPaid += extra
+				}
+			}
+		}
+
+		for i := range balances {
+			if balances[i] <= 0.005 && payoffMonth[i] == 0 && loans[i].Balance > 0 {
+				balances[i] = 0
+				payoffMonth[i] = month
+				remaining--
+			}
+		}
+	}
+
+	result.Months = month
+	result.PayoffDate = startDate.AddDate(0, month, 0).Format("2006-01-02")
+	for i, loan := range loans {
+		result.TotalInterest += interest[i]
+		payoffDate := ""
+		if payoffMonth[i] > 0 {
+			payoffDate = startDate.AddDate(0, payoffMonth[i], 0).Format("2006-01-02")
+		}
+		result.Loans = append(result.Loans, LoanPayoffResult{
+			LoanID:        loan.ID,
+			Lender:        loan.Lender,
+			PayoffMonth:   payoffMonth[i],
+			PayoffDate:    payoffDate,
+			TotalInterest: math.Round(interest[i]*100) / 100,
+		})
+	}
+	result.TotalInterest = math.Round(result.TotalInterest*100) / 100
+	result.TotalPaid = math.Round(result.TotalPaid*100) / 100
+
+	return result
+}
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSimulatePrepayment(t *testing.T) {
+	start := time.Date(2024, 1, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		loans      []SimulationLoan
+		extra      float64
+		strategy   string
+		wantMonths int
+		wantPayoff []int
+		wantPaid   float64
+	}{
+		{
+			name:       "аннуитет без досрочных платежей гасится за срок",
+			loans:      []SimulationLoan{{ID: "a", Balance: 10000, AnnualRate: 12, MonthlyPayment: CalculateMonthlyPayment(10000, 12, 12)}},
+			strategy:   StrategyMinimum,
+			wantMonths: 12,
+			wantPayoff: []int{12},
+		},
+		{
+			name: "balloon-платеж вносится остатком в последний месяц срока",
+			loans: []SimulationLoan{{ID: "a", Balance: 10000, MonthlyPayment: 500,
+				BalloonAmount: 5000, RemainingMonths: 10}},
+			strategy:   StrategyMinimum,
+			wantMonths: 10,
+			wantPayoff: []int{10},
+			wantPaid:   10000,
+		},
+		{
+			name: "срок balloon-кредита истек — остаток гасится в первый месяц",
+			loans: []SimulationLoan{{ID: "a", Balance: 3000, MonthlyPayment: 500,
+				BalloonAmount: 3000, RemainingMonths: -2}},
+			strategy:   StrategyMinimum,
+			wantMonths: 1,
+			wantPayoff: []int{1},
+			wantPaid:   3000,
+		},
+		{
+			name: "fixed_extra переносит остаток доли погашенного кредита на остальные",
+			loans: []SimulationLoan{
+				{ID: "a", Balance: 50},
+				{ID: "b", Balance: 150},
+			},
+			extra:      200,
+			strategy:   StrategyFixed,
+			wantMonths: 1,
+			wantPayoff: []int{1, 1},
+			wantPaid:   200,
+		},
+		{
+			name: "snowball: кредит с нулевым остатком не пополняет бюджет",
+			loans: []SimulationLoan{
+				{ID: "paid", Balance: 0, MonthlyPayment: 1000},
+				{ID: "b", Balance: 1000, MonthlyPayment: 100},
+			},
+			extra:      100,
+			strategy:   StrategySnowball,
+			wantMonths: 5,
+			wantPayoff: []int{0, 5},
+			wantPaid:   1000,
+		},
+		{
+			name: "avalanche направляет бюджет на кредит с максимальной ставкой",
+			loans: []SimulationLoan{
+				{ID: "low", Balance: 1200, AnnualRate: 0, MonthlyPayment: 100},
+				{ID: "high", Balance: 1200, AnnualRate: 0.0001, MonthlyPayment: 100},
+			},
+			extra:      500,
+			strategy:   StrategyAvalanche,
+			wantMonths: 4,
+			wantPayoff: []int{4, 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := SimulatePrepayment(tt.loans, tt.extra, tt.strategy, start)
+			if result.Months != tt.wantMonths {
+				t.Errorf("Months = %d, want %d", result.Months, tt.wantMonths)
+			}
+			for i, want := range tt.wantPayoff {
+				if got := result.Loans[i].PayoffMonth; got != want {
+					t.Errorf("loan %s PayoffMonth = %d, want %d", tt.loans[i].ID, got, want)
+				}
+			}
+			if tt.wantPaid > 0 && math.Abs(result.TotalPaid-tt.wantPaid) > 0.01 {
+				t.Errorf("TotalPaid = %.2f, want %.2f", result.TotalPaid, tt.wantPaid)
+			}
+		})
+	}
+}
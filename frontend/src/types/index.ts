@@ -44,6 +44,8 @@ export interface Loan {
   start_date: string;
   monthly_payment: number;
   remaining_balance: number;
+  day_count?: '30/360' | 'actual/365' | 'actual/360';
+  last_payment_date?: string;
   status: 'active' | 'paid_off';
   created_at: string;
   updated_at: string;
@@ -57,6 +59,7 @@ export interface Payment {
   interest_paid: number;
   total_paid: number;
   remaining_balance: number;
+  days_accrued?: number;
   created_at: string;
 }
 